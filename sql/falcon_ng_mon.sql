@@ -79,6 +79,7 @@ create table `event_cur` (
   `value` varchar(256) not null default '' comment '当前值',
   `users` varchar(512) not null default '[]' comment 'notify users',
   `groups` varchar(512) not null default '[]' comment 'notify groups',
+  `oncalls` varchar(512) not null default '[]' comment 'notify oncalls',
   `info` varchar(512) not null default '' comment 'strategy info',
   `ignore_alert` int(2) not null default 0 comment 'ignore event',
   `claimants` varchar(512)  not null default '[]' comment 'claimants',
@@ -89,6 +90,7 @@ create table `event_cur` (
   KEY `idx_sid` (`sid`),
   KEY `idx_hashid` (`hashid`),
   KEY `idx_node_path` (`node_path`),
+  KEY `idx_endpoint` (`endpoint`),
   KEY `idx_etime` (`etime`)
 ) engine=innodb default charset=utf8 comment 'event';
 
@@ -110,6 +112,7 @@ create table `event` (
   `value` varchar(256) not null default '' comment '当前值',
   `users` varchar(512) not null default '[]' comment 'notify users',
   `groups` varchar(512) not null default '[]' comment 'notify groups',
+  `oncalls` varchar(512) not null default '[]' comment 'notify oncalls',
   `info` varchar(512) not null default '' comment 'strategy info',
   `need_upgrade` int(2)  not null default 0 comment 'need upgrade',
   `alert_upgrade` text not null comment 'alert upgrade',
@@ -142,6 +145,8 @@ CREATE TABLE `stra` (
   `priority` int(1) NOT NULL DEFAULT 3 COMMENT '告警等级',
   `notify_group` varchar(256) NOT NULL DEFAULT '' COMMENT '告警通知组',
   `notify_user` varchar(256) NOT NULL DEFAULT '' COMMENT '告警通知人',
+  `notify_oncall` varchar(256) NOT NULL DEFAULT '[]' COMMENT '告警通知的值班表',
+  `notify_webhook` varchar(256) NOT NULL DEFAULT '[]' COMMENT '告警通知的webhook',
   `callback` varchar(1024) NOT NULL DEFAULT '' COMMENT 'callback url',
   `creator` varchar(64) NOT NULL COMMENT '创建者',
   `created` timestamp NOT NULL DEFAULT '1971-01-01 00:00:00' COMMENT 'created',
@@ -149,6 +154,7 @@ CREATE TABLE `stra` (
   `last_updated` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
   `need_upgrade` int(2)  not null default 0 comment 'need upgrade',
   `alert_upgrade` text comment 'alert upgrade',
+  `escalation_id` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '升级策略id',
   PRIMARY KEY (`id`),
   KEY `idx_nid` (`nid`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
@@ -238,4 +244,193 @@ CREATE TABLE `collect_hist` (
   `created` datetime NOT NULL DEFAULT '1971-01-01 00:00:00' COMMENT 'created',
   PRIMARY KEY (`id`),
   KEY `idx_cid` (`cid`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT 'hist';
\ No newline at end of file
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT 'hist';
+CREATE TABLE `judge_member` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT 'id',
+  `ident` varchar(255) NOT NULL DEFAULT '' COMMENT 'judge identity',
+  `addr` varchar(255) NOT NULL DEFAULT '' COMMENT 'judge http addr',
+  `rpc` varchar(255) NOT NULL DEFAULT '' COMMENT 'judge rpc addr',
+  `stra_num` int(11) NOT NULL DEFAULT '0' COMMENT '运行的策略数',
+  `clock` bigint(20) NOT NULL DEFAULT '0' COMMENT '最近一次心跳时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_ident` (`ident`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT 'judge member';
+
+CREATE TABLE `judge_stra_state` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT 'id',
+  `sid` bigint(20) NOT NULL DEFAULT '0' COMMENT 'stra id',
+  `ident` varchar(255) NOT NULL DEFAULT '' COMMENT '上报状态的judge',
+  `state` mediumtext COMMENT '报警状态',
+  `clock` bigint(20) NOT NULL DEFAULT '0' COMMENT '上报时间',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `idx_sid` (`sid`),
+  KEY `idx_clock` (`clock`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT 'judge stra state handoff';
+
+CREATE TABLE `inhibit` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT 'id',
+  `nid` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '服务树节点id',
+  `name` varchar(255) NOT NULL DEFAULT '' COMMENT 'name',
+  `src_sids` varchar(1024) NOT NULL DEFAULT '' COMMENT '源策略id, 逗号分隔',
+  `src_metric` varchar(255) NOT NULL DEFAULT '' COMMENT '源指标',
+  `src_tags` varchar(255) NOT NULL DEFAULT '' COMMENT '源tags',
+  `tgt_sids` varchar(1024) NOT NULL DEFAULT '' COMMENT '目标策略id, 逗号分隔',
+  `tgt_metric` varchar(255) NOT NULL DEFAULT '' COMMENT '目标指标',
+  `tgt_tags` varchar(255) NOT NULL DEFAULT '' COMMENT '目标tags',
+  `equal` varchar(32) NOT NULL DEFAULT 'endpoint' COMMENT 'endpoint: 同一个endpoint, node: 同一个节点',
+  `action` varchar(32) NOT NULL DEFAULT 'suppress' COMMENT 'suppress: 不发送, mark: 发送并标记',
+  `creator` varchar(255) NOT NULL DEFAULT '' COMMENT 'creator',
+  `created` datetime NOT NULL COMMENT 'created',
+  `last_updator` varchar(255) NOT NULL DEFAULT '' COMMENT 'last_updator',
+  `last_updated` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_nid` (`nid`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT 'inhibit';
+
+CREATE TABLE `notify_tpl` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT 'id',
+  `name` varchar(255) NOT NULL DEFAULT '' COMMENT 'name',
+  `channel` varchar(32) NOT NULL DEFAULT '' COMMENT 'voice | sms | mail | im | webhook',
+  `priority` tinyint(1) NOT NULL DEFAULT '0' COMMENT '0: 不限制',
+  `sid` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '策略id, 0: 不限制',
+  `nid` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '服务树节点id, 0: 不限制',
+  `subject` varchar(1024) NOT NULL DEFAULT '' COMMENT '邮件标题模板',
+  `content` text COMMENT '内容模板',
+  `creator` varchar(255) NOT NULL DEFAULT '' COMMENT 'creator',
+  `created` datetime NOT NULL COMMENT 'created',
+  `last_updator` varchar(255) NOT NULL DEFAULT '' COMMENT 'last_updator',
+  `last_updated` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  KEY `idx_channel` (`channel`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT 'notify template';
+
+CREATE TABLE `oncall` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT 'id',
+  `name` varchar(255) NOT NULL DEFAULT '' COMMENT 'name',
+  `note` varchar(255) NOT NULL DEFAULT '' COMMENT 'note',
+  `timezone` varchar(64) NOT NULL DEFAULT '' COMMENT '时区, 为空使用本地时区',
+  `layers` text COMMENT '轮值层',
+  `creator` varchar(255) NOT NULL DEFAULT '' COMMENT 'creator',
+  `created` datetime NOT NULL COMMENT 'created',
+  `last_updator` varchar(255) NOT NULL DEFAULT '' COMMENT 'last_updator',
+  `last_updated` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT 'oncall schedule';
+
+CREATE TABLE `oncall_override` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT 'id',
+  `oncall_id` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT 'oncall id',
+  `user_id` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '替班的用户',
+  `stime` bigint(20) NOT NULL DEFAULT '0' COMMENT '开始时间',
+  `etime` bigint(20) NOT NULL DEFAULT '0' COMMENT '结束时间',
+  `note` varchar(255) NOT NULL DEFAULT '' COMMENT 'note',
+  `creator` varchar(255) NOT NULL DEFAULT '' COMMENT 'creator',
+  `created` datetime NOT NULL COMMENT 'created',
+  PRIMARY KEY (`id`),
+  KEY `idx_oncall_id` (`oncall_id`, `etime`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT 'oncall override';
+
+CREATE TABLE `oncall_page` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT 'id',
+  `oncall_id` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT 'oncall id',
+  `event_id` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT 'event id',
+  `hashid` varchar(128) NOT NULL DEFAULT '' COMMENT 'event hashid',
+  `user_id` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '呼叫的值班人',
+  `clock` bigint(20) NOT NULL DEFAULT '0' COMMENT '呼叫时间',
+  PRIMARY KEY (`id`),
+  KEY `idx_oncall_id` (`oncall_id`, `clock`),
+  KEY `idx_event_id` (`event_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT 'oncall page record';
+
+CREATE TABLE `escalation` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT 'id',
+  `name` varchar(255) NOT NULL DEFAULT '' COMMENT 'name',
+  `note` varchar(255) NOT NULL DEFAULT '' COMMENT 'note',
+  `steps` text COMMENT '升级步骤',
+  `repeats` int(10) NOT NULL DEFAULT '0' COMMENT '重复的轮数, -1: 直到认领或恢复',
+  `creator` varchar(255) NOT NULL DEFAULT '' COMMENT 'creator',
+  `created` datetime NOT NULL COMMENT 'created',
+  `last_updator` varchar(255) NOT NULL DEFAULT '' COMMENT 'last_updator',
+  `last_updated` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT 'escalation policy';
+
+CREATE TABLE `escalation_log` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT 'id',
+  `escalation_id` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '升级策略id, 0: 策略的alert_upgrade',
+  `event_cur_id` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT 'event_cur id',
+  `hashid` varchar(128) NOT NULL DEFAULT '' COMMENT 'event hashid',
+  `stime` bigint(20) NOT NULL DEFAULT '0' COMMENT '报警产生的时间',
+  `round` int(10) NOT NULL DEFAULT '0' COMMENT '轮次, -1: 停止升级',
+  `step` int(10) NOT NULL DEFAULT '0' COMMENT '步骤, -1: 停止升级',
+  `action` varchar(32) NOT NULL DEFAULT '' COMMENT 'notify | claimed | ignored | recovered | finished',
+  `users` varchar(1024) NOT NULL DEFAULT '[]' COMMENT '通知的用户id',
+  `channels` varchar(255) NOT NULL DEFAULT '[]' COMMENT '通知的通道',
+  `priority` tinyint(1) NOT NULL DEFAULT '0' COMMENT '升级后的优先级',
+  `clock` bigint(20) NOT NULL DEFAULT '0' COMMENT 'clock',
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `uniq_step` (`event_cur_id`, `round`, `step`),
+  KEY `idx_hashid` (`hashid`, `stime`),
+  KEY `idx_clock` (`clock`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT 'escalation timeline';
+
+CREATE TABLE `webhook` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT 'id',
+  `name` varchar(255) NOT NULL DEFAULT '' COMMENT 'name',
+  `note` varchar(255) NOT NULL DEFAULT '' COMMENT 'note',
+  `url` varchar(1024) NOT NULL DEFAULT '' COMMENT '请求地址',
+  `headers` text COMMENT '自定义的请求头',
+  `secret` varchar(255) NOT NULL DEFAULT '' COMMENT '签名的密钥, 为空不签名',
+  `body` text COMMENT '请求body的模板, 为空使用webhook通道的通知模板',
+  `timeout` int(10) NOT NULL DEFAULT '0' COMMENT '超时时间, 单位毫秒, 0使用sender的配置',
+  `creator` varchar(255) NOT NULL DEFAULT '' COMMENT 'creator',
+  `created` datetime NOT NULL COMMENT 'created',
+  `last_updator` varchar(255) NOT NULL DEFAULT '' COMMENT 'last_updator',
+  `last_updated` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT 'outgoing webhook';
+
+CREATE TABLE `webhook_dead_letter` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT 'id',
+  `webhook_id` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT 'webhook id',
+  `notify_id` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT 'notify_log id, 重放时更新同一条记录',
+  `url` varchar(1024) NOT NULL DEFAULT '' COMMENT '最后一次请求的地址',
+  `body` mediumtext COMMENT '请求body',
+  `attempts` int(10) NOT NULL DEFAULT '0' COMMENT '请求次数',
+  `error` varchar(1024) NOT NULL DEFAULT '' COMMENT '最后一次失败的原因',
+  `status` varchar(32) NOT NULL DEFAULT '' COMMENT 'dead | replayed',
+  `clock` bigint(20) NOT NULL DEFAULT '0' COMMENT '进入死信的时间',
+  `replayed` bigint(20) NOT NULL DEFAULT '0' COMMENT '重放的时间',
+  `replayer` varchar(255) NOT NULL DEFAULT '' COMMENT '重放的操作人',
+  PRIMARY KEY (`id`),
+  KEY `idx_webhook_id` (`webhook_id`, `status`),
+  KEY `idx_clock` (`clock`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT 'failed webhook deliveries';
+
+CREATE TABLE `notify_log` (
+  `id` bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT 'id',
+  `event_id` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '触发通知的事件, 0: 不是事件触发的',
+  `channel` varchar(32) NOT NULL DEFAULT '' COMMENT 'voice | sms | mail | im | webhook',
+  `tos` varchar(4096) NOT NULL DEFAULT '[]' COMMENT '接收人',
+  `subject` varchar(1024) NOT NULL DEFAULT '' COMMENT 'subject',
+  `content` mediumtext COMMENT 'content',
+  `status` varchar(32) NOT NULL DEFAULT '' COMMENT 'queued | sent | failed | retried',
+  `attempts` int(10) NOT NULL DEFAULT '0' COMMENT '发送次数',
+  `response` varchar(1024) NOT NULL DEFAULT '' COMMENT '通道的返回或错误信息',
+  `clock` bigint(20) NOT NULL DEFAULT '0' COMMENT '收到的时间',
+  `updated` bigint(20) NOT NULL DEFAULT '0' COMMENT '最后一次状态变化的时间',
+  PRIMARY KEY (`id`),
+  KEY `idx_event_id` (`event_id`),
+  KEY `idx_clock` (`clock`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8 COMMENT 'notification delivery log';
+
+-- 升级: 上面的语句会重建数据库, 已经在运行的falcon_ng_mon不要执行整个文件
+-- 已有的表新增的字段和索引执行下面的ALTER TABLE, 新增的表执行上面对应的CREATE TABLE
+--
+-- ALTER TABLE `event_cur` ADD KEY `idx_endpoint` (`endpoint`);
+-- ALTER TABLE `event_cur` ADD COLUMN `oncalls` varchar(512) not null default '[]' comment 'notify oncalls' AFTER `groups`;
+-- ALTER TABLE `event` ADD COLUMN `oncalls` varchar(512) not null default '[]' comment 'notify oncalls' AFTER `groups`;
+-- ALTER TABLE `stra` ADD COLUMN `notify_oncall` varchar(256) NOT NULL DEFAULT '[]' COMMENT '告警通知的值班表' AFTER `notify_user`;
+-- ALTER TABLE `stra` ADD COLUMN `escalation_id` bigint(20) unsigned NOT NULL DEFAULT '0' COMMENT '升级策略id' AFTER `alert_upgrade`;
+-- ALTER TABLE `stra` ADD COLUMN `notify_webhook` varchar(256) NOT NULL DEFAULT '[]' COMMENT '告警通知的webhook' AFTER `notify_oncall`;
@@ -0,0 +1,44 @@
+package dataobj
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JudgeItem transfer推送给judge的数据, Value为原始值, COUNTER|DERIVE由judge计算速率
+type JudgeItem struct {
+	Endpoint  string            `json:"endpoint"`
+	Metric    string            `json:"metric"`
+	Tags      string            `json:"tags"`
+	TagsMap   map[string]string `json:"tagsMap"`
+	Value     float64           `json:"value"`
+	Timestamp int64             `json:"timestamp"`
+	DsType    string            `json:"dstype"`
+	Step      int               `json:"step"`
+}
+
+func (this *JudgeItem) String() string {
+	return fmt.Sprintf(
+		"<Endpoint:%s, Metric:%s, Tags:%s, Value:%v, TS:%d %v DsType:%s, Step:%d>",
+		this.Endpoint,
+		this.Metric,
+		this.Tags,
+		this.Value,
+		this.Timestamp,
+		time.Unix(this.Timestamp, 0).Format("2006-01-02 15:04:05"),
+		this.DsType,
+		this.Step,
+	)
+}
+
+// Counter 与judge中series.Counter的格式一致: metric/k1=v1,k2=v2
+func (this *JudgeItem) Counter() string {
+	return PKWithTags(this.Metric, this.Tags)
+}
+
+// EventTopic judge推送事件的分片(如/falcon-ng/event/p1)转换为nsq/kafka的topic(falcon-ng.event.p1),
+// 两者的topic都不能包含'/'
+func EventTopic(partition string) string {
+	return strings.Replace(strings.Trim(partition, "/"), "/", ".", -1)
+}
@@ -1,6 +1,8 @@
 package dataobj
 
 type Notify struct {
+	Id      int64    `json:"id,omitempty"`       // 通知记录(notify_log)的id, sender收到时生成
+	EventId int64    `json:"event_id,omitempty"` // 触发通知的事件
 	Tos     []string `json:"tos"`
 	Subject string   `json:"subject,omitempty"`
 	Content string   `json:"content"`
@@ -28,17 +28,23 @@ type Stra struct {
 	RecoveryNotify   int          `json:"recovery_notify"`
 	NotifyGroup      []int64      `json:"notify_group"`
 	NotifyUser       []int64      `json:"notify_user"`
+	NotifyOncall     []int64      `json:"notify_oncall"`
+	NotifyWebhook    []int64      `json:"notify_webhook"`
 	LeafNids         interface{}  `json:"leaf_nids"`
 	NeedUpgrade      int          `json:"need_upgrade"`
 	AlertUpgrade     AlertUpgrade `json:"alert_upgrade"`
+	EscalationId     int64        `json:"escalation_id"`
+	Endpoints        []string     `json:"endpoints"`
 }
 
 type Exp struct {
 	Eopt      string  `json:"eopt"`
 	Func      string  `json:"func"`
-	Metric    string  `json:"metric"`
+	Metric    string  `json:"metric"` // expression不为空时是运算结果的指标名
 	Params    []int   `json:"params"`
 	Threshold float64 `json:"threshold"`
+
+	Expression string `json:"expression,omitempty"` // 多指标的四则运算, 如 errors / requests * 100
 }
 
 type Tag struct {
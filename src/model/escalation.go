@@ -0,0 +1,322 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/config"
+)
+
+const (
+	ESCALATION_NOTIFY    = "notify"
+	ESCALATION_CLAIMED   = "claimed"
+	ESCALATION_IGNORED   = "ignored"
+	ESCALATION_RECOVERED = "recovered"
+	ESCALATION_FINISHED  = "finished"
+
+	escalationStopStep = -1
+)
+
+// Escalation 升级策略: 报警产生后, 没有被认领并且没有恢复, 按顺序执行每一步
+// 每一步的延迟从上一步开始计算, 第一步从报警产生开始计算; 所有步骤执行完之后, 从第一步开始重复Repeat轮
+type Escalation struct {
+	Id          int64            `json:"id"`
+	Name        string           `json:"name"`
+	Note        string           `json:"note"`
+	StepsStr    string           `json:"-" xorm:"steps"`
+	Steps       []EscalationStep `json:"steps" xorm:"-"`
+	Repeat      int              `json:"repeat" xorm:"repeats"` // 0: 不重复, -1: 一直重复直到认领或恢复
+	Creator     string           `json:"creator"`
+	Created     time.Time        `json:"created" xorm:"created"`
+	LastUpdator string           `json:"last_updator"`
+	LastUpdated time.Time        `json:"last_updated" xorm:"<-"`
+}
+
+type EscalationStep struct {
+	Delay    int      `json:"delay"` // 单位秒
+	Users    []int64  `json:"users"`
+	Groups   []int64  `json:"groups"`
+	Oncalls  []int64  `json:"oncalls"`
+	Channels []string `json:"channels"` // 为空使用优先级对应的通道
+	Priority int      `json:"priority"` // 升级后的优先级, 0表示不变
+}
+
+// EscalationLog 升级的时间线, 每次报警(event_cur)单独记录
+// 同一步只记录一次, 多个alarm实例同时执行时只有插入成功的实例发送通知
+type EscalationLog struct {
+	Id           int64  `json:"id"`
+	EscalationId int64  `json:"escalation_id"` // 0表示策略中的告警升级配置
+	EventCurId   int64  `json:"event_cur_id"`
+	HashId       uint64 `json:"hashid" xorm:"hashid"`
+	Stime        int64  `json:"stime"` // 报警产生的时间, 即event_cur的创建时间
+	Round        int    `json:"round"`
+	Step         int    `json:"step"`
+	Action       string `json:"action"`
+	Users        string `json:"users"` // 通知的用户, 认领时为认领人
+	Channels     string `json:"channels"`
+	Priority     int    `json:"priority"`
+	Clock        int64  `json:"clock"`
+}
+
+func (e *Escalation) Encode() error {
+	e.Name = strings.TrimSpace(e.Name)
+	if e.Name == "" {
+		return fmt.Errorf("arg[name] empty")
+	}
+
+	if len(e.Steps) == 0 {
+		return fmt.Errorf("steps empty")
+	}
+
+	if e.Repeat < -1 {
+		return fmt.Errorf("illegal repeat: %d", e.Repeat)
+	}
+
+	total := 0
+	for i, step := range e.Steps {
+		if step.Delay < 0 {
+			return fmt.Errorf("step[%d] illegal delay: %d", i, step.Delay)
+		}
+		total += step.Delay
+
+		if len(step.Users) == 0 && len(step.Groups) == 0 && len(step.Oncalls) == 0 {
+			return fmt.Errorf("step[%d] users, groups and oncalls are all empty", i)
+		}
+
+		if step.Priority < 0 || step.Priority > 3 {
+			return fmt.Errorf("step[%d] illegal priority: %d", i, step.Priority)
+		}
+
+		for _, channel := range step.Channels {
+			switch channel {
+			case "voice", "sms", "mail", "im", "webhook":
+			default:
+				return fmt.Errorf("step[%d] unknown channel: %s", i, channel)
+			}
+		}
+	}
+
+	if e.Repeat != 0 && total == 0 {
+		return fmt.Errorf("delay of all steps is 0, cannot repeat")
+	}
+
+	bs, err := json.Marshal(e.Steps)
+	if err != nil {
+		return err
+	}
+	e.StepsStr = string(bs)
+
+	return nil
+}
+
+func (e *Escalation) Decode() error {
+	e.Steps = []EscalationStep{}
+	if e.StepsStr == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(e.StepsStr), &e.Steps)
+}
+
+// Due 第n次通知(从0开始)对应的轮次, 步骤, 以及相对报警产生的延迟; 所有轮次都执行完时返回false
+func (e *Escalation) Due(n int) (round, step int, delay int64, ok bool) {
+	cnt := len(e.Steps)
+	if cnt == 0 {
+		return 0, 0, 0, false
+	}
+
+	round, step = n/cnt, n%cnt
+	if e.Repeat >= 0 && round > e.Repeat {
+		return round, step, 0, false
+	}
+
+	var total int64
+	for i := 0; i < cnt; i++ {
+		total += int64(e.Steps[i].Delay)
+		if i <= step {
+			delay += int64(e.Steps[i].Delay)
+		}
+	}
+
+	return round, step, int64(round)*total + delay, true
+}
+
+func (e *Escalation) Add() error {
+	_, err := DB["mon"].InsertOne(e)
+	return err
+}
+
+func (e *Escalation) Update(cols ...string) error {
+	_, err := DB["mon"].Where("id=?", e.Id).Cols(cols...).Update(e)
+	return err
+}
+
+func EscalationDel(id int64) error {
+	cnt, err := DB["mon"].Where("escalation_id=?", id).Count(new(Stra))
+	if err != nil {
+		return err
+	}
+
+	if cnt > 0 {
+		return fmt.Errorf("escalation is used by %d strategies", cnt)
+	}
+
+	_, err = DB["mon"].Where("id=?", id).Delete(new(Escalation))
+	return err
+}
+
+func EscalationGet(col string, value interface{}) (*Escalation, error) {
+	var obj Escalation
+	has, err := DB["mon"].Where(col+"=?", value).Get(&obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return nil, nil
+	}
+
+	return &obj, obj.Decode()
+}
+
+func EscalationGets(query string) ([]Escalation, error) {
+	session := DB["mon"].NewSession()
+	defer session.Close()
+
+	if query != "" {
+		q := "%" + query + "%"
+		session = session.Where("name like ? or note like ?", q, q)
+	}
+
+	var objs []Escalation
+	if err := session.OrderBy("name").Find(&objs); err != nil {
+		return nil, err
+	}
+
+	for i := range objs {
+		if err := objs[i].Decode(); err != nil {
+			return nil, err
+		}
+	}
+
+	return objs, nil
+}
+
+func EscalationGetAll() ([]Escalation, error) {
+	return EscalationGets("")
+}
+
+// EscalationLogAdd 已经存在(其他alarm实例已经处理)时返回false
+func EscalationLogAdd(log *EscalationLog) (bool, error) {
+	has, err := DB["mon"].Where("event_cur_id=? and round=? and step=?", log.EventCurId, log.Round, log.Step).Exist(new(EscalationLog))
+	if err != nil || has {
+		return false, err
+	}
+
+	if _, err = DB["mon"].InsertOne(log); err != nil {
+		// 唯一索引冲突
+		if strings.Contains(err.Error(), "Duplicate") {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (l *EscalationLog) Update(cols ...string) error {
+	_, err := DB["mon"].Where("id=?", l.Id).Cols(cols...).Update(l)
+	return err
+}
+
+// EscalationLogStop 升级已经开始时, 记录升级停止的原因, 每次报警只记录一次
+func EscalationLogStop(logs []EscalationLog, action string, users string) error {
+	if len(logs) == 0 {
+		return nil
+	}
+
+	last := logs[len(logs)-1]
+	if last.IsStop() {
+		return nil
+	}
+
+	_, err := EscalationLogAdd(&EscalationLog{
+		EscalationId: last.EscalationId,
+		EventCurId:   last.EventCurId,
+		HashId:       last.HashId,
+		Stime:        last.Stime,
+		Round:        escalationStopStep,
+		Step:         escalationStopStep,
+		Action:       action,
+		Users:        users,
+		Channels:     "[]",
+		Clock:        time.Now().Unix(),
+	})
+	return err
+}
+
+// IsStop 升级是否已经停止
+func (l *EscalationLog) IsStop() bool {
+	return l.Step == escalationStopStep
+}
+
+func EscalationLogGets(eventCurId int64) ([]EscalationLog, error) {
+	var objs []EscalationLog
+	err := DB["mon"].Where("event_cur_id=?", eventCurId).OrderBy("id").Find(&objs)
+	return objs, err
+}
+
+func EscalationLogGetsByCurIds(ids []int64) (map[int64][]EscalationLog, error) {
+	ret := make(map[int64][]EscalationLog)
+	if len(ids) == 0 {
+		return ret, nil
+	}
+
+	var objs []EscalationLog
+	if err := DB["mon"].In("event_cur_id", ids).OrderBy("id").Find(&objs); err != nil {
+		return nil, err
+	}
+
+	for i := range objs {
+		ret[objs[i].EventCurId] = append(ret[objs[i].EventCurId], objs[i])
+	}
+
+	return ret, nil
+}
+
+// EscalationLogGetsByEvent 历史事件所在的那次报警的升级记录: 前一个恢复事件之后, 下一个恢复事件之前开始的报警
+func EscalationLogGetsByEvent(event *Event) ([]EscalationLog, error) {
+	var prev, next Event
+	has, err := DB["mon"].Where("hashid=? and event_type=? and etime<?", event.HashId, config.RECOVERY, event.Etime).OrderBy("etime desc").Get(&prev)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		prev.Etime = 0
+	}
+
+	if event.EventType == config.RECOVERY {
+		next = *event
+	} else {
+		has, err = DB["mon"].Where("hashid=? and event_type=? and etime>=?", event.HashId, config.RECOVERY, event.Etime).OrderBy("etime").Get(&next)
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			next.Etime = time.Now().Unix()
+		}
+	}
+
+	var last EscalationLog
+	has, err = DB["mon"].Where("hashid=? and stime>? and stime<=?", event.HashId, prev.Etime, next.Etime).OrderBy("id desc").Get(&last)
+	if err != nil || !has {
+		return []EscalationLog{}, err
+	}
+
+	return EscalationLogGets(last.EventCurId)
+}
+
+func DelEscalationLogOlder(ts int64, batch int) error {
+	_, err := DB["mon"].Exec("delete from escalation_log where clock < ? limit ?", ts, batch)
+	return err
+}
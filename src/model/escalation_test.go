@@ -0,0 +1,130 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func Test_EscalationDue(t *testing.T) {
+	e := &Escalation{
+		Steps: []EscalationStep{
+			{Delay: 60},
+			{Delay: 300},
+		},
+		Repeat: 1,
+	}
+
+	cases := []struct {
+		n     int
+		round int
+		step  int
+		delay int64
+		ok    bool
+	}{
+		{0, 0, 0, 60, true},
+		{1, 0, 1, 360, true},
+		{2, 1, 0, 420, true},
+		{3, 1, 1, 720, true},
+		{4, 2, 0, 0, false},
+	}
+
+	for _, c := range cases {
+		round, step, delay, ok := e.Due(c.n)
+		if round != c.round || step != c.step || delay != c.delay || ok != c.ok {
+			t.Errorf("Due(%d) = %d, %d, %d, %v; want %d, %d, %d, %v", c.n, round, step, delay, ok, c.round, c.step, c.delay, c.ok)
+		}
+	}
+
+	e.Repeat = -1
+	if _, _, delay, ok := e.Due(100); !ok || delay != 50*360+60 {
+		t.Errorf("Due(100) with endless repeat = %d, %v", delay, ok)
+	}
+}
+
+func Test_EscalationLogStop(t *testing.T) {
+	defer mockDB(t)()
+
+	notified := EscalationLog{Id: 1, EscalationId: 2, EventCurId: 3, HashId: 4, Stime: 1600000000, Round: 0, Step: 0, Action: ESCALATION_NOTIFY}
+	stopped := EscalationLog{Id: 2, EscalationId: 2, EventCurId: 3, HashId: 4, Stime: 1600000000, Round: -1, Step: -1, Action: ESCALATION_CLAIMED}
+
+	cases := []struct {
+		logs   []EscalationLog
+		action string
+		users  string
+		stop   bool
+	}{
+		// 升级还没有开始
+		{nil, ESCALATION_CLAIMED, "[1]", false},
+		{[]EscalationLog{notified}, ESCALATION_CLAIMED, "[1]", true},
+		{[]EscalationLog{notified}, ESCALATION_RECOVERED, "[]", true},
+		// 已经停止的不再记录
+		{[]EscalationLog{notified, stopped}, ESCALATION_IGNORED, "[]", false},
+	}
+
+	for _, c := range cases {
+		if err := EscalationLogStop(c.logs, c.action, c.users); err != nil {
+			t.Fatal(err)
+		}
+
+		inserts := records.reset("INSERT")
+		if !c.stop {
+			if len(inserts) != 0 {
+				t.Fatalf("%s: unexpected insert: %+v", c.action, inserts)
+			}
+			continue
+		}
+
+		if len(inserts) != 1 || !strings.HasPrefix(inserts[0].query, "INSERT INTO `escalation_log`") {
+			t.Fatalf("%s: unexpected sql: %+v", c.action, inserts)
+		}
+
+		for _, v := range []string{c.action, c.users, "-1", "2", "3", "1600000000"} {
+			if !containsValue(inserts[0].args, v) {
+				t.Fatalf("%s: %s not found in args: %v", c.action, v, inserts[0].args)
+			}
+		}
+	}
+
+	stop := EscalationLog{Round: escalationStopStep, Step: escalationStopStep}
+	if !stop.IsStop() || notified.IsStop() {
+		t.Fatal("unexpected IsStop")
+	}
+}
+
+// 忽略, 认领, 屏蔽, 被抑制和升级已经停止的报警在sql中过滤
+func Test_EventCurGetsToEscalate(t *testing.T) {
+	defer mockDB(t)()
+
+	if _, err := EventCurGetsToEscalate(); err != nil {
+		t.Fatal(err)
+	}
+
+	queries := records.reset("SELECT")
+	if len(queries) != 1 {
+		t.Fatalf("unexpected sql: %+v", queries)
+	}
+
+	cases := []struct {
+		name string
+		cond string
+		args []interface{}
+	}{
+		{"ignored", "ignore_alert=0", nil},
+		{"claimed", "claimants='[]'", nil},
+		{"masked", "status & ? = 0", []interface{}{1 << FLAG_MASK}},
+		{"inhibited and not sent", "(status & ? = 0 or status & ? <> 0)", []interface{}{1 << FLAG_INHIBIT, 1 << FLAG_SEND}},
+		{"stopped", "not exists (select 1 from escalation_log", []interface{}{escalationStopStep}},
+	}
+
+	for _, c := range cases {
+		if !strings.Contains(queries[0].query, c.cond) {
+			t.Fatalf("%s: %s not found in sql: %s", c.name, c.cond, queries[0].query)
+		}
+		for _, v := range c.args {
+			if !containsValue(queries[0].args, fmt.Sprint(v)) {
+				t.Fatalf("%s: %v not found in args: %v", c.name, v, queries[0].args)
+			}
+		}
+	}
+}
@@ -27,6 +27,7 @@ type Event struct {
 	Detail        string    `json:"detail"`
 	Users         string    `json:"users"`
 	Groups        string    `json:"groups"`
+	Oncalls       string    `json:"oncalls"` // 值班表id
 	Nid           int64     `json:"nid"`
 	NeedUpgrade   int       `json:"need_upgrade"`
 	AlertUpgrade  string    `json:"alert_upgrade"`
@@ -172,6 +173,21 @@ func EventGet(col string, value interface{}) (*Event, error) {
 	return &obj, nil
 }
 
+// EventGetLastAlert 同一条曲线最近一次的报警事件
+func EventGetLastAlert(hashid uint64) (*Event, error) {
+	var obj Event
+	has, err := DB["mon"].Where("hashid=? and event_type=?", hashid, config.ALERT).Desc("id").Get(&obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return nil, nil
+	}
+
+	return &obj, nil
+}
+
 func DelEventOlder(ts int64, batch int) error {
 	sql := "delete from event where etime < ? limit ?"
 	_, err := DB["mon"].Exec(sql, ts, batch)
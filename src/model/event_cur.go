@@ -31,6 +31,7 @@ type EventCur struct {
 	Detail        string    `json:"detail"`
 	Users         string    `json:"users"`
 	Groups        string    `json:"groups"`
+	Oncalls       string    `json:"oncalls"` // 值班表id
 	Nid           int64     `json:"nid"`
 	IgnoreAlert   int       `json:"ignore_alert"`
 	Claimants     string    `json:"claimants"`
@@ -60,7 +61,7 @@ func SaveEventCur(eventCur *EventCur) error {
 	}
 
 	if has {
-		if _, err := session.Where("hashid=?", eventCur.HashId).Cols("sid", "sname", "node_path", "endpoint", "priority", "category", "status", "etime", "detail", "value", "info", "users", "groups", "nid", "alert_upgrade", "need_upgrade", "endpoint_alias").Update(eventCur); err != nil {
+		if _, err := session.Where("hashid=?", eventCur.HashId).Cols("sid", "sname", "node_path", "endpoint", "priority", "category", "status", "etime", "detail", "value", "info", "users", "groups", "oncalls", "nid", "alert_upgrade", "need_upgrade", "endpoint_alias").Update(eventCur); err != nil {
 			session.Rollback()
 			return err
 		}
@@ -103,7 +104,21 @@ func UpdateClaimantsById(userId, id int64) error {
 	}
 
 	_, err = DB["mon"].Exec("update event_cur set claimants=? where id=?", string(data), id)
-	return err
+	if err != nil {
+		return err
+	}
+
+	return escalationClaimed(id, userId)
+}
+
+// escalationClaimed 认领后立即在升级的时间线上记录, alarm下一次检查时停止升级
+func escalationClaimed(id, userId int64) error {
+	logs, err := EscalationLogGets(id)
+	if err != nil {
+		return err
+	}
+
+	return EscalationLogStop(logs, ESCALATION_CLAIMED, fmt.Sprintf("[%d]", userId))
 }
 
 func UpdateClaimantsByNodePath(userId int64, nodePath string) error {
@@ -147,6 +162,12 @@ func UpdateClaimantsByNodePath(userId int64, nodePath string) error {
 		return err
 	}
 
+	for i := 0; i < len(objs); i++ {
+		if err := escalationClaimed(objs[i].Id, userId); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -231,9 +252,37 @@ func EventCurGet(col string, value interface{}) (*EventCur, error) {
 	return &obj, nil
 }
 
+// EventCurGetsBy 正在报警的事件
+func EventCurGetsBy(col string, value interface{}) ([]EventCur, error) {
+	var objs []EventCur
+	err := DB["mon"].Where(col+"=?", value).Find(&objs)
+	return objs, err
+}
+
+// EventCurGetsToEscalate 可能需要升级的报警: 没有忽略, 没有认领, 没有屏蔽, 没有被抑制, 并且升级没有停止
+// 被抑制的报警没有发送(FLAG_INHIBIT并且没有FLAG_SEND), 标记为已抑制但正常发送的报警仍然升级
+func EventCurGetsToEscalate() ([]EventCur, error) {
+	var objs []EventCur
+	err := DB["mon"].Where("ignore_alert=0 and (claimants='' or claimants='[]')").
+		And("status & ? = 0", 1<<FLAG_MASK).
+		And("(status & ? = 0 or status & ? <> 0)", 1<<FLAG_INHIBIT, 1<<FLAG_SEND).
+		And("not exists (select 1 from escalation_log where escalation_log.event_cur_id=event_cur.id and escalation_log.round=? and escalation_log.step=?)", escalationStopStep, escalationStopStep).
+		Find(&objs)
+	return objs, err
+}
+
 func (e *EventCur) EventIgnore() error {
 	_, err := DB["mon"].Exec("update event_cur set ignore_alert=1 where id=?", e.Id)
-	return err
+	if err != nil {
+		return err
+	}
+
+	logs, err := EscalationLogGets(e.Id)
+	if err != nil {
+		return err
+	}
+
+	return EscalationLogStop(logs, ESCALATION_IGNORED, "[]")
 }
 
 func DelEventCurOlder(ts int64, batch int) error {
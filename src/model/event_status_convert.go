@@ -7,6 +7,7 @@ package model
 // 0 0 1 0 0 0 被收敛
 // 0 1 0 0 x 0 无接收人
 // 1 0 0 0 x 0 升级发送
+// 抑制单独占一位: 1 0 0 0 0 0 0 被抑制, 不发送; 1 x x x x x x 标记为已抑制, 正常发送
 const (
 	FLAG_SEND = iota
 	FLAG_CALLBACK
@@ -14,6 +15,7 @@ const (
 	FLAG_CONVERGE
 	FLAG_NONEUSER
 	FLAG_UPGRADE
+	FLAG_INHIBIT
 )
 
 const (
@@ -24,6 +26,7 @@ const (
 	STATUS_MASK     = "mask"      // 已屏蔽
 	STATUS_CONVERGE = "converge"  // 频率限制
 	STATUS_UPGRADE  = "upgrade"   // 升级报警
+	STATUS_INHIBIT  = "inhibit"   // 已抑制
 )
 
 func StatusConvert(s []string) []string {
@@ -45,6 +48,8 @@ func StatusConvert(s []string) []string {
 			status = append(status, "已收敛")
 		case STATUS_UPGRADE:
 			status = append(status, "已升级")
+		case STATUS_INHIBIT:
+			status = append(status, "已抑制")
 		}
 	}
 
@@ -65,6 +70,8 @@ func GetStatus(status string) int {
 		return 1 << FLAG_CONVERGE
 	case STATUS_UPGRADE:
 		return 1 << FLAG_UPGRADE
+	case STATUS_INHIBIT:
+		return 1 << FLAG_INHIBIT
 	}
 
 	return 0
@@ -92,6 +99,8 @@ func GetFlagsByStatus(ss []string) []uint16 {
 			flags[s] = getConverge()
 		case STATUS_UPGRADE:
 			flags[s] = getUpgrade()
+		case STATUS_INHIBIT:
+			flags[s] = getInhibit()
 		}
 	}
 	uss := make([][]uint16, 0)
@@ -109,6 +118,10 @@ func GetStatusByFlag(flag uint16) []string {
 		return ret
 	}
 
+	if (flag>>FLAG_INHIBIT)&0x01 == 1 {
+		ret = append(ret, STATUS_INHIBIT)
+	}
+
 	if (flag>>FLAG_UPGRADE)&0x01 == 1 {
 		ret = append(ret, STATUS_UPGRADE)
 	}
@@ -143,14 +156,14 @@ func getDoing() []uint16 {
 	return []uint16{0}
 }
 
-// x 0 0 0 x 1 已发送
+// x x 0 0 0 x 1 已发送
 func getSend() []uint16 {
-	return []uint16{1, 3, 33, 35}
+	return withInhibit([]uint16{1, 3, 33, 35})
 }
 
-// x 0 0 0 1 x 已回调
+// x x 0 0 0 1 x 已回调
 func getCallback() []uint16 {
-	return []uint16{2, 3, 34, 35}
+	return withInhibit([]uint16{2, 3, 34, 35})
 }
 
 // 0 0 0 1 0 0 已屏蔽
@@ -158,19 +171,44 @@ func getMask() []uint16 {
 	return []uint16{4}
 }
 
-// x 0 1 0 0 0 被收敛
+// x x 0 1 0 0 0 被收敛
 func getConverge() []uint16 {
-	return []uint16{8, 40}
+	return withInhibit([]uint16{8, 40})
 }
 
-// x 1 0 0 x 0 无接收人
+// x x 1 0 0 x 0 无接收人
 func getNoneUser() []uint16 {
-	return []uint16{16, 18, 48, 50}
+	return withInhibit([]uint16{16, 18, 48, 50})
 }
 
-// 1 x x 0 x x 已升级
+// x 1 x x 0 x x 已升级
 func getUpgrade() []uint16 {
-	return []uint16{32, 33, 34, 35, 40, 41, 42, 43, 48, 49, 50, 51, 56, 57, 58, 59}
+	return withInhibit([]uint16{32, 33, 34, 35, 40, 41, 42, 43, 48, 49, 50, 51, 56, 57, 58, 59})
+}
+
+// 1 x x x 0 x x 已抑制
+func getInhibit() []uint16 {
+	set := map[uint16]struct{}{1 << FLAG_INHIBIT: {}}
+	for _, flags := range [][]uint16{getSend(), getCallback(), getConverge(), getNoneUser(), getUpgrade()} {
+		for _, flag := range flags {
+			set[flag|1<<FLAG_INHIBIT] = struct{}{}
+		}
+	}
+
+	ret := make([]uint16, 0, len(set))
+	for flag := range set {
+		ret = append(ret, flag)
+	}
+	return ret
+}
+
+// withInhibit 标记为已抑制但是正常处理的事件
+func withInhibit(flags []uint16) []uint16 {
+	ret := make([]uint16, 0, len(flags)*2)
+	for _, flag := range flags {
+		ret = append(ret, flag, flag|1<<FLAG_INHIBIT)
+	}
+	return ret
 }
 
 func interSection(ss [][]uint16) []uint16 {
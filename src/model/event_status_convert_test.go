@@ -0,0 +1,115 @@
+package model
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/toolkits/pkg/slice"
+)
+
+func Test_GetStatusByFlag(t *testing.T) {
+	cases := []struct {
+		flag   uint16
+		status []string
+	}{
+		{0, []string{STATUS_DOING}},
+		{1 << FLAG_SEND, []string{STATUS_SEND}},
+		{1<<FLAG_SEND | 1<<FLAG_CALLBACK, []string{STATUS_SEND, STATUS_CALLBACK}},
+		{1 << FLAG_MASK, []string{STATUS_MASK}},
+		{1 << FLAG_CONVERGE, []string{STATUS_CONVERGE}},
+		{1 << FLAG_NONEUSER, []string{STATUS_NONEUSER}},
+		{1<<FLAG_UPGRADE | 1<<FLAG_SEND, []string{STATUS_UPGRADE, STATUS_SEND}},
+		// 被抑制, 不发送
+		{1 << FLAG_INHIBIT, []string{STATUS_INHIBIT}},
+		// 标记为已抑制, 正常发送
+		{1<<FLAG_INHIBIT | 1<<FLAG_SEND, []string{STATUS_INHIBIT, STATUS_SEND}},
+		{1<<FLAG_INHIBIT | 1<<FLAG_CONVERGE, []string{STATUS_INHIBIT, STATUS_CONVERGE}},
+	}
+
+	for _, c := range cases {
+		if status := GetStatusByFlag(c.flag); !reflect.DeepEqual(status, c.status) {
+			t.Fatalf("GetStatusByFlag(%b) = %v, want %v", c.flag, status, c.status)
+		}
+	}
+}
+
+// 按状态查询时, 查询到的事件的状态都包括所有查询的状态
+func Test_GetFlagsByStatus(t *testing.T) {
+	cases := []struct {
+		status []string
+		match  []uint16
+		miss   []uint16
+	}{
+		{
+			[]string{STATUS_INHIBIT},
+			[]uint16{1 << FLAG_INHIBIT, 1<<FLAG_INHIBIT | 1<<FLAG_SEND, 1<<FLAG_INHIBIT | 1<<FLAG_CONVERGE},
+			[]uint16{0, 1 << FLAG_SEND, 1 << FLAG_MASK},
+		},
+		{
+			[]string{STATUS_SEND},
+			[]uint16{1 << FLAG_SEND, 1<<FLAG_INHIBIT | 1<<FLAG_SEND},
+			[]uint16{0, 1 << FLAG_INHIBIT},
+		},
+		{
+			[]string{STATUS_SEND, STATUS_INHIBIT},
+			[]uint16{1<<FLAG_INHIBIT | 1<<FLAG_SEND},
+			[]uint16{1 << FLAG_SEND, 1 << FLAG_INHIBIT},
+		},
+		{
+			[]string{STATUS_MASK, STATUS_INHIBIT},
+			[]uint16{},
+			[]uint16{1 << FLAG_MASK, 1 << FLAG_INHIBIT},
+		},
+		{
+			[]string{STATUS_DOING},
+			[]uint16{0},
+			[]uint16{1 << FLAG_INHIBIT},
+		},
+	}
+
+	for _, c := range cases {
+		flags := GetFlagsByStatus(c.status)
+		set := make(map[uint16]struct{}, len(flags))
+		for _, flag := range flags {
+			set[flag] = struct{}{}
+
+			// 反过来转换的状态包括查询的状态
+			status := GetStatusByFlag(flag)
+			for _, s := range c.status {
+				if !slice.ContainsString(status, s) {
+					t.Fatalf("%v: flag %b has status %v", c.status, flag, status)
+				}
+			}
+		}
+
+		for _, flag := range c.match {
+			if _, has := set[flag]; !has {
+				t.Fatalf("%v: flag %b not found in %v", c.status, flag, sortFlags(flags))
+			}
+		}
+
+		for _, flag := range c.miss {
+			if _, has := set[flag]; has {
+				t.Fatalf("%v: unexpected flag %b in %v", c.status, flag, sortFlags(flags))
+			}
+		}
+	}
+}
+
+func Test_StatusConvert(t *testing.T) {
+	status := []string{STATUS_DOING, STATUS_SEND, STATUS_INHIBIT, "unknown"}
+	want := []string{"处理中", "已发送", "已抑制"}
+	if got := StatusConvert(status); !reflect.DeepEqual(got, want) {
+		t.Fatalf("StatusConvert(%v) = %v, want %v", status, got, want)
+	}
+
+	if GetStatus(STATUS_INHIBIT) != 1<<FLAG_INHIBIT || GetStatus(STATUS_DOING) != 0 {
+		t.Fatalf("unexpected status flag")
+	}
+}
+
+func sortFlags(flags []uint16) []uint16 {
+	sort.Slice(flags, func(i, j int) bool { return flags[i] < flags[j] })
+	return flags
+}
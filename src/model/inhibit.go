@@ -0,0 +1,166 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	INHIBIT_EQUAL_ENDPOINT = "endpoint" // 源事件和目标事件是同一个endpoint
+	INHIBIT_EQUAL_NODE     = "node"     // 源事件和目标事件在同一个节点下
+
+	INHIBIT_ACTION_SUPPRESS = "suppress" // 不发送通知
+	INHIBIT_ACTION_MARK     = "mark"     // 正常发送通知, 事件标记为已抑制
+)
+
+// Inhibit 抑制规则: 源事件正在报警时, 同一个endpoint(或节点)上匹配的目标事件被抑制
+// 源和目标的选择器: 策略ID列表, 指标, tags(格式同屏蔽规则 key1=value1,value2;key2=value3), 为空表示不限制
+type Inhibit struct {
+	Id          int64     `json:"id"`
+	Nid         int64     `json:"nid"` // 规则只对该节点下的策略产生的事件生效
+	NodePath    string    `json:"node_path" xorm:"-"`
+	Name        string    `json:"name"`
+	SrcSids     string    `json:"src_sids"` // 逗号分隔
+	SrcMetric   string    `json:"src_metric"`
+	SrcTags     string    `json:"src_tags"`
+	TgtSids     string    `json:"tgt_sids"`
+	TgtMetric   string    `json:"tgt_metric"`
+	TgtTags     string    `json:"tgt_tags"`
+	Equal       string    `json:"equal"`
+	Action      string    `json:"action"`
+	Creator     string    `json:"creator"`
+	Created     time.Time `json:"created" xorm:"created"`
+	LastUpdator string    `json:"last_updator"`
+	LastUpdated time.Time `json:"last_updated" xorm:"<-"`
+}
+
+func (i *Inhibit) Validate() error {
+	i.Name = strings.TrimSpace(i.Name)
+	if i.Name == "" {
+		return fmt.Errorf("arg[name] empty")
+	}
+
+	if i.SrcSids == "" && i.SrcMetric == "" {
+		return fmt.Errorf("source strategy and metric are both empty")
+	}
+
+	if i.TgtSids == "" && i.TgtMetric == "" {
+		return fmt.Errorf("target strategy and metric are both empty")
+	}
+
+	if i.SrcSids != "" && i.SrcSids == i.TgtSids && i.SrcMetric == i.TgtMetric && i.SrcTags == i.TgtTags {
+		return fmt.Errorf("source and target are the same")
+	}
+
+	for _, tags := range []string{i.SrcTags, i.TgtTags} {
+		if err := tagsValidate(tags); err != nil {
+			return err
+		}
+	}
+
+	switch i.Equal {
+	case "":
+		i.Equal = INHIBIT_EQUAL_ENDPOINT
+	case INHIBIT_EQUAL_ENDPOINT, INHIBIT_EQUAL_NODE:
+	default:
+		return fmt.Errorf("arg[equal] invalid: %s", i.Equal)
+	}
+
+	switch i.Action {
+	case "":
+		i.Action = INHIBIT_ACTION_SUPPRESS
+	case INHIBIT_ACTION_SUPPRESS, INHIBIT_ACTION_MARK:
+	default:
+		return fmt.Errorf("arg[action] invalid: %s", i.Action)
+	}
+
+	return nil
+}
+
+// tagsValidate key1=value1,value2;key2=value3
+func tagsValidate(tags string) error {
+	if strings.TrimSpace(tags) == "" {
+		return nil
+	}
+
+	for _, kv := range strings.Split(tags, ";") {
+		arr := strings.SplitN(kv, "=", 2)
+		if len(arr) != 2 || strings.TrimSpace(arr[0]) == "" || strings.TrimSpace(arr[1]) == "" {
+			return fmt.Errorf("tags invalid: %s", tags)
+		}
+	}
+
+	return nil
+}
+
+func (i *Inhibit) Add() error {
+	_, err := DB["mon"].InsertOne(i)
+	return err
+}
+
+func (i *Inhibit) Update(cols ...string) error {
+	_, err := DB["mon"].Where("id=?", i.Id).Cols(cols...).Update(i)
+	return err
+}
+
+func InhibitDel(id int64) error {
+	_, err := DB["mon"].Where("id=?", id).Delete(new(Inhibit))
+	return err
+}
+
+func InhibitGet(col string, value interface{}) (*Inhibit, error) {
+	var obj Inhibit
+	has, err := DB["mon"].Where(col+"=?", value).Get(&obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return nil, nil
+	}
+
+	return &obj, nil
+}
+
+// InhibitGets 节点及其所有父节点上的规则
+func InhibitGets(nodeId int64) ([]Inhibit, error) {
+	node, err := NodeGet("id", nodeId)
+	if err != nil {
+		return nil, err
+	}
+
+	if node == nil {
+		return nil, fmt.Errorf("no such node[%d]", nodeId)
+	}
+
+	nodes, err := NodeGetsByPaths(Paths(node.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, len(nodes))
+	paths := make(map[int64]string, len(nodes))
+	for i := 0; i < len(nodes); i++ {
+		ids = append(ids, nodes[i].Id)
+		paths[nodes[i].Id] = nodes[i].Path
+	}
+
+	var objs []Inhibit
+	if len(ids) == 0 {
+		return objs, nil
+	}
+
+	err = DB["mon"].In("nid", ids).OrderBy("id desc").Find(&objs)
+	for i := 0; i < len(objs); i++ {
+		objs[i].NodePath = paths[objs[i].Nid]
+	}
+
+	return objs, err
+}
+
+func InhibitGetAll() ([]Inhibit, error) {
+	var objs []Inhibit
+	err := DB["mon"].Find(&objs)
+	return objs, err
+}
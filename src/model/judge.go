@@ -0,0 +1,127 @@
+package model
+
+import (
+	"time"
+)
+
+// JudgeMember judge通过心跳注册, portal根据存活的judge重建一致性哈希环
+type JudgeMember struct {
+	Id      int64  `json:"id"`
+	Ident   string `json:"ident"`          // judge的identity, 即拉取策略时的ip参数
+	Addr    string `json:"addr"`           // judge的http管理接口地址
+	Rpc     string `json:"rpc"`            // judge接收transfer推送数据的rpc地址
+	StraNum int    `json:"stra_num"`       // judge上正在运行的策略数
+	Clock   int64  `json:"clock"`          // 最近一次心跳的时间
+	Node    string `json:"node" xorm:"-"`  // 在哈希环上的节点名
+	Alive   bool   `json:"alive" xorm:"-"` // 心跳是否超时
+}
+
+// JudgeStraState 策略的报警状态, 策略迁移到其他judge时, 新的judge从这里恢复
+type JudgeStraState struct {
+	Id    int64  `json:"id"`
+	Sid   int64  `json:"sid"`
+	Ident string `json:"ident"` // 上报状态的judge
+	State string `json:"state"` // judge上报的状态, 原样保存
+	Clock int64  `json:"clock"`
+}
+
+func JudgeHeartbeat(ident, addr, rpc string, straNum int) error {
+	now := time.Now().Unix()
+
+	var obj JudgeMember
+	has, err := DB["mon"].Where("ident=?", ident).Get(&obj)
+	if err != nil {
+		return err
+	}
+
+	if !has {
+		_, err = DB["mon"].Insert(&JudgeMember{
+			Ident:   ident,
+			Addr:    addr,
+			Rpc:     rpc,
+			StraNum: straNum,
+			Clock:   now,
+		})
+		return err
+	}
+
+	obj.Addr = addr
+	obj.Rpc = rpc
+	obj.StraNum = straNum
+	obj.Clock = now
+	_, err = DB["mon"].Where("id=?", obj.Id).Cols("addr", "rpc", "stra_num", "clock").Update(&obj)
+	return err
+}
+
+// JudgeMemberLeave judge正常退出, 心跳时间置为0, 立即从哈希环中摘除
+func JudgeMemberLeave(ident string) error {
+	_, err := DB["mon"].Where("ident=?", ident).Cols("clock").Update(&JudgeMember{Clock: 0})
+	return err
+}
+
+func JudgeMembers() ([]*JudgeMember, error) {
+	objs := make([]*JudgeMember, 0)
+	err := DB["mon"].OrderBy("ident").Find(&objs)
+	return objs, err
+}
+
+// JudgeMemberDel 长时间没有心跳的judge, 从成员列表中删除
+func JudgeMemberDel(ident string) error {
+	_, err := DB["mon"].Where("ident=?", ident).Delete(new(JudgeMember))
+	return err
+}
+
+// JudgeStraStatesSave 按策略ID覆盖保存, state为空表示没有需要交接的状态
+func JudgeStraStatesSave(ident string, states map[int64]string) error {
+	if len(states) == 0 {
+		return nil
+	}
+
+	now := time.Now().Unix()
+	session := DB["mon"].NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	for sid, state := range states {
+		if _, err := session.Where("sid=?", sid).Delete(new(JudgeStraState)); err != nil {
+			session.Rollback()
+			return err
+		}
+
+		if state == "" {
+			continue
+		}
+
+		_, err := session.Insert(&JudgeStraState{
+			Sid:   sid,
+			Ident: ident,
+			State: state,
+			Clock: now,
+		})
+		if err != nil {
+			session.Rollback()
+			return err
+		}
+	}
+
+	return session.Commit()
+}
+
+func JudgeStraStateGets(sids []int64) ([]*JudgeStraState, error) {
+	objs := make([]*JudgeStraState, 0)
+	if len(sids) == 0 {
+		return objs, nil
+	}
+
+	err := DB["mon"].In("sid", sids).Find(&objs)
+	return objs, err
+}
+
+// JudgeStraStateClean 清理已经删除或者很久没有更新的策略状态
+func JudgeStraStateClean(before int64) error {
+	_, err := DB["mon"].Where("clock<?", before).Delete(new(JudgeStraState))
+	return err
+}
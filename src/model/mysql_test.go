@@ -0,0 +1,126 @@
+package model
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-xorm/core"
+	"github.com/go-xorm/xorm"
+)
+
+// recordDriver 只记录执行的sql, 查询都返回空结果, 用于检查生成的sql, 不需要mysql
+type recordDriver struct {
+	sync.Mutex
+	records []record
+}
+
+type record struct {
+	query string
+	args  []driver.Value
+}
+
+func (d *recordDriver) Open(name string) (driver.Conn, error) { return &recordConn{d}, nil }
+
+func (d *recordDriver) add(query string, args []driver.Value) {
+	d.Lock()
+	defer d.Unlock()
+	d.records = append(d.records, record{query, args})
+}
+
+// reset 返回之前执行的sql, prefix不为空时只返回以prefix开头的sql
+func (d *recordDriver) reset(prefix string) []record {
+	d.Lock()
+	defer d.Unlock()
+
+	ret := make([]record, 0, len(d.records))
+	for _, r := range d.records {
+		if strings.HasPrefix(r.query, prefix) {
+			ret = append(ret, r)
+		}
+	}
+	d.records = nil
+	return ret
+}
+
+type recordConn struct{ d *recordDriver }
+
+func (c *recordConn) Prepare(query string) (driver.Stmt, error) { return &recordStmt{c.d, query}, nil }
+func (c *recordConn) Close() error                              { return nil }
+func (c *recordConn) Begin() (driver.Tx, error)                 { return nil, fmt.Errorf("not supported") }
+
+type recordStmt struct {
+	d     *recordDriver
+	query string
+}
+
+func (s *recordStmt) Close() error  { return nil }
+func (s *recordStmt) NumInput() int { return -1 }
+
+func (s *recordStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.add(s.query, args)
+	return recordResult{}, nil
+}
+
+func (s *recordStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.add(s.query, args)
+	return emptyRows{}, nil
+}
+
+// recordResult 插入时返回固定的id
+type recordResult struct{}
+
+func (recordResult) LastInsertId() (int64, error) { return 10, nil }
+func (recordResult) RowsAffected() (int64, error) { return 1, nil }
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string              { return []string{"id"} }
+func (emptyRows) Close() error                   { return nil }
+func (emptyRows) Next(dest []driver.Value) error { return io.EOF }
+
+var (
+	records     = &recordDriver{}
+	recordsOnce sync.Once
+)
+
+// mockDB DB["mon"]替换为只记录sql的engine, 返回的函数用于恢复
+func mockDB(t *testing.T) func() {
+	recordsOnce.Do(func() {
+		sql.Register("record", records)
+		core.RegisterDriver("record", core.QueryDriver("mysql"))
+	})
+
+	db, err := xorm.NewEngine("record", "root:1234@tcp(127.0.0.1:3306)/mon")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, has := DB["mon"]
+	DB["mon"] = db
+	records.reset("")
+
+	return func() {
+		if has {
+			DB["mon"] = old
+		} else {
+			delete(DB, "mon")
+		}
+	}
+}
+
+func containsValue(args []driver.Value, v string) bool {
+	for _, arg := range args {
+		if bs, ok := arg.([]byte); ok {
+			arg = string(bs)
+		}
+		if fmt.Sprint(arg) == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,155 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-xorm/xorm"
+
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/config"
+)
+
+// 通知的状态: queued(sender收到) -> sent | failed, webhook重试或重放时为retried
+const (
+	NOTIFY_QUEUED  = "queued"
+	NOTIFY_SENT    = "sent"
+	NOTIFY_FAILED  = "failed"
+	NOTIFY_RETRIED = "retried"
+)
+
+// notifyLogFrom 每个状态可以从哪些状态变化过来, sent之后不再变化, failed的webhook死信重放时变为retried
+var notifyLogFrom = map[string][]string{
+	NOTIFY_SENT:    {NOTIFY_QUEUED, NOTIFY_RETRIED},
+	NOTIFY_FAILED:  {NOTIFY_QUEUED, NOTIFY_RETRIED},
+	NOTIFY_RETRIED: {NOTIFY_QUEUED, NOTIFY_RETRIED, NOTIFY_FAILED},
+}
+
+// NotifyLog 每次通知的投递记录, sender收到通知时生成, 发送之后更新状态和通道的返回
+type NotifyLog struct {
+	Id       int64  `json:"id"`
+	EventId  int64  `json:"event_id"` // 0表示不是告警事件触发的通知
+	Channel  string `json:"channel"`
+	Tos      string `json:"tos"`
+	Subject  string `json:"subject"`
+	Content  string `json:"content"`
+	Status   string `json:"status"`
+	Attempts int    `json:"attempts"`
+	Response string `json:"response"` // 通道的返回或错误信息
+	Clock    int64  `json:"clock"`    // 收到的时间
+	Updated  int64  `json:"updated"`  // 最后一次状态变化的时间
+}
+
+func (l *NotifyLog) Add() error {
+	now := time.Now().Unix()
+	l.Status = NOTIFY_QUEUED
+	l.Clock = now
+	l.Updated = now
+
+	_, err := DB["mon"].InsertOne(l)
+	return err
+}
+
+// NotifyLogUpdate id为0(记录没有生成)时忽略, 当前状态不能变化到status时不更新
+func NotifyLogUpdate(id int64, status, response string, attempts int) error {
+	if id == 0 {
+		return nil
+	}
+
+	from, has := notifyLogFrom[status]
+	if !has {
+		return fmt.Errorf("illegal notify status: %s", status)
+	}
+
+	if len(response) > 1024 {
+		response = response[:1024]
+	}
+
+	obj := NotifyLog{
+		Status:   status,
+		Response: response,
+		Attempts: attempts,
+		Updated:  time.Now().Unix(),
+	}
+
+	_, err := DB["mon"].Where("id=?", id).In("status", from).Cols("status", "response", "attempts", "updated").Update(&obj)
+	return err
+}
+
+func NotifyLogGet(id int64) (*NotifyLog, error) {
+	var obj NotifyLog
+	has, err := DB["mon"].Where("id=?", id).Get(&obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return nil, nil
+	}
+
+	return &obj, nil
+}
+
+func NotifyLogGetsByEvent(eventId int64) ([]NotifyLog, error) {
+	objs := []NotifyLog{}
+	err := DB["mon"].Where("event_id=?", eventId).OrderBy("id").Find(&objs)
+	return objs, err
+}
+
+// NotifyLogGetsByEventCur 当前报警从产生到现在的所有通知, 即上一次恢复之后的事件触发的通知
+func NotifyLogGetsByEventCur(cur *EventCur) ([]NotifyLog, error) {
+	var last Event
+	_, err := DB["mon"].Where("hashid=? and event_type=?", cur.HashId, config.RECOVERY).Cols("id").OrderBy("id desc").Get(&last)
+	if err != nil {
+		return nil, err
+	}
+
+	objs := []NotifyLog{}
+	err = DB["mon"].Where("event_id in (select id from event where hashid=? and id>?)", cur.HashId, last.Id).OrderBy("id").Find(&objs)
+	return objs, err
+}
+
+type NotifyLogQuery struct {
+	EventId int64
+	Channel string
+	Status  string
+	Stime   int64
+	Etime   int64
+}
+
+func (q NotifyLogQuery) session() *xorm.Session {
+	session := DB["mon"].Where("clock>=? and clock<?", q.Stime, q.Etime)
+	if q.EventId > 0 {
+		session = session.Where("event_id=?", q.EventId)
+	}
+
+	if q.Channel != "" {
+		session = session.Where("channel=?", q.Channel)
+	}
+
+	if q.Status != "" {
+		session = session.Where("status=?", q.Status)
+	}
+
+	return session
+}
+
+func NotifyLogTotal(q NotifyLogQuery) (int64, error) {
+	session := q.session()
+	defer session.Close()
+
+	return session.Count(new(NotifyLog))
+}
+
+func NotifyLogGets(q NotifyLogQuery, limit, offset int) ([]NotifyLog, error) {
+	session := q.session()
+	defer session.Close()
+
+	objs := []NotifyLog{}
+	err := session.OrderBy("id desc").Limit(limit, offset).Find(&objs)
+	return objs, err
+}
+
+func DelNotifyLogOlder(ts int64, batch int) error {
+	_, err := DB["mon"].Exec("delete from notify_log where clock < ? limit ?", ts, batch)
+	return err
+}
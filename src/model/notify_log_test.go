@@ -0,0 +1,115 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/toolkits/pkg/slice"
+)
+
+func Test_NotifyLogAdd(t *testing.T) {
+	defer mockDB(t)()
+
+	l := &NotifyLog{EventId: 1, Channel: "webhook", Tos: `["3"]`, Content: "{}", Status: NOTIFY_SENT}
+	if err := l.Add(); err != nil {
+		t.Fatal(err)
+	}
+
+	if l.Id != 10 || l.Status != NOTIFY_QUEUED || l.Clock == 0 || l.Updated != l.Clock {
+		t.Fatalf("unexpected notify log: %+v", l)
+	}
+
+	execs := records.reset("")
+	if len(execs) != 1 || !strings.HasPrefix(execs[0].query, "INSERT INTO `notify_log`") {
+		t.Fatalf("unexpected sql: %+v", execs)
+	}
+	if !containsValue(execs[0].args, NOTIFY_QUEUED) {
+		t.Fatalf("notify log not queued: %+v", execs[0].args)
+	}
+}
+
+func Test_NotifyLogUpdate(t *testing.T) {
+	defer mockDB(t)()
+
+	long := strings.Repeat("x", 2000)
+	cases := []struct {
+		id       int64
+		status   string
+		response string
+		from     []string
+		fail     bool
+	}{
+		{1, NOTIFY_SENT, "ok", []string{NOTIFY_QUEUED, NOTIFY_RETRIED}, false},
+		{1, NOTIFY_FAILED, long, []string{NOTIFY_QUEUED, NOTIFY_RETRIED}, false},
+		{1, NOTIFY_RETRIED, "status code: 500", []string{NOTIFY_QUEUED, NOTIFY_RETRIED, NOTIFY_FAILED}, false},
+		// 只有Add生成queued状态
+		{1, NOTIFY_QUEUED, "", nil, true},
+		{1, "unknown", "", nil, true},
+		// 记录没有生成
+		{0, NOTIFY_SENT, "", nil, false},
+	}
+
+	for _, c := range cases {
+		err := NotifyLogUpdate(c.id, c.status, c.response, 2)
+		if (err != nil) != c.fail {
+			t.Fatalf("update %d to %s: unexpected err: %v", c.id, c.status, err)
+		}
+
+		execs := records.reset("")
+		if c.fail || c.id == 0 {
+			if len(execs) != 0 {
+				t.Fatalf("update %d to %s: unexpected sql: %+v", c.id, c.status, execs)
+			}
+			continue
+		}
+
+		if len(execs) != 1 || !strings.HasPrefix(execs[0].query, "UPDATE `notify_log`") ||
+			!strings.Contains(execs[0].query, fmt.Sprintf("`status` IN (%s)", strings.TrimSuffix(strings.Repeat("?,", len(c.from)), ","))) {
+			t.Fatalf("update to %s: unexpected sql: %+v", c.status, execs)
+		}
+
+		args := execs[0].args
+		for _, s := range append(c.from, c.status) {
+			if !containsValue(args, s) {
+				t.Fatalf("update to %s: %s not found in args: %v", c.status, s, args)
+			}
+		}
+
+		response := c.response
+		if len(response) > 1024 {
+			response = response[:1024]
+		}
+		if !containsValue(args, response) || containsValue(args, long) {
+			t.Fatalf("update to %s: response not truncated: %d", c.status, len(c.response))
+		}
+	}
+}
+
+// queued -> sent | failed | retried, retried -> sent | failed | retried, 死信重放 failed -> retried
+func Test_NotifyLogTransition(t *testing.T) {
+	cases := []struct {
+		from string
+		to   string
+		ok   bool
+	}{
+		{NOTIFY_QUEUED, NOTIFY_SENT, true},
+		{NOTIFY_QUEUED, NOTIFY_FAILED, true},
+		{NOTIFY_QUEUED, NOTIFY_RETRIED, true},
+		{NOTIFY_RETRIED, NOTIFY_RETRIED, true},
+		{NOTIFY_RETRIED, NOTIFY_SENT, true},
+		{NOTIFY_RETRIED, NOTIFY_FAILED, true},
+		{NOTIFY_FAILED, NOTIFY_RETRIED, true},
+		{NOTIFY_FAILED, NOTIFY_SENT, false},
+		{NOTIFY_SENT, NOTIFY_FAILED, false},
+		{NOTIFY_SENT, NOTIFY_RETRIED, false},
+		{NOTIFY_SENT, NOTIFY_QUEUED, false},
+		{NOTIFY_FAILED, NOTIFY_QUEUED, false},
+	}
+
+	for _, c := range cases {
+		if ok := slice.ContainsString(notifyLogFrom[c.to], c.from); ok != c.ok {
+			t.Fatalf("%s -> %s: %v, want %v", c.from, c.to, ok, c.ok)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// NotifyTpl 通知模板, 按通道选择, 优先级/策略/节点为0表示不限制
+// 多个模板同时匹配时: 指定策略的 > 指定节点的(节点越深越优先) > 指定优先级的 > 通用的
+type NotifyTpl struct {
+	Id          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Channel     string    `json:"channel"` // voice | sms | mail | im | webhook
+	Priority    int       `json:"priority"`
+	Sid         int64     `json:"sid"`
+	Nid         int64     `json:"nid"`
+	NodePath    string    `json:"node_path" xorm:"-"`
+	Subject     string    `json:"subject"` // 只有mail使用
+	Content     string    `json:"content"`
+	Creator     string    `json:"creator"`
+	Created     time.Time `json:"created" xorm:"created"`
+	LastUpdator string    `json:"last_updator"`
+	LastUpdated time.Time `json:"last_updated" xorm:"<-"`
+}
+
+func (t *NotifyTpl) Validate() error {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		return fmt.Errorf("arg[name] empty")
+	}
+
+	switch t.Channel {
+	case "voice", "sms", "mail", "im", "webhook":
+	default:
+		return fmt.Errorf("arg[channel] invalid: %s", t.Channel)
+	}
+
+	if t.Priority < 0 || t.Priority > 3 {
+		return fmt.Errorf("arg[priority] invalid: %d", t.Priority)
+	}
+
+	if strings.TrimSpace(t.Content) == "" {
+		return fmt.Errorf("arg[content] empty")
+	}
+
+	return nil
+}
+
+func (t *NotifyTpl) Add() error {
+	_, err := DB["mon"].InsertOne(t)
+	return err
+}
+
+func (t *NotifyTpl) Update(cols ...string) error {
+	_, err := DB["mon"].Where("id=?", t.Id).Cols(cols...).Update(t)
+	return err
+}
+
+func NotifyTplDel(id int64) error {
+	_, err := DB["mon"].Where("id=?", id).Delete(new(NotifyTpl))
+	return err
+}
+
+func NotifyTplGet(col string, value interface{}) (*NotifyTpl, error) {
+	var obj NotifyTpl
+	has, err := DB["mon"].Where(col+"=?", value).Get(&obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return nil, nil
+	}
+
+	return &obj, nil
+}
+
+func NotifyTplGets(channel string, sid, nid int64) ([]NotifyTpl, error) {
+	session := DB["mon"].NewSession()
+	defer session.Close()
+
+	if channel != "" {
+		session = session.Where("channel=?", channel)
+	}
+
+	if sid > 0 {
+		session = session.Where("sid=?", sid)
+	}
+
+	if nid > 0 {
+		session = session.Where("nid=?", nid)
+	}
+
+	var objs []NotifyTpl
+	err := session.OrderBy("id desc").Find(&objs)
+	return objs, err
+}
+
+func NotifyTplGetAll() ([]NotifyTpl, error) {
+	var objs []NotifyTpl
+	err := DB["mon"].Find(&objs)
+	return objs, err
+}
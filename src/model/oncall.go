@@ -0,0 +1,468 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ONCALL_ROTATION_DAILY  = "daily"
+	ONCALL_ROTATION_WEEKLY = "weekly"
+
+	oncallTimeLayout = "2006-01-02 15:04"
+)
+
+// Oncall 值班表, 由多层轮值组成, 后面的层覆盖前面的层, 临时替班覆盖所有的层
+// 所有的时间都按值班表的时区计算
+type Oncall struct {
+	Id          int64         `json:"id"`
+	Name        string        `json:"name"`
+	Note        string        `json:"note"`
+	Timezone    string        `json:"timezone"` // 如 Asia/Shanghai, 为空使用本地时区
+	LayersStr   string        `json:"-" xorm:"layers"`
+	Layers      []OncallLayer `json:"layers" xorm:"-"`
+	Creator     string        `json:"creator"`
+	Created     time.Time     `json:"created" xorm:"created"`
+	LastUpdator string        `json:"last_updator"`
+	LastUpdated time.Time     `json:"last_updated" xorm:"<-"`
+}
+
+// OncallLayer 一层轮值: 从Start开始, 每Interval天(weekly为周)按Users的顺序交接一次
+// Stime/Etime/DaysOfWeek 限制该层生效的时间, 如只负责夜班, Stime大于Etime表示跨天
+type OncallLayer struct {
+	Name       string  `json:"name"`
+	Users      []int64 `json:"users"`
+	Rotation   string  `json:"rotation"` // daily | weekly
+	Interval   int     `json:"interval"`
+	Start      string  `json:"start"` // 第一次交接的时间, 2006-01-02 15:04
+	Stime      string  `json:"stime"` // 15:04, 为空不限制
+	Etime      string  `json:"etime"`
+	DaysOfWeek []int   `json:"days_of_week"` // 0-6, 0为周日, 为空不限制
+
+	start time.Time
+}
+
+// OncallOverride 临时替班, 时间区间内由UserId值班
+type OncallOverride struct {
+	Id       int64     `json:"id"`
+	OncallId int64     `json:"oncall_id"`
+	UserId   int64     `json:"user_id"`
+	Stime    int64     `json:"stime"`
+	Etime    int64     `json:"etime"`
+	Note     string    `json:"note"`
+	Creator  string    `json:"creator"`
+	Created  time.Time `json:"created" xorm:"created"`
+}
+
+// OncallPage 通知时实际呼叫的值班人
+type OncallPage struct {
+	Id       int64  `json:"id"`
+	OncallId int64  `json:"oncall_id"`
+	EventId  int64  `json:"event_id"`
+	HashId   uint64 `json:"hashid" xorm:"hashid"`
+	UserId   int64  `json:"user_id"`
+	Clock    int64  `json:"clock"`
+}
+
+// OncallShift 最终的值班安排, 时间段[Stime, Etime)
+type OncallShift struct {
+	UserId int64 `json:"user_id"`
+	Stime  int64 `json:"stime"`
+	Etime  int64 `json:"etime"`
+}
+
+func (o *Oncall) Location() (*time.Location, error) {
+	if o.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(o.Timezone)
+}
+
+func (o *Oncall) Encode() error {
+	o.Name = strings.TrimSpace(o.Name)
+	if o.Name == "" {
+		return fmt.Errorf("arg[name] empty")
+	}
+
+	loc, err := o.Location()
+	if err != nil {
+		return fmt.Errorf("unknown timezone: %s", o.Timezone)
+	}
+
+	for i := range o.Layers {
+		if err := o.Layers[i].validate(loc); err != nil {
+			return fmt.Errorf("layer[%d] %v", i, err)
+		}
+	}
+
+	bs, err := json.Marshal(o.Layers)
+	if err != nil {
+		return err
+	}
+	o.LayersStr = string(bs)
+
+	return nil
+}
+
+func (o *Oncall) Decode() error {
+	o.Layers = []OncallLayer{}
+	if o.LayersStr != "" {
+		if err := json.Unmarshal([]byte(o.LayersStr), &o.Layers); err != nil {
+			return err
+		}
+	}
+
+	loc, err := o.Location()
+	if err != nil {
+		return err
+	}
+
+	for i := range o.Layers {
+		if o.Layers[i].start, err = time.ParseInLocation(oncallTimeLayout, o.Layers[i].Start, loc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *OncallLayer) validate(loc *time.Location) error {
+	if len(l.Users) == 0 {
+		return fmt.Errorf("users empty")
+	}
+
+	switch l.Rotation {
+	case ONCALL_ROTATION_DAILY, ONCALL_ROTATION_WEEKLY:
+	default:
+		return fmt.Errorf("unknown rotation: %s", l.Rotation)
+	}
+
+	if l.Interval <= 0 {
+		l.Interval = 1
+	}
+
+	var err error
+	if l.start, err = time.ParseInLocation(oncallTimeLayout, l.Start, loc); err != nil {
+		return fmt.Errorf("illegal start: %s", l.Start)
+	}
+
+	if (l.Stime == "") != (l.Etime == "") {
+		return fmt.Errorf("stime and etime must be set together")
+	}
+
+	if l.Stime != "" {
+		if checkDurationString(l.Stime) != nil || checkDurationString(l.Etime) != nil {
+			return fmt.Errorf("illegal stime/etime: %s-%s", l.Stime, l.Etime)
+		}
+	}
+
+	for _, day := range l.DaysOfWeek {
+		if day < 0 || day > 6 {
+			return fmt.Errorf("illegal days_of_week %v", l.DaysOfWeek)
+		}
+	}
+
+	return nil
+}
+
+// days 两次交接间隔的天数
+func (l *OncallLayer) days() int {
+	if l.Rotation == ONCALL_ROTATION_WEEKLY {
+		return l.Interval * 7
+	}
+	return l.Interval
+}
+
+// handoff 第n次交接的时间, 按天计算, 夏令时切换时交接时间不变
+func (l *OncallLayer) handoff(n int) time.Time {
+	return l.start.AddDate(0, 0, n*l.days())
+}
+
+// turn t所在的轮次
+func (l *OncallLayer) turn(t time.Time) int {
+	n := int(t.Sub(l.start).Hours() / 24 / float64(l.days()))
+	for n > 0 && l.handoff(n).After(t) {
+		n--
+	}
+	for !l.handoff(n + 1).After(t) {
+		n++
+	}
+	return n
+}
+
+func (l *OncallLayer) restricted(t time.Time) bool {
+	if len(l.DaysOfWeek) > 0 {
+		found := false
+		for _, day := range l.DaysOfWeek {
+			if int(t.Weekday()) == day {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return true
+		}
+	}
+
+	if l.Stime == "" {
+		return false
+	}
+
+	now := t.Format("15:04")
+	if l.Stime <= l.Etime {
+		return now < l.Stime || now >= l.Etime
+	}
+	return now < l.Stime && now >= l.Etime
+}
+
+// userAt 该层在t时刻的值班人, 0表示该层不生效
+func (l *OncallLayer) userAt(t time.Time) int64 {
+	if len(l.Users) == 0 || t.Before(l.start) || l.restricted(t) {
+		return 0
+	}
+
+	return l.Users[l.turn(t)%len(l.Users)]
+}
+
+// UserAt t时刻的值班人, 已经Decode过; overrides中后创建的优先
+func (o *Oncall) UserAt(t time.Time, overrides []OncallOverride) int64 {
+	ts := t.Unix()
+	for i := len(overrides) - 1; i >= 0; i-- {
+		if overrides[i].Stime <= ts && ts < overrides[i].Etime {
+			return overrides[i].UserId
+		}
+	}
+
+	loc, err := o.Location()
+	if err != nil {
+		return 0
+	}
+	t = t.In(loc)
+
+	for i := len(o.Layers) - 1; i >= 0; i-- {
+		if uid := o.Layers[i].userAt(t); uid > 0 {
+			return uid
+		}
+	}
+
+	return 0
+}
+
+// Shifts [stime, etime)之间的最终值班安排, 在所有可能交接的时间点上计算值班人
+func (o *Oncall) Shifts(stime, etime int64, overrides []OncallOverride) []OncallShift {
+	loc, err := o.Location()
+	if err != nil {
+		return []OncallShift{}
+	}
+
+	points := map[int64]struct{}{stime: {}}
+	add := func(t time.Time) {
+		if ts := t.Unix(); ts > stime && ts < etime {
+			points[ts] = struct{}{}
+		}
+	}
+
+	start, end := time.Unix(stime, 0).In(loc), time.Unix(etime, 0).In(loc)
+	for i := range o.Layers {
+		l := &o.Layers[i]
+		add(l.start)
+
+		if !end.Before(l.start) {
+			n := 0
+			if start.After(l.start) {
+				n = l.turn(start)
+			}
+			for ; !l.handoff(n).After(end); n++ {
+				add(l.handoff(n))
+			}
+		}
+
+		if len(l.DaysOfWeek) == 0 && l.Stime == "" {
+			continue
+		}
+
+		for day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc); !day.After(end); day = day.AddDate(0, 0, 1) {
+			add(day)
+			for _, hm := range []string{l.Stime, l.Etime} {
+				if t, err := time.ParseInLocation(oncallTimeLayout, day.Format("2006-01-02")+" "+hm, loc); err == nil {
+					add(t)
+				}
+			}
+		}
+	}
+
+	for i := range overrides {
+		add(time.Unix(overrides[i].Stime, 0))
+		add(time.Unix(overrides[i].Etime, 0))
+	}
+
+	list := make([]int64, 0, len(points))
+	for ts := range points {
+		list = append(list, ts)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+
+	shifts := []OncallShift{}
+	for _, ts := range list {
+		uid := o.UserAt(time.Unix(ts, 0), overrides)
+		n := len(shifts)
+		if n > 0 && shifts[n-1].UserId == uid {
+			continue
+		}
+
+		if n > 0 {
+			shifts[n-1].Etime = ts
+		}
+		shifts = append(shifts, OncallShift{UserId: uid, Stime: ts, Etime: etime})
+	}
+
+	// 没有人值班的时间段不返回
+	ret := make([]OncallShift, 0, len(shifts))
+	for i := range shifts {
+		if shifts[i].UserId > 0 {
+			ret = append(ret, shifts[i])
+		}
+	}
+
+	return ret
+}
+
+func (o *Oncall) Add() error {
+	_, err := DB["mon"].InsertOne(o)
+	return err
+}
+
+func (o *Oncall) Update(cols ...string) error {
+	_, err := DB["mon"].Where("id=?", o.Id).Cols(cols...).Update(o)
+	return err
+}
+
+func OncallDel(id int64) error {
+	session := DB["mon"].NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	if _, err := session.Where("oncall_id=?", id).Delete(new(OncallOverride)); err != nil {
+		session.Rollback()
+		return err
+	}
+
+	if _, err := session.Where("id=?", id).Delete(new(Oncall)); err != nil {
+		session.Rollback()
+		return err
+	}
+
+	return session.Commit()
+}
+
+func OncallGet(col string, value interface{}) (*Oncall, error) {
+	var obj Oncall
+	has, err := DB["mon"].Where(col+"=?", value).Get(&obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return nil, nil
+	}
+
+	return &obj, obj.Decode()
+}
+
+func OncallGets(query string) ([]Oncall, error) {
+	session := DB["mon"].NewSession()
+	defer session.Close()
+
+	if query != "" {
+		q := "%" + query + "%"
+		session = session.Where("name like ? or note like ?", q, q)
+	}
+
+	var objs []Oncall
+	if err := session.OrderBy("name").Find(&objs); err != nil {
+		return nil, err
+	}
+
+	for i := range objs {
+		if err := objs[i].Decode(); err != nil {
+			return nil, err
+		}
+	}
+
+	return objs, nil
+}
+
+// OncallUserAt 值班表在t时刻的值班人, 0表示没有人值班
+func OncallUserAt(id int64, t time.Time) (int64, error) {
+	oncall, err := OncallGet("id", id)
+	if err != nil {
+		return 0, err
+	}
+
+	if oncall == nil {
+		return 0, fmt.Errorf("no such oncall[%d]", id)
+	}
+
+	overrides, err := OncallOverrideGets(id, t.Unix(), t.Unix()+1)
+	if err != nil {
+		return 0, err
+	}
+
+	return oncall.UserAt(t, overrides), nil
+}
+
+func (o *OncallOverride) Add() error {
+	if o.UserId <= 0 {
+		return fmt.Errorf("arg[user_id] empty")
+	}
+
+	if o.Stime >= o.Etime {
+		return fmt.Errorf("stime must be less than etime")
+	}
+
+	_, err := DB["mon"].InsertOne(o)
+	return err
+}
+
+func OncallOverrideDel(oncallId, id int64) error {
+	_, err := DB["mon"].Where("id=? and oncall_id=?", id, oncallId).Delete(new(OncallOverride))
+	return err
+}
+
+// OncallOverrideGets 和[stime, etime)有交集的替班, 按创建顺序返回
+func OncallOverrideGets(oncallId, stime, etime int64) ([]OncallOverride, error) {
+	var objs []OncallOverride
+	err := DB["mon"].Where("oncall_id=? and stime<? and etime>?", oncallId, etime, stime).OrderBy("id").Find(&objs)
+	return objs, err
+}
+
+func OncallPagesSave(pages []*OncallPage) error {
+	if len(pages) == 0 {
+		return nil
+	}
+
+	_, err := DB["mon"].Insert(pages)
+	return err
+}
+
+func OncallPageTotal(oncallId, stime, etime int64) (int64, error) {
+	return DB["mon"].Where("oncall_id=? and clock>=? and clock<?", oncallId, stime, etime).Count(new(OncallPage))
+}
+
+func OncallPageGets(oncallId, stime, etime int64, limit, offset int) ([]OncallPage, error) {
+	var objs []OncallPage
+	err := DB["mon"].Where("oncall_id=? and clock>=? and clock<?", oncallId, stime, etime).OrderBy("id desc").Limit(limit, offset).Find(&objs)
+	return objs, err
+}
+
+// OncallPageGetsByEvent 事件通知时呼叫的值班人
+func OncallPageGetsByEvent(eventId int64) ([]OncallPage, error) {
+	var objs []OncallPage
+	err := DB["mon"].Where("event_id=?", eventId).Find(&objs)
+	return objs, err
+}
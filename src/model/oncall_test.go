@@ -0,0 +1,66 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_OncallUserAt(t *testing.T) {
+	o := &Oncall{
+		Name:     "sre",
+		Timezone: "UTC",
+		Layers: []OncallLayer{
+			{Users: []int64{1, 2, 3}, Rotation: ONCALL_ROTATION_DAILY, Start: "2020-01-01 09:00"},
+			// 第二层只负责周末
+			{Users: []int64{10, 11}, Rotation: ONCALL_ROTATION_WEEKLY, Start: "2020-01-04 00:00", DaysOfWeek: []int{0, 6}},
+		},
+	}
+	if err := o.Encode(); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Decode(); err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(s string) time.Time {
+		ts, _ := time.ParseInLocation(oncallTimeLayout, s, time.UTC)
+		return ts
+	}
+
+	cases := map[string]int64{
+		"2020-01-01 08:59": 0,
+		"2020-01-01 09:00": 1,
+		"2020-01-02 08:59": 1,
+		"2020-01-02 09:00": 2,
+		"2020-01-03 12:00": 3,
+		"2020-01-04 12:00": 10, // 周六
+		"2020-01-06 12:00": 3,  // 周一, 第一层的第5轮
+		"2020-01-11 12:00": 11,
+	}
+	for s, expect := range cases {
+		if uid := o.UserAt(at(s), nil); uid != expect {
+			t.Fatalf("user at %s: got %d, expect %d", s, uid, expect)
+		}
+	}
+
+	overrides := []OncallOverride{{UserId: 99, Stime: at("2020-01-02 10:00").Unix(), Etime: at("2020-01-02 12:00").Unix()}}
+	if uid := o.UserAt(at("2020-01-02 11:00"), overrides); uid != 99 {
+		t.Fatalf("override: got %d, expect 99", uid)
+	}
+
+	shifts := o.Shifts(at("2020-01-02 00:00").Unix(), at("2020-01-03 00:00").Unix(), overrides)
+	expects := []OncallShift{
+		{UserId: 1, Stime: at("2020-01-02 00:00").Unix(), Etime: at("2020-01-02 09:00").Unix()},
+		{UserId: 2, Stime: at("2020-01-02 09:00").Unix(), Etime: at("2020-01-02 10:00").Unix()},
+		{UserId: 99, Stime: at("2020-01-02 10:00").Unix(), Etime: at("2020-01-02 12:00").Unix()},
+		{UserId: 2, Stime: at("2020-01-02 12:00").Unix(), Etime: at("2020-01-03 00:00").Unix()},
+	}
+	if len(shifts) != len(expects) {
+		t.Fatalf("shifts: got %+v, expect %+v", shifts, expects)
+	}
+	for i := range shifts {
+		if shifts[i] != expects[i] {
+			t.Fatalf("shift[%d]: got %+v, expect %+v", i, shifts[i], expects[i])
+		}
+	}
+}
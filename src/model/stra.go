@@ -28,12 +28,15 @@ type Stra struct {
 	Callback            string    `json:"callback"`
 	NotifyGroupStr      string    `xorm:"notify_group" json:"-"`
 	NotifyUserStr       string    `xorm:"notify_user" json:"-"`
+	NotifyOncallStr     string    `xorm:"notify_oncall" json:"-"`
+	NotifyWebhookStr    string    `xorm:"notify_webhook" json:"-"`
 	Creator             string    `json:"creator"`
 	Created             time.Time `xorm:"created" json:"created"`
 	LastUpdator         string    `xorm:"last_updator" json:"last_updator"`
 	LastUpdated         time.Time `xorm:"<-" json:"last_updated"`
 	NeedUpgrade         int       `xorm:"need_upgrade" json:"need_upgrade"`
 	AlertUpgradeStr     string    `xorm:"alert_upgrade" json:"-"`
+	EscalationId        int64     `xorm:"escalation_id" json:"escalation_id"` //升级策略id, 不为0时代替alert_upgrade
 
 	ExclNid          []int64      `xorm:"-" json:"excl_nid"`
 	Exprs            []Exp        `xorm:"-" json:"exprs"`
@@ -42,7 +45,9 @@ type Stra struct {
 	Converge         []int        `xorm:"-" json:"converge"`
 	NotifyGroup      []int        `xorm:"-" json:"notify_group"`
 	NotifyUser       []int        `xorm:"-" json:"notify_user"`
-	LeafNids         []int64      `xorm:"-" json:"leaf_nids"` //叶子节点id
+	NotifyOncall     []int64      `xorm:"-" json:"notify_oncall"`  //值班表id
+	NotifyWebhook    []int64      `xorm:"-" json:"notify_webhook"` //webhook id
+	LeafNids         []int64      `xorm:"-" json:"leaf_nids"`      //叶子节点id
 	Endpoints        []string     `xorm:"-" json:"endpoints"`
 	AlertUpgrade     AlertUpgrade `xorm:"-" json:"alert_upgrade"`
 }
@@ -58,10 +63,12 @@ type StraLog struct {
 
 type Exp struct {
 	Eopt      string  `json:"eopt"`
-	Func      string  `json:"func"`      //all,max,min
-	Metric    string  `json:"metric"`    //metric
+	Func      string  `json:"func"`      //all,max,min; 同比: c_avg,c_avg_abs,c_avg_rate,c_avg_rate_abs等, params[0]为对比的时间偏移(s); 模型: ewma[_abs](params[0]为训练窗口(s)), holtwinters[_abs](params为周期(s)和周期个数), 阈值为k-sigma中的k
+	Metric    string  `json:"metric"`    //metric, expression不为空时是运算结果的指标名
 	Params    []int   `json:"params"`    //连续n秒
 	Threshold float64 `json:"threshold"` //阈值
+
+	Expression string `json:"expression,omitempty"` //多指标的四则运算, 如 errors / requests * 100, 按endpoint和tags对齐
 }
 
 type Tag struct {
@@ -363,7 +370,7 @@ func (s *Stra) Encode() error {
 	err = json.Unmarshal(exprs, &exprsTmp)
 	for _, exp := range exprsTmp {
 		if _, found := MathOperators[exp.Eopt]; !found {
-			return fmt.Errorf("unknown exp.eopt:%s", exp)
+			return fmt.Errorf("unknown exp.eopt:%s", exp.Eopt)
 		}
 	}
 
@@ -426,6 +433,24 @@ func (s *Stra) Encode() error {
 	}
 	s.NotifyUserStr = string(notifyUser)
 
+	if s.NotifyOncall == nil {
+		s.NotifyOncall = []int64{}
+	}
+	notifyOncall, err := json.Marshal(s.NotifyOncall)
+	if err != nil {
+		return err
+	}
+	s.NotifyOncallStr = string(notifyOncall)
+
+	if s.NotifyWebhook == nil {
+		s.NotifyWebhook = []int64{}
+	}
+	notifyWebhook, err := json.Marshal(s.NotifyWebhook)
+	if err != nil {
+		return err
+	}
+	s.NotifyWebhookStr = string(notifyWebhook)
+
 	return nil
 }
 
@@ -472,6 +497,22 @@ func (s *Stra) Decode() error {
 		return err
 	}
 
+	s.NotifyOncall = []int64{}
+	if s.NotifyOncallStr != "" {
+		err = json.Unmarshal([]byte(s.NotifyOncallStr), &s.NotifyOncall)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.NotifyWebhook = []int64{}
+	if s.NotifyWebhookStr != "" {
+		err = json.Unmarshal([]byte(s.NotifyWebhookStr), &s.NotifyWebhook)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -479,22 +520,22 @@ func (s *Stra) Decode() error {
 func checkDurationString(str string) error {
 	slice := strings.Split(str, ":")
 	if len(slice) != 2 {
-		return fmt.Errorf("illegal duration", str)
+		return fmt.Errorf("illegal duration: %s", str)
 	}
 
 	hour, err := strconv.Atoi(slice[0])
 	if err != nil {
-		return fmt.Errorf("illegal duration", str)
+		return fmt.Errorf("illegal duration: %s", str)
 	}
 	if hour < 0 || hour > 23 {
-		return fmt.Errorf("illegal duration", str)
+		return fmt.Errorf("illegal duration: %s", str)
 	}
 	minute, err := strconv.Atoi(slice[1])
 	if err != nil {
-		return fmt.Errorf("illegal duration", str)
+		return fmt.Errorf("illegal duration: %s", str)
 	}
 	if minute < 0 || minute > 59 {
-		return fmt.Errorf("illegal duration", str)
+		return fmt.Errorf("illegal duration: %s", str)
 	}
 
 	return nil
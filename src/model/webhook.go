@@ -0,0 +1,278 @@
+package model
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-xorm/xorm"
+)
+
+// 死信的状态: dead -> pending(请求重放) -> replayed(sender已经重新投递, 失败会产生新的死信)
+const (
+	WEBHOOK_DEAD     = "dead"
+	WEBHOOK_PENDING  = "pending"
+	WEBHOOK_REPLAYED = "replayed"
+)
+
+// Webhook 通知的webhook通道, 策略中配置, 由sender投递
+// Body为空时使用webhook通道的通知模板渲染的内容作为请求的body
+type Webhook struct {
+	Id          int64             `json:"id"`
+	Name        string            `json:"name"`
+	Note        string            `json:"note"`
+	Url         string            `json:"url"`
+	HeadersStr  string            `json:"-" xorm:"headers"`
+	Headers     map[string]string `json:"headers" xorm:"-"`
+	Secret      string            `json:"secret,omitempty"` // 不为空时对请求签名
+	Body        string            `json:"body"`
+	Timeout     int               `json:"timeout"` // 单位毫秒, 0使用sender的配置
+	Creator     string            `json:"creator"`
+	Created     time.Time         `json:"created" xorm:"created"`
+	LastUpdator string            `json:"last_updator"`
+	LastUpdated time.Time         `json:"last_updated" xorm:"<-"`
+}
+
+// WebhookDeadLetter 重试之后仍然失败的投递, 修复之后可以重放
+type WebhookDeadLetter struct {
+	Id        int64  `json:"id"`
+	WebhookId int64  `json:"webhook_id"`
+	NotifyId  int64  `json:"notify_id"`
+	Url       string `json:"url"`
+	Body      string `json:"body"`
+	Attempts  int    `json:"attempts"`
+	Error     string `json:"error"`
+	Status    string `json:"status"`
+	Clock     int64  `json:"clock"`
+	Replayed  int64  `json:"replayed"`
+	Replayer  string `json:"replayer"`
+}
+
+func (w *Webhook) Encode() error {
+	w.Name = strings.TrimSpace(w.Name)
+	if w.Name == "" {
+		return fmt.Errorf("arg[name] empty")
+	}
+
+	w.Url = strings.TrimSpace(w.Url)
+	if !(strings.HasPrefix(w.Url, "http://") || strings.HasPrefix(w.Url, "https://")) {
+		return fmt.Errorf("illegal url: %s", w.Url)
+	}
+
+	if w.Timeout < 0 {
+		return fmt.Errorf("illegal timeout: %d", w.Timeout)
+	}
+
+	if w.Headers == nil {
+		w.Headers = map[string]string{}
+	}
+
+	for k := range w.Headers {
+		if strings.TrimSpace(k) == "" {
+			return fmt.Errorf("header name empty")
+		}
+
+		// 签名相关的请求头由sender生成
+		if strings.HasPrefix(http.CanonicalHeaderKey(k), "X-Falcon-") {
+			return fmt.Errorf("header %s is reserved", k)
+		}
+	}
+
+	bs, err := json.Marshal(w.Headers)
+	if err != nil {
+		return err
+	}
+	w.HeadersStr = string(bs)
+
+	return nil
+}
+
+func (w *Webhook) Decode() error {
+	w.Headers = map[string]string{}
+	if w.HeadersStr == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(w.HeadersStr), &w.Headers)
+}
+
+func (w *Webhook) Add() error {
+	cnt, err := DB["mon"].Where("name=?", w.Name).Count(new(Webhook))
+	if err != nil {
+		return err
+	}
+
+	if cnt > 0 {
+		return fmt.Errorf("webhook[%s] already exists", w.Name)
+	}
+
+	_, err = DB["mon"].InsertOne(w)
+	return err
+}
+
+func (w *Webhook) Update(cols ...string) error {
+	cnt, err := DB["mon"].Where("name=? and id<>?", w.Name, w.Id).Count(new(Webhook))
+	if err != nil {
+		return err
+	}
+
+	if cnt > 0 {
+		return fmt.Errorf("webhook[%s] already exists", w.Name)
+	}
+
+	_, err = DB["mon"].Where("id=?", w.Id).Cols(cols...).Update(w)
+	return err
+}
+
+func WebhookDel(id int64) error {
+	cnt, err := DB["mon"].Where("notify_webhook like ?", fmt.Sprintf("%%%d%%", id)).Count(new(Stra))
+	if err != nil {
+		return err
+	}
+
+	// like只能粗略过滤, 需要逐个确认
+	if cnt > 0 {
+		var stras []Stra
+		if err := DB["mon"].Where("notify_webhook like ?", fmt.Sprintf("%%%d%%", id)).Cols("id", "notify_webhook").Find(&stras); err != nil {
+			return err
+		}
+
+		for i := range stras {
+			var ids []int64
+			if err := json.Unmarshal([]byte(stras[i].NotifyWebhookStr), &ids); err != nil {
+				continue
+			}
+
+			for _, wid := range ids {
+				if wid == id {
+					return fmt.Errorf("webhook is used by strategy[%d]", stras[i].Id)
+				}
+			}
+		}
+	}
+
+	_, err = DB["mon"].Where("id=?", id).Delete(new(Webhook))
+	return err
+}
+
+func WebhookGet(col string, value interface{}) (*Webhook, error) {
+	var obj Webhook
+	has, err := DB["mon"].Where(col+"=?", value).Get(&obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return nil, nil
+	}
+
+	return &obj, obj.Decode()
+}
+
+func WebhookGets(query string) ([]Webhook, error) {
+	session := DB["mon"].NewSession()
+	defer session.Close()
+
+	if query != "" {
+		q := "%" + query + "%"
+		session = session.Where("name like ? or note like ? or url like ?", q, q, q)
+	}
+
+	var objs []Webhook
+	if err := session.OrderBy("name").Find(&objs); err != nil {
+		return nil, err
+	}
+
+	for i := range objs {
+		if err := objs[i].Decode(); err != nil {
+			return nil, err
+		}
+	}
+
+	return objs, nil
+}
+
+func WebhookGetAll() ([]Webhook, error) {
+	return WebhookGets("")
+}
+
+func (d *WebhookDeadLetter) Add() error {
+	_, err := DB["mon"].InsertOne(d)
+	return err
+}
+
+// Replay 请求重放, 由sender重新投递; 已经请求过的返回false
+func (d *WebhookDeadLetter) Replay(replayer string) (bool, error) {
+	return d.setStatus(WEBHOOK_DEAD, WEBHOOK_PENDING, replayer)
+}
+
+// Claim sender重新投递之前抢占, 多个sender实例只有一个能抢占成功
+func (d *WebhookDeadLetter) Claim() (bool, error) {
+	return d.setStatus(WEBHOOK_PENDING, WEBHOOK_REPLAYED, d.Replayer)
+}
+
+func (d *WebhookDeadLetter) setStatus(from, to, replayer string) (bool, error) {
+	obj := WebhookDeadLetter{
+		Status:   to,
+		Replayed: time.Now().Unix(),
+		Replayer: replayer,
+	}
+
+	num, err := DB["mon"].Where("id=? and status=?", d.Id, from).Cols("status", "replayed", "replayer").Update(&obj)
+	if err != nil || num == 0 {
+		return false, err
+	}
+
+	d.Status, d.Replayed, d.Replayer = obj.Status, obj.Replayed, obj.Replayer
+	return true, nil
+}
+
+func WebhookDeadLetterPending(limit int) ([]WebhookDeadLetter, error) {
+	var objs []WebhookDeadLetter
+	err := DB["mon"].Where("status=?", WEBHOOK_PENDING).OrderBy("id").Limit(limit).Find(&objs)
+	return objs, err
+}
+
+func WebhookDeadLetterGet(id int64) (*WebhookDeadLetter, error) {
+	var obj WebhookDeadLetter
+	has, err := DB["mon"].Where("id=?", id).Get(&obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return nil, nil
+	}
+
+	return &obj, nil
+}
+
+func webhookDeadLetterSession(webhookId int64, status string) *xorm.Session {
+	session := DB["mon"].NewSession()
+	if webhookId > 0 {
+		session = session.Where("webhook_id=?", webhookId)
+	}
+
+	if status != "" {
+		session = session.Where("status=?", status)
+	}
+
+	return session
+}
+
+// WebhookDeadLetterTotal webhookId为0或status为空时不过滤
+func WebhookDeadLetterTotal(webhookId int64, status string) (int64, error) {
+	session := webhookDeadLetterSession(webhookId, status)
+	defer session.Close()
+
+	return session.Count(new(WebhookDeadLetter))
+}
+
+func WebhookDeadLetterGets(webhookId int64, status string, limit, offset int) ([]WebhookDeadLetter, error) {
+	session := webhookDeadLetterSession(webhookId, status)
+	defer session.Close()
+
+	var objs []WebhookDeadLetter
+	err := session.OrderBy("id desc").Limit(limit, offset).Find(&objs)
+	return objs, err
+}
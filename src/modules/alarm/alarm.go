@@ -65,14 +65,35 @@ func main() {
 		log.Fatalf("sync stra failed, err: %v", err)
 	}
 
+	if err := cron.SyncInhibit(); err != nil {
+		log.Fatalf("sync inhibit failed, err: %v", err)
+	}
+
+	if err := cron.SyncNotifyTpl(); err != nil {
+		log.Fatalf("sync notify tpl failed, err: %v", err)
+	}
+
+	if err := cron.SyncEscalation(); err != nil {
+		log.Fatalf("sync escalation failed, err: %v", err)
+	}
+
+	if err := cron.SyncWebhook(); err != nil {
+		log.Fatalf("sync webhook failed, err: %v", err)
+	}
+
 	redi.InitRedis()
 	go cron.SyncMaskconfLoop()
 	go cron.SyncStraLoop()
+	go cron.SyncInhibitLoop()
+	go cron.SyncNotifyTplLoop()
+	go cron.SyncEscalationLoop()
+	go cron.SyncWebhookLoop()
 	go cron.ReadHighEvent()
 	go cron.ReadLowEvent()
 	go cron.CallbackConsumer()
 	go cron.MergeEvent()
 	go cron.CleanEventLoop()
+	go cron.EscalateLoop()
 
 	http.Start()
 	ending()
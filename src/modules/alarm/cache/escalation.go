@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"sync"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+)
+
+type EscalationCacheMap struct {
+	sync.RWMutex
+	Data map[int64]*model.Escalation
+}
+
+var EscalationCache *EscalationCacheMap
+
+func NewEscalationCache() *EscalationCacheMap {
+	return &EscalationCacheMap{
+		Data: make(map[int64]*model.Escalation),
+	}
+}
+
+func (this *EscalationCacheMap) SetAll(m map[int64]*model.Escalation) {
+	this.Lock()
+	defer this.Unlock()
+	this.Data = m
+}
+
+func (this *EscalationCacheMap) GetById(id int64) (*model.Escalation, bool) {
+	this.RLock()
+	defer this.RUnlock()
+
+	value, exists := this.Data[id]
+	return value, exists
+}
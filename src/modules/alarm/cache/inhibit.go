@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"sync"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+)
+
+// InhibitRule 抑制规则, tags已经展开, 格式同屏蔽规则
+type InhibitRule struct {
+	*model.Inhibit
+	SrcSids map[int64]struct{}
+	SrcTags []string
+	TgtSids map[int64]struct{}
+	TgtTags []string
+}
+
+type InhibitCacheList struct {
+	sync.RWMutex
+	Data []*InhibitRule
+}
+
+var InhibitCache *InhibitCacheList
+
+func NewInhibitCache() *InhibitCacheList {
+	return &InhibitCacheList{
+		Data: make([]*InhibitRule, 0),
+	}
+}
+
+func (this *InhibitCacheList) SetAll(rules []*InhibitRule) {
+	this.Lock()
+	defer this.Unlock()
+	this.Data = rules
+}
+
+func (this *InhibitCacheList) GetAll() []*InhibitRule {
+	this.RLock()
+	defer this.RUnlock()
+
+	return this.Data
+}
@@ -3,4 +3,8 @@ package cache
 func Init() {
 	MaskCache = NewMaskCache()
 	StraCache = NewStraCache()
+	InhibitCache = NewInhibitCache()
+	NotifyTplCache = NewNotifyTplCache()
+	EscalationCache = NewEscalationCache()
+	WebhookCache = NewWebhookCache()
 }
@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"sync"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+)
+
+// NotifyTplCacheMap channel -> 该通道的所有模板, 模板的NodePath已经填充
+type NotifyTplCacheMap struct {
+	sync.RWMutex
+	Data map[string][]*model.NotifyTpl
+}
+
+var NotifyTplCache *NotifyTplCacheMap
+
+func NewNotifyTplCache() *NotifyTplCacheMap {
+	return &NotifyTplCacheMap{
+		Data: make(map[string][]*model.NotifyTpl),
+	}
+}
+
+func (this *NotifyTplCacheMap) SetAll(m map[string][]*model.NotifyTpl) {
+	this.Lock()
+	defer this.Unlock()
+	this.Data = m
+}
+
+func (this *NotifyTplCacheMap) Get(channel string) []*model.NotifyTpl {
+	this.RLock()
+	defer this.RUnlock()
+
+	return this.Data[channel]
+}
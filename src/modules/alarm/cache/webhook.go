@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"sync"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+)
+
+type WebhookCacheMap struct {
+	sync.RWMutex
+	Data map[int64]*model.Webhook
+}
+
+var WebhookCache *WebhookCacheMap
+
+func NewWebhookCache() *WebhookCacheMap {
+	return &WebhookCacheMap{
+		Data: make(map[int64]*model.Webhook),
+	}
+}
+
+func (this *WebhookCacheMap) SetAll(m map[int64]*model.Webhook) {
+	this.Lock()
+	defer this.Unlock()
+	this.Data = m
+}
+
+func (this *WebhookCacheMap) GetById(id int64) (*model.Webhook, bool) {
+	this.RLock()
+	defer this.RUnlock()
+
+	value, exists := this.Data[id]
+	return value, exists
+}
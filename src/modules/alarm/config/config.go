@@ -27,6 +27,12 @@ type CfgYml struct {
 	Link     LinkSection         `yaml:"link"`
 	Cleaner  CleanerSection      `yaml:"cleaner"`
 	Merge    MergeSection        `yaml:"merge"`
+	Escalate EscalateSection     `yaml:"escalate"`
+}
+
+// 检查升级策略的间隔, 单位秒, 升级的精度受此影响
+type EscalateSection struct {
+	Interval int `yaml:"interval"`
 }
 
 type MergeSection struct {
@@ -57,9 +63,25 @@ type ServerSection struct {
 }
 
 type QueueSection struct {
-	High     []interface{} `yaml:"high"`
-	Low      []interface{} `yaml:"low"`
-	Callback string        `yaml:"callback"`
+	Type     string            `yaml:"type"` // 事件从哪里读取: redis(默认) | nsq | kafka
+	High     []interface{}     `yaml:"high"`
+	Low      []interface{}     `yaml:"low"`
+	Callback string            `yaml:"callback"`
+	Nsq      NsqQueueSection   `yaml:"nsq"`
+	Kafka    KafkaQueueSection `yaml:"kafka"`
+}
+
+// nsq/kafka的topic由high/low中的队列名转换而来, 如/falcon-ng/event/p1 -> falcon-ng.event.p1
+type NsqQueueSection struct {
+	Lookupds []string `yaml:"lookupds"`
+	Chan     string   `yaml:"chan"`
+}
+
+// 通过kafka rest proxy消费
+type KafkaQueueSection struct {
+	Addr    string `yaml:"addr"`
+	Group   string `yaml:"group"`
+	Timeout int    `yaml:"timeout"` // 单位ms
 }
 
 type RedisSection struct {
@@ -103,6 +125,26 @@ func ParseCfg(ymlfile string) error {
 		return fmt.Errorf("cannot read yml[%s]: %v", ymlfile, err)
 	}
 
+	if c.Queue.Type == "" {
+		c.Queue.Type = "redis"
+	}
+
+	if c.Queue.Nsq.Chan == "" {
+		c.Queue.Nsq.Chan = "alarm"
+	}
+
+	if c.Queue.Kafka.Group == "" {
+		c.Queue.Kafka.Group = "alarm"
+	}
+
+	if c.Queue.Kafka.Timeout <= 0 {
+		c.Queue.Kafka.Timeout = 5000
+	}
+
+	if c.Escalate.Interval <= 0 {
+		c.Escalate.Interval = 10
+	}
+
 	lock.Lock()
 	defer lock.Unlock()
 	cfgYml = &c
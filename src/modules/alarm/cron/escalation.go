@@ -0,0 +1,288 @@
+package cron
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/toolkits/pkg/logger"
+	"github.com/toolkits/pkg/slice"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/cache"
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/config"
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/notify"
+)
+
+// 升级: 报警产生后一直没有被认领, 按升级策略的步骤依次通知, 认领/忽略/恢复/所有轮次执行完之后停止
+// 策略没有指定升级策略时, 之前的告警升级配置(alert_upgrade)作为只有一步的升级策略执行
+
+func SyncEscalationLoop() {
+	interval := config.GetCfgYml().Interval
+	for {
+		SyncEscalation()
+		time.Sleep(time.Second * time.Duration(interval))
+	}
+}
+
+func SyncEscalation() error {
+	objs, err := model.EscalationGetAll()
+	if err != nil {
+		logger.Errorf("get escalation fail, err: %v", err)
+		return err
+	}
+
+	m := make(map[int64]*model.Escalation, len(objs))
+	for i := 0; i < len(objs); i++ {
+		m[objs[i].Id] = &objs[i]
+	}
+
+	cache.EscalationCache.SetAll(m)
+
+	return nil
+}
+
+func EscalateLoop() {
+	for {
+		time.Sleep(time.Second * time.Duration(config.GetCfgYml().Escalate.Interval))
+		Escalate()
+	}
+}
+
+func Escalate() {
+	// 忽略, 认领和升级已经停止的报警在sql中过滤掉
+	curs, err := model.EventCurGetsToEscalate()
+	if err != nil {
+		logger.Errorf("get event_cur failed, err: %v", err)
+		return
+	}
+
+	ids := make([]int64, 0, len(curs))
+	policies := make(map[int64]*model.Escalation, len(curs))
+	escalationIds := make(map[int64]int64, len(curs))
+	for i := 0; i < len(curs); i++ {
+		if isClaimed(&curs[i]) {
+			continue
+		}
+
+		escalationId, policy := escalationOf(&curs[i])
+		if policy == nil {
+			continue
+		}
+
+		ids = append(ids, curs[i].Id)
+		policies[curs[i].Id] = policy
+		escalationIds[curs[i].Id] = escalationId
+	}
+
+	if len(ids) == 0 {
+		return
+	}
+
+	logs, err := model.EscalationLogGetsByCurIds(ids)
+	if err != nil {
+		logger.Errorf("get escalation_log failed, err: %v", err)
+		return
+	}
+
+	now := time.Now().Unix()
+	for i := 0; i < len(curs); i++ {
+		cur := &curs[i]
+		policy, has := policies[cur.Id]
+		if !has {
+			continue
+		}
+
+		curLogs := logs[cur.Id]
+		if n := len(curLogs); n > 0 && curLogs[n-1].IsStop() {
+			continue
+		}
+
+		round, step, delay, ok := policy.Due(len(curLogs))
+		if !ok {
+			if err := model.EscalationLogStop(curLogs, model.ESCALATION_FINISHED, "[]"); err != nil {
+				logger.Errorf("stop escalation failed, event_cur: %d, err: %v", cur.Id, err)
+			}
+			continue
+		}
+
+		if now < cur.Created.Unix()+delay {
+			continue
+		}
+
+		escalate(cur, escalationIds[cur.Id], &policy.Steps[step], round, step)
+	}
+}
+
+// escalate 先记录, 记录成功(没有被其他alarm实例处理)之后再通知
+func escalate(cur *model.EventCur, escalationId int64, step *model.EscalationStep, round, idx int) {
+	event, err := model.EventGetLastAlert(cur.HashId)
+	if err != nil || event == nil {
+		logger.Errorf("get last alert event failed, event_cur: %d, err: %v", cur.Id, err)
+		return
+	}
+
+	if step.Priority > 0 {
+		event.Priority = step.Priority
+	}
+
+	channels := step.Channels
+	if len(channels) == 0 {
+		channels = config.GetCfgYml().Notify[fmt.Sprintf("p%v", event.Priority)]
+	}
+	bs, _ := json.Marshal(channels)
+
+	log := &model.EscalationLog{
+		EscalationId: escalationId,
+		EventCurId:   cur.Id,
+		HashId:       cur.HashId,
+		Stime:        cur.Created.Unix(),
+		Round:        round,
+		Step:         idx,
+		Action:       model.ESCALATION_NOTIFY,
+		Users:        "[]",
+		Channels:     string(bs),
+		Priority:     event.Priority,
+		Clock:        time.Now().Unix(),
+	}
+
+	added, err := model.EscalationLogAdd(log)
+	if err != nil {
+		logger.Errorf("add escalation_log failed, log: %+v, err: %v", log, err)
+		return
+	}
+
+	if !added {
+		return
+	}
+
+	userIds, err := notify.EscalationUserIds(step, []*model.Event{event})
+	if err != nil {
+		logger.Errorf("get escalation users failed, event: %+v, err: %v", event, err)
+	}
+
+	bs, _ = json.Marshal(userIds)
+	log.Users = string(bs)
+	if err := log.Update("users"); err != nil {
+		logger.Errorf("update escalation_log failed, log: %+v, err: %v", log, err)
+	}
+
+	if step.Priority > 0 && step.Priority != cur.Priority {
+		if err := model.UpdateEventCurPriority(cur.HashId, step.Priority); err != nil {
+			logger.Errorf("UpdateEventCurPriority failed, err: %v, event: %+v", err, event)
+		}
+
+		if err := model.UpdateEventPriority(event.Id, step.Priority); err != nil {
+			logger.Errorf("UpdateEventPriority failed, err: %v, event: %+v", err, event)
+		}
+	}
+
+	logger.Infof("escalate event, round: %d, step: %d, users: %v, event: %+v", round, idx, userIds, event)
+	SetEventStatus(event, model.STATUS_UPGRADE)
+
+	go notify.DoEscalate(userIds, channels, event)
+	SetEventStatus(event, model.STATUS_SEND)
+}
+
+// stopEscalation 报警恢复, 停止升级, 并通知升级过程中通知过的人
+func stopEscalation(event *model.Event, notifyRecovery bool) {
+	logs, err := model.EscalationLogGetsByEvent(event)
+	if err != nil {
+		logger.Errorf("get escalation_log failed, event: %+v, err: %v", event, err)
+		return
+	}
+
+	if len(logs) == 0 {
+		return
+	}
+
+	if err := model.EscalationLogStop(logs, model.ESCALATION_RECOVERED, "[]"); err != nil {
+		logger.Errorf("stop escalation failed, event: %+v, err: %v", event, err)
+	}
+
+	if !notifyRecovery {
+		return
+	}
+
+	userIds := []int64{}
+	channels := []string{}
+	for i := 0; i < len(logs); i++ {
+		if logs[i].Action != model.ESCALATION_NOTIFY {
+			continue
+		}
+
+		var ids []int64
+		if err := json.Unmarshal([]byte(logs[i].Users), &ids); err == nil {
+			userIds = append(userIds, ids...)
+		}
+
+		var chs []string
+		if err := json.Unmarshal([]byte(logs[i].Channels), &chs); err == nil {
+			channels = append(channels, chs...)
+		}
+	}
+
+	go notify.DoEscalate(slice.UniqueInt64(userIds), config.Set(channels), event)
+}
+
+// escalationOf 报警对应的升级策略
+func escalationOf(cur *model.EventCur) (int64, *model.Escalation) {
+	stra, has := cache.StraCache.GetById(cur.Sid)
+	if !has {
+		return 0, nil
+	}
+
+	if stra.EscalationId > 0 {
+		policy, has := cache.EscalationCache.GetById(stra.EscalationId)
+		if !has {
+			logger.Warningf("escalation not found, stra: %d, escalation: %d", stra.ID, stra.EscalationId)
+			return 0, nil
+		}
+		return policy.Id, policy
+	}
+
+	if cur.NeedUpgrade != 1 {
+		return 0, nil
+	}
+
+	return 0, legacyEscalation(cur)
+}
+
+// legacyEscalation 告警升级配置: 持续Duration秒没有认领, 升级到Level, 并且通知原来的接收人和升级的接收人
+func legacyEscalation(cur *model.EventCur) *model.Escalation {
+	alertUpgrade, err := model.EventAlertUpgradeUnMarshal(cur.AlertUpgrade)
+	if err != nil {
+		logger.Errorf("AlertUpgrade unmarshal failed, event_cur: %d, err: %v", cur.Id, err)
+		return nil
+	}
+
+	step := model.EscalationStep{
+		Delay:    alertUpgrade.Duration,
+		Priority: alertUpgrade.Level,
+	}
+
+	for _, users := range []string{cur.Users, alertUpgrade.Users} {
+		var ids []int64
+		if err := json.Unmarshal([]byte(users), &ids); err == nil {
+			step.Users = append(step.Users, ids...)
+		}
+	}
+
+	for _, groups := range []string{cur.Groups, alertUpgrade.Groups} {
+		var ids []int64
+		if err := json.Unmarshal([]byte(groups), &ids); err == nil {
+			step.Groups = append(step.Groups, ids...)
+		}
+	}
+
+	if cur.Oncalls != "" {
+		json.Unmarshal([]byte(cur.Oncalls), &step.Oncalls)
+	}
+
+	return &model.Escalation{Steps: []model.EscalationStep{step}}
+}
+
+func isClaimed(cur *model.EventCur) bool {
+	claimants := strings.TrimSpace(cur.Claimants)
+	return claimants != "" && claimants != "[]"
+}
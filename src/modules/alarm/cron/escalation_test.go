@@ -0,0 +1,100 @@
+package cron
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+)
+
+// 告警升级配置作为只有一步的升级策略: 原来的接收人和升级的接收人都通知
+func Test_LegacyEscalation(t *testing.T) {
+	cases := []struct {
+		name string
+		cur  model.EventCur
+		step *model.EscalationStep
+	}{
+		{
+			"users and groups merged",
+			model.EventCur{
+				Users:        "[1,2]",
+				Groups:       "[10]",
+				AlertUpgrade: `{"users":"[3]","groups":"[11,12]","duration":300,"level":1}`,
+			},
+			&model.EscalationStep{Delay: 300, Priority: 1, Users: []int64{1, 2, 3}, Groups: []int64{10, 11, 12}},
+		},
+		{
+			"oncalls kept",
+			model.EventCur{
+				Users:        "[]",
+				Groups:       "[]",
+				Oncalls:      "[5]",
+				AlertUpgrade: `{"users":"[3]","groups":"[]","duration":60,"level":2}`,
+			},
+			&model.EscalationStep{Delay: 60, Priority: 2, Users: []int64{3}, Oncalls: []int64{5}},
+		},
+		{
+			"empty alert upgrade",
+			model.EventCur{Users: "[1]", Groups: "[]"},
+			&model.EscalationStep{Users: []int64{1}},
+		},
+		{
+			"illegal users ignored",
+			model.EventCur{
+				Users:        "illegal",
+				Groups:       "[10]",
+				AlertUpgrade: `{"users":"","groups":"[]","duration":60,"level":0}`,
+			},
+			&model.EscalationStep{Delay: 60, Groups: []int64{10}},
+		},
+		{
+			"illegal alert upgrade",
+			model.EventCur{Users: "[1]", Groups: "[]", AlertUpgrade: "{"},
+			nil,
+		},
+	}
+
+	for _, c := range cases {
+		policy := legacyEscalation(&c.cur)
+		if c.step == nil {
+			if policy != nil {
+				t.Fatalf("%s: unexpected policy: %+v", c.name, policy)
+			}
+			continue
+		}
+
+		if policy == nil || len(policy.Steps) != 1 || policy.Repeat != 0 {
+			t.Fatalf("%s: unexpected policy: %+v", c.name, policy)
+		}
+
+		if !reflect.DeepEqual(policy.Steps[0], *c.step) {
+			t.Fatalf("%s: step = %+v, want %+v", c.name, policy.Steps[0], *c.step)
+		}
+
+		// 只执行一次
+		if _, _, delay, ok := policy.Due(0); !ok || delay != int64(c.step.Delay) {
+			t.Fatalf("%s: first step due = %d, %v", c.name, delay, ok)
+		}
+		if _, _, _, ok := policy.Due(1); ok {
+			t.Fatalf("%s: legacy escalation should not repeat", c.name)
+		}
+	}
+}
+
+func Test_IsClaimed(t *testing.T) {
+	cases := []struct {
+		claimants string
+		claimed   bool
+	}{
+		{"", false},
+		{"[]", false},
+		{" [] ", false},
+		{"[1]", true},
+	}
+
+	for _, c := range cases {
+		if claimed := isClaimed(&model.EventCur{Claimants: c.claimants}); claimed != c.claimed {
+			t.Fatalf("isClaimed(%q) = %v, want %v", c.claimants, claimed, c.claimed)
+		}
+	}
+}
@@ -33,4 +33,14 @@ func CleanEvent() {
 	if err != nil {
 		logger.Errorf("del event_cur older failed, err: %v", err)
 	}
+
+	err = model.DelEscalationLogOlder(ts, batch)
+	if err != nil {
+		logger.Errorf("del escalation_log older failed, err: %v", err)
+	}
+
+	err = model.DelNotifyLogOlder(ts, batch)
+	if err != nil {
+		logger.Errorf("del notify_log older failed, err: %v", err)
+	}
 }
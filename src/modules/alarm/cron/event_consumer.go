@@ -6,17 +6,17 @@ import (
 	"time"
 
 	"github.com/toolkits/pkg/logger"
+	"github.com/toolkits/pkg/slice"
 
 	"github.com/open-falcon/falcon-ng/src/model"
 	"github.com/open-falcon/falcon-ng/src/modules/alarm/cache"
 	"github.com/open-falcon/falcon-ng/src/modules/alarm/config"
 	"github.com/open-falcon/falcon-ng/src/modules/alarm/notify"
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/notify/tpl"
 	"github.com/open-falcon/falcon-ng/src/modules/alarm/redi"
 )
 
 const RECOVERY_TIME_PREFIX = "/falcon-ng/recovery/time/"
-const ALERT_TIME_PREFIX = "/falcon-ng/alert/time/"
-const ALERT_UPGRADE_PREFIX = "/falcon-ng/alert/upgrade/"
 
 func consume(event *model.Event, isHigh bool) {
 	if event == nil {
@@ -28,52 +28,24 @@ func consume(event *model.Event, isHigh bool) {
 		return
 	}
 
-	if event.NeedUpgrade == 1 {
-		needUpgrade, needNotify := isAlertUpgrade(event)
-		if needUpgrade {
-			var alertUpgrade model.EventAlertUpgrade
-			if err := json.Unmarshal([]byte(event.AlertUpgrade), &alertUpgrade); err != nil {
-				logger.Errorf("AlertUpgrade unmarshal failed, event: %+v, err: %v", event, err)
-				return
-			}
-
-			if event.EventType == config.ALERT {
-				err := model.UpdateEventCurPriority(event.HashId, alertUpgrade.Level)
-				if err != nil {
-					logger.Errorf("UpdateEventCurPriority failed, err: %v, event: %+v", err, event)
-					return
-				}
-			}
-			err := model.UpdateEventPriority(event.Id, alertUpgrade.Level)
-			if err != nil {
-				logger.Errorf("UpdateEventPriority failed, err: %v, event: %+v", err, event)
-				return
-			}
-			event.Priority = alertUpgrade.Level
-
-			SetEventStatus(event, model.STATUS_UPGRADE)
-
-			if needNotify {
-				if event.EventType == config.ALERT && NeedCallback(event.Sid) {
-					if err := PushCallbackEvent(event); err != nil {
-						logger.Errorf("push event to callback queue failed, callbackEvent: %+v", event)
-					}
-					logger.Infof("push event to callback queue succ, event: %+v", event)
-
-					SetEventStatus(event, model.STATUS_CALLBACK)
-				}
-
-				go notify.DoNotify(true, event)
-				SetEventStatus(event, model.STATUS_SEND)
-				return
-			}
-
-			SetEventStatus(event, model.STATUS_CONVERGE)
+	// 源事件恢复, 补发不再被抑制的事件
+	if event.EventType == config.RECOVERY {
+		go releaseInhibited(event)
+	}
+
+	if action, inhibited := IsInhibitEvent(event); inhibited {
+		SetEventStatus(event, model.STATUS_INHIBIT)
+		if action == model.INHIBIT_ACTION_SUPPRESS {
 			return
 		}
 	}
 
-	if isInConverge(event, false) {
+	inConverge := isInConverge(event, false)
+	if event.EventType == config.RECOVERY {
+		stopEscalation(event, !inConverge)
+	}
+
+	if inConverge {
 		SetEventStatus(event, model.STATUS_CONVERGE)
 		return
 	}
@@ -88,7 +60,7 @@ func consume(event *model.Event, isHigh bool) {
 	}
 
 	// 没有配置报警接收人，修改event状态为无接收人
-	if strings.TrimSpace(event.Users) == "[]" && strings.TrimSpace(event.Groups) == "[]" {
+	if strings.TrimSpace(event.Users) == "[]" && strings.TrimSpace(event.Groups) == "[]" && !hasOncall(event) && !hasWebhook(event) {
 		SetEventStatus(event, model.STATUS_NONEUSER)
 		return
 	}
@@ -98,7 +70,7 @@ func consume(event *model.Event, isHigh bool) {
 		return
 	}
 
-	go notify.DoNotify(false, event)
+	go notify.DoNotify(event)
 	SetEventStatus(event, model.STATUS_SEND)
 }
 
@@ -163,93 +135,6 @@ func isInConverge(event *model.Event, isUpgrade bool) bool {
 	return false
 }
 
-// 三种情况，不需要升级报警
-// 1，被认领的报警不需要升级
-// 2，忽略的报警不需要升级
-// 3，屏蔽的报警，不需要升级
-func isAlertUpgrade(event *model.Event) (needUpgrade, needNotify bool) {
-	alertUpgradeKey := ALERT_UPGRADE_PREFIX + fmt.Sprint(event.HashId)
-	eventAlertKey := ALERT_TIME_PREFIX + fmt.Sprint(event.HashId)
-
-	if event.EventType == config.RECOVERY {
-		err := model.EventCurDel(event.HashId)
-		if err != nil {
-			logger.Errorf("del event cur failed, event: %+v, err: %v", event, err)
-		}
-
-		if redi.HasKey(alertUpgradeKey) {
-			err := redi.DelKey(eventAlertKey)
-			if err != nil {
-				logger.Errorf("redis del eventAlertkey failed, key: %v, err: %v", eventAlertKey, err)
-			}
-
-			err = redi.DelKey(alertUpgradeKey)
-			if err != nil {
-				logger.Errorf("redis del alertUpgradeKey failed, key: %v, err: %v", alertUpgradeKey, err)
-			}
-
-			return true, true
-		}
-
-		return false, false
-	}
-
-	eventCur, err := model.EventCurGet("hashid", event.HashId)
-	if err != nil {
-		logger.Errorf("AlertUpgrade failed:get event_cur failed, event: %+v, err: %v", event, err)
-		return false, false
-	}
-
-	if eventCur == nil {
-		logger.Infof("AlertUpgrade failed:get event_cur is nil, event: %+v", event)
-		return false, false
-	}
-
-	now := time.Now().Unix()
-
-	var alertUpgrade model.EventAlertUpgrade
-	if err = json.Unmarshal([]byte(event.AlertUpgrade), &alertUpgrade); err != nil {
-		logger.Errorf("AlertUpgrade unmarshal failed, event: %+v, err: %v", event, err)
-		return false, false
-	}
-
-	upgradeDuration := int64(alertUpgrade.Duration)
-
-	claimants := strings.TrimSpace(eventCur.Claimants)
-	if claimants != "[]" && claimants != "" {
-		return false, false
-	}
-
-	if eventCur.IgnoreAlert == 1 {
-		return false, false
-	}
-
-	if !redi.HasKey(eventAlertKey) {
-		err := redi.SetWithTTL(eventAlertKey, now, 30*24*3600)
-		if err != nil {
-			logger.Errorf("set eventAlertKey failed, eventAlertKey: %v, err: %v", eventAlertKey, err)
-			return false, false
-		}
-	}
-
-	firstAlertTime := redi.GET(eventAlertKey)
-	if now-firstAlertTime < upgradeDuration {
-		return false, false
-	}
-
-	err = redi.SetWithTTL(alertUpgradeKey, 1, 30*24*3600)
-	if err != nil {
-		logger.Errorf("set alertUpgradeKey failed, alertUpgradeKey: %v, err: %v", alertUpgradeKey, err)
-		return false, false
-	}
-
-	if isInConverge(event, true) {
-		return true, false
-	}
-
-	return true, true
-}
-
 func SetEventStatus(event *model.Event, status string) {
 	if err := model.SaveEventStatus(event.Id, status); err != nil {
 		logger.Errorf("set event status failed, event: %+v, status: %v, err:%v", event, status, err)
@@ -265,3 +150,19 @@ func SetEventStatus(event *model.Event, status string) {
 		}
 	}
 }
+
+func hasOncall(event *model.Event) bool {
+	oncalls := strings.TrimSpace(event.Oncalls)
+	return oncalls != "" && oncalls != "[]"
+}
+
+// hasWebhook 策略配置了webhook, 并且事件优先级的通知通道包括webhook, 和notify.DoNotify一致
+func hasWebhook(event *model.Event) bool {
+	channels := config.GetCfgYml().Notify[fmt.Sprintf("p%v", event.Priority)]
+	if !slice.ContainsString(channels, tpl.CHANNEL_WEBHOOK) {
+		return false
+	}
+
+	stra, has := cache.StraCache.GetById(event.Sid)
+	return has && len(stra.NotifyWebhook) > 0
+}
@@ -0,0 +1,51 @@
+package cron
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/model"
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/cache"
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/config"
+)
+
+// 只有优先级的通知通道包括webhook时, webhook才算作接收人
+func Test_HasWebhook(t *testing.T) {
+	f, err := ioutil.TempFile("", "alarm.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.WriteString("notify:\n  p1: [\"im\", \"webhook\"]\n  p2: [\"im\"]\n")
+	f.Close()
+	if err := config.ParseCfg(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	cache.StraCache = cache.NewStraCache()
+	cache.StraCache.SetAll(map[int64]*dataobj.Stra{
+		1: {ID: 1, NotifyWebhook: []int64{3}},
+		2: {ID: 2},
+	})
+
+	cases := []struct {
+		sid      int64
+		priority int
+		want     bool
+	}{
+		{1, 1, true},
+		{1, 2, false},
+		{1, 3, false},
+		{2, 1, false},
+		{4, 1, false},
+	}
+
+	for _, c := range cases {
+		if got := hasWebhook(&model.Event{Sid: c.sid, Priority: c.priority}); got != c.want {
+			t.Fatalf("sid %d, p%d: hasWebhook = %v, want %v", c.sid, c.priority, got, c.want)
+		}
+	}
+}
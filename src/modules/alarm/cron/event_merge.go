@@ -97,7 +97,7 @@ func parseMergeEvent(eventMap map[int64][]*model.Event) {
 			}
 
 			for _, bounds := range config.SplitN(len(alertEvents), max) {
-				go notify.DoNotify(false, alertEvents[bounds[0]:bounds[1]]...)
+				go notify.DoNotify(alertEvents[bounds[0]:bounds[1]]...)
 			}
 
 			for i := range alertEvents {
@@ -119,7 +119,7 @@ func parseMergeEvent(eventMap map[int64][]*model.Event) {
 			}
 
 			for _, bounds := range config.SplitN(len(recoveryEvents), max) {
-				go notify.DoNotify(false, recoveryEvents[bounds[0]:bounds[1]]...)
+				go notify.DoNotify(recoveryEvents[bounds[0]:bounds[1]]...)
 			}
 
 			for i := range recoveryEvents {
@@ -1,13 +1,19 @@
 package cron
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
 	"time"
 
+	nsq "github.com/bitly/go-nsq"
 	"github.com/garyburd/redigo/redis"
 	"github.com/json-iterator/go"
 	"github.com/toolkits/pkg/logger"
 
+	"github.com/open-falcon/falcon-ng/src/dataobj"
 	"github.com/open-falcon/falcon-ng/src/model"
 	"github.com/open-falcon/falcon-ng/src/modules/alarm/cache"
 	"github.com/open-falcon/falcon-ng/src/modules/alarm/config"
@@ -20,8 +26,9 @@ func ReadHighEvent() {
 		return
 	}
 
+	reader := newEventReader(queues)
 	for {
-		event, err := popEvent(queues)
+		event, err := popEvent(reader)
 		if err != nil {
 			time.Sleep(time.Second)
 			continue
@@ -36,8 +43,9 @@ func ReadLowEvent() {
 		return
 	}
 
+	reader := newEventReader(queues)
 	for {
-		event, err := popEvent(queues)
+		event, err := popEvent(reader)
 		if err != nil {
 			time.Sleep(time.Second)
 			continue
@@ -46,29 +54,235 @@ func ReadLowEvent() {
 	}
 }
 
-func popEvent(queues []interface{}) (*model.Event, error) {
-	queues = append(queues, 0)
-	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+// eventReader 从judge推送事件的队列中读取一个事件, 没有事件时阻塞
+type eventReader interface {
+	Pop() ([]byte, error)
+}
+
+func newEventReader(queues []interface{}) eventReader {
+	switch config.GetCfgYml().Queue.Type {
+	case "nsq":
+		return newNsqEventReader(queues)
+	case "kafka":
+		return newKafkaEventReader(queues)
+	default:
+		return &redisEventReader{queues: append(queues, 0)}
+	}
+}
+
+type redisEventReader struct {
+	queues []interface{}
+}
 
+func (r *redisEventReader) Pop() ([]byte, error) {
 	rc := redi.RedisConnPool.Get()
 	defer rc.Close()
 
-	reply, err := redis.Strings(rc.Do("BRPOP", queues...))
+	reply, err := redis.Strings(rc.Do("BRPOP", r.queues...))
 	if err != nil {
 		if err != redis.ErrNil {
-			logger.Warningf("get alarm event from redis failed, queues: %v, err: %v", queues, err)
+			logger.Warningf("get alarm event from redis failed, queues: %v, err: %v", r.queues, err)
 		}
 		return nil, err
 	}
 
 	if reply == nil {
 		logger.Errorf("get alarm event from redis timeout")
+		return nil, redis.ErrNil
+	}
+
+	return []byte(reply[1]), nil
+}
+
+// nsqEventReader 每个队列对应一个topic, 收到的消息直接ack, 和BRPOP一样
+type nsqEventReader struct {
+	events chan []byte
+}
+
+func newNsqEventReader(queues []interface{}) *nsqEventReader {
+	cfg := config.GetCfgYml().Queue.Nsq
+	r := &nsqEventReader{events: make(chan []byte)}
+
+	conf := nsq.NewConfig()
+	for _, q := range queues {
+		topic := dataobj.EventTopic(fmt.Sprint(q))
+		consumer, err := nsq.NewConsumer(topic, cfg.Chan, conf)
+		if err != nil {
+			logger.Errorf("create nsq consumer failed, topic: %s, err: %v", topic, err)
+			continue
+		}
+
+		consumer.SetLogger(nil, nsq.LogLevelError)
+		consumer.AddHandler(nsq.HandlerFunc(func(m *nsq.Message) error {
+			r.events <- m.Body
+			return nil
+		}))
+
+		if err = consumer.ConnectToNSQLookupds(cfg.Lookupds); err != nil {
+			logger.Errorf("connect to nsq lookupd failed, topic: %s, err: %v", topic, err)
+		}
+	}
+
+	return r
+}
+
+func (r *nsqEventReader) Pop() ([]byte, error) {
+	return <-r.events, nil
+}
+
+// kafkaEventReader 通过kafka rest proxy(v2)消费, 一批事件都处理完之后才提交offset
+type kafkaEventReader struct {
+	addr    string
+	group   string
+	topics  []string
+	client  *http.Client
+	baseURI string // 消费者实例的地址, 为空时需要重新创建
+	pending [][]byte
+	fetched bool // 是否有已经读取但是还没有提交的事件
+}
+
+type kafkaRecord struct {
+	Topic     string              `json:"topic"`
+	Value     jsoniter.RawMessage `json:"value"`
+	Partition int                 `json:"partition"`
+	Offset    int64               `json:"offset"`
+}
+
+func newKafkaEventReader(queues []interface{}) *kafkaEventReader {
+	cfg := config.GetCfgYml().Queue.Kafka
+	r := &kafkaEventReader{
+		addr:   strings.TrimRight(cfg.Addr, "/"),
+		group:  cfg.Group,
+		client: &http.Client{Timeout: time.Duration(cfg.Timeout)*time.Millisecond + 5*time.Second},
+	}
+
+	for _, q := range queues {
+		r.topics = append(r.topics, dataobj.EventTopic(fmt.Sprint(q)))
+	}
+
+	return r
+}
+
+func (r *kafkaEventReader) Pop() ([]byte, error) {
+	for len(r.pending) == 0 {
+		if err := r.fetch(); err != nil {
+			logger.Warningf("get alarm event from kafka failed, topics: %v, err: %v", r.topics, err)
+			// 消费者实例可能已经过期, 重新创建
+			r.baseURI = ""
+			return nil, err
+		}
+	}
+
+	event := r.pending[0]
+	r.pending = r.pending[1:]
+	return event, nil
+}
+
+func (r *kafkaEventReader) fetch() error {
+	if r.baseURI == "" {
+		if err := r.subscribe(); err != nil {
+			return err
+		}
+	}
+
+	if r.fetched {
+		if _, err := r.do("POST", r.baseURI+"/offsets", nil); err != nil {
+			return err
+		}
+		r.fetched = false
+	}
+
+	url := fmt.Sprintf("%s/records?timeout=%d", r.baseURI, config.GetCfgYml().Queue.Kafka.Timeout)
+	data, err := r.do("GET", url, nil)
+	if err != nil {
+		return err
+	}
+
+	var records []kafkaRecord
+	if err = jsoniter.Unmarshal(data, &records); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		r.pending = append(r.pending, []byte(record.Value))
+	}
+	r.fetched = len(records) > 0
+	return nil
+}
+
+func (r *kafkaEventReader) subscribe() error {
+	body := map[string]string{
+		"format":             "json",
+		"auto.offset.reset":  "earliest",
+		"auto.commit.enable": "false",
+	}
+	data, err := r.do("POST", r.addr+"/consumers/"+r.group, body)
+	if err != nil {
+		return err
+	}
+
+	var instance struct {
+		InstanceId string `json:"instance_id"`
+		BaseURI    string `json:"base_uri"`
+	}
+	if err = jsoniter.Unmarshal(data, &instance); err != nil {
+		return err
+	}
+
+	if _, err = r.do("POST", instance.BaseURI+"/subscription", map[string][]string{"topics": r.topics}); err != nil {
+		return err
+	}
+
+	logger.Infof("kafka consumer %s subscribed to %v", instance.InstanceId, r.topics)
+	r.baseURI = instance.BaseURI
+	return nil
+}
+
+func (r *kafkaEventReader) do(method, url string, v interface{}) ([]byte, error) {
+	var body []byte
+	if v != nil {
+		var err error
+		if body, err = jsoniter.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.json.v2+json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s %s: status code %d: %s", method, url, resp.StatusCode, string(data))
+	}
+
+	return data, nil
+}
+
+func popEvent(reader eventReader) (*model.Event, error) {
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	body, err := reader.Pop()
+	if err != nil {
 		return nil, err
 	}
 
 	event := new(model.Event)
-	if err = json.Unmarshal([]byte(reply[1]), event); err != nil {
-		logger.Errorf("unmarshal redis reply failed, err: %v", err)
+	if err = json.Unmarshal(body, event); err != nil {
+		logger.Errorf("unmarshal event failed, err: %v", err)
 		return nil, err
 	}
 
@@ -144,6 +358,12 @@ func popEvent(queues []interface{}) (*model.Event, error) {
 		return nil, err
 	}
 
+	oncalls, err := json.Marshal(stra.NotifyOncall)
+	if err != nil {
+		logger.Errorf("oncalls marshal failed, err: %v, event: %+v", err, event)
+		return nil, err
+	}
+
 	alertUpgrade, err := model.EventAlertUpgradeMarshal(stra.AlertUpgrade)
 	if err != nil {
 		logger.Errorf("EventAlertUpgradeMarshal failed, err: %v, event: %+v", err, event)
@@ -158,6 +378,7 @@ func popEvent(queues []interface{}) (*model.Event, error) {
 	event.Nid = stra.Nid
 	event.Users = string(users)
 	event.Groups = string(groups)
+	event.Oncalls = string(oncalls)
 	event.NodePath = nodePath
 	event.NeedUpgrade = stra.NeedUpgrade
 	event.AlertUpgrade = alertUpgrade
@@ -168,8 +389,8 @@ func popEvent(queues []interface{}) (*model.Event, error) {
 
 	if event.EventType == config.ALERT {
 		eventCur := new(model.EventCur)
-		if err = json.Unmarshal([]byte(reply[1]), eventCur); err != nil {
-			logger.Errorf("unmarshal redis reply failed, err: %v, event: %+v", err, event)
+		if err = json.Unmarshal(body, eventCur); err != nil {
+			logger.Errorf("unmarshal event failed, err: %v, event: %+v", err, event)
 		}
 
 		eventCur.Sname = stra.Name
@@ -178,6 +399,7 @@ func popEvent(queues []interface{}) (*model.Event, error) {
 		eventCur.Nid = stra.Nid
 		eventCur.Users = string(users)
 		eventCur.Groups = string(groups)
+		eventCur.Oncalls = string(oncalls)
 		eventCur.NodePath = nodePath
 		eventCur.NeedUpgrade = stra.NeedUpgrade
 		eventCur.AlertUpgrade = alertUpgrade
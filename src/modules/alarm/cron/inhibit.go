@@ -0,0 +1,312 @@
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/toolkits/pkg/logger"
+	"github.com/toolkits/pkg/str"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/cache"
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/config"
+)
+
+// 抑制: 源事件正在报警(event_cur中存在)时, 同一个endpoint或者节点上匹配的目标事件不发送通知(或者只做标记)
+// 被抑制的报警, 对应的恢复事件也不发送; 源事件恢复后, 不再被抑制的目标事件补发通知
+
+func SyncInhibitLoop() {
+	interval := config.GetCfgYml().Interval
+	for {
+		SyncInhibit()
+		time.Sleep(time.Second * time.Duration(interval))
+	}
+}
+
+func SyncInhibit() error {
+	objs, err := model.InhibitGetAll()
+	if err != nil {
+		logger.Errorf("get inhibit fail, err: %v", err)
+		return err
+	}
+
+	nids := make([]int64, 0, len(objs))
+	for i := 0; i < len(objs); i++ {
+		nids = append(nids, objs[i].Nid)
+	}
+
+	paths := make(map[int64]string)
+	if len(nids) > 0 {
+		nodes, err := model.NodesGetByIds(nids)
+		if err != nil {
+			logger.Errorf("get inhibit nodes fail, err: %v", err)
+			return err
+		}
+
+		for i := 0; i < len(nodes); i++ {
+			paths[nodes[i].Id] = nodes[i].Path
+		}
+	}
+
+	rules := make([]*cache.InhibitRule, 0, len(objs))
+	for i := 0; i < len(objs); i++ {
+		path, has := paths[objs[i].Nid]
+		if !has {
+			logger.Warningf("node of inhibit not found, inhibit: %+v", objs[i])
+			continue
+		}
+
+		objs[i].NodePath = path
+		rules = append(rules, &cache.InhibitRule{
+			Inhibit: &objs[i],
+			SrcSids: sidsFormat(objs[i].SrcSids),
+			SrcTags: tagsFormat(objs[i].SrcTags),
+			TgtSids: sidsFormat(objs[i].TgtSids),
+			TgtTags: tagsFormat(objs[i].TgtTags),
+		})
+	}
+
+	cache.InhibitCache.SetAll(rules)
+
+	return nil
+}
+
+// IsInhibitEvent 返回事件是否被抑制, 以及抑制的方式, 多条规则同时匹配时, 不发送优先
+func IsInhibitEvent(event *model.Event) (string, bool) {
+	if event.EventType == config.RECOVERY {
+		last, err := model.EventGetLastAlert(event.HashId)
+		if err != nil {
+			logger.Errorf("get last alert event failed, event: %+v, err: %v", event, err)
+			return "", false
+		}
+
+		if last != nil && isSuppressed(last.Status) {
+			return model.INHIBIT_ACTION_SUPPRESS, true
+		}
+
+		return "", false
+	}
+
+	rules := cache.InhibitCache.GetAll()
+	if len(rules) == 0 {
+		return "", false
+	}
+
+	detail, err := event.GetEventDetail()
+	if err != nil {
+		logger.Errorf("get event detail failed, err: %v", err)
+		return "", false
+	}
+
+	action := ""
+	firing := newFiringEvents(event)
+	for _, rule := range rules {
+		if !inNodePath(event.NodePath, rule.NodePath) {
+			continue
+		}
+
+		if !selectorMatch(rule.TgtSids, rule.TgtMetric, rule.TgtTags, event.Sid, detail) {
+			continue
+		}
+
+		source, has := firing.find(rule, event.HashId)
+		if !has {
+			continue
+		}
+
+		logger.Infof("event inhibited by rule: %d, source: %d, action: %s, event: %+v", rule.Id, source.Id, rule.Action, event)
+		if rule.Action == model.INHIBIT_ACTION_SUPPRESS {
+			return rule.Action, true
+		}
+		action = rule.Action
+	}
+
+	return action, action != ""
+}
+
+// releaseInhibited 源事件恢复后, 之前被抑制的目标事件如果不再被抑制, 补发通知
+func releaseInhibited(event *model.Event) {
+	rules := cache.InhibitCache.GetAll()
+	if len(rules) == 0 {
+		return
+	}
+
+	detail, err := event.GetEventDetail()
+	if err != nil {
+		logger.Errorf("get event detail failed, err: %v", err)
+		return
+	}
+
+	released := make(map[uint64]struct{})
+	firing := newFiringEvents(event)
+	for _, rule := range rules {
+		if !inNodePath(event.NodePath, rule.NodePath) {
+			continue
+		}
+
+		if !selectorMatch(rule.SrcSids, rule.SrcMetric, rule.SrcTags, event.Sid, detail) {
+			continue
+		}
+
+		curs, err := firing.get(rule.Equal)
+		if err != nil {
+			logger.Errorf("get event_cur failed, event: %+v, err: %v", event, err)
+			return
+		}
+
+		for i := 0; i < len(curs); i++ {
+			if _, has := released[curs[i].HashId]; has || !isSuppressed(curs[i].Status) {
+				continue
+			}
+
+			cd, err := curEventDetail(&curs[i])
+			if err != nil || !inNodePath(curs[i].NodePath, rule.NodePath) ||
+				!selectorMatch(rule.TgtSids, rule.TgtMetric, rule.TgtTags, curs[i].Sid, cd) {
+				continue
+			}
+
+			alert, err := model.EventGetLastAlert(curs[i].HashId)
+			if err != nil || alert == nil {
+				continue
+			}
+
+			if _, inhibited := IsInhibitEvent(alert); inhibited {
+				continue
+			}
+
+			released[curs[i].HashId] = struct{}{}
+			logger.Infof("inhibited event released, source: %+v, event: %+v", event, alert)
+			consume(alert, isHighPriority(alert.Priority))
+		}
+	}
+}
+
+// isSuppressed 被抑制并且没有发送
+func isSuppressed(status uint16) bool {
+	return (status>>model.FLAG_INHIBIT)&0x01 == 1 && (status>>model.FLAG_SEND)&0x01 == 0
+}
+
+// firingEvents 同一个endpoint或者节点上正在报警的事件, 第一次使用时查询
+type firingEvents struct {
+	event *model.Event
+	curs  map[string][]model.EventCur
+}
+
+func newFiringEvents(event *model.Event) *firingEvents {
+	return &firingEvents{event: event, curs: make(map[string][]model.EventCur)}
+}
+
+func (f *firingEvents) get(equal string) ([]model.EventCur, error) {
+	if curs, has := f.curs[equal]; has {
+		return curs, nil
+	}
+
+	var (
+		curs []model.EventCur
+		err  error
+	)
+	if equal == model.INHIBIT_EQUAL_NODE {
+		curs, err = model.EventCurGetsBy("node_path", f.event.NodePath)
+	} else {
+		curs, err = model.EventCurGetsBy("endpoint", f.event.Endpoint)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f.curs[equal] = curs
+	return curs, nil
+}
+
+// find 匹配规则中源选择器的报警, 不包括事件自己
+func (f *firingEvents) find(rule *cache.InhibitRule, hashid uint64) (*model.EventCur, bool) {
+	curs, err := f.get(rule.Equal)
+	if err != nil {
+		logger.Errorf("get event_cur failed, event: %+v, err: %v", f.event, err)
+		return nil, false
+	}
+
+	for i := 0; i < len(curs); i++ {
+		if curs[i].HashId == hashid || !inNodePath(curs[i].NodePath, rule.NodePath) {
+			continue
+		}
+
+		detail, err := curEventDetail(&curs[i])
+		if err != nil {
+			continue
+		}
+
+		if selectorMatch(rule.SrcSids, rule.SrcMetric, rule.SrcTags, curs[i].Sid, detail) {
+			return &curs[i], true
+		}
+	}
+
+	return nil, false
+}
+
+func curEventDetail(cur *model.EventCur) ([]model.EventDetail, error) {
+	detail := []model.EventDetail{}
+	err := json.Unmarshal([]byte(cur.Detail), &detail)
+	return detail, err
+}
+
+// selectorMatch 策略ID, 指标, tags都为空时不限制
+func selectorMatch(sids map[int64]struct{}, metric string, tags []string, sid int64, detail []model.EventDetail) bool {
+	if len(sids) > 0 {
+		if _, has := sids[sid]; !has {
+			return false
+		}
+	}
+
+	if metric == "" && (len(tags) == 0 || inList("", tags)) {
+		return true
+	}
+
+	for i := 0; i < len(detail); i++ {
+		if metric != "" && detail[i].Metric != metric {
+			continue
+		}
+
+		eventTagsList := []string{}
+		for k, v := range detail[i].Tags {
+			eventTagsList = append(eventTagsList, fmt.Sprintf("%s=%s", strings.TrimSpace(k), strings.TrimSpace(v)))
+		}
+
+		for j := 0; j < len(tags); j++ {
+			tagsList := strings.Split(tags[j], ",")
+			if inList("", tagsList) || listContains(tagsList, eventTagsList) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func inNodePath(path, rulePath string) bool {
+	return path == rulePath || strings.HasPrefix(path, rulePath+".")
+}
+
+func sidsFormat(sids string) map[int64]struct{} {
+	ret := make(map[int64]struct{})
+	if strings.TrimSpace(sids) == "" {
+		return ret
+	}
+
+	for _, id := range str.IdsInt64(strings.Replace(sids, " ", "", -1)) {
+		ret[id] = struct{}{}
+	}
+	return ret
+}
+
+func isHighPriority(priority int) bool {
+	queue := "/falcon-ng/event/p" + strconv.Itoa(priority)
+	for _, q := range config.GetCfgYml().Queue.High {
+		if fmt.Sprint(q) == queue {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package cron
+
+import (
+	"testing"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/cache"
+)
+
+func Test_SelectorMatch(t *testing.T) {
+	detail := []model.EventDetail{
+		{Metric: "cpu.idle", Tags: map[string]string{"cpu": "cpu-total", "host": "a"}},
+	}
+
+	cases := []struct {
+		name   string
+		sids   string
+		metric string
+		tags   string
+		sid    int64
+		want   bool
+	}{
+		{"empty selector", "", "", "", 1, true},
+		{"sid match", "1,2", "", "", 2, true},
+		{"sid no match", "1,2", "", "", 3, false},
+		{"sid with spaces", " 1, 2 ", "", "", 2, true},
+		{"metric match", "", "cpu.idle", "", 1, true},
+		{"metric no match", "", "mem.used", "", 1, false},
+		{"tags match", "", "cpu.idle", "cpu=cpu-total", 1, true},
+		{"tags match one of values", "", "cpu.idle", "cpu=cpu0,cpu-total", 1, true},
+		{"tags match all keys", "", "cpu.idle", "cpu=cpu-total;host=a", 1, true},
+		{"tags no match value", "", "cpu.idle", "cpu=cpu0", 1, false},
+		{"tags no match one key", "", "cpu.idle", "cpu=cpu-total;host=b", 1, false},
+		{"tags without metric", "", "", "host=a", 1, true},
+		{"sid match tags no match", "1", "", "host=b", 1, false},
+	}
+
+	for _, c := range cases {
+		if got := selectorMatch(sidsFormat(c.sids), c.metric, tagsFormat(c.tags), c.sid, detail); got != c.want {
+			t.Fatalf("%s: selectorMatch = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func Test_IsSuppressed(t *testing.T) {
+	cases := []struct {
+		status uint16
+		want   bool
+	}{
+		{0, false},
+		{1 << model.FLAG_SEND, false},
+		{1 << model.FLAG_INHIBIT, true},
+		{1<<model.FLAG_INHIBIT | 1<<model.FLAG_SEND, false}, // 标记为已抑制, 正常发送
+		{1<<model.FLAG_INHIBIT | 1<<model.FLAG_CONVERGE, true},
+		{1 << model.FLAG_MASK, false},
+	}
+
+	for _, c := range cases {
+		if got := isSuppressed(c.status); got != c.want {
+			t.Fatalf("isSuppressed(%b) = %v, want %v", c.status, got, c.want)
+		}
+	}
+}
+
+func Test_InNodePath(t *testing.T) {
+	cases := []struct {
+		path     string
+		rulePath string
+		want     bool
+	}{
+		{"cop.dev", "cop.dev", true},
+		{"cop.dev.app", "cop.dev", true},
+		{"cop.devops", "cop.dev", false},
+		{"cop", "cop.dev", false},
+	}
+
+	for _, c := range cases {
+		if got := inNodePath(c.path, c.rulePath); got != c.want {
+			t.Fatalf("inNodePath(%s, %s) = %v, want %v", c.path, c.rulePath, got, c.want)
+		}
+	}
+}
+
+// 源事件在event_cur中才抑制目标事件, 已经恢复的源事件不在event_cur中
+func Test_InhibitFindSource(t *testing.T) {
+	rule := &cache.InhibitRule{
+		Inhibit: &model.Inhibit{Id: 1, NodePath: "cop.dev", SrcMetric: "net.ping", Equal: model.INHIBIT_EQUAL_ENDPOINT},
+		SrcSids: sidsFormat(""),
+		SrcTags: tagsFormat(""),
+	}
+
+	event := &model.Event{Sid: 2, HashId: 100, NodePath: "cop.dev.app", Endpoint: "10.0.0.1"}
+	ping := model.EventCur{Id: 1, Sid: 1, HashId: 1, NodePath: "cop.dev.app", Endpoint: "10.0.0.1",
+		Detail: `[{"metric":"net.ping","tags":{}}]`}
+	cpu := model.EventCur{Id: 2, Sid: 3, HashId: 2, NodePath: "cop.dev.app", Endpoint: "10.0.0.1",
+		Detail: `[{"metric":"cpu.idle","tags":{}}]`}
+	self := model.EventCur{Id: 3, Sid: 2, HashId: 100, NodePath: "cop.dev.app", Endpoint: "10.0.0.1",
+		Detail: `[{"metric":"net.ping","tags":{}}]`}
+	other := ping
+	other.Id, other.HashId, other.NodePath = 4, 4, "cop.ops"
+
+	cases := []struct {
+		name   string
+		firing []model.EventCur
+		want   int64
+	}{
+		{"source firing", []model.EventCur{cpu, ping}, 1},
+		{"no source match", []model.EventCur{cpu}, 0},
+		{"source recovered", []model.EventCur{}, 0},
+		{"event itself", []model.EventCur{self}, 0},
+		{"source out of node", []model.EventCur{other}, 0},
+	}
+
+	for _, c := range cases {
+		f := newFiringEvents(event)
+		f.curs[model.INHIBIT_EQUAL_ENDPOINT] = c.firing
+
+		source, has := f.find(rule, event.HashId)
+		if has != (c.want != 0) || (has && source.Id != c.want) {
+			t.Fatalf("%s: find = %+v, %v, want %d", c.name, source, has, c.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package cron
+
+import (
+	"time"
+
+	"github.com/toolkits/pkg/logger"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/cache"
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/config"
+)
+
+func SyncNotifyTplLoop() {
+	interval := config.GetCfgYml().Interval
+	for {
+		SyncNotifyTpl()
+		time.Sleep(time.Second * time.Duration(interval))
+	}
+}
+
+func SyncNotifyTpl() error {
+	objs, err := model.NotifyTplGetAll()
+	if err != nil {
+		logger.Errorf("get notify tpl fail, err: %v", err)
+		return err
+	}
+
+	nids := []int64{}
+	for i := 0; i < len(objs); i++ {
+		if objs[i].Nid > 0 {
+			nids = append(nids, objs[i].Nid)
+		}
+	}
+
+	paths := make(map[int64]string)
+	if len(nids) > 0 {
+		nodes, err := model.NodesGetByIds(nids)
+		if err != nil {
+			logger.Errorf("get notify tpl nodes fail, err: %v", err)
+			return err
+		}
+
+		for i := 0; i < len(nodes); i++ {
+			paths[nodes[i].Id] = nodes[i].Path
+		}
+	}
+
+	m := make(map[string][]*model.NotifyTpl)
+	for i := 0; i < len(objs); i++ {
+		if objs[i].Nid > 0 {
+			path, has := paths[objs[i].Nid]
+			if !has {
+				logger.Warningf("node of notify tpl not found, tpl: %d %s", objs[i].Id, objs[i].Name)
+				continue
+			}
+			objs[i].NodePath = path
+		}
+
+		m[objs[i].Channel] = append(m[objs[i].Channel], &objs[i])
+	}
+
+	cache.NotifyTplCache.SetAll(m)
+
+	return nil
+}
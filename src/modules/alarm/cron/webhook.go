@@ -0,0 +1,38 @@
+package cron
+
+import (
+	"time"
+
+	"github.com/toolkits/pkg/logger"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/cache"
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/config"
+)
+
+func SyncWebhookLoop() {
+	interval := config.GetCfgYml().Interval
+	for {
+		SyncWebhook()
+		time.Sleep(time.Second * time.Duration(interval))
+	}
+}
+
+func SyncWebhook() error {
+	objs, err := model.WebhookGetAll()
+	if err != nil {
+		logger.Errorf("get webhook fail, err: %v", err)
+		return err
+	}
+
+	m := make(map[int64]*model.Webhook, len(objs))
+	for i := 0; i < len(objs); i++ {
+		// 签名由sender处理, alarm不需要密钥
+		objs[i].Secret = ""
+		m[objs[i].Id] = &objs[i]
+	}
+
+	cache.WebhookCache.SetAll(m)
+
+	return nil
+}
@@ -1,54 +1,92 @@
 package notify
 
 import (
-	"bytes"
 	"fmt"
-	"html/template"
+	"io/ioutil"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/json-iterator/go"
 	"github.com/toolkits/pkg/file"
 	"github.com/toolkits/pkg/logger"
 	"github.com/toolkits/pkg/net/httplib"
+	"github.com/toolkits/pkg/slice"
 
 	"github.com/open-falcon/falcon-ng/src/dataobj"
 	"github.com/open-falcon/falcon-ng/src/model"
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/cache"
 	"github.com/open-falcon/falcon-ng/src/modules/alarm/config"
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/notify/tpl"
 )
 
 var json = jsoniter.ConfigCompatibleWithStandardLibrary
 
-func DoNotify(isUpgrade bool, events ...*model.Event) {
+// DoNotify 通知策略配置的接收人, 值班人和webhook
+func DoNotify(events ...*model.Event) {
 	cnt := len(events)
 	if cnt == 0 {
 		return
 	}
 
+	prio := fmt.Sprintf("p%v", events[cnt-1].Priority)
+	channels := config.GetCfgYml().Notify[prio]
+	if slice.ContainsString(channels, tpl.CHANNEL_WEBHOOK) {
+		notifyWebhooks(getWebhookIds(events[cnt-1].Sid), false, events)
+	}
+
 	userIds, err := getUserIds(events[cnt-1].Users, events[cnt-1].Groups)
 	if err != nil {
 		logger.Errorf("notify failed, get users id failed, events: %+v, err: %v", events, err)
 		return
 	}
 
-	prio := fmt.Sprintf("p%v", events[cnt-1].Priority)
+	oncallIds, err := getOncallIds(events[cnt-1].Oncalls)
+	if err != nil {
+		logger.Errorf("unmarshal oncalls failed, oncalls: %s, err: %v", events[cnt-1].Oncalls, err)
+	}
+	userIds = append(userIds, getOncallUserIds(oncallIds, events)...)
 
-	if isUpgrade {
-		alertUpgradeString := events[cnt-1].AlertUpgrade
-		var alertUpgrade model.EventAlertUpgrade
-		if err = json.Unmarshal([]byte(alertUpgradeString), &alertUpgrade); err != nil {
-			logger.Errorf("")
-		}
+	doNotify(userIds, channels, false, events)
+}
+
+// DoEscalate 通知升级的接收人, channels为空时使用事件优先级对应的通道
+func DoEscalate(userIds []int64, channels []string, events ...*model.Event) {
+	cnt := len(events)
+	if cnt == 0 {
+		return
+	}
 
-		upgradeUserIds, err := getUserIds(alertUpgrade.Users, alertUpgrade.Groups)
+	if len(channels) == 0 {
+		channels = config.GetCfgYml().Notify[fmt.Sprintf("p%v", events[cnt-1].Priority)]
+	}
+
+	if slice.ContainsString(channels, tpl.CHANNEL_WEBHOOK) {
+		notifyWebhooks(getWebhookIds(events[cnt-1].Sid), true, events)
+	}
+
+	doNotify(userIds, channels, true, events)
+}
+
+// EscalationUserIds 升级步骤的接收人, 值班人在通知时确定
+func EscalationUserIds(step *model.EscalationStep, events []*model.Event) ([]int64, error) {
+	userIds := append([]int64{}, step.Users...)
+
+	if len(step.Groups) > 0 {
+		teamUsers, err := model.UserIdGetByTeamIds(step.Groups)
 		if err != nil {
-			logger.Errorf("upgrade notify failed, get upgrade users id failed, events: %+v, err: %v", events, err)
+			return nil, err
 		}
+		userIds = append(userIds, teamUsers...)
+	}
 
-		if upgradeUserIds != nil {
-			userIds = append(userIds, upgradeUserIds...)
-		}
-		prio = fmt.Sprintf("p%v", alertUpgrade.Level)
+	userIds = append(userIds, getOncallUserIds(step.Oncalls, events)...)
+	return slice.UniqueInt64(userIds), nil
+}
+
+func doNotify(userIds []int64, notifyTypes []string, isUpgrade bool, events []*model.Event) {
+	if len(userIds) == 0 {
+		return
 	}
 
 	users, err := model.UserGetByIds(userIds)
@@ -57,150 +95,178 @@ func DoNotify(isUpgrade bool, events ...*model.Event) {
 		return
 	}
 
-	content, mailContent := genContent(isUpgrade, events)
-	subject := genSubject(isUpgrade, events)
-
-	notifyTypes := config.GetCfgYml().Notify[prio]
-
+	data := genData(isUpgrade, events)
 	for i := 0; i < len(notifyTypes); i++ {
 		switch notifyTypes[i] {
-		case "voice":
+		case tpl.CHANNEL_VOICE:
 			if events[0].EventType == config.ALERT {
 				tos := []string{}
 				for j := 0; j < len(users); j++ {
 					tos = append(tos, users[j].Phone)
 				}
 
-				content := events[0].Sname
-				send(config.Set(tos), content, "", "voice")
+				_, content := genContent(tpl.CHANNEL_VOICE, data)
+				send(data.Event.Id, config.Set(tos), content, "", "voice")
 			}
-		case "sms":
+		case tpl.CHANNEL_SMS:
 			tos := []string{}
 			for j := 0; j < len(users); j++ {
 				tos = append(tos, users[j].Phone)
 			}
 
-			send(config.Set(tos), content, "", "sms")
-		case "mail":
+			_, content := genContent(tpl.CHANNEL_SMS, data)
+			send(data.Event.Id, config.Set(tos), content, "", "sms")
+		case tpl.CHANNEL_MAIL:
 			tos := []string{}
 			for j := 0; j < len(users); j++ {
 				tos = append(tos, users[j].Email)
 			}
 
-			send(config.Set(tos), mailContent, subject, "mail")
-		case "im":
+			subject, content := genContent(tpl.CHANNEL_MAIL, data)
+			send(data.Event.Id, config.Set(tos), content, subject, "mail")
+		case tpl.CHANNEL_IM:
 			tos := []string{}
 			for j := 0; j < len(users); j++ {
 				tos = append(tos, users[j].Im)
 			}
 
-			send(config.Set(tos), content, "", "im")
+			_, content := genContent(tpl.CHANNEL_IM, data)
+			send(data.Event.Id, config.Set(tos), content, "", "im")
+		case tpl.CHANNEL_WEBHOOK:
+			// webhook的接收方是策略配置的webhook, 不是用户, 见notifyWebhooks
 		default:
 			logger.Errorf("not support %s to send notify, events: %+v", notifyTypes[i], events)
 		}
 	}
 }
 
-func genContent(isUpgrade bool, events []*model.Event) (string, string) {
+// genData 模板中可以使用的数据, 聚合的事件以最后一个为准
+func genData(isUpgrade bool, events []*model.Event) *tpl.Data {
 	cnt := len(events)
-	if cnt == 0 {
-		return "", ""
-	}
-
 	cfg := config.GetCfgYml()
+	event := events[cnt-1]
 
 	metricList := []string{}
-	detail, err := events[cnt-1].GetEventDetail()
+	detail, err := event.GetEventDetail()
 	if err != nil {
-		logger.Errorf("get event detail failed, event: %+v, err: %v", events[cnt-1], err)
+		logger.Errorf("get event detail failed, event: %+v, err: %v", event, err)
 	} else {
 		for i := 0; i < len(detail); i++ {
-			metricList = append(metricList, detail[0].Metric)
+			metricList = append(metricList, detail[i].Metric)
 		}
 	}
 
-	metric := strings.Join(metricList, ",")
-
-	status := genStatus(events)
-	sname := events[cnt-1].Sname
-	endpoint := genEndpoint(events)
-	tags := genTags(events)
-	value := events[cnt-1].Value
-	info := events[cnt-1].Info
-	etime := genEtime(events)
-	slink := fmt.Sprintf(cfg.Link.Stra, events[cnt-1].Sid)
-	elink := fmt.Sprintf(cfg.Link.Event, events[cnt-1].Id)
-	clink := ""
-
-	content := fmt.Sprintf(
-		"级别状态：%s\n策略名称：%s\nendpoint：%s\nmetric：%s\ntags：%s\n当前值：%s\n报警说明：%s\n触发时间：%s\n报警详情：%s\n报警策略：%s",
-		status,
-		sname,
-		endpoint,
-		metric,
-		tags,
-		value,
-		info,
-		etime,
-		elink,
-		slink)
-
-	if events[0].EventType == config.ALERT {
-		clink = genClaimLink(events)
-		if clink != "" {
-			content += fmt.Sprintf("\n认领报警：%s", clink)
+	data := &tpl.Data{
+		Event:     event,
+		Events:    events,
+		Details:   detail,
+		IsAlert:   events[0].EventType == config.ALERT,
+		IsUpgrade: isUpgrade,
+		IsMerged:  cnt > 1,
+		Priority:  event.Priority,
+		EventType: config.EventTypeMap[event.EventType],
+		Status:    genStatus(events),
+		Sname:     event.Sname,
+		NodePath:  event.NodePath,
+		Endpoint:  genEndpoint(events),
+		Metric:    strings.Join(config.Set(metricList), ","),
+		Tags:      genTags(events),
+		Value:     event.Value,
+		Info:      event.Info,
+		Etime:     genEtime(events),
+		Elink:     fmt.Sprintf(cfg.Link.Event, event.Id),
+		Slink:     fmt.Sprintf(cfg.Link.Stra, event.Sid),
+	}
+
+	if data.IsAlert {
+		data.Clink = genClaimLink(events)
+		data.HasClaim = data.Clink != ""
+	}
+
+	return data
+}
+
+// genContent 使用匹配的模板渲染, 没有配置模板或者模板渲染失败时使用默认模板
+// 邮件没有配置模板时, 兼容之前的etc/mail.tpl
+func genContent(channel string, data *tpl.Data) (string, string) {
+	subject, content := tpl.Default(channel)
+	custom := false
+
+	if t := selectTpl(channel, data.Event); t != nil {
+		content = t.Content
+		if t.Subject != "" {
+			subject = t.Subject
+		}
+		custom = true
+	} else if channel == tpl.CHANNEL_MAIL {
+		fp := path.Join(file.SelfDir(), "etc", "mail.tpl")
+		if file.IsExist(fp) {
+			bs, err := ioutil.ReadFile(fp)
+			if err != nil {
+				logger.Errorf("read %s failed, err: %v", fp, err)
+			} else {
+				content = string(bs)
+				custom = true
+			}
 		}
+	}
 
+	s, c, err := tpl.Render(channel, subject, content, data)
+	if err == nil {
+		return s, c
 	}
 
-	mailContent := ""
-	if isUpgrade {
-		content = "[报警已升级]\n" + content
+	logger.Errorf("render %s notify template failed, event: %d, err: %v", channel, data.Event.Id, err)
+	if !custom {
+		return "", ""
 	}
 
-	fp := path.Join(file.SelfDir(), "etc", "mail.tpl")
-	t, err := template.ParseFiles(fp)
+	subject, content = tpl.Default(channel)
+	s, c, err = tpl.Render(channel, subject, content, data)
 	if err != nil {
-		logger.Errorf("InternalServerError: cannot parse %s %v", fp, err)
-		mailContent = fmt.Sprintf("InternalServerError: cannot parse %s %v", fp, err)
-	} else {
-		isAlert := false
-		hasClaim := false
-		if events[0].EventType == config.ALERT {
-			isAlert = true
+		logger.Errorf("render %s default template failed, event: %d, err: %v", channel, data.Event.Id, err)
+	}
+	return s, c
+}
+
+// selectTpl 指定策略的模板优先, 然后是节点(越深越优先), 然后是优先级, 同等条件下取最新的
+func selectTpl(channel string, event *model.Event) *model.NotifyTpl {
+	var (
+		ret   *model.NotifyTpl
+		score = -1
+	)
+
+	tpls := cache.NotifyTplCache.Get(channel)
+	for _, t := range tpls {
+		if t.Priority > 0 && t.Priority != event.Priority {
+			continue
 		}
 
-		if clink != "" {
-			hasClaim = true
+		if t.Sid > 0 && t.Sid != event.Sid {
+			continue
 		}
 
-		var body bytes.Buffer
-		err = t.Execute(&body, map[string]interface{}{
-			"IsAlert":   isAlert,
-			"Status":    status,
-			"Sname":     sname,
-			"Endpoint":  endpoint,
-			"Metric":    metric,
-			"Tags":      tags,
-			"Value":     value,
-			"Info":      info,
-			"Etime":     etime,
-			"Elink":     elink,
-			"Slink":     slink,
-			"HasClaim":  hasClaim,
-			"Clink":     clink,
-			"IsUpgrade": isUpgrade,
-		})
+		if t.Nid > 0 && event.NodePath != t.NodePath && !strings.HasPrefix(event.NodePath, t.NodePath+".") {
+			continue
+		}
 
-		if err != nil {
-			logger.Errorf("InternalServerError: %v", err)
-			mailContent = fmt.Sprintf("InternalServerError: %v", err)
-		} else {
-			mailContent += body.String()
+		s := 0
+		if t.Sid > 0 {
+			s += 1 << 20
+		}
+		if t.Nid > 0 {
+			s += 1<<10 + strings.Count(t.NodePath, ".") + 1
+		}
+		if t.Priority > 0 {
+			s++
+		}
+
+		if s > score || (s == score && t.Id > ret.Id) {
+			ret, score = t, s
 		}
 	}
 
-	return content, mailContent
+	return ret
 }
 
 func genClaimLink(events []*model.Event) string {
@@ -220,21 +286,6 @@ func genClaimLink(events []*model.Event) string {
 	return ""
 }
 
-func genSubject(isUpgrade bool, events []*model.Event) string {
-	cnt := len(events)
-
-	subject := ""
-	if isUpgrade {
-		subject = "[报警已升级]" + subject
-	}
-
-	if cnt > 1 {
-		return subject + fmt.Sprintf("[P%d 聚合%s]%s", events[cnt-1].Priority, config.EventTypeMap[events[cnt-1].EventType], events[cnt-1].Sname)
-	}
-
-	return subject + fmt.Sprintf("[P%d %s]%s", events[cnt-1].Priority, config.EventTypeMap[events[cnt-1].EventType], events[cnt-1].Sname)
-}
-
 func genStatus(events []*model.Event) string {
 	cnt := len(events)
 	status := fmt.Sprintf("P%d %s", events[cnt-1].Priority, config.EventTypeMap[events[cnt-1].EventType])
@@ -312,11 +363,13 @@ func genEtime(events []*model.Event) string {
 	return model.ParseEtime(stime) + "~" + model.ParseEtime(etime)
 }
 
-func send(tos []string, content, subject, notifyType string) {
+// send eventId用于关联sender生成的通知记录
+func send(eventId int64, tos []string, content, subject, notifyType string) {
 	sendCfg := config.GetCfgYml().API.Sender
 	servers := sendCfg.Server
 
 	data := dataobj.Notify{
+		EventId: eventId,
 		Tos:     tos,
 		Subject: subject,
 		Content: content,
@@ -361,3 +414,97 @@ func getUserIds(users, groups string) ([]int64, error) {
 
 	return userIds, nil
 }
+
+// getWebhookIds 策略配置的webhook
+func getWebhookIds(sid int64) []int64 {
+	stra, has := cache.StraCache.GetById(sid)
+	if !has {
+		return nil
+	}
+	return stra.NotifyWebhook
+}
+
+// notifyWebhooks 每个webhook单独渲染body, 没有配置body模板时使用webhook通道的通知模板
+func notifyWebhooks(webhookIds []int64, isUpgrade bool, events []*model.Event) {
+	if len(webhookIds) == 0 {
+		return
+	}
+
+	data := genData(isUpgrade, events)
+	defaultBody := ""
+	for _, id := range webhookIds {
+		hook, has := cache.WebhookCache.GetById(id)
+		if !has {
+			logger.Warningf("webhook[%d] not found, sid: %d", id, data.Event.Sid)
+			continue
+		}
+
+		body := ""
+		if hook.Body != "" {
+			var err error
+			if _, body, err = tpl.Render(tpl.CHANNEL_WEBHOOK, "", hook.Body, data); err != nil {
+				logger.Errorf("render body of webhook[%d] failed, event: %d, err: %v", id, data.Event.Id, err)
+				body = ""
+			}
+		}
+
+		if body == "" {
+			if defaultBody == "" {
+				_, defaultBody = genContent(tpl.CHANNEL_WEBHOOK, data)
+			}
+			body = defaultBody
+		}
+
+		send(data.Event.Id, []string{fmt.Sprint(id)}, body, "", "webhook")
+	}
+}
+
+func getOncallIds(oncalls string) ([]int64, error) {
+	oncallIds := []int64{}
+	if strings.TrimSpace(oncalls) == "" {
+		return oncallIds, nil
+	}
+
+	err := json.Unmarshal([]byte(oncalls), &oncallIds)
+	return oncallIds, err
+}
+
+// getOncallUserIds 发送时才确定值班人, 并记录每个事件呼叫了哪些值班人
+func getOncallUserIds(oncallIds []int64, events []*model.Event) []int64 {
+	if len(oncallIds) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	userIds := []int64{}
+	pages := []*model.OncallPage{}
+	for _, id := range oncallIds {
+		userId, err := model.OncallUserAt(id, now)
+		if err != nil {
+			logger.Errorf("get oncall user failed, oncall: %d, err: %v", id, err)
+			continue
+		}
+
+		if userId == 0 {
+			logger.Warningf("nobody is on call, oncall: %d, events: %+v", id, events)
+			continue
+		}
+
+		userIds = append(userIds, userId)
+		for i := 0; i < len(events); i++ {
+			pages = append(pages, &model.OncallPage{
+				OncallId: id,
+				EventId:  events[i].Id,
+				HashId:   events[i].HashId,
+				UserId:   userId,
+				Clock:    now.Unix(),
+			})
+		}
+	}
+
+	if err := model.OncallPagesSave(pages); err != nil {
+		logger.Errorf("save oncall pages failed, pages: %+v, err: %v", pages, err)
+	}
+
+	return userIds
+}
@@ -0,0 +1,226 @@
+package tpl
+
+import (
+	"bytes"
+	"encoding/json"
+	htmltpl "html/template"
+	"strings"
+	texttpl "text/template"
+	"time"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+)
+
+// 通知模板: 模板使用go template语法, mail渲染为html, 其他通道渲染为纯文本
+// alarm发送通知 和 portal预览 使用同一套渲染逻辑
+
+const (
+	CHANNEL_VOICE   = "voice"
+	CHANNEL_SMS     = "sms"
+	CHANNEL_MAIL    = "mail"
+	CHANNEL_IM      = "im"
+	CHANNEL_WEBHOOK = "webhook"
+)
+
+var Channels = []string{CHANNEL_VOICE, CHANNEL_SMS, CHANNEL_MAIL, CHANNEL_IM, CHANNEL_WEBHOOK}
+
+// Data 模板中可以使用的字段, 聚合通知时Event是最后一个事件
+type Data struct {
+	Event     *model.Event
+	Events    []*model.Event
+	Details   []model.EventDetail // Event的现场值, 包括预测值
+	IsAlert   bool
+	IsUpgrade bool
+	IsMerged  bool
+	Priority  int
+	EventType string // 报警 | 恢复
+	Status    string // 如 P1 报警
+	Sname     string
+	NodePath  string
+	Endpoint  string
+	Metric    string
+	Tags      string
+	Value     string
+	Info      string
+	Etime     string
+	Elink     string // 事件详情
+	Slink     string // 策略
+	HasClaim  bool
+	Clink     string // 认领
+}
+
+var funcs = map[string]interface{}{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"unixtime": func(ts int64) string {
+		return time.Unix(ts, 0).Format("2006-01-02 15:04:05")
+	},
+	"json": func(v interface{}) string {
+		bs, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(bs)
+	},
+	"truncate": func(s string, n int) string {
+		r := []rune(s)
+		if len(r) <= n {
+			return s
+		}
+		return string(r[:n])
+	},
+}
+
+// Validate 检查模板的语法
+func Validate(channel, subject, content string) error {
+	_, _, err := Render(channel, subject, content, SampleData())
+	return err
+}
+
+// Render subject为空时只渲染content
+func Render(channel, subject, content string, data *Data) (string, string, error) {
+	var err error
+	if subject != "" {
+		if subject, err = render(CHANNEL_SMS, "subject", subject, data); err != nil {
+			return "", "", err
+		}
+	}
+
+	if content, err = render(channel, "content", content, data); err != nil {
+		return "", "", err
+	}
+
+	return strings.TrimSpace(subject), content, nil
+}
+
+func render(channel, name, text string, data *Data) (string, error) {
+	var body bytes.Buffer
+	if channel == CHANNEL_MAIL {
+		t, err := htmltpl.New(name).Funcs(funcs).Parse(text)
+		if err != nil {
+			return "", err
+		}
+		err = t.Execute(&body, data)
+		return body.String(), err
+	}
+
+	t, err := texttpl.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	err = t.Execute(&body, data)
+	return body.String(), err
+}
+
+// Default 没有配置模板时使用的默认模板
+func Default(channel string) (subject string, content string) {
+	switch channel {
+	case CHANNEL_VOICE:
+		return "", DefaultVoice
+	case CHANNEL_MAIL:
+		return DefaultSubject, DefaultMail
+	case CHANNEL_WEBHOOK:
+		return "", DefaultWebhook
+	default:
+		return "", DefaultContent
+	}
+}
+
+const (
+	DefaultSubject = `{{if .IsUpgrade}}[报警已升级]{{end}}[P{{.Priority}} {{if .IsMerged}}聚合{{end}}{{.EventType}}]{{.Sname}}`
+
+	DefaultVoice = `{{.Sname}}`
+
+	DefaultContent = `{{if .IsUpgrade}}[报警已升级]
+{{end}}级别状态：{{.Status}}
+策略名称：{{.Sname}}
+endpoint：{{.Endpoint}}
+metric：{{.Metric}}
+tags：{{.Tags}}
+当前值：{{.Value}}
+报警说明：{{.Info}}
+触发时间：{{.Etime}}
+报警详情：{{.Elink}}
+报警策略：{{.Slink}}{{if .HasClaim}}
+认领报警：{{.Clink}}{{end}}`
+
+	// webhook的内容作为请求的body
+	DefaultWebhook = `{"event":{{json .Event}},"status":{{json .Status}},"is_alert":{{.IsAlert}},"is_upgrade":{{.IsUpgrade}},"endpoint":{{json .Endpoint}},"metric":{{json .Metric}},"tags":{{json .Tags}},"elink":{{json .Elink}},"clink":{{json .Clink}}}`
+
+	DefaultMail = `<html>
+<body>
+{{if .IsUpgrade}}<p><b>[报警已升级]</b></p>{{end}}
+<table border="1" cellspacing="0" cellpadding="4">
+<tr><td>级别状态</td><td>{{.Status}}</td></tr>
+<tr><td>策略名称</td><td>{{.Sname}}</td></tr>
+<tr><td>节点</td><td>{{.NodePath}}</td></tr>
+<tr><td>endpoint</td><td>{{.Endpoint}}</td></tr>
+<tr><td>metric</td><td>{{.Metric}}</td></tr>
+<tr><td>tags</td><td>{{.Tags}}</td></tr>
+<tr><td>当前值</td><td>{{.Value}}</td></tr>
+<tr><td>报警说明</td><td>{{.Info}}</td></tr>
+<tr><td>触发时间</td><td>{{.Etime}}</td></tr>
+<tr><td>报警详情</td><td><a href="{{.Elink}}">{{.Elink}}</a></td></tr>
+<tr><td>报警策略</td><td><a href="{{.Slink}}">{{.Slink}}</a></td></tr>
+{{if .HasClaim}}<tr><td>认领报警</td><td><a href="{{.Clink}}">{{.Clink}}</a></td></tr>{{end}}
+</table>
+</body>
+</html>`
+)
+
+// SampleData 预览模板时使用的示例事件
+func SampleData() *Data {
+	detail := []model.EventDetail{
+		{
+			Metric: "cpu.idle",
+			Tags:   map[string]string{"cpu": "cpu-total"},
+			Points: []*model.EventDetailPoint{
+				{Timestamp: 1577836800, Value: 3.2},
+				{Timestamp: 1577836810, Value: 2.8},
+			},
+		},
+	}
+	bs, _ := json.Marshal(detail)
+
+	event := &model.Event{
+		Id:            1,
+		Sid:           1,
+		Sname:         "cpu idle too low",
+		NodePath:      "cop.dev.app",
+		Endpoint:      "10.0.0.1",
+		EndpointAlias: "app-01",
+		Priority:      1,
+		EventType:     "alert",
+		HashId:        1,
+		Etime:         1577836810,
+		Value:         "cpu.idle: 2.8",
+		Info:          "cpu.idle all(#2) < 5",
+		Detail:        string(bs),
+		Users:         "[]",
+		Groups:        "[]",
+		Nid:           1,
+	}
+
+	return &Data{
+		Event:     event,
+		Events:    []*model.Event{event},
+		Details:   detail,
+		IsAlert:   true,
+		Priority:  1,
+		EventType: "报警",
+		Status:    "P1 报警",
+		Sname:     event.Sname,
+		NodePath:  event.NodePath,
+		Endpoint:  "10.0.0.1(app-01)",
+		Metric:    "cpu.idle",
+		Tags:      "cpu=cpu-total",
+		Value:     event.Value,
+		Info:      event.Info,
+		Etime:     "2020-01-01 08:00:10",
+		Elink:     "http://portal.falcon-ng.com/#/monitor/history/his/1",
+		Slink:     "http://portal.falcon-ng.com/#/monitor/strategy/1",
+		HasClaim:  true,
+		Clink:     "http://portal.falcon-ng.com/#/monitor/history/cur/1",
+	}
+}
@@ -0,0 +1,47 @@
+package tpl
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Render(t *testing.T) {
+	for _, channel := range Channels {
+		subject, content := Default(channel)
+		if err := Validate(channel, subject, content); err != nil {
+			t.Fatalf("default template of %s invalid: %v", channel, err)
+		}
+	}
+
+	data := SampleData()
+
+	// mail按html渲染, 需要转义
+	_, content, err := Render(CHANNEL_MAIL, "", "<b>{{.Info}}</b>", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != "<b>cpu.idle all(#2) &lt; 5</b>" {
+		t.Fatalf("unexpected mail content: %s", content)
+	}
+
+	_, content, err = Render(CHANNEL_SMS, "", "{{.Info}}", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content != data.Info {
+		t.Fatalf("unexpected sms content: %s", content)
+	}
+
+	subject, content, err := Render(CHANNEL_IM, " [{{upper .Event.EventType}}] ",
+		"{{range .Details}}{{.Metric}}:{{range .Points}} {{.Value}}{{end}}{{end}}", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "[ALERT]" || content != "cpu.idle: 3.2 2.8" {
+		t.Fatalf("unexpected im subject: %s, content: %s", subject, content)
+	}
+
+	if err := Validate(CHANNEL_SMS, "", "{{.NoSuchField}}"); err == nil || !strings.Contains(err.Error(), "NoSuchField") {
+		t.Fatalf("expect error on unknown field, got: %v", err)
+	}
+}
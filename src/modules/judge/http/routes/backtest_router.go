@@ -0,0 +1,42 @@
+package routes
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/worker"
+)
+
+// backtestForm stra是portal格式的策略, strategy是judge内部格式的策略, 二选一
+type backtestForm struct {
+	Stra     *model.Stra      `json:"stra"`
+	Strategy *schema.Strategy `json:"strategy"`
+	Start    int64            `json:"start"`
+	End      int64            `json:"end"`
+}
+
+// straBacktest 用历史数据回放策略, 返回会产生的事件, 不会推送
+func straBacktest(c *gin.Context) {
+	var f backtestForm
+	if err := c.ShouldBindJSON(&f); err != nil {
+		renderMessage(c, err)
+		return
+	}
+
+	var (
+		ret *worker.BacktestResult
+		err error
+	)
+	switch {
+	case f.Stra != nil:
+		ret, err = worker.BacktestStra(f.Stra, f.Start, f.End)
+	case f.Strategy != nil:
+		ret, err = worker.Backtest(f.Strategy, f.Start, f.End)
+	default:
+		err = errors.New("stra or strategy required")
+	}
+	renderData(c, ret, err)
+}
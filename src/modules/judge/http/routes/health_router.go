@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 与judge.go中的version保持一致
+const Version = 1
+
+func ping(c *gin.Context) {
+	c.String(200, "pong")
+}
+
+func version(c *gin.Context) {
+	c.String(200, strconv.Itoa(Version))
+}
+
+func addr(c *gin.Context) {
+	c.String(200, c.Request.RemoteAddr)
+}
+
+func pid(c *gin.Context) {
+	c.String(200, fmt.Sprintf("%d", os.Getpid()))
+}
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// Config routes
+func Config(r *gin.Engine) {
+	sys := r.Group("/api/judge")
+	{
+		sys.GET("/ping", ping)
+		sys.GET("/version", version)
+		sys.GET("/pid", pid)
+		sys.GET("/addr", addr)
+
+		sys.GET("/summary", summary)
+		sys.GET("/stra", straList)
+		sys.POST("/stra/reload", straReloadAll)
+		sys.GET("/stra/:id", straGet)
+		sys.GET("/stra/:id/series", straSeries)
+		sys.GET("/stra/:id/state", straState)
+		sys.POST("/stra/:id/reload", straReload)
+		sys.POST("/stra/:id/run", straRun)
+		sys.POST("/backtest", straBacktest)
+	}
+}
@@ -0,0 +1,97 @@
+package routes
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/open-falcon/falcon-ng/src/modules/judge/worker"
+)
+
+func summary(c *gin.Context) {
+	renderData(c, worker.GetWorkerSummary(), nil)
+}
+
+func straList(c *gin.Context) {
+	renderData(c, worker.ListStrategySummary(), nil)
+}
+
+func straGet(c *gin.Context) {
+	id, err := urlParamId(c)
+	if err != nil {
+		renderMessage(c, err)
+		return
+	}
+
+	stra, found := worker.GetStrategySummary(id)
+	if !found {
+		renderMessage(c, fmt.Errorf("strategy %d not found", id))
+		return
+	}
+	renderData(c, stra, nil)
+}
+
+// straSeries 策略关联的曲线和缓存中的点
+func straSeries(c *gin.Context) {
+	id, err := urlParamId(c)
+	if err != nil {
+		renderMessage(c, err)
+		return
+	}
+
+	series, found := worker.GetStrategySeries(id)
+	if !found {
+		renderMessage(c, fmt.Errorf("strategy %d not found", id))
+		return
+	}
+	renderData(c, series, nil)
+}
+
+// straState 每条曲线的报警(解除)状态和最近一次产生的事件
+func straState(c *gin.Context) {
+	id, err := urlParamId(c)
+	if err != nil {
+		renderMessage(c, err)
+		return
+	}
+
+	states, found := worker.GetStrategyStates(id)
+	if !found {
+		renderMessage(c, fmt.Errorf("strategy %d not found", id))
+		return
+	}
+	renderData(c, states, nil)
+}
+
+func straReloadAll(c *gin.Context) {
+	renderMessage(c, worker.Reload(0))
+}
+
+func straReload(c *gin.Context) {
+	id, err := urlParamId(c)
+	if err != nil {
+		renderMessage(c, err)
+		return
+	}
+
+	renderMessage(c, worker.Reload(id))
+}
+
+func straRun(c *gin.Context) {
+	id, err := urlParamId(c)
+	if err != nil {
+		renderMessage(c, err)
+		return
+	}
+
+	renderMessage(c, worker.RunStrategy(id))
+}
+
+func urlParamId(c *gin.Context) (int64, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("illegal strategy id: %s", c.Param("id"))
+	}
+	return id, nil
+}
@@ -7,6 +7,8 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/open-falcon/falcon-ng/src/modules/judge/http"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/http/routes"
 	"github.com/open-falcon/falcon-ng/src/modules/judge/logger"
 	"github.com/open-falcon/falcon-ng/src/modules/judge/worker"
 
@@ -14,7 +16,7 @@ import (
 	"github.com/toolkits/pkg/runner"
 )
 
-const version = 1
+const version = routes.Version
 
 var (
 	vers *bool
@@ -63,13 +65,21 @@ func main() {
 	aconf()
 	start()
 
-	worker.Start(*conf)
+	opts := worker.InitOptions(*conf)
+	worker.Start(opts)
+
+	if opts.HTTP.Listen != "" {
+		http.Start(opts.HTTP, opts.Log.Level)
+	}
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	select {
 	case <-c:
 		logger.Info(0, "stop signal caught, try to stop judge server")
+		if opts.HTTP.Listen != "" {
+			http.Shutdown()
+		}
 		worker.Stop()
 	}
 	logger.Info(0, "judge server stopped succefully")
@@ -0,0 +1,17 @@
+package rpc
+
+import (
+	"github.com/open-falcon/falcon-ng/src/modules/judge/logger"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+func (j *Judge) Ping(args string, reply *dataobj.SimpleRpcResponse) error {
+	return nil
+}
+
+func (j *Judge) Send(items []*dataobj.JudgeItem, reply *dataobj.SimpleRpcResponse) error {
+	ignored := stg.Push(items)
+	logger.Debugf(0, "recv %d items from transfer, ignored:%d", len(items), ignored)
+	return nil
+}
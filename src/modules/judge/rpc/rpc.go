@@ -0,0 +1,58 @@
+package rpc
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"net/rpc"
+	"reflect"
+	"time"
+
+	"github.com/open-falcon/falcon-ng/src/modules/judge/logger"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage"
+
+	"github.com/ugorji/go/codec"
+)
+
+type RPCOption struct {
+	Listen string `yaml:"listen"` // 为空时不启动rpc, 只从transfer查询数据
+}
+
+var stg storage.Storage
+
+type Judge int
+
+// Start 接收transfer推送过来的数据
+func Start(opts RPCOption, s storage.Storage) {
+	stg = s
+
+	server := rpc.NewServer()
+	server.Register(new(Judge))
+
+	l, err := net.Listen("tcp", opts.Listen)
+	if err != nil {
+		log.Fatalf("[F] cannot listen %s: %v", opts.Listen, err)
+	}
+	logger.Infof(0, "rpc listening %s", opts.Listen)
+
+	var mh codec.MsgpackHandle
+	mh.MapType = reflect.TypeOf(map[string]interface{}(nil))
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			logger.Warningf(0, "listener accept error:%v", err)
+			time.Sleep(time.Duration(100) * time.Millisecond)
+			continue
+		}
+
+		var bufconn = struct {
+			io.Closer
+			*bufio.Reader
+			*bufio.Writer
+		}{conn, bufio.NewReader(conn), bufio.NewWriter(conn)}
+
+		go server.ServeCodec(codec.MsgpackSpecRpc.ServerCodec(bufconn, &mh))
+	}
+}
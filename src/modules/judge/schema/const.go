@@ -16,6 +16,7 @@ const (
 
 const (
 	CATEGORY_THRESHOLD = 1 // 阈值
+	CATEGORY_MODEL     = 2 // 模型, 根据历史数据预测, 实际值偏离预测值时报警
 
 	EVENT_ALERT   = "alert"
 	EVENT_RECOVER = "recovery"
@@ -26,6 +27,9 @@ const (
 	TRIGGER_DURATION_HAPPEN = "duration_happen"
 	TRIGGER_DURATION_STAT   = "duration_stat"
 	TRIGGER_NODATA          = "nodata"
+	TRIGGER_PERIOD_COMPARE  = "period_compare" // 同比, 和N秒之前的同一个时间窗口比较
+	TRIGGER_EWMA            = "ewma"           // 模型, 指数加权移动平均
+	TRIGGER_HOLT_WINTERS    = "holt_winters"   // 模型, 三次指数平滑, 适用于有周期性的曲线
 
 	MATH_OPERATOR_MAX = "max"
 	MATH_OPERATOR_MIN = "min"
@@ -33,6 +37,16 @@ const (
 	MATH_OPERATOR_SUM = "sum"
 	MATH_OPERATOR_OBO = "all" // one by one
 
+	// 同比的比较方式
+	COMPARE_DIFF     = "diff"     // 差值, 当前-之前
+	COMPARE_DIFF_ABS = "diff_abs" // 差值的绝对值
+	COMPARE_RATE     = "rate"     // 变化率, (当前-之前)/之前*100
+	COMPARE_RATE_ABS = "rate_abs" // 变化率的绝对值
+
+	// 模型的偏离度
+	MODEL_DEVIATION     = "dev"     // (实际值-预测值)/标准差
+	MODEL_DEVIATION_ABS = "dev_abs" // 偏离度的绝对值
+
 	// 曲线相关
 	ENDPOINT_KEYWORD  = "endpoint"
 	COUNTER_SEPERATOR = "/"
@@ -0,0 +1,48 @@
+package entity
+
+import (
+	"sort"
+	"time"
+
+	"github.com/open-falcon/falcon-ng/src/modules/judge/logger"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema"
+)
+
+// Backtest 用模拟的时钟回放 [start, end] 的历史数据, 返回会产生的事件, 不推送
+// 策略实体不需要Start, storage应该是只包含历史数据的实现
+func (se *StrategyEntity) Backtest(start, end int64) []*schema.Event {
+	se.Update(true)
+
+	judgements := se.judgements()
+	se.RLock()
+	interval := se.interval
+	se.RUnlock()
+	if len(judgements) == 0 || interval <= 0 {
+		logger.Warning(se.ID, "strategy backtest: no series matched")
+		return []*schema.Event{}
+	}
+
+	// 从start开始判断, 不使用当前时间初始化
+	for _, je := range judgements {
+		je.Lock()
+		je.next, je.deadline = timeWindow(time.Unix(start, 0), je.interval)
+		je.Unlock()
+	}
+
+	events := make([]*schema.Event, 0)
+	for ts := start + int64(interval); ts <= end+int64(interval); ts += int64(interval) {
+		now := time.Unix(ts, 0)
+		executions := se.ExecutionsByTime(now)
+		if len(executions) == 0 {
+			continue
+		}
+		for _, je := range judgements {
+			events = append(events, je.Run(se.storage, se.Strategy, executions, now)...)
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Etime < events[j].Etime })
+	logger.Infof(se.ID, "strategy backtest finished, range:[%d, %d], series:%d, events:%d",
+		start, end, len(judgements), len(events))
+	return events
+}
@@ -55,6 +55,27 @@ func NewExecutionEntity(strategy *schema.Strategy,
 				se.Expressions[i].Params,
 			)
 
+		case schema.TRIGGER_PERIOD_COMPARE:
+			trg, err = trigger.NewTriggerPeriodCompare(
+				se.Expressions[i].Thresholds,
+				se.Expressions[i].Operator,
+				se.Expressions[i].Params,
+			)
+
+		case schema.TRIGGER_EWMA:
+			trg, err = trigger.NewTriggerEWMA(
+				se.Expressions[i].Thresholds,
+				se.Expressions[i].Operator,
+				se.Expressions[i].Params,
+			)
+
+		case schema.TRIGGER_HOLT_WINTERS:
+			trg, err = trigger.NewTriggerHoltWinters(
+				se.Expressions[i].Thresholds,
+				se.Expressions[i].Operator,
+				se.Expressions[i].Params,
+			)
+
 		case schema.TRIGGER_NODATA:
 			trg, err = trigger.NewTriggerNodata(
 				se.Expressions[i].Params,
@@ -87,24 +108,37 @@ func (ee *ExecutionEntity) Effective(day int, minute int) bool {
 	return false
 }
 
+// Run 返回 状态, 现场值, 预测值(只有模型类算子才有), info, 逻辑运算符
 func (ee *ExecutionEntity) Run(stg storage.Storage,
-	ID uint32, current int64, granularity int) (int, []*dataobj.RRDData, []string, string) {
+	ID uint32, current int64, granularity int) (int, []*dataobj.RRDData, []*dataobj.RRDData, []string, string) {
 
 	if len(ee.Triggers) == 0 {
-		return schema.STATUS_EMPTY, nil, []string{}, ""
+		return schema.STATUS_EMPTY, nil, nil, []string{}, ""
 	}
 	if ID <= 0 {
-		return schema.STATUS_EMPTY, nil, []string{}, ""
+		return schema.STATUS_EMPTY, nil, nil, []string{}, ""
 	}
 
 	var (
 		points = make(map[int64]*dataobj.RRDData)
+		preds  = make(map[int64]*dataobj.RRDData)
 		infos  = make([]string, 0)
 		status = schema.STATUS_INIT
 	)
 
 	for i := range ee.Triggers {
-		istatus, ipoints, info, err := ee.Triggers[i].Run(stg, ID, current, granularity)
+		var (
+			istatus int
+			ipoints []*dataobj.RRDData
+			ipreds  []*dataobj.RRDData
+			info    string
+			err     error
+		)
+		if mt, ok := ee.Triggers[i].(trigger.ModelTrigger); ok {
+			istatus, ipoints, ipreds, info, err = mt.Predict(stg, ID, current, granularity)
+		} else {
+			istatus, ipoints, info, err = ee.Triggers[i].Run(stg, ID, current, granularity)
+		}
 		if err != nil {
 			logger.Warningf(ee.sid, "timestamp[%d] trigger run failed: %v", current, err)
 		}
@@ -115,13 +149,16 @@ func (ee *ExecutionEntity) Run(stg storage.Storage,
 				points[ipoints[j].Timestamp] = ipoints[j]
 			}
 		}
+		for j := range ipreds {
+			preds[ipreds[j].Timestamp] = ipreds[j]
+		}
 		if len(info) > 0 {
 			infos = append(infos, info)
 		}
 	}
 	// null/empty 都代表跳过当前点; null 需要下次重试, empty 不需要下次重试
 	if status == schema.STATUS_NULL || status == schema.STATUS_EMPTY {
-		return status, nil, []string{}, ""
+		return status, nil, nil, []string{}, ""
 	}
 
 	ret := make([]*dataobj.RRDData, len(points))
@@ -130,5 +167,9 @@ func (ee *ExecutionEntity) Run(stg storage.Storage,
 		ret[i] = p
 		i++
 	}
-	return status, ret, infos, ee.Operator
+	var pret []*dataobj.RRDData
+	for _, p := range preds {
+		pret = append(pret, p)
+	}
+	return status, ret, pret, infos, ee.Operator
 }
@@ -0,0 +1,170 @@
+package entity
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema/expression"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage/series"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+// 多指标运算的结果作为一条"虚拟曲线", 在Storage之上封装一层:
+// 虚拟曲线的ID从exprIDBase开始分配, 和storage中的ID不会冲突,
+// 查询时先查询各个操作数的曲线, 按时间戳对齐后计算, 对trigger透明
+
+const exprIDBase uint32 = 1 << 31
+
+var exprCreated = exprIDBase
+
+type exprSeries struct {
+	*series.Series
+	expr     *expression.Expression
+	operands map[string]uint32 // metric -> 操作数的曲线ID
+}
+
+type ExpressionStorage struct {
+	storage.Storage
+	sync.RWMutex
+	series map[uint32]*exprSeries
+	keys   map[string]uint32 // 虚拟曲线的key -> ID, 曲线不变时ID保持不变
+}
+
+func NewExpressionStorage(stg storage.Storage) *ExpressionStorage {
+	return &ExpressionStorage{
+		Storage: stg,
+		series:  make(map[uint32]*exprSeries),
+		keys:    make(map[string]uint32),
+	}
+}
+
+func isExprID(ID uint32) bool {
+	return ID >= exprIDBase
+}
+
+// Set 注册虚拟曲线, key需要包含judgement的信息, 同一个策略中可能有相同的表达式
+func (es *ExpressionStorage) Set(key string, s *series.Series,
+	expr *expression.Expression, operands map[string]uint32) uint32 {
+	es.Lock()
+	defer es.Unlock()
+
+	ID, found := es.keys[key]
+	if !found {
+		ID = atomic.AddUint32(&exprCreated, 1)
+		es.keys[key] = ID
+	}
+	s.ID = ID
+	es.series[ID] = &exprSeries{Series: s, expr: expr, operands: operands}
+	return ID
+}
+
+// Retain 清理不在alive中的虚拟曲线
+func (es *ExpressionStorage) Retain(alive map[uint32]struct{}) {
+	es.Lock()
+	defer es.Unlock()
+
+	for key, ID := range es.keys {
+		if _, found := alive[ID]; !found {
+			delete(es.keys, key)
+			delete(es.series, ID)
+		}
+	}
+}
+
+func (es *ExpressionStorage) lookup(ID uint32) (*exprSeries, bool) {
+	if !isExprID(ID) {
+		return nil, false
+	}
+	es.RLock()
+	defer es.RUnlock()
+	s, found := es.series[ID]
+	return s, found
+}
+
+func (es *ExpressionStorage) Query(ID uint32, stime, etime int64, span int) ([]*dataobj.RRDData, error) {
+	s, found := es.lookup(ID)
+	if !found {
+		return es.Storage.Query(ID, stime, etime, span)
+	}
+
+	operands := make(map[string][]*dataobj.RRDData, len(s.operands))
+	for metric, oid := range s.operands {
+		ps, err := es.Storage.Query(oid, stime, etime, span)
+		if err != nil {
+			return nil, err
+		}
+		operands[metric] = ps
+	}
+	return evalPoints(s.expr, operands), nil
+}
+
+func (es *ExpressionStorage) Get(ID uint32) (*series.Series, bool) {
+	s, found := es.lookup(ID)
+	if !found {
+		return es.Storage.Get(ID)
+	}
+	return s.Series, true
+}
+
+func (es *ExpressionStorage) Buffered(ID uint32) (map[int][]*dataobj.RRDData, bool) {
+	s, found := es.lookup(ID)
+	if !found {
+		return es.Storage.Buffered(ID)
+	}
+
+	spans := make(map[int]map[string][]*dataobj.RRDData)
+	for metric, oid := range s.operands {
+		buffered, found := es.Storage.Buffered(oid)
+		if !found {
+			return nil, false
+		}
+		for span, ps := range buffered {
+			if _, found := spans[span]; !found {
+				spans[span] = make(map[string][]*dataobj.RRDData)
+			}
+			spans[span][metric] = ps
+		}
+	}
+
+	ret := make(map[int][]*dataobj.RRDData, len(spans))
+	for span, operands := range spans {
+		ret[span] = evalPoints(s.expr, operands)
+	}
+	return ret, true
+}
+
+// evalPoints 按时间戳对齐, 只计算所有操作数都有值的时刻, 结果为NaN的点丢弃
+func evalPoints(expr *expression.Expression,
+	operands map[string][]*dataobj.RRDData) []*dataobj.RRDData {
+
+	values := make(map[int64]map[string]float64)
+	for metric, ps := range operands {
+		for i := range ps {
+			if ps[i] == nil || math.IsNaN(float64(ps[i].Value)) {
+				continue
+			}
+			if _, found := values[ps[i].Timestamp]; !found {
+				values[ps[i].Timestamp] = make(map[string]float64, len(operands))
+			}
+			values[ps[i].Timestamp][metric] = float64(ps[i].Value)
+		}
+	}
+
+	ret := make([]*dataobj.RRDData, 0, len(values))
+	for ts, vs := range values {
+		if len(vs) != len(expr.Metrics()) {
+			continue
+		}
+		value := expr.Eval(vs)
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		ret = append(ret, dataobj.NewRRDData(ts, value))
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Timestamp < ret[j].Timestamp })
+	return ret
+}
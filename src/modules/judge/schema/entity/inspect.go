@@ -0,0 +1,115 @@
+package entity
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema"
+)
+
+// 运行时状态的快照, 供http接口排查问题使用
+
+type SeriesDetail struct {
+	ID       uint32                     `json:"id"`
+	Metric   string                     `json:"metric"`
+	Tags     map[string]string          `json:"tags"`
+	Step     int                        `json:"step"`
+	Dstype   string                     `json:"dstype"`
+	Buffered map[int][]*dataobj.RRDData `json:"buffered"` // 缓存中的点, span -> points
+	History  []*dataobj.RRDData         `json:"history"`  // 等待组装到事件中的现场值
+}
+
+type JudgementState struct {
+	ID        uint32          `json:"id"`
+	Series    []uint32        `json:"series"`
+	Interval  int             `json:"interval"`
+	Next      int64           `json:"next"`       // 下一个待判断的时间戳
+	Status    string          `json:"status"`     // 最近一次判断的结果
+	LastEvent string          `json:"last_event"` // 最近一次发出的事件类型
+	Driver    json.RawMessage `json:"driver"`     // 报警(解除)判断的计数
+	Event     *schema.Event   `json:"event"`      // 最近一次产生的事件, 进程启动后没有产生过为null
+}
+
+// Series 返回策略关联的所有曲线和缓存的点
+func (se *StrategyEntity) Series() []*SeriesDetail {
+	ret := make([]*SeriesDetail, 0)
+
+	for _, je := range se.judgements() {
+		je.Lock()
+		for _, m := range je.Metrics {
+			detail := &SeriesDetail{ID: m.ID}
+			if s, found := se.storage.Get(m.ID); found {
+				detail.Metric = s.Metric
+				detail.Tags = s.Tags
+				detail.Step = s.Granularity
+				detail.Dstype = s.Dstype
+			}
+			detail.Buffered, _ = se.storage.Buffered(m.ID)
+			if m.History != nil {
+				detail.History = m.History.Dump()
+			}
+			ret = append(ret, detail)
+		}
+		je.Unlock()
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret
+}
+
+// States 返回每条曲线当前的报警(解除)状态
+func (se *StrategyEntity) States() []*JudgementState {
+	ret := make([]*JudgementState, 0)
+
+	for _, je := range se.judgements() {
+		ret = append(ret, je.State())
+	}
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret
+}
+
+func (se *StrategyEntity) judgements() []*JudgementEntity {
+	se.RLock()
+	defer se.RUnlock()
+
+	ret := make([]*JudgementEntity, 0, len(se.Judgements))
+	for _, je := range se.Judgements {
+		ret = append(ret, je)
+	}
+	return ret
+}
+
+func (je *JudgementEntity) State() *JudgementState {
+	je.Lock()
+	defer je.Unlock()
+
+	state := &JudgementState{
+		ID:        je.ID(),
+		Interval:  je.interval,
+		Next:      je.next,
+		LastEvent: eventMapping(je.lastEvent),
+		Event:     je.last,
+	}
+	for _, m := range je.Metrics {
+		state.Series = append(state.Series, m.ID)
+	}
+
+	if pd, ok := je.Driver.(*AlertPointDriver); ok {
+		state.Status = schema.MapStatus(pd.LastStatus)
+	}
+	state.Driver, _ = json.Marshal(je.Driver)
+
+	return state
+}
+
+func eventMapping(code int) string {
+	switch code {
+	case schema.EVENT_CODE_ALERT:
+		return schema.EVENT_ALERT
+	case schema.EVENT_CODE_RECOVER:
+		return schema.EVENT_RECOVER
+	}
+	return ""
+}
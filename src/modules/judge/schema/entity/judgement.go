@@ -107,6 +107,9 @@ func (je *JudgementEntity) Run(
 
 	var events []*schema.Event
 
+	je.Lock()
+	defer je.Unlock()
+
 	start, end := timeWindow(now, je.interval)
 	if je.next == 0 {
 		logger.Debugf(je.sid, "judgement first start, initialize")
@@ -138,13 +141,14 @@ func (je *JudgementEntity) Run(
 
 		final := schema.STATUS_INIT                    // 初始值
 		fpoints := make(map[uint32][]*dataobj.RRDData) // 待写入缓存中的点
+		fpreds := make(map[uint32][]*dataobj.RRDData)  // 待写入缓存中的预测值
 		finfos := make([]infoTuple, 0)                 // 用于填充event.Info字段
 
 		for i := range je.Metrics {
 			ifinal := schema.STATUS_INIT
 			for j := range executions {
 				if executions[j].key == je.Metrics[i].key {
-					status, points, infos, op := executions[j].Run(stg, je.Metrics[i].ID, current, je.interval)
+					status, points, preds, infos, op := executions[j].Run(stg, je.Metrics[i].ID, current, je.interval)
 
 					ifinal = logicalOperate(strategy.Operator, ifinal, status)
 					if _, found := ongoings[current]; !found {
@@ -159,6 +163,9 @@ func (je *JudgementEntity) Run(
 					if len(infos) > 0 {
 						finfos = append(finfos, infoTuple{ID: je.Metrics[i].ID, Infos: infos, Op: op})
 					}
+					if len(preds) > 0 {
+						fpreds[je.Metrics[i].ID] = append(fpreds[je.Metrics[i].ID], preds...)
+					}
 					if len(points) > 0 {
 						if _, found := fpoints[je.Metrics[i].ID]; !found {
 							fpoints[je.Metrics[i].ID] = points
@@ -198,6 +205,13 @@ func (je *JudgementEntity) Run(
 					}
 					je.Metrics[i].History.Write(points)
 				}
+				preds, found := fpreds[je.Metrics[i].ID]
+				if found {
+					if je.Metrics[i].Predictions == nil {
+						je.Metrics[i].Predictions = buffer.NewChainHistory(je.historySize)
+					}
+					je.Metrics[i].Predictions.Write(preds)
+				}
 			}
 		} else {
 			// 时间戳错误, 打印日志
@@ -216,6 +230,9 @@ func (je *JudgementEntity) Run(
 						current, je.Metrics[i].ID)
 					je.Metrics[i].History.Cleanup()
 				}
+				if je.Metrics[i].Predictions != nil {
+					je.Metrics[i].Predictions.Cleanup()
+				}
 			}
 		}
 		// 判断是否触发报警 or 报警解除
@@ -233,6 +250,9 @@ func (je *JudgementEntity) Run(
 					if je.Metrics[i].History != nil {
 						je.Metrics[i].History.Reset()
 					}
+					if je.Metrics[i].Predictions != nil {
+						je.Metrics[i].Predictions.Reset()
+					}
 				}
 			}
 		} else if eventCode == schema.EVENT_CODE_RECOVER {
@@ -274,6 +294,11 @@ func (je *JudgementEntity) Run(
 					series.Tags,
 					series.Granularity,
 					points)
+
+				if je.Metrics[i].Predictions != nil {
+					event.SetPredPoints(je.Metrics[i].Predictions.Dump())
+					je.Metrics[i].Predictions.Reset()
+				}
 			}
 			// 更新info字段
 			var info string
@@ -311,6 +336,7 @@ func (je *JudgementEntity) Run(
 			// 更新 detail 字段
 			if event.Finalize() {
 				events = append(events, event)
+				je.last = event
 			}
 		}
 		logger.Debugf(je.sid, "judgement timestamp[%d] finished successfully", current)
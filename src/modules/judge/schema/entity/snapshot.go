@@ -0,0 +1,134 @@
+package entity
+
+import (
+	"strings"
+
+	"github.com/open-falcon/falcon-ng/src/modules/judge/logger"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema"
+)
+
+// 报警状态的持久化, 进程重启后恢复, 避免 丢失恢复事件 或者 重复报警
+// 曲线ID在重启后会变化, 用曲线的key来标识一个judgement
+
+// JudgementSnapshot 一条曲线的报警状态
+type JudgementSnapshot struct {
+	Next      int64             `json:"next"`            // 下一个待判断的时间戳
+	LastEvent int               `json:"last_event"`      // 上一次的事件, EVENT_CODE
+	Driver    *AlertPointDriver `json:"driver"`          // 报警(解除)判断的计数, 包括报警次数限制的窗口
+	Event     *schema.Event     `json:"event,omitempty"` // 最近一次产生的事件
+}
+
+// Snapshot 返回所有曲线的报警状态, 还没有恢复的状态也一并返回, key是曲线的key
+func (se *StrategyEntity) Snapshot() map[string]*JudgementSnapshot {
+	ret := make(map[string]*JudgementSnapshot)
+
+	se.RLock()
+	for key, state := range se.restores {
+		ret[key] = state
+	}
+	se.RUnlock()
+
+	for _, je := range se.judgements() {
+		key, ok := se.judgementKey(je)
+		if !ok {
+			continue
+		}
+		if state := je.snapshot(); state != nil {
+			ret[key] = state
+		}
+	}
+	return ret
+}
+
+// Restore 设置待恢复的状态, 曲线更新时生效
+func (se *StrategyEntity) Restore(states map[string]*JudgementSnapshot) {
+	if len(states) == 0 {
+		return
+	}
+
+	se.Lock()
+	defer se.Unlock()
+	se.restores = states
+}
+
+// restoreJudgement 调用方需要持有写锁
+func (se *StrategyEntity) restoreJudgement(je *JudgementEntity) {
+	if len(se.restores) == 0 {
+		return
+	}
+	key, ok := se.judgementKey(je)
+	if !ok {
+		return
+	}
+	state, found := se.restores[key]
+	if !found {
+		return
+	}
+	delete(se.restores, key)
+
+	if je.restore(state, se.Strategy.Alert) {
+		logger.Debugf(se.ID, "judgement state restored, series[%d], next:%d", je.ID(), state.Next)
+	}
+}
+
+// judgementKey 由所有曲线的key拼接而成, Metrics是按key排好序的
+func (se *StrategyEntity) judgementKey(je *JudgementEntity) (string, bool) {
+	keys := make([]string, 0, len(je.Metrics))
+	for _, m := range je.Metrics {
+		s, found := se.storage.Get(m.ID)
+		if !found {
+			return "", false
+		}
+		keys = append(keys, m.key+"="+s.Key())
+	}
+	return strings.Join(keys, ";"), true
+}
+
+func (je *JudgementEntity) snapshot() *JudgementSnapshot {
+	je.Lock()
+	defer je.Unlock()
+
+	driver, ok := je.Driver.(*AlertPointDriver)
+	if !ok {
+		return nil
+	}
+	// 一直正常的曲线, 不需要保存
+	if je.lastEvent == schema.EVENT_CODE_RECOVER &&
+		driver.LastEventStatus == schema.EVENT_CODE_RECOVER &&
+		len(driver.AlertTimestamp) == 0 &&
+		len(driver.EventAlertTimestamp) == 0 {
+		return nil
+	}
+	copied := *driver
+	copied.AlertTimestamp = append([]int64{}, driver.AlertTimestamp...)
+	copied.RecoverTimestamp = append([]int64{}, driver.RecoverTimestamp...)
+	copied.EventAlertTimestamp = append([]int64{}, driver.EventAlertTimestamp...)
+
+	return &JudgementSnapshot{
+		Next:      je.next,
+		LastEvent: je.lastEvent,
+		Driver:    &copied,
+		Event:     je.last,
+	}
+}
+
+// restore 阈值以当前的策略为准
+func (je *JudgementEntity) restore(state *JudgementSnapshot, alert schema.StrategyAlert) bool {
+	if state == nil || state.Driver == nil {
+		return false
+	}
+
+	je.Lock()
+	defer je.Unlock()
+
+	driver := *state.Driver
+	if err := driver.SetThreshold(alert); err != nil {
+		logger.Warningf(je.sid, "judgement state restore failed: %v", err)
+		return false
+	}
+	je.Driver = &driver
+	je.next = state.Next
+	je.lastEvent = state.LastEvent
+	je.last = state.Event
+	return true
+}
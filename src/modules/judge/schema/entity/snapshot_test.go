@@ -0,0 +1,256 @@
+package entity
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage/series"
+)
+
+// memStorage 只有一条曲线的storage, 不依赖transfer和index
+type memStorage struct {
+	sync.Mutex
+	counter storage.Counter
+	points  []*dataobj.RRDData
+	keys    map[string]uint32
+	series  map[uint32]*series.Series
+}
+
+func newMemStorage(counter storage.Counter, points []*dataobj.RRDData) *memStorage {
+	return &memStorage{
+		counter: counter,
+		points:  points,
+		keys:    make(map[string]uint32),
+		series:  make(map[uint32]*series.Series),
+	}
+}
+
+func (m *memStorage) Query(ID uint32, stime, etime int64, span int) ([]*dataobj.RRDData, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, found := m.series[ID]; !found {
+		return nil, nil
+	}
+	ret := make([]*dataobj.RRDData, 0)
+	for _, p := range m.points {
+		if p.Timestamp >= stime && p.Timestamp <= etime {
+			ret = append(ret, p)
+		}
+	}
+	return ret, nil
+}
+
+func (m *memStorage) Index(req *storage.IndexRequest) ([]storage.Counter, error) {
+	return []storage.Counter{m.counter}, nil
+}
+
+func (m *memStorage) GenerateAndSet(s *series.Series, bufferSize int, spans []int) uint32 {
+	m.Lock()
+	defer m.Unlock()
+
+	if ID, found := m.keys[s.Key()]; found {
+		s.ID = ID
+		return ID
+	}
+	s.ID = uint32(len(m.keys) + 1)
+	m.keys[s.Key()] = s.ID
+	m.series[s.ID] = s
+	return s.ID
+}
+
+func (m *memStorage) Get(ID uint32) (*series.Series, bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	s, found := m.series[ID]
+	return s, found
+}
+
+func (m *memStorage) Push(items []*dataobj.JudgeItem) int {
+	return len(items)
+}
+
+func (m *memStorage) Buffered(ID uint32) (map[int][]*dataobj.RRDData, bool) {
+	return nil, false
+}
+
+func (m *memStorage) Cleanup() {}
+
+const testBase = int64(1600000000)
+
+// cpu.idle < 10 报警: [base, base+90] 异常, [base+100, base+190] 正常
+func mockStorage() *memStorage {
+	points := make([]*dataobj.RRDData, 0)
+	for ts := testBase; ts < testBase+200; ts += 10 {
+		value := 5.0
+		if ts >= testBase+100 {
+			value = 50
+		}
+		points = append(points, dataobj.NewRRDData(ts, value))
+	}
+	return newMemStorage(storage.Counter{Counter: "endpoint=mock", Step: 10, Dstype: "GAUGE"}, points)
+}
+
+func mockStrategy() *schema.Strategy {
+	return &schema.Strategy{
+		ID:        1,
+		Name:      "cpu.idle",
+		Priority:  1,
+		Category:  1,
+		Operator:  schema.LOGIC_OPERATOR_AND,
+		Endpoints: []string{"mock"},
+		Partition: "/falcon-ng/event/p1",
+		Judgements: []schema.StrategyJudgement{
+			{
+				Metric: "cpu.idle",
+				Execution: schema.StrategyExecution{
+					EffectiveDay:   []int{0, 1, 2, 3, 4, 5, 6},
+					EffectiveStart: 0,
+					EffectiveEnd:   1439,
+					Operator:       schema.LOGIC_OPERATOR_AND,
+					Expressions: []schema.StrategyExpression{
+						{
+							Func:       schema.TRIGGER_DURATION_HAPPEN,
+							Params:     []string{"10", "1"},
+							Operator:   schema.LOGIC_OPERATOR_AND,
+							Thresholds: []schema.StrategyThreshold{{Operator: "<", Threshold: 10}},
+						},
+					},
+				},
+			},
+		},
+		Alert: schema.StrategyAlert{
+			AlertCountThreshold:    1,
+			RecoverCountThreshold:  1,
+			LimitCountThreshold:    1,
+			LimitDurationThreshold: 3600,
+		},
+	}
+}
+
+// runUntil 按判断周期依次执行到end, 和loop中的调度一致
+func runUntil(se *StrategyEntity, start, end int64) []*schema.Event {
+	events := make([]*schema.Event, 0)
+	for ts := start; ts <= end; ts += 10 {
+		now := time.Unix(ts, 0)
+		for _, je := range se.judgements() {
+			events = append(events, je.Run(se.storage, se.Strategy, se.ExecutionsByTime(now), now)...)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Etime < events[j].Etime })
+	return events
+}
+
+func eventTypes(events []*schema.Event) []string {
+	ret := make([]string, 0, len(events))
+	for _, event := range events {
+		ret = append(ret, event.EventType)
+	}
+	return ret
+}
+
+// 报警之后重启: 状态经过状态文件恢复之后, 不重复报警, 恢复时发出恢复事件
+func Test_SnapshotRestore(t *testing.T) {
+	stg := mockStorage()
+
+	se := NewStrategyEntity(mockStrategy(), stg)
+	if se == nil {
+		t.Fatal("new strategy entity failed")
+	}
+	events := se.Backtest(testBase, testBase+50)
+	if types := eventTypes(events); !reflect.DeepEqual(types, []string{schema.EVENT_ALERT}) {
+		t.Fatalf("unexpected events before restart: %v", types)
+	}
+
+	states := se.Snapshot()
+	if len(states) != 1 {
+		t.Fatalf("unexpected snapshot size: %d", len(states))
+	}
+
+	// 和状态文件一样经过json
+	bs, err := json.Marshal(states)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored map[string]*JudgementSnapshot
+	if err = json.Unmarshal(bs, &restored); err != nil {
+		t.Fatal(err)
+	}
+
+	after := NewStrategyEntity(mockStrategy(), stg)
+	after.Restore(restored)
+	// 曲线还没有生成时, 待恢复的状态也要保存
+	if pending := after.Snapshot(); !reflect.DeepEqual(pending, restored) {
+		t.Fatalf("pending states lost before index update")
+	}
+
+	after.Update(true)
+	got, _ := json.Marshal(after.Snapshot())
+	if string(got) != string(bs) {
+		t.Fatalf("restored state mismatch, want %s, got %s", string(bs), string(got))
+	}
+
+	events = runUntil(after, testBase+70, testBase+200)
+	if types := eventTypes(events); !reflect.DeepEqual(types, []string{schema.EVENT_RECOVER}) {
+		t.Fatalf("unexpected events after restart: %v", types)
+	}
+	if events[0].Etime != testBase+100 {
+		t.Fatalf("unexpected recover time: %d", events[0].Etime)
+	}
+}
+
+// nodata的driver直接保存在状态文件中
+func Test_SnapshotNodataDriver(t *testing.T) {
+	alert := mockStrategy().Alert
+	driver, err := NewAlertPointDriver(alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	driver.Happen(testBase, schema.STATUS_ALERT)
+	if code, _ := driver.DumpEvent(testBase, 10); code != schema.EVENT_CODE_ALERT {
+		t.Fatalf("unexpected event code: %d", code)
+	}
+
+	bs, err := json.Marshal(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored AlertPointDriver
+	if err = json.Unmarshal(bs, &restored); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*driver, restored) {
+		t.Fatalf("driver mismatch, want %+v, got %+v", *driver, restored)
+	}
+
+	// 恢复之后和原来的driver行为一致: 持续异常不重复报警, 正常之后恢复
+	steps := []struct {
+		ts     int64
+		status int
+	}{
+		{testBase + 10, schema.STATUS_ALERT},
+		{testBase + 20, schema.STATUS_RECOVER},
+	}
+	for _, step := range steps {
+		driver.Happen(step.ts, step.status)
+		restored.Happen(step.ts, step.status)
+
+		want, _ := driver.DumpEvent(step.ts, 10)
+		got, _ := restored.DumpEvent(step.ts, 10)
+		if want != got {
+			t.Fatalf("timestamp[%d] event code mismatch, want %d, got %d", step.ts, want, got)
+		}
+	}
+	if code := restored.LastEventStatus; code != schema.EVENT_CODE_RECOVER {
+		t.Fatalf("unexpected last event status: %d", code)
+	}
+}
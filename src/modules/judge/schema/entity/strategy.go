@@ -10,6 +10,7 @@ import (
 
 	"github.com/open-falcon/falcon-ng/src/modules/judge/logger"
 	"github.com/open-falcon/falcon-ng/src/modules/judge/schema"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema/expression"
 	"github.com/open-falcon/falcon-ng/src/modules/judge/schema/publish"
 	"github.com/open-falcon/falcon-ng/src/modules/judge/storage"
 	"github.com/open-falcon/falcon-ng/src/modules/judge/storage/query"
@@ -64,6 +65,14 @@ func NewStrategyEntity(stra *schema.Strategy,
 	executions := make([]*ExecutionEntity, 0)
 	for i := range stra.Judgements {
 		metric := stra.Judgements[i].Metric
+		// 多指标运算时, metric是运算结果的指标名
+		if len(stra.Judgements[i].Expression) > 0 {
+			if _, err := expression.Parse(stra.Judgements[i].Expression); err != nil {
+				logger.Warningf(stra.ID, "new strategy failed: expression %s error %v",
+					stra.Judgements[i].Expression, err)
+				return nil
+			}
+		}
 
 		ee, err := NewExecutionEntity(stra, stra.Judgements[i].Execution, metric)
 		if err != nil {
@@ -73,15 +82,18 @@ func NewStrategyEntity(stra *schema.Strategy,
 		executions = append(executions, ee)
 	}
 
+	exprs := NewExpressionStorage(stg)
 	return &StrategyEntity{
 		Strategy:   stra,
 		stop:       make(chan struct{}, 1),
+		trigger:    make(chan struct{}, 1),
 		cache:      nil,
 		status:     ENTITY_STATUS_EMPTY,
 		indexing:   false,
 		interval:   10, // 默认设置interval为10s
 		publisher:  pub,
-		storage:    stg,
+		storage:    exprs,
+		exprs:      exprs,
 		Judgements: make(map[uint32]*JudgementEntity),
 		Executions: executions,
 	}
@@ -104,20 +116,36 @@ func (se *StrategyEntity) loop() {
 			se.status = ENTITY_STATUS_STOPPED
 			logger.Info(se.ID, "strategy run stopped")
 			return
+		case <-se.trigger:
+			logger.Info(se.ID, "strategy run triggered")
+			se.runOnce()
 		case <-time.After(time.Duration(se.interval) * time.Second):
-			// 更新策略配置, 如果有
-			se.Update(false)
-
-			// 执行判断 && 生成事件
-			se.Run()
-
-			// 执行完成, 等待下一个周期
-			se.status = ENTITY_STATUS_WAITING
+			se.runOnce()
 		}
 	}
 
 }
 
+func (se *StrategyEntity) runOnce() {
+	// 更新策略配置, 如果有
+	se.Update(false)
+
+	// 执行判断 && 生成事件
+	se.Run()
+
+	// 执行完成, 等待下一个周期
+	se.status = ENTITY_STATUS_WAITING
+}
+
+// Trigger 让策略的调度循环立即执行一次判断, 与定时执行串行
+// 已经有等待执行的命令时不会重复执行
+func (se *StrategyEntity) Trigger() {
+	select {
+	case se.trigger <- struct{}{}:
+	default:
+	}
+}
+
 func (se *StrategyEntity) Status() int {
 	return se.status
 }
@@ -220,9 +248,30 @@ func (se *StrategyEntity) Update(index bool) {
 		adds     = make(map[uint32]*JudgementEntity)
 		updates  = make(map[uint32]*JudgementEntity)
 		IDmap    = make(map[uint32]struct{}) // map[ID]struct{}
+		exprIDs  = make(map[uint32]struct{}) // 多指标运算的虚拟曲线
 		interval = 0                         // 最小的调度间隔
 	)
 
+	// 生成series并更新缓存信息, 返回曲线ID
+	generate := func(metric string, counter storage.Counter) (uint32, bool) {
+		if counter.Step == 0 {
+			logger.Warningf(se.ID, "strategy index warning: zero step %v", counter)
+			return 0, false
+		}
+		if !once {
+			bufferSize, span = stra.MaxBufferSizeAndSpan(counter.Step)
+			once = true
+		}
+		tags := series.CounterString2TagMap(counter.Counter)
+
+		ss, err := series.NewSeries(metric, tags, counter.Step, counter.Dstype)
+		if err != nil {
+			logger.Debugf(se.ID, "strategy index warning: new series failed %v", err)
+			return 0, false
+		}
+		return se.storage.GenerateAndSet(ss, bufferSize, span), true
+	}
+
 	for _, endpoint := range stra.Endpoints {
 		counters := make(map[string]map[string]CounterUnit) // map[key]{map[key]unit}
 
@@ -236,6 +285,17 @@ func (se *StrategyEntity) Update(index bool) {
 			}
 
 			include, exclude := stra.Judgements[i].Xclude()
+			// 多指标运算, 每个操作数都生成曲线, 运算结果是一条虚拟曲线
+			if len(stra.Judgements[i].Expression) > 0 {
+				units := se.indexExpression(mkey, endpoint, stra.Judgements[i],
+					include, exclude, generate)
+				for ckey, unit := range units {
+					counters[mkey][ckey] = unit
+					exprIDs[unit.ID] = struct{}{}
+				}
+				continue
+			}
+
 			result, err := se.storage.Index(
 				query.NewIndexRequest(endpoint, metric, include, exclude),
 			)
@@ -245,24 +305,11 @@ func (se *StrategyEntity) Update(index bool) {
 			}
 
 			for j := range result {
-				if result[j].Step == 0 {
-					logger.Warningf(se.ID, "strategy index warning: zero step %v", result[j])
-					continue
-				}
-				if !once {
-					bufferSize, span = stra.MaxBufferSizeAndSpan(result[j].Step)
-					once = true
-				}
-				// 生成series
-				tags := series.CounterString2TagMap(result[j].Counter)
-
-				ss, err := series.NewSeries(metric, tags, result[j].Step, result[j].Dstype)
-				if err != nil {
-					logger.Debugf(se.ID, "strategy index warning: new series failed %v", err)
+				// 生成ID并更新缓存信息
+				ID, ok := generate(metric, result[j])
+				if !ok {
 					continue
 				}
-				// 生成ID并更新缓存信息
-				ID := se.storage.GenerateAndSet(ss, bufferSize, span)
 
 				// 不能使用 ss.Key(), 因为不能包含 metric字段
 				ckey := result[j].Counter
@@ -349,6 +396,9 @@ func (se *StrategyEntity) Update(index bool) {
 		}
 	}
 
+	// 清理已下线的虚拟曲线
+	se.exprs.Retain(exprIDs)
+
 	// 更新曲线列表
 	se.Lock()
 	if interval == 0 {
@@ -374,9 +424,10 @@ func (se *StrategyEntity) Update(index bool) {
 			}
 		}
 	}
-	// 添加新的曲线
+	// 添加新的曲线, 重启前保存的报警状态在此时恢复
 	for id, je := range adds {
 		if je != nil {
+			se.restoreJudgement(je)
 			se.Judgements[id] = je
 		}
 	}
@@ -391,6 +442,68 @@ func (se *StrategyEntity) Update(index bool) {
 	return
 }
 
+// indexExpression 查询表达式中每个指标的曲线, counter(endpoint和tags)和step一致的曲线才能参与运算
+// 返回 counter -> 虚拟曲线
+func (se *StrategyEntity) indexExpression(mkey, endpoint string,
+	judgement schema.StrategyJudgement,
+	include, exclude map[string][]string,
+	generate func(string, storage.Counter) (uint32, bool)) map[string]CounterUnit {
+
+	expr, err := expression.Parse(judgement.Expression)
+	if err != nil {
+		logger.Warningf(se.ID, "strategy index warning: expression %s error %v",
+			judgement.Expression, err)
+		return nil
+	}
+
+	metrics := expr.Metrics()
+	operands := make(map[string]map[string]CounterUnit, len(metrics)) // map[metric]{map[counter]unit}
+	for _, metric := range metrics {
+		result, err := se.storage.Index(
+			query.NewIndexRequest(endpoint, metric, include, exclude),
+		)
+		if err != nil {
+			logger.Warningf(se.ID, "strategy index warning: index error %v", err)
+			return nil
+		}
+
+		operands[metric] = make(map[string]CounterUnit)
+		for j := range result {
+			if ID, ok := generate(metric, result[j]); ok {
+				operands[metric][result[j].Counter] = CounterUnit{
+					ID:          ID,
+					Granularity: result[j].Step,
+				}
+			}
+		}
+	}
+
+	ret := make(map[string]CounterUnit)
+	for ckey, unit := range operands[metrics[0]] {
+		IDs := map[string]uint32{metrics[0]: unit.ID}
+		for _, metric := range metrics[1:] {
+			iunit, found := operands[metric][ckey]
+			if !found || iunit.Granularity != unit.Granularity {
+				break
+			}
+			IDs[metric] = iunit.ID
+		}
+		if len(IDs) != len(metrics) {
+			continue
+		}
+
+		tags := series.CounterString2TagMap(ckey)
+		ss, err := series.NewSeries(judgement.Metric, tags, unit.Granularity, "GAUGE")
+		if err != nil {
+			logger.Debugf(se.ID, "strategy index warning: new series failed %v", err)
+			continue
+		}
+		ID := se.exprs.Set(mkey+schema.COUNTER_SEPERATOR+ss.Key(), ss, expr, IDs)
+		ret[ckey] = CounterUnit{ID: ID, Granularity: unit.Granularity}
+	}
+	return ret
+}
+
 func (se *StrategyEntity) Run() {
 	se.status = ENTITY_STATUS_RUNNING
 	now := time.Now()
@@ -0,0 +1,56 @@
+package entity
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage"
+)
+
+type chanPublisher chan *schema.Event
+
+func (c chanPublisher) Publish(event *schema.Event) error {
+	c <- event
+	return nil
+}
+
+func (c chanPublisher) Close() {}
+
+// 手动执行由调度循环执行, 不需要等到下一个周期
+func Test_StrategyTrigger(t *testing.T) {
+	now := time.Now().Unix() / 10 * 10
+	points := make([]*dataobj.RRDData, 0)
+	for ts := now - 100; ts <= now; ts += 10 {
+		points = append(points, dataobj.NewRRDData(ts, 5))
+	}
+	stg := newMemStorage(storage.Counter{Counter: "endpoint=mock", Step: 10, Dstype: "GAUGE"}, points)
+
+	pub := make(chanPublisher, 10)
+	se := NewStrategyEntity(mockStrategy(), stg, pub)
+	if se == nil {
+		t.Fatal("new strategy entity failed")
+	}
+	se.interval = 3600
+
+	// 没有调度循环时命令最多保留一个, 不会阻塞
+	se.Trigger()
+	se.Trigger()
+	if len(se.trigger) != 1 {
+		t.Fatalf("unexpected pending triggers: %d", len(se.trigger))
+	}
+
+	se.Update(true)
+	go se.loop()
+	defer func() { se.stop <- struct{}{} }()
+
+	select {
+	case event := <-pub:
+		if event.EventType != schema.EVENT_ALERT {
+			t.Fatalf("unexpected event: %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("strategy not run")
+	}
+}
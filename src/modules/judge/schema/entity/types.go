@@ -17,18 +17,21 @@ import (
 
 // StrategyEntity 策略实体, 对应唯一的一个报警策略
 type StrategyEntity struct {
-	sync.RWMutex                            // 读写锁
-	*schema.Strategy                        // 策略详情
-	cache            *StrategyEntity        // 缓冲区, 指针, 使用后置空
-	stop             chan struct{}          // 接受stop命令
-	status           int                    // 状态
-	indexing         bool                   // 是否正在执行曲线更新
-	interval         int                    // 调度周期, 与指标的最小step有关
-	indexInterval    int                    // 执行曲线更新的频率
-	publisher        publish.EventPublisher // 报警事件推送到某个目的地
-	storage          storage.Storage        // 数据缓存, 全局唯一
-	concurrency      *nsema.Semaphore       // judgements的并发数
-	seriesCount      int                    // 曲线总数
+	sync.RWMutex                                   // 读写锁
+	*schema.Strategy                               // 策略详情
+	cache            *StrategyEntity               // 缓冲区, 指针, 使用后置空
+	stop             chan struct{}                 // 接受stop命令
+	trigger          chan struct{}                 // 接受立即执行一次判断的命令
+	status           int                           // 状态
+	indexing         bool                          // 是否正在执行曲线更新
+	interval         int                           // 调度周期, 与指标的最小step有关
+	indexInterval    int                           // 执行曲线更新的频率
+	publisher        publish.EventPublisher        // 报警事件推送到某个目的地
+	storage          storage.Storage               // 数据缓存, 全局唯一, 封装了多指标运算的虚拟曲线
+	exprs            *ExpressionStorage            // 多指标运算的虚拟曲线
+	concurrency      *nsema.Semaphore              // judgements的并发数
+	seriesCount      int                           // 曲线总数
+	restores         map[string]*JudgementSnapshot // 待恢复的报警状态, key是曲线的key
 
 	Judgements map[uint32]*JudgementEntity // key是judgementEntity的唯一标识, 与曲线ID
 	Executions []*ExecutionEntity          // 每个trigger关联一个metric, 每个metric关联一堆线
@@ -37,22 +40,25 @@ type StrategyEntity struct {
 // JudgementEntity 判断实体, 对应唯一的"一条曲线"
 // 多个指标时, step应该相同, 否则无效, 信任schema层传递的结果
 type JudgementEntity struct {
-	sid         int64 // 关联的策略ID, 打印日志时使用
-	next        int64 // 初始进度
-	deadline    int64 // 截止进度
-	lastEvent   int   // 上一次报警状态, 减少history结构体的写入
-	interval    int   // 每条线维护一个独立的interval
-	historySize int   // metricEntity.History 的大小, 与算子和alert参数有关, 与部分算子的参数也有关
-	windowSize  int   // 查询数据时允许的最大时间范围, 与 schema.Strategy 的配置有关, windowSize == 0 永远等待
+	sync.Mutex                // Run和查询状态时加锁
+	sid         int64         // 关联的策略ID, 打印日志时使用
+	next        int64         // 初始进度
+	deadline    int64         // 截止进度
+	lastEvent   int           // 上一次报警状态, 减少history结构体的写入
+	interval    int           // 每条线维护一个独立的interval
+	historySize int           // metricEntity.History 的大小, 与算子和alert参数有关, 与部分算子的参数也有关
+	windowSize  int           // 查询数据时允许的最大时间范围, 与 schema.Strategy 的配置有关, windowSize == 0 永远等待
+	last        *schema.Event // 最近一次产生的事件
 
 	Metrics []*MetricEntity   // judgement的唯一key
 	Driver  AlertDriverEntity // 报警(解除)判断 驱动实体
 }
 
 type MetricEntity struct {
-	key     string         // key就是metric名, 后续可能会是counter
-	ID      uint32         // 唯一索引, 只有一个元素
-	History buffer.History // 历史点, 运行时初始化
+	key         string         // key就是metric名, 后续可能会是counter
+	ID          uint32         // 唯一索引, 只有一个元素
+	History     buffer.History // 历史点, 运行时初始化
+	Predictions buffer.History // 模型类算子的预测值, 与History同步写入和清理, 运行时初始化
 }
 
 // ExecutionEntity 执行实体
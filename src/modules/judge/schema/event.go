@@ -2,18 +2,16 @@ package schema
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"math"
 	"strconv"
 	"sync"
 
-	"github.com/json-iterator/go"
 	"github.com/open-falcon/falcon-ng/src/dataobj"
 	"github.com/spaolacci/murmur3"
 )
 
-var json = jsoniter.ConfigCompatibleWithStandardLibrary
-
 var (
 	bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
 )
@@ -69,6 +67,14 @@ func (e *Event) SetPoints(key string,
 	e.History = append(e.History, history)
 }
 
+// SetPredPoints 预测值, 对应最近一次SetPoints的曲线
+func (e *Event) SetPredPoints(points []*dataobj.RRDData) {
+	if len(e.History) == 0 || len(points) == 0 {
+		return
+	}
+	e.History[len(e.History)-1].PredPoints = points
+}
+
 // 计算hashid, 要求 history 的写入顺序是有序的,
 func (e *Event) Finalize() bool {
 	if len(e.History) == 0 {
@@ -0,0 +1,270 @@
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 多指标的四则运算表达式, 如 "disk.io.read.bytes + disk.io.write.bytes", "errors / requests * 100"
+// 支持 + - * / 和括号, 操作数是指标名或者常数, 指标名中有其他字符时用双引号括起来, 如 "\"net-in\" / 1024"
+
+var (
+	ErrorEmpty      = errors.New("empty expression")
+	ErrorNoMetric   = errors.New("expression without metric")
+	ErrorUnexpected = errors.New("unexpected end of expression")
+)
+
+type Expression struct {
+	text    string
+	root    node
+	metrics []string // 去重后的指标名, 按出现的顺序
+}
+
+type node interface {
+	eval(values map[string]float64) float64
+}
+
+type numberNode float64
+
+type metricNode string
+
+type negativeNode struct {
+	operand node
+}
+
+type binaryNode struct {
+	operator    byte
+	left, right node
+}
+
+func (n numberNode) eval(values map[string]float64) float64 {
+	return float64(n)
+}
+
+// 指标没有值时为NaN, 运算结果也是NaN
+func (n metricNode) eval(values map[string]float64) float64 {
+	value, found := values[string(n)]
+	if !found {
+		return math.NaN()
+	}
+	return value
+}
+
+func (n negativeNode) eval(values map[string]float64) float64 {
+	return -n.operand.eval(values)
+}
+
+func (n binaryNode) eval(values map[string]float64) float64 {
+	left, right := n.left.eval(values), n.right.eval(values)
+	switch n.operator {
+	case '+':
+		return left + right
+	case '-':
+		return left - right
+	case '*':
+		return left * right
+	case '/':
+		// 除数为0时没有意义
+		if right == 0 {
+			return math.NaN()
+		}
+		return left / right
+	}
+	return math.NaN()
+}
+
+// Parse 解析表达式, 至少包含一个指标
+func Parse(text string) (*Expression, error) {
+	tokens, err := tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, ErrorEmpty
+	}
+
+	p := &parser{tokens: tokens, seen: make(map[string]struct{})}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected token %q", p.tokens[p.pos].text)
+	}
+	if len(p.metrics) == 0 {
+		return nil, ErrorNoMetric
+	}
+
+	return &Expression{
+		text:    text,
+		root:    root,
+		metrics: p.metrics,
+	}, nil
+}
+
+func (e *Expression) String() string {
+	return e.text
+}
+
+// Metrics 表达式中引用的指标
+func (e *Expression) Metrics() []string {
+	return e.metrics
+}
+
+// Eval 计算表达式的值, 缺少指标或者除数为0时返回NaN
+func (e *Expression) Eval(values map[string]float64) float64 {
+	return e.root.eval(values)
+}
+
+const (
+	tokenOperator = iota
+	tokenNumber
+	tokenMetric
+)
+
+type token struct {
+	kind int
+	text string
+}
+
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' ||
+		c >= 'A' && c <= 'Z' ||
+		c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == ':'
+}
+
+func tokenize(text string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.IndexByte("+-*/()", c) >= 0:
+			tokens = append(tokens, token{kind: tokenOperator, text: string(c)})
+			i++
+		case c == '"':
+			end := strings.IndexByte(text[i+1:], '"')
+			if end <= 0 {
+				return nil, fmt.Errorf("illegal quoted metric at %d", i)
+			}
+			tokens = append(tokens, token{kind: tokenMetric, text: text[i+1 : i+1+end]})
+			i += end + 2
+		case isNameChar(c):
+			start := i
+			for i < len(text) && isNameChar(text[i]) {
+				i++
+			}
+			name := text[start:i]
+			if _, err := strconv.ParseFloat(name, 64); err == nil {
+				tokens = append(tokens, token{kind: tokenNumber, text: name})
+			} else {
+				tokens = append(tokens, token{kind: tokenMetric, text: name})
+			}
+		default:
+			return nil, fmt.Errorf("illegal character %q at %d", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+// parser 递归下降:
+// expr   := term (('+'|'-') term)*
+// term   := factor (('*'|'/') factor)*
+// factor := number | metric | '(' expr ')' | '-' factor
+type parser struct {
+	tokens  []token
+	pos     int
+	metrics []string
+	seen    map[string]struct{}
+}
+
+func (p *parser) peekOperator(operators string) (byte, bool) {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokenOperator {
+		return 0, false
+	}
+	op := p.tokens[p.pos].text[0]
+	return op, strings.IndexByte(operators, op) >= 0
+}
+
+func (p *parser) parseExpr() (node, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.peekOperator("+-")
+		if !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{operator: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseTerm() (node, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.peekOperator("*/")
+		if !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{operator: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseFactor() (node, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, ErrorUnexpected
+	}
+	tk := p.tokens[p.pos]
+	p.pos++
+
+	switch tk.kind {
+	case tokenNumber:
+		value, _ := strconv.ParseFloat(tk.text, 64)
+		return numberNode(value), nil
+	case tokenMetric:
+		if _, found := p.seen[tk.text]; !found {
+			p.seen[tk.text] = struct{}{}
+			p.metrics = append(p.metrics, tk.text)
+		}
+		return metricNode(tk.text), nil
+	}
+
+	switch tk.text {
+	case "-":
+		operand, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return negativeNode{operand: operand}, nil
+	case "(":
+		inner, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if op, ok := p.peekOperator(")"); !ok || op != ')' {
+			return nil, errors.New("missing closing parenthesis")
+		}
+		p.pos++
+		return inner, nil
+	}
+	return nil, fmt.Errorf("unexpected token %q", tk.text)
+}
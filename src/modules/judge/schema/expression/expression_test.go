@@ -0,0 +1,53 @@
+package expression
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func Test_Expression(t *testing.T) {
+	cases := []struct {
+		text    string
+		metrics []string
+		values  map[string]float64
+		expect  float64
+	}{
+		{"disk.io.read.bytes + disk.io.write.bytes", []string{"disk.io.read.bytes", "disk.io.write.bytes"},
+			map[string]float64{"disk.io.read.bytes": 1, "disk.io.write.bytes": 2}, 3},
+		{"errors / requests * 100", []string{"errors", "requests"},
+			map[string]float64{"errors": 5, "requests": 50}, 10},
+		{"(a - b) / -2 + a", []string{"a", "b"},
+			map[string]float64{"a": 1, "b": 5}, 3},
+		{`"net-in" / 1024`, []string{"net-in"},
+			map[string]float64{"net-in": 2048}, 2},
+	}
+
+	for _, c := range cases {
+		expr, err := Parse(c.text)
+		if err != nil {
+			t.Fatalf("parse %s failed: %v", c.text, err)
+		}
+		if !reflect.DeepEqual(expr.Metrics(), c.metrics) {
+			t.Fatalf("%s: unexpected metrics %v", c.text, expr.Metrics())
+		}
+		if value := expr.Eval(c.values); value != c.expect {
+			t.Fatalf("%s: expect %.2f, got %.2f", c.text, c.expect, value)
+		}
+	}
+
+	// 除数为0, 或者缺少指标
+	expr, _ := Parse("a / b")
+	if !math.IsNaN(expr.Eval(map[string]float64{"a": 1, "b": 0})) {
+		t.Fatal("expect NaN when divided by zero")
+	}
+	if !math.IsNaN(expr.Eval(map[string]float64{"a": 1})) {
+		t.Fatal("expect NaN when metric missing")
+	}
+
+	for _, text := range []string{"", "1 + 2", "a +", "(a + b", "a $ b", `"" + a`} {
+		if _, err := Parse(text); err == nil {
+			t.Fatalf("expect error for %q", text)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package kafka
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/logger"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema/publish"
+)
+
+const contentType = "application/vnd.kafka.json.v2+json"
+
+// KafkaPublisher 通过kafka rest proxy(v2)写入, 事件按Partition写入对应的topic,
+// 如/falcon-ng/event/p1 -> falcon-ng.event.p1, 以hashid作为key, 同一个告警的事件有序
+type KafkaPublisher struct {
+	opts   publish.KafkaPublisherOption
+	client *http.Client
+	buffer chan *schema.Event
+	stop   chan struct{}
+	done   chan struct{}
+
+	// Publish持有读锁直到事件入队列, Close之后不会再有事件写入缓冲区
+	lock   sync.RWMutex
+	closed bool
+}
+
+type record struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+type produceRequest struct {
+	Records []record `json:"records"`
+}
+
+type produceResponse struct {
+	Offsets []struct {
+		Partition int    `json:"partition"`
+		Offset    int64  `json:"offset"`
+		ErrorCode int    `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+func NewKafkaPublisher(opts publish.KafkaPublisherOption) (*KafkaPublisher, error) {
+	if len(opts.Addrs) == 0 {
+		return nil, errors.New("empty kafka addr")
+	}
+
+	if opts.BufferSize == 0 {
+		opts.BufferSize = 1
+	}
+	if opts.BatchSize == 0 {
+		opts.BatchSize = 100
+	}
+	if opts.CallTimeout == 0 {
+		opts.CallTimeout = 5000
+	}
+
+	kp := &KafkaPublisher{
+		opts:   opts,
+		client: &http.Client{Timeout: publish.Duration(opts.CallTimeout)},
+		buffer: make(chan *schema.Event, opts.BufferSize),
+		stop:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		closed: false,
+	}
+
+	go kp.loop()
+
+	return kp, nil
+}
+
+func (kp *KafkaPublisher) Publish(event *schema.Event) error {
+	kp.lock.RLock()
+	defer kp.lock.RUnlock()
+
+	if kp.closed {
+		return nil
+	}
+
+	var err error
+	select {
+	case kp.buffer <- event:
+		// do nothing
+	case <-time.After(publish.Duration(kp.opts.BufferEnqueueTimeout)):
+		// 入队列超时, 直接写入到kafka
+		err = kp.push([]*schema.Event{event})
+	}
+
+	return err
+}
+
+func (kp *KafkaPublisher) Close() {
+	kp.lock.Lock()
+	if kp.closed {
+		kp.lock.Unlock()
+		return
+	}
+	kp.closed = true
+	kp.lock.Unlock()
+
+	kp.stop <- struct{}{}
+	<-kp.done
+
+	// loop已经退出, 把缓冲区中剩下的写完
+	for len(kp.buffer) > 0 {
+		kp.push(kp.drain(<-kp.buffer))
+	}
+
+	logger.Info(0, "kafka publish closed")
+}
+
+func (kp *KafkaPublisher) loop() {
+	defer close(kp.done)
+	for {
+		select {
+		case <-kp.stop:
+			logger.Info(0, "kafka publish loop stopped")
+			return
+		case event := <-kp.buffer:
+			kp.push(kp.drain(event))
+		}
+	}
+}
+
+// drain 取出缓冲区中已有的事件, 凑成一批一起写入
+func (kp *KafkaPublisher) drain(first *schema.Event) []*schema.Event {
+	events := []*schema.Event{first}
+	for len(events) < kp.opts.BatchSize {
+		select {
+		case event := <-kp.buffer:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+	return events
+}
+
+func (kp *KafkaPublisher) push(events []*schema.Event) error {
+	topics := make(map[string][]record)
+	for _, event := range events {
+		bytes, err := json.Marshal(event)
+		if err != nil {
+			logger.Warningf(event.Sid, "kafka publish failed, error:%v", err)
+			continue
+		}
+
+		topic := dataobj.EventTopic(event.Partition)
+		if topic == "" {
+			logger.Warningf(event.Sid, "kafka publish failed: empty partition")
+			continue
+		}
+
+		topics[topic] = append(topics[topic], record{
+			Key:   strconv.FormatUint(event.Hashid, 10),
+			Value: bytes,
+		})
+	}
+
+	var lastErr error
+	for topic, records := range topics {
+		if err := kp.produce(topic, records); err != nil {
+			logger.Warningf(0, "kafka publish %d events to %s failed finally: %v", len(records), topic, err)
+			lastErr = err
+			continue
+		}
+		logger.Debugf(0, "kafka publish succ, topic: %s, events: %d", topic, len(records))
+	}
+
+	return lastErr
+}
+
+// produce 依次尝试各个rest proxy, 有一个成功即可
+func (kp *KafkaPublisher) produce(topic string, records []record) error {
+	body, err := json.Marshal(produceRequest{Records: records})
+	if err != nil {
+		return err
+	}
+
+	for i := range kp.opts.Addrs {
+		url := strings.TrimRight(kp.opts.Addrs[i], "/") + "/topics/" + topic
+		if err = kp.post(url, body); err == nil {
+			return nil
+		}
+		logger.Debugf(0, "kafka publish to %s failed, error:%v", url, err)
+	}
+
+	return err
+}
+
+func (kp *KafkaPublisher) post(url string, body []byte) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+
+	resp, err := kp.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code %d: %s", resp.StatusCode, string(data))
+	}
+
+	var ret produceResponse
+	if err = json.Unmarshal(data, &ret); err != nil {
+		return err
+	}
+
+	// 部分记录写入失败时整批重试, 可能产生重复的事件
+	for _, o := range ret.Offsets {
+		if o.ErrorCode != 0 || o.Error != "" {
+			return fmt.Errorf("produce error %d: %s", o.ErrorCode, o.Error)
+		}
+	}
+
+	return nil
+}
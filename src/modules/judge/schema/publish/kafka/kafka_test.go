@@ -0,0 +1,119 @@
+package kafka
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema/publish"
+)
+
+func Test_Kafka(t *testing.T) {
+	var lock sync.Mutex
+	received := make(map[string]int)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		var req produceRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		lock.Lock()
+		received[r.URL.Path] += len(req.Records)
+		lock.Unlock()
+
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":1}]}`))
+	}))
+	defer server.Close()
+
+	kp, err := NewKafkaPublisher(publish.KafkaPublisherOption{
+		Addrs:                []string{"http://127.0.0.1:1", server.URL}, // 第一个地址不可用
+		CallTimeout:          1000,
+		BufferSize:           10,
+		BufferEnqueueTimeout: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		partition := "/falcon-ng/event/p1"
+		if i%2 == 0 {
+			partition = "/falcon-ng/event/p2"
+		}
+		if err := kp.Publish(schema.NewEvent(int64(i), partition, schema.EVENT_ALERT)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Close之后缓冲区中的事件都已经写出
+	kp.Close()
+	if received["/topics/falcon-ng.event.p1"] != 2 || received["/topics/falcon-ng.event.p2"] != 3 {
+		t.Fatalf("unexpected records %v", received)
+	}
+}
+
+// Close和Publish并发, 需要go test -race检查
+func Test_KafkaConcurrentClose(t *testing.T) {
+	var lock sync.Mutex
+	received := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		var req produceRequest
+		json.Unmarshal(body, &req)
+
+		lock.Lock()
+		received += len(req.Records)
+		lock.Unlock()
+
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":1}]}`))
+	}))
+	defer server.Close()
+
+	kp, err := NewKafkaPublisher(publish.KafkaPublisherOption{
+		Addrs:                []string{server.URL},
+		CallTimeout:          1000,
+		BufferSize:           100,
+		BufferEnqueueTimeout: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if err := kp.Publish(schema.NewEvent(int64(i*10+j), "/falcon-ng/event/p1", schema.EVENT_ALERT)); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+
+	kp.Close()
+	kp.Close() // 重复Close直接返回
+	wg.Wait()
+
+	// Close之后的事件直接丢弃, 不会留在缓冲区
+	if len(kp.buffer) != 0 {
+		t.Fatalf("buffer not drained: %d", len(kp.buffer))
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if received > 100 {
+		t.Fatalf("unexpected records %d", received)
+	}
+}
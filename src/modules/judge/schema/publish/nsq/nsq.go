@@ -0,0 +1,159 @@
+package nsq
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/logger"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema/publish"
+
+	nsq "github.com/bitly/go-nsq"
+)
+
+// NsqPublisher 事件按Partition写入对应的topic, 如/falcon-ng/event/p1 -> falcon-ng.event.p1
+type NsqPublisher struct {
+	opts      publish.NsqPublisherOption
+	producers []*nsq.Producer
+	buffer    chan *schema.Event
+	stop      chan struct{}
+	done      chan struct{}
+
+	// Publish持有读锁直到事件入队列, Close之后不会再有事件写入缓冲区
+	lock   sync.RWMutex
+	closed bool
+}
+
+func NewNsqPublisher(opts publish.NsqPublisherOption) (*NsqPublisher, error) {
+	if len(opts.Addrs) == 0 {
+		return nil, errors.New("empty nsq addr")
+	}
+
+	if opts.BufferSize == 0 {
+		opts.BufferSize = 1
+	}
+
+	conf := nsq.NewConfig()
+	if opts.CallTimeout > 0 {
+		conf.DialTimeout = publish.Duration(opts.CallTimeout)
+		conf.WriteTimeout = publish.Duration(opts.CallTimeout)
+	}
+
+	nsqp := &NsqPublisher{
+		opts:      opts,
+		producers: make([]*nsq.Producer, 0),
+		buffer:    make(chan *schema.Event, opts.BufferSize),
+		stop:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		closed:    false,
+	}
+	for i := range opts.Addrs {
+		p, err := nsq.NewProducer(opts.Addrs[i], conf)
+		if err != nil {
+			logger.Errorf(0, "create nsq producer %s failed: %v", opts.Addrs[i], err)
+			continue
+		}
+		p.SetLogger(nil, nsq.LogLevelError)
+
+		if err = p.Ping(); err != nil {
+			logger.Errorf(0, "ping nsq %s failed: %v", opts.Addrs[i], err)
+			p.Stop()
+			continue
+		}
+		nsqp.producers = append(nsqp.producers, p)
+	}
+	if len(nsqp.producers) == 0 {
+		return nil, errors.New("nsq server not available")
+	}
+
+	go nsqp.loop()
+
+	return nsqp, nil
+}
+
+func (np *NsqPublisher) Publish(event *schema.Event) error {
+	np.lock.RLock()
+	defer np.lock.RUnlock()
+
+	if np.closed {
+		return nil
+	}
+
+	var err error
+	select {
+	case np.buffer <- event:
+		// do nothing
+	case <-time.After(publish.Duration(np.opts.BufferEnqueueTimeout)):
+		// 入队列超时, 直接写入到nsq
+		err = np.push(event)
+	}
+
+	return err
+}
+
+func (np *NsqPublisher) Close() {
+	np.lock.Lock()
+	if np.closed {
+		np.lock.Unlock()
+		return
+	}
+	np.closed = true
+	np.lock.Unlock()
+
+	np.stop <- struct{}{}
+	<-np.done
+
+	// loop已经退出, 把缓冲区中剩下的写完
+	for len(np.buffer) > 0 {
+		np.push(<-np.buffer)
+	}
+
+	for i := range np.producers {
+		np.producers[i].Stop()
+	}
+
+	logger.Info(0, "nsq publish closed")
+}
+
+func (np *NsqPublisher) loop() {
+	defer close(np.done)
+	for {
+		select {
+		case <-np.stop:
+			logger.Info(0, "nsq publish loop stopped")
+			return
+		case event := <-np.buffer:
+			np.push(event)
+		}
+	}
+}
+
+func (np *NsqPublisher) push(event *schema.Event) error {
+	bytes, err := json.Marshal(event)
+	if err != nil {
+		logger.Warningf(0, "nsq publish failed, error:%v", err)
+		return err
+	}
+
+	topic := dataobj.EventTopic(event.Partition)
+	if topic == "" {
+		logger.Warningf(event.Sid, "nsq publish failed: empty partition")
+		return errors.New("nsq publish failed")
+	}
+
+	// 依次尝试各个nsqd, 有一个成功即可
+	for i := range np.producers {
+		err = np.producers[i].Publish(topic, bytes)
+		if err == nil {
+			logger.Debugf(event.Sid, "nsq publish succ, topic: %s, event: %s", topic, string(bytes))
+			return nil
+		}
+		logger.Debugf(event.Sid, "nsq publish to %s failed, error:%v", np.producers[i], err)
+	}
+
+	logger.Warningf(event.Sid, "nsq publish failed finally")
+	return errors.New("nsq publish failed")
+}
@@ -15,6 +15,7 @@ func Duration(n int) time.Duration {
 type PublisherOption struct {
 	Type  string               `yaml:"type"`
 	Nsq   NsqPublisherOption   `yaml:"nsq,omitempty"`
+	Kafka KafkaPublisherOption `yaml:"kafka,omitempty"`
 	File  FilePublisherOption  `yaml:"file,omitempty"`
 	Redis RedisPublisherOption `yaml:"redis,omitempty"`
 }
@@ -26,6 +27,15 @@ type NsqPublisherOption struct {
 	BufferEnqueueTimeout int      `yaml:"bufferEnqueueTimeout"` // 缓存入队列超时
 }
 
+// 通过kafka rest proxy写入, 不依赖kafka客户端
+type KafkaPublisherOption struct {
+	Addrs                []string `yaml:"addrs"`                // rest proxy的地址, 形如 http://IP:port
+	CallTimeout          int      `yaml:"callTimeout"`          // 请求超时
+	BatchSize            int      `yaml:"batchSize"`            // 一次请求最多写入的事件个数
+	BufferSize           int      `yaml:"bufferSize"`           // 缓存个数
+	BufferEnqueueTimeout int      `yaml:"bufferEnqueueTimeout"` // 缓存入队列超时
+}
+
 type FilePublisherOption struct {
 	Name string `yaml:"name"`
 }
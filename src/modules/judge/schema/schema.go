@@ -22,9 +22,10 @@ type Strategy struct {
 
 // StrategyJudgement 对应的指标列表(描述文档)和策略配置
 type StrategyJudgement struct {
-	Metric    string              `json:"metric"`    // 指标名
-	Tags      []StrategyTagFilter `json:"tags"`      // tags过滤规则
-	Execution StrategyExecution   `json:"execution"` // 指标对应的判断表达式
+	Metric     string              `json:"metric"`     // 指标名, Expression不为空时是运算结果的指标名
+	Expression string              `json:"expression"` // 多指标的四则运算, 如 "errors / requests * 100", 按endpoint和tags对齐
+	Tags       []StrategyTagFilter `json:"tags"`       // tags过滤规则
+	Execution  StrategyExecution   `json:"execution"`  // 指标对应的判断表达式
 }
 
 // StrategyTagFilter 指标描述文档的一部分, tags过滤相关
@@ -90,9 +91,10 @@ type Event struct {
 }
 
 type History struct {
-	Key         string             `json:"-"`              // 用于计算event的hashid
-	Metric      string             `json:"metric"`         // 指标名
-	Tags        map[string]string  `json:"tags,omitempty"` // endpoint/counter
-	Granularity int                `json:"-"`              // alarm补齐数据时需要
-	Points      []*dataobj.RRDData `json:"points"`         // 现场值
+	Key         string             `json:"-"`                     // 用于计算event的hashid
+	Metric      string             `json:"metric"`                // 指标名
+	Tags        map[string]string  `json:"tags,omitempty"`        // endpoint/counter
+	Granularity int                `json:"-"`                     // alarm补齐数据时需要
+	Points      []*dataobj.RRDData `json:"points"`                // 现场值
+	PredPoints  []*dataobj.RRDData `json:"pred_points,omitempty"` // 预测值, 模型类策略才有
 }
@@ -27,6 +27,22 @@ func (s *Strategy) MaxBufferSizeAndSpan(interval int) (int, []int) {
 					}
 				}
 			}
+			// 同比需要额外缓存offset秒之前的数据
+			if expression.Func == TRIGGER_PERIOD_COMPARE &&
+				len(expression.Params) == 4 {
+				if period, err := strconv.Atoi(expression.Params[0]); err == nil {
+					if period/interval > maxPeriod {
+						maxPeriod = period / interval
+					}
+				}
+				if offset, err := strconv.Atoi(expression.Params[1]); err == nil && offset > 0 {
+					spanM[offset] = struct{}{}
+				}
+			}
+			// 模型需要额外缓存训练使用的历史数据
+			if period := expression.trainingPeriod(); period/interval > maxPeriod {
+				maxPeriod = period / interval
+			}
 		}
 	}
 	span := make([]int, 0)
@@ -53,8 +69,11 @@ func (s *Strategy) MaxEventHistorySize(interval int) int {
 	for _, judgement := range s.Judgements {
 		for _, expression := range judgement.Execution.Expressions {
 			if expression.Func == TRIGGER_DURATION_HAPPEN ||
-				expression.Func == TRIGGER_DURATION_STAT {
-				if len(expression.Params) == 2 {
+				expression.Func == TRIGGER_DURATION_STAT ||
+				expression.Func == TRIGGER_PERIOD_COMPARE ||
+				expression.Func == TRIGGER_EWMA ||
+				expression.Func == TRIGGER_HOLT_WINTERS {
+				if len(expression.Params) >= 2 {
 					if period, err := strconv.Atoi(expression.Params[0]); err == nil {
 						if period/interval > base {
 							base = period / interval
@@ -67,6 +86,38 @@ func (s *Strategy) MaxEventHistorySize(interval int) int {
 	return base + maxPeriod
 }
 
+// IsModel 是否包含模型类的算子
+func (s *Strategy) IsModel() bool {
+	for _, judgement := range s.Judgements {
+		for _, expression := range judgement.Execution.Expressions {
+			if expression.Func == TRIGGER_EWMA ||
+				expression.Func == TRIGGER_HOLT_WINTERS {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// trainingPeriod 模型类算子需要的时间范围(判断窗口+训练数据), 单位秒, 非模型类返回0
+func (expression StrategyExpression) trainingPeriod() int {
+	var params []int
+	for _, param := range expression.Params {
+		if p, err := strconv.Atoi(param); err == nil {
+			params = append(params, p)
+		}
+	}
+	// ewma: [duration, window, dev]
+	if expression.Func == TRIGGER_EWMA && len(params) == 2 {
+		return params[0] + params[1]
+	}
+	// holt_winters: [duration, season, seasons, dev]
+	if expression.Func == TRIGGER_HOLT_WINTERS && len(params) == 3 {
+		return params[0] + params[1]*params[2]
+	}
+	return 0
+}
+
 func (sj StrategyJudgement) Xclude() (include map[string][]string,
 	exclude map[string][]string) {
 	include = make(map[string][]string)
@@ -0,0 +1,356 @@
+package trigger
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+// 模型类算子: 用 (duration, current] 之前的一段历史数据训练出基线,
+// 预测 (duration, current] 内每个点的值, 判断的是偏离度 (实际值-预测值)/标准差,
+// 阈值即k-sigma中的k, 所有点都满足阈值时报警
+
+const (
+	// Holt-Winters 的平滑系数, 分别对应 水平/趋势/季节
+	hwAlpha = 0.3
+	hwBeta  = 0.05
+	hwGamma = 0.3
+)
+
+// TriggerEWMA 指数加权移动平均, 同时维护指数加权的方差
+// params: [duration, window, dev/dev_abs]
+type TriggerEWMA struct {
+	TriggerThreshold
+	TriggerInfo
+	Duration  int64  // 判断的时间窗口, 以秒作为单位
+	Window    int64  // 训练使用的历史数据长度, 以秒作为单位
+	Deviation string // 偏离度的计算方式, 支持 dev/dev_abs
+}
+
+func NewTriggerEWMA(
+	thresholds []schema.StrategyThreshold, operator string,
+	params []string) (TriggerEWMA, error) {
+
+	threshold, err := NewTriggerThreshold(thresholds, operator)
+	if err != nil {
+		return TriggerEWMA{}, err
+	}
+
+	if len(params) != 3 {
+		return TriggerEWMA{}, ErrorParamIllegal
+	}
+	duration, err := strconv.ParseInt(params[0], 10, 64)
+	if err != nil || duration < 0 {
+		return TriggerEWMA{}, ErrorParamIllegal
+	}
+	window, err := strconv.ParseInt(params[1], 10, 64)
+	if err != nil || window <= 0 {
+		return TriggerEWMA{}, ErrorParamIllegal
+	}
+	if !isDeviation(params[2]) {
+		return TriggerEWMA{}, ErrorParamIllegal
+	}
+
+	// ewma_dev(xxx,60s,3600s)
+	info := "ewma_" + params[2] + "(%s," + params[0] + "s," + params[1] + "s)"
+	left, right := threshold.info()
+	ti := NewTriggerInfo(info, left, right)
+
+	return TriggerEWMA{
+		TriggerThreshold: threshold,
+		TriggerInfo:      ti,
+		Duration:         duration,
+		Window:           window,
+		Deviation:        params[2],
+	}, nil
+}
+
+func (tr TriggerEWMA) Run(
+	stg storage.Storage,
+	ID uint32,
+	current int64,
+	granularity int) (status int, points []*dataobj.RRDData, info string, err error) {
+
+	status, points, _, info, err = tr.Predict(stg, ID, current, granularity)
+	return
+}
+
+func (tr TriggerEWMA) Predict(
+	stg storage.Storage,
+	ID uint32,
+	current int64,
+	granularity int) (status int, points []*dataobj.RRDData, preds []*dataobj.RRDData, info string, err error) {
+
+	if ID <= 0 {
+		return schema.STATUS_EMPTY, nil, nil, "", ErrorQueryIDIllegal
+	}
+	delta := alignDuration(tr.Duration, granularity)
+
+	ps, enough, err := queryWindow(stg, ID, current-delta-tr.Window, current, 0)
+	if err != nil {
+		return schema.STATUS_NULL, nil, nil, "", err
+	}
+	if !enough {
+		return schema.STATUS_NULL, nil, nil, "", nil
+	}
+	train, actual := splitWindow(ps, current-delta)
+	// 训练数据少于窗口的一半, 基线没有参考意义, 跳过
+	if len(train) < 3 || int64(len(train)*granularity*2) < tr.Window {
+		return schema.STATUS_EMPTY, nil, nil, "", nil
+	}
+
+	// 平滑系数与窗口内的点数相关, 窗口越大, 越平滑
+	size := tr.Window / int64(granularity)
+	if size < 1 {
+		size = 1
+	}
+	alpha := 2 / (float64(size) + 1)
+	mean, variance := float64(train[0].Value), 0.0
+	for i := 1; i < len(train); i++ {
+		diff := float64(train[i].Value) - mean
+		incr := alpha * diff
+		mean += incr
+		variance = (1 - alpha) * (variance + diff*incr)
+	}
+
+	preds = make([]*dataobj.RRDData, len(actual))
+	for i := range actual {
+		preds[i] = dataobj.NewRRDData(actual[i].Timestamp, mean)
+	}
+	return tr.judge(actual, preds, math.Sqrt(variance))
+}
+
+// TriggerHoltWinters 加法模型的三次指数平滑, 适用于有周期性的曲线
+// params: [duration, season, seasons, dev/dev_abs]
+type TriggerHoltWinters struct {
+	TriggerThreshold
+	TriggerInfo
+	Duration  int64  // 判断的时间窗口, 以秒作为单位
+	Season    int64  // 一个周期的长度, 以秒作为单位, 如86400
+	Seasons   int64  // 训练使用的周期个数, 至少2个
+	Deviation string // 偏离度的计算方式, 支持 dev/dev_abs
+}
+
+func NewTriggerHoltWinters(
+	thresholds []schema.StrategyThreshold, operator string,
+	params []string) (TriggerHoltWinters, error) {
+
+	threshold, err := NewTriggerThreshold(thresholds, operator)
+	if err != nil {
+		return TriggerHoltWinters{}, err
+	}
+
+	if len(params) != 4 {
+		return TriggerHoltWinters{}, ErrorParamIllegal
+	}
+	duration, err := strconv.ParseInt(params[0], 10, 64)
+	if err != nil || duration < 0 {
+		return TriggerHoltWinters{}, ErrorParamIllegal
+	}
+	season, err := strconv.ParseInt(params[1], 10, 64)
+	if err != nil || season <= 0 {
+		return TriggerHoltWinters{}, ErrorParamIllegal
+	}
+	seasons, err := strconv.ParseInt(params[2], 10, 64)
+	if err != nil || seasons < 2 {
+		return TriggerHoltWinters{}, ErrorParamIllegal
+	}
+	if !isDeviation(params[3]) {
+		return TriggerHoltWinters{}, ErrorParamIllegal
+	}
+
+	// holtwinters_dev(xxx,60s,86400s,3)
+	info := "holtwinters_" + params[3] + "(%s," + params[0] + "s," + params[1] + "s," + params[2] + ")"
+	left, right := threshold.info()
+	ti := NewTriggerInfo(info, left, right)
+
+	return TriggerHoltWinters{
+		TriggerThreshold: threshold,
+		TriggerInfo:      ti,
+		Duration:         duration,
+		Season:           season,
+		Seasons:          seasons,
+		Deviation:        params[3],
+	}, nil
+}
+
+func (tr TriggerHoltWinters) Run(
+	stg storage.Storage,
+	ID uint32,
+	current int64,
+	granularity int) (status int, points []*dataobj.RRDData, info string, err error) {
+
+	status, points, _, info, err = tr.Predict(stg, ID, current, granularity)
+	return
+}
+
+func (tr TriggerHoltWinters) Predict(
+	stg storage.Storage,
+	ID uint32,
+	current int64,
+	granularity int) (status int, points []*dataobj.RRDData, preds []*dataobj.RRDData, info string, err error) {
+
+	if ID <= 0 {
+		return schema.STATUS_EMPTY, nil, nil, "", ErrorQueryIDIllegal
+	}
+	delta := alignDuration(tr.Duration, granularity)
+	length := int(tr.Season / int64(granularity)) // 一个周期内的点数
+	if length < 2 {
+		return schema.STATUS_EMPTY, nil, nil, "", ErrorParamIllegal
+	}
+
+	stime := current - delta - tr.Season*tr.Seasons
+	ps, enough, err := queryWindow(stg, ID, stime, current, 0)
+	if err != nil {
+		return schema.STATUS_NULL, nil, nil, "", err
+	}
+	if !enough {
+		return schema.STATUS_NULL, nil, nil, "", nil
+	}
+	train, actual := splitWindow(ps, current-delta)
+
+	// 训练数据按granularity对齐, 缺失的点为NaN
+	values := make([]float64, length*int(tr.Seasons))
+	for i := range values {
+		values[i] = math.NaN()
+	}
+	for i := range train {
+		idx := int((train[i].Timestamp-stime)/int64(granularity)) - 1
+		if idx >= 0 && idx < len(values) {
+			values[idx] = float64(train[i].Value)
+		}
+	}
+
+	// 用前两个周期初始化 水平/趋势/季节, 任何一个周期的点不足一半都跳过
+	first, n1 := meanValues(values[:length])
+	second, n2 := meanValues(values[length : 2*length])
+	if n1*2 < length || n2*2 < length {
+		return schema.STATUS_EMPTY, nil, nil, "", nil
+	}
+	level, trend := first, (second-first)/float64(length)
+	seasonal := make([]float64, length)
+	for i := 0; i < length; i++ {
+		if !math.IsNaN(values[i]) {
+			seasonal[i] = values[i] - first
+		}
+	}
+
+	variance := 0.0
+	for t := length; t < len(values); t++ {
+		x := values[t]
+		pred := level + trend + seasonal[t%length]
+		// 缺失的点用预测值代替, 不影响误差
+		if math.IsNaN(x) {
+			x = pred
+		}
+		diff := x - pred
+		variance = hwGamma*diff*diff + (1-hwGamma)*variance
+
+		last := level
+		level = hwAlpha*(x-seasonal[t%length]) + (1-hwAlpha)*(level+trend)
+		trend = hwBeta*(level-last) + (1-hwBeta)*trend
+		seasonal[t%length] = hwGamma*(x-level) + (1-hwGamma)*seasonal[t%length]
+	}
+
+	// 判断窗口内的点不再参与训练, 向后外推
+	end := current - delta
+	preds = make([]*dataobj.RRDData, len(actual))
+	for i := range actual {
+		h := int((actual[i].Timestamp - end) / int64(granularity))
+		pred := level + float64(h)*trend + seasonal[(len(values)+h-1)%length]
+		preds[i] = dataobj.NewRRDData(actual[i].Timestamp, pred)
+	}
+	return tr.judge(actual, preds, math.Sqrt(variance))
+}
+
+// judgeDeviation 每个点计算偏离度, 全部满足阈值时报警, info中显示最新点的偏离度
+func (th TriggerThreshold) judgeDeviation(deviation string,
+	actual []*dataobj.RRDData, preds []*dataobj.RRDData, sigma float64) (bool, float64) {
+
+	var (
+		final   float64
+		trigged = len(actual) > 0
+	)
+	for i := range actual {
+		diff := float64(actual[i].Value) - float64(preds[i].Value)
+		switch {
+		case diff == 0:
+			final = 0
+		case sigma == 0:
+			final = math.Inf(int(diff / math.Abs(diff)))
+		default:
+			final = diff / sigma
+		}
+		if deviation == schema.MODEL_DEVIATION_ABS {
+			final = math.Abs(final)
+		}
+		trigged = trigged && th.Compare(final)
+	}
+	return trigged, final
+}
+
+func (tr TriggerEWMA) judge(actual []*dataobj.RRDData, preds []*dataobj.RRDData,
+	sigma float64) (int, []*dataobj.RRDData, []*dataobj.RRDData, string, error) {
+
+	trigged, final := tr.judgeDeviation(tr.Deviation, actual, preds, sigma)
+	if trigged {
+		return schema.STATUS_ALERT, actual, preds, tr.Info(final), nil
+	}
+	return schema.STATUS_RECOVER, actual, preds, tr.Info(final), nil
+}
+
+func (tr TriggerHoltWinters) judge(actual []*dataobj.RRDData, preds []*dataobj.RRDData,
+	sigma float64) (int, []*dataobj.RRDData, []*dataobj.RRDData, string, error) {
+
+	trigged, final := tr.judgeDeviation(tr.Deviation, actual, preds, sigma)
+	if trigged {
+		return schema.STATUS_ALERT, actual, preds, tr.Info(final), nil
+	}
+	return schema.STATUS_RECOVER, actual, preds, tr.Info(final), nil
+}
+
+func isDeviation(deviation string) bool {
+	return deviation == schema.MODEL_DEVIATION ||
+		deviation == schema.MODEL_DEVIATION_ABS
+}
+
+// alignDuration 与granularity对齐, 确保可以查询到一个周期
+func alignDuration(duration int64, granularity int) int64 {
+	if duration < int64(granularity) {
+		return int64(granularity)
+	}
+	return duration - duration%int64(granularity)
+}
+
+// splitWindow ps按时间排序, 以split为界分为训练数据和判断数据
+func splitWindow(ps []*dataobj.RRDData, split int64) (train, actual []*dataobj.RRDData) {
+	for i := range ps {
+		if ps[i].Timestamp > split {
+			return ps[:i], ps[i:]
+		}
+	}
+	return ps, nil
+}
+
+// meanValues 忽略NaN的平均值, 同时返回有效点数
+func meanValues(values []float64) (float64, int) {
+	var (
+		sum float64
+		n   int
+	)
+	for _, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		sum += v
+		n++
+	}
+	if n == 0 {
+		return 0, 0
+	}
+	return sum / float64(n), n
+}
@@ -0,0 +1,93 @@
+package trigger
+
+import (
+	"math"
+	"testing"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema"
+)
+
+func Test_EWMA(t *testing.T) {
+	var ps []*dataobj.RRDData
+	for ts := int64(10); ts <= 600; ts += 10 {
+		ps = append(ps, dataobj.NewRRDData(ts, float64(10+ts/10%2*2)))
+	}
+	stg := &mockStorage{points: map[int][]*dataobj.RRDData{0: ps}}
+
+	// 偏离基线超过3个标准差
+	tr, err := NewTriggerEWMA(
+		[]schema.StrategyThreshold{{Operator: ">", Threshold: 3}},
+		schema.LOGIC_OPERATOR_AND,
+		[]string{"10", "300", schema.MODEL_DEVIATION_ABS},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stg.points[0] = append(ps, dataobj.NewRRDData(610, 30))
+	status, points, preds, _, err := tr.Predict(stg, 1, 610, 10)
+	if err != nil || status != schema.STATUS_ALERT || len(points) != 1 || len(preds) != 1 {
+		t.Fatalf("unexpected result: %d %v %v %v", status, points, preds, err)
+	}
+	if pred := float64(preds[0].Value); pred < 10 || pred > 12 {
+		t.Fatalf("unexpected prediction: %.2f", pred)
+	}
+
+	stg.points[0] = append(ps, dataobj.NewRRDData(610, 11))
+	if status, _, _, _ = tr.Run(stg, 1, 610, 10); status != schema.STATUS_RECOVER {
+		t.Fatalf("expect recover, got %d", status)
+	}
+
+	// 最新的点还没有到, 下次重试
+	if status, _, _, _ = tr.Run(stg, 1, 620, 10); status != schema.STATUS_NULL {
+		t.Fatalf("expect null, got %d", status)
+	}
+
+	// 训练数据不足
+	stg.points[0] = ps[len(ps)-5:]
+	if status, _, _, _ = tr.Run(stg, 1, 600, 10); status != schema.STATUS_EMPTY {
+		t.Fatalf("expect empty, got %d", status)
+	}
+}
+
+func Test_HoltWinters(t *testing.T) {
+	season := []float64{10, 20, 30, 20}
+	var ps []*dataobj.RRDData
+	for ts := int64(10); ts <= 80; ts += 10 {
+		ps = append(ps, dataobj.NewRRDData(ts, season[(ts/10-1)%4]))
+	}
+	stg := &mockStorage{points: map[int][]*dataobj.RRDData{0: ps}}
+
+	tr, err := NewTriggerHoltWinters(
+		[]schema.StrategyThreshold{{Operator: ">", Threshold: 3}},
+		schema.LOGIC_OPERATOR_AND,
+		[]string{"10", "40", "2", schema.MODEL_DEVIATION},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 符合周期规律
+	stg.points[0] = append(ps, dataobj.NewRRDData(90, 10))
+	status, _, preds, _, err := tr.Predict(stg, 1, 90, 10)
+	if err != nil || status != schema.STATUS_RECOVER || len(preds) != 1 {
+		t.Fatalf("unexpected result: %d %v %v", status, preds, err)
+	}
+	if pred := float64(preds[0].Value); math.Abs(pred-10) > 0.01 {
+		t.Fatalf("unexpected prediction: %.2f", pred)
+	}
+
+	stg.points[0] = append(ps, dataobj.NewRRDData(90, 25))
+	if status, _, _, _ = tr.Run(stg, 1, 90, 10); status != schema.STATUS_ALERT {
+		t.Fatalf("expect alert, got %d", status)
+	}
+
+	if _, err = NewTriggerHoltWinters(
+		[]schema.StrategyThreshold{{Operator: ">", Threshold: 3}},
+		schema.LOGIC_OPERATOR_AND,
+		[]string{"10", "40", "1", schema.MODEL_DEVIATION},
+	); err == nil {
+		t.Fatal("expect error for one season")
+	}
+}
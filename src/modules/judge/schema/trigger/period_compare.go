@@ -0,0 +1,182 @@
+package trigger
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+// TriggerPeriodCompare 同比, 一段时间内的统计值和Offset秒之前同一段时间的统计值比较
+// params: [duration, offset, max/min/avg/sum, diff/diff_abs/rate/rate_abs]
+type TriggerPeriodCompare struct {
+	TriggerThreshold
+	TriggerInfo
+	Duration int64  // 一段时间的定义, 以秒作为单位
+	Offset   int64  // 和多少秒之前比较, 如86400(天同比), 604800(周同比)
+	Operator string // 统计方式, 支持 max/min/avg/sum
+	Compare  string // 比较方式, 支持 diff/diff_abs/rate/rate_abs
+}
+
+func NewTriggerPeriodCompare(
+	thresholds []schema.StrategyThreshold, operator string,
+	params []string) (TriggerPeriodCompare, error) {
+
+	threshold, err := NewTriggerThreshold(thresholds, operator)
+	if err != nil {
+		return TriggerPeriodCompare{}, err
+	}
+
+	if len(params) != 4 {
+		return TriggerPeriodCompare{}, ErrorParamIllegal
+	}
+	duration, err := strconv.ParseInt(params[0], 10, 64)
+	if err != nil || duration < 0 {
+		return TriggerPeriodCompare{}, ErrorParamIllegal
+	}
+	offset, err := strconv.ParseInt(params[1], 10, 64)
+	if err != nil || offset <= 0 {
+		return TriggerPeriodCompare{}, ErrorParamIllegal
+	}
+
+	if params[2] != schema.MATH_OPERATOR_MAX &&
+		params[2] != schema.MATH_OPERATOR_MIN &&
+		params[2] != schema.MATH_OPERATOR_AVG &&
+		params[2] != schema.MATH_OPERATOR_SUM {
+		return TriggerPeriodCompare{}, ErrorParamIllegal
+	}
+
+	if params[3] != schema.COMPARE_DIFF &&
+		params[3] != schema.COMPARE_DIFF_ABS &&
+		params[3] != schema.COMPARE_RATE &&
+		params[3] != schema.COMPARE_RATE_ABS {
+		return TriggerPeriodCompare{}, ErrorParamIllegal
+	}
+
+	// c_avg_rate(xxx,60s,86400s)
+	info := "c_" + params[2] + "_" + params[3] + "(%s," + params[0] + "s," + params[1] + "s)"
+	left, right := threshold.info()
+	ti := NewTriggerInfo(info, left, right)
+
+	return TriggerPeriodCompare{
+		TriggerThreshold: threshold,
+		TriggerInfo:      ti,
+		Duration:         duration,
+		Offset:           offset,
+		Operator:         params[2],
+		Compare:          params[3],
+	}, nil
+}
+
+func (tr TriggerPeriodCompare) Run(
+	stg storage.Storage,
+	ID uint32,
+	current int64,
+	granularity int) (status int, points []*dataobj.RRDData, info string, err error) {
+
+	if ID <= 0 {
+		return schema.STATUS_EMPTY, nil, "", ErrorQueryIDIllegal
+	}
+	var delta int64
+	if tr.Duration < int64(granularity) {
+		delta = int64(granularity) // 确保可以查询到一个周期
+	} else {
+		delta = tr.Duration - tr.Duration%int64(granularity)
+	}
+
+	// 当前: current-delta ~ current
+	ps, enough, err := queryWindow(stg, ID, current-delta, current, 0)
+	if err != nil {
+		return schema.STATUS_NULL, nil, "", err
+	}
+	// 最新时刻的点还没有查到, 下次重试
+	if !enough {
+		return schema.STATUS_NULL, nil, "", nil
+	}
+
+	// 之前: 同样长度的时间窗口, 向前偏移offset, 缓存在span=offset的history中
+	past, _, err := queryWindow(stg, ID, current-tr.Offset-delta, current-tr.Offset, int(tr.Offset))
+	if err != nil {
+		return schema.STATUS_NULL, nil, "", err
+	}
+	// 之前的数据不存在(比如新上报的曲线), 重试也没有意义, 跳过
+	if len(past) == 0 {
+		return schema.STATUS_EMPTY, nil, "", nil
+	}
+
+	cur, before := statValues(tr.Operator, ps), statValues(tr.Operator, past)
+
+	var final float64
+	switch tr.Compare {
+	case schema.COMPARE_DIFF:
+		final = cur - before
+	case schema.COMPARE_DIFF_ABS:
+		final = math.Abs(cur - before)
+	case schema.COMPARE_RATE, schema.COMPARE_RATE_ABS:
+		// 之前为0时变化率没有意义
+		if before == 0 {
+			return schema.STATUS_EMPTY, nil, "", nil
+		}
+		final = (cur - before) / math.Abs(before) * 100
+		if tr.Compare == schema.COMPARE_RATE_ABS {
+			final = math.Abs(final)
+		}
+	}
+
+	if tr.TriggerThreshold.Compare(final) {
+		return schema.STATUS_ALERT, ps, tr.Info(final), nil
+	}
+	return schema.STATUS_RECOVER, ps, tr.Info(final), nil
+}
+
+// queryWindow 查询(stime, etime]内的有效点, enough表示etime时刻的点是否存在
+func queryWindow(stg storage.Storage, ID uint32, stime, etime int64,
+	span int) (ps []*dataobj.RRDData, enough bool, err error) {
+
+	tps, err := stg.Query(ID, stime, etime, span)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for i := range tps {
+		if tps[i] == nil {
+			continue
+		}
+
+		if tps[i].Timestamp > stime &&
+			tps[i].Timestamp <= etime &&
+			!math.IsNaN(float64(tps[i].Value)) {
+			if tps[i].Timestamp == etime {
+				enough = true
+			}
+			ps = append(ps, tps[i])
+		}
+	}
+	return ps, enough, nil
+}
+
+// statValues 计算统计值, ps不为空
+func statValues(operator string, ps []*dataobj.RRDData) float64 {
+	final := float64(ps[0].Value)
+	if operator == schema.MATH_OPERATOR_AVG || operator == schema.MATH_OPERATOR_SUM {
+		final = 0
+	}
+
+	for i := range ps {
+		value := float64(ps[i].Value)
+		switch operator {
+		case schema.MATH_OPERATOR_MAX:
+			final = max(final, value)
+		case schema.MATH_OPERATOR_MIN:
+			final = min(final, value)
+		case schema.MATH_OPERATOR_AVG:
+			final += value / float64(len(ps))
+		case schema.MATH_OPERATOR_SUM:
+			final += value
+		}
+	}
+	return final
+}
@@ -0,0 +1,84 @@
+package trigger
+
+import (
+	"testing"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage/series"
+)
+
+// mockStorage 按span返回固定的点
+type mockStorage struct {
+	points map[int][]*dataobj.RRDData
+}
+
+func (m *mockStorage) Query(ID uint32, stime, etime int64, span int) ([]*dataobj.RRDData, error) {
+	var ret []*dataobj.RRDData
+	for _, p := range m.points[span] {
+		if p.Timestamp >= stime && p.Timestamp <= etime {
+			ret = append(ret, p)
+		}
+	}
+	return ret, nil
+}
+
+func (m *mockStorage) Index(req *storage.IndexRequest) ([]storage.Counter, error) { return nil, nil }
+func (m *mockStorage) GenerateAndSet(s *series.Series, bufferSize int, spans []int) uint32 {
+	return 0
+}
+func (m *mockStorage) Get(ID uint32) (*series.Series, bool)                  { return nil, false }
+func (m *mockStorage) Push(items []*dataobj.JudgeItem) int                   { return 0 }
+func (m *mockStorage) Buffered(ID uint32) (map[int][]*dataobj.RRDData, bool) { return nil, false }
+func (m *mockStorage) Cleanup()                                              {}
+
+func Test_PeriodCompare(t *testing.T) {
+	stg := &mockStorage{points: map[int][]*dataobj.RRDData{
+		0: {
+			dataobj.NewRRDData(86410, 60),
+			dataobj.NewRRDData(86420, 40),
+		},
+		86400: {
+			dataobj.NewRRDData(10, 100),
+			dataobj.NewRRDData(20, 100),
+		},
+	}}
+
+	// 平均值比一天前下降超过30%
+	tr, err := NewTriggerPeriodCompare(
+		[]schema.StrategyThreshold{{Operator: "<", Threshold: -30}},
+		schema.LOGIC_OPERATOR_AND,
+		[]string{"20", "86400", schema.MATH_OPERATOR_AVG, schema.COMPARE_RATE},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, points, info, err := tr.Run(stg, 1, 86420, 10)
+	if err != nil || status != schema.STATUS_ALERT || len(points) != 2 {
+		t.Fatalf("unexpected result: %d %v %v", status, points, err)
+	}
+	if info != "c_avg_rate(%s,20s,86400s)=-50.00 <-30.00" {
+		t.Fatalf("unexpected info: %s", info)
+	}
+
+	// 最新的点还没有到, 下次重试
+	if status, _, _, _ = tr.Run(stg, 1, 86430, 10); status != schema.STATUS_NULL {
+		t.Fatalf("expect null, got %d", status)
+	}
+
+	// 一天前没有数据, 跳过
+	delete(stg.points, 86400)
+	if status, _, _, _ = tr.Run(stg, 1, 86420, 10); status != schema.STATUS_EMPTY {
+		t.Fatalf("expect empty, got %d", status)
+	}
+
+	if _, err = NewTriggerPeriodCompare(
+		[]schema.StrategyThreshold{{Operator: "<", Threshold: -30}},
+		schema.LOGIC_OPERATOR_AND,
+		[]string{"20", "0", schema.MATH_OPERATOR_AVG, schema.COMPARE_RATE},
+	); err != ErrorParamIllegal {
+		t.Fatalf("expect param illegal, got %v", err)
+	}
+}
@@ -32,6 +32,15 @@ type Trigger interface {
 		granularity int) (status int, points []*dataobj.RRDData, info string, err error)
 }
 
+// ModelTrigger 模型类算子, 除现场值外, 还返回现场值对应时刻的预测值
+type ModelTrigger interface {
+	Trigger
+	Predict(stg storage.Storage,
+		ID uint32,
+		current int64,
+		granularity int) (status int, points []*dataobj.RRDData, preds []*dataobj.RRDData, info string, err error)
+}
+
 type TriggerThreshold struct {
 	thresholds []schema.StrategyThreshold
 	operator   string
@@ -1,6 +1,9 @@
 package buffer
 
 import (
+	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/open-falcon/falcon-ng/src/modules/judge/storage"
@@ -20,11 +23,15 @@ type StorageBuffer struct {
 	queue            chan *QueryRequest
 	query            query.SeriesQueryManager
 	queryConcurrency *nsema.Semaphore
+
+	pushLock  sync.RWMutex
+	pushIndex map[string]*pushEntry // endpoint/counter -> 曲线ID, 用于写入transfer推送的数据
 }
 
 type SeriesBuffer struct {
 	*series.Series
-	data []History
+	data  []History
+	atime int64 // 最后一次被策略使用(Set)的时间, 用于过期清理
 }
 
 // NewStorageBuffer
@@ -38,9 +45,10 @@ func NewStorageBuffer(opts StorageBufferOption,
 		queue:            make(chan *QueryRequest, opts.QueryQueueSize),
 		query:            qm,
 		queryConcurrency: nsema.NewSemaphore(opts.QueryConcurrency),
+		pushIndex:        make(map[string]*pushEntry),
 	}
 	go buffer.loop()
-	// TODO: buffer 定期执行cleanup
+	go buffer.cleanupLoop()
 	return buffer
 }
 
@@ -79,10 +87,54 @@ func (b *StorageBuffer) Get(ID uint32) (*series.Series, bool) {
 	return buffer.Series, true
 }
 
-// TODO: 对缓存进行清理, seriesBuffer需要一个atime参数
-// opts里需要有一个过期清理的配置
+// Buffered 返回曲线在缓存中的点, 按span区分
+func (b *StorageBuffer) Buffered(ID uint32) (map[int][]*dataobj.RRDData, bool) {
+	buffer, found := b.lookup(ID)
+	if !found {
+		return nil, false
+	}
+
+	ret := make(map[int][]*dataobj.RRDData, len(buffer.data))
+	for i := range buffer.data {
+		ret[buffer.data[i].ID()] = buffer.data[i].Read(0, math.MaxInt64)
+	}
+	return ret, true
+}
+
+// Cleanup 清理超过SeriesExpire没有被策略使用的曲线, 包括推送数据的索引
+// 策略删除之后不再Set, 它的曲线会在过期之后被清理
 func (b *StorageBuffer) Cleanup() {
+	b.cleanup(time.Now().Unix())
+}
 
+func (b *StorageBuffer) cleanup(now int64) {
+	if b.opts.SeriesExpire <= 0 {
+		return
+	}
+
+	deadline := now - int64(b.opts.SeriesExpire)
+	for item := range b.storage.IterBuffered() {
+		buffer, ok := item.Val.(*SeriesBuffer)
+		if !ok || atomic.LoadInt64(&buffer.atime) >= deadline {
+			continue
+		}
+
+		removed := b.storage.RemoveCb(item.Key, func(key uint32, v interface{}, exists bool) bool {
+			// 检查和删除之间可能被重新Set
+			return exists && v == buffer && atomic.LoadInt64(&buffer.atime) < deadline
+		})
+
+		if removed {
+			b.unregister(buffer.Series)
+		}
+	}
+}
+
+func (b *StorageBuffer) cleanupLoop() {
+	for {
+		time.Sleep(time.Minute)
+		b.Cleanup()
+	}
 }
 
 func (b *StorageBuffer) Set(s *series.Series, size int, spans []int) {
@@ -97,9 +149,11 @@ func (b *StorageBuffer) Set(s *series.Series, size int, spans []int) {
 	if !found {
 		buffer = NewSeriesBuffer(s, size, spans)
 		b.storage.Set(s.ID, buffer)
+		b.register(s)
 		return
 	}
 
+	atomic.StoreInt64(&buffer.atime, time.Now().Unix())
 	buffer.Series = s
 
 	if size < b.opts.HistorySize {
@@ -128,6 +182,7 @@ func NewSeriesBuffer(s *series.Series, size int,
 	return &SeriesBuffer{
 		Series: s,
 		data:   data,
+		atime:  time.Now().Unix(),
 	}
 }
 
@@ -0,0 +1,150 @@
+package buffer
+
+import (
+	"sync"
+
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage/series"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+// pushEntry 同一个endpoint/counter可能对应多条曲线(比如不同的step)
+type pushEntry struct {
+	sync.Mutex
+	IDs []uint32
+
+	// COUNTER|DERIVE 需要前一个原始值来计算速率, 与tsdb的算法保持一致
+	rawTs  int64
+	rawVal float64
+}
+
+func (b *StorageBuffer) register(s *series.Series) {
+	key := dataobj.PKWithCounter(s.Endpoint(), s.Counter)
+
+	b.pushLock.Lock()
+	defer b.pushLock.Unlock()
+
+	entry, found := b.pushIndex[key]
+	if !found {
+		entry = &pushEntry{}
+		b.pushIndex[key] = entry
+	}
+
+	entry.Lock()
+	defer entry.Unlock()
+
+	for _, ID := range entry.IDs {
+		if ID == s.ID {
+			return
+		}
+	}
+	entry.IDs = append(entry.IDs, s.ID)
+}
+
+// unregister 曲线从缓存中清理之后, 推送的数据不再写入
+func (b *StorageBuffer) unregister(s *series.Series) {
+	key := dataobj.PKWithCounter(s.Endpoint(), s.Counter)
+
+	b.pushLock.Lock()
+	defer b.pushLock.Unlock()
+
+	entry, found := b.pushIndex[key]
+	if !found {
+		return
+	}
+
+	entry.Lock()
+	defer entry.Unlock()
+
+	IDs := entry.IDs[:0]
+	for _, ID := range entry.IDs {
+		if ID != s.ID {
+			IDs = append(IDs, ID)
+		}
+	}
+	entry.IDs = IDs
+
+	if len(entry.IDs) == 0 {
+		delete(b.pushIndex, key)
+	}
+}
+
+func (b *StorageBuffer) pushEntry(endpoint, counter string) (*pushEntry, bool) {
+	b.pushLock.RLock()
+	defer b.pushLock.RUnlock()
+
+	entry, found := b.pushIndex[dataobj.PKWithCounter(endpoint, counter)]
+	return entry, found
+}
+
+// Push 写入transfer推送过来的数据, 只写入当前周期(span=0)的history,
+// 策略执行时命中history就不再去transfer查询. 返回被忽略的点数
+func (b *StorageBuffer) Push(items []*dataobj.JudgeItem) int {
+	ignored := 0
+	for _, item := range items {
+		if item == nil || item.Step <= 0 {
+			ignored++
+			continue
+		}
+
+		entry, found := b.pushEntry(item.Endpoint, item.Counter())
+		if !found {
+			ignored++
+			continue
+		}
+
+		entry.Lock()
+		value, ok := entry.calc(item)
+		IDs := make([]uint32, len(entry.IDs))
+		copy(IDs, entry.IDs)
+		entry.Unlock()
+
+		if !ok {
+			ignored++
+			continue
+		}
+
+		point := []*dataobj.RRDData{dataobj.NewRRDData(item.Timestamp, value)}
+		for _, ID := range IDs {
+			buffer, found := b.lookup(ID)
+			if !found || buffer.Granularity() != item.Step {
+				continue
+			}
+
+			for i := range buffer.data {
+				if buffer.data[i].ID() == 0 {
+					buffer.data[i].Write(point)
+				}
+			}
+		}
+	}
+
+	return ignored
+}
+
+func (e *pushEntry) calc(item *dataobj.JudgeItem) (float64, bool) {
+	if item.DsType != dataobj.COUNTER && item.DsType != dataobj.DERIVE {
+		return item.Value, true
+	}
+
+	if item.Timestamp <= e.rawTs {
+		return 0, false
+	}
+
+	prevTs, prevVal := e.rawTs, e.rawVal
+	e.rawTs, e.rawVal = item.Timestamp, item.Value
+
+	// 第一个点或者间隔超过heartbeat, 无法计算速率
+	if prevTs == 0 || item.Timestamp-prevTs > int64(item.Step*2) {
+		return 0, false
+	}
+
+	value := (item.Value - prevVal) / float64(item.Timestamp-prevTs)
+
+	// 计数器重置或者回绕
+	if item.DsType == dataobj.COUNTER && value < 0 {
+		return 0, false
+	}
+
+	return value, true
+}
@@ -0,0 +1,123 @@
+package buffer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage/query"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage/series"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 推送的数据不依赖下游, 不需要查询管理器
+func newPushSeries(t *testing.T, buffer *StorageBuffer, step int, dstype string) *series.Series {
+	s, err := series.NewSeries(
+		"net.if.in.bytes",
+		map[string]string{
+			"endpoint": "mock",
+			"iface":    "eth0",
+		},
+		step,
+		dstype,
+	)
+	assert.Nil(t, err)
+
+	buffer.GenerateAndSet(s, 12, []int{0})
+	return s
+}
+
+func Test_BufferPush(t *testing.T) {
+	buffer := NewStorageBuffer(NewStorageBufferOption(), query.SeriesQueryManager{})
+	s := newPushSeries(t, buffer, 10, dataobj.GAUGE)
+
+	now := time.Now().Unix()
+	ignored := buffer.Push([]*dataobj.JudgeItem{
+		{Endpoint: "mock", Metric: "net.if.in.bytes", Tags: "iface=eth0", Value: 1, Timestamp: now, DsType: dataobj.GAUGE, Step: 10},
+		// step不一致, 不写入
+		{Endpoint: "mock", Metric: "net.if.in.bytes", Tags: "iface=eth0", Value: 2, Timestamp: now, DsType: dataobj.GAUGE, Step: 60},
+		// 没有策略使用的曲线
+		{Endpoint: "mock", Metric: "net.if.in.bytes", Tags: "iface=eth1", Value: 3, Timestamp: now, DsType: dataobj.GAUGE, Step: 10},
+		nil,
+	})
+	assert.Equal(t, 2, ignored)
+
+	data, found := buffer.Buffered(s.ID)
+	assert.True(t, found)
+	assert.Len(t, data[0], 1)
+	assert.Equal(t, now, data[0][0].Timestamp)
+	assert.Equal(t, dataobj.JsonFloat(1), data[0][0].Value)
+
+	// 重复Set不会重复注册
+	buffer.GenerateAndSet(s, 12, []int{0})
+	entry, found := buffer.pushEntry("mock", "net.if.in.bytes/iface=eth0")
+	assert.True(t, found)
+	assert.Equal(t, []uint32{s.ID}, entry.IDs)
+}
+
+func Test_BufferPushCounter(t *testing.T) {
+	buffer := NewStorageBuffer(NewStorageBufferOption(), query.SeriesQueryManager{})
+	s := newPushSeries(t, buffer, 10, dataobj.COUNTER)
+
+	now := time.Now().Unix()
+	item := func(ts int64, value float64) *dataobj.JudgeItem {
+		return &dataobj.JudgeItem{Endpoint: "mock", Metric: "net.if.in.bytes", Tags: "iface=eth0",
+			Value: value, Timestamp: ts, DsType: dataobj.COUNTER, Step: 10}
+	}
+
+	// 第一个点没有速率, 重复的时间戳和计数器重置都忽略
+	assert.Equal(t, 1, buffer.Push([]*dataobj.JudgeItem{item(now-20, 100)}))
+	assert.Equal(t, 0, buffer.Push([]*dataobj.JudgeItem{item(now-10, 200)}))
+	assert.Equal(t, 1, buffer.Push([]*dataobj.JudgeItem{item(now-10, 300)}))
+	assert.Equal(t, 1, buffer.Push([]*dataobj.JudgeItem{item(now, 50)}))
+
+	data, found := buffer.Buffered(s.ID)
+	assert.True(t, found)
+	assert.Len(t, data[0], 1)
+	assert.Equal(t, now-10, data[0][0].Timestamp)
+	assert.Equal(t, dataobj.JsonFloat(10), data[0][0].Value)
+}
+
+func Test_BufferCleanup(t *testing.T) {
+	buffer := NewStorageBuffer(NewStorageBufferOption(), query.SeriesQueryManager{})
+	expired := newPushSeries(t, buffer, 10, dataobj.GAUGE)
+	active := newPushSeries(t, buffer, 60, dataobj.GAUGE)
+
+	now := time.Now().Unix()
+	b, _ := buffer.lookup(expired.ID)
+	b.atime = now - int64(buffer.opts.SeriesExpire) - 1
+
+	buffer.cleanup(now)
+
+	_, found := buffer.Get(expired.ID)
+	assert.False(t, found)
+	_, found = buffer.Get(active.ID)
+	assert.True(t, found)
+
+	entry, found := buffer.pushEntry("mock", "net.if.in.bytes/iface=eth0")
+	assert.True(t, found)
+	assert.Equal(t, []uint32{active.ID}, entry.IDs)
+
+	// 被清理的曲线不再写入推送的数据
+	ignored := buffer.Push([]*dataobj.JudgeItem{
+		{Endpoint: "mock", Metric: "net.if.in.bytes", Tags: "iface=eth0", Value: 1, Timestamp: now, DsType: dataobj.GAUGE, Step: 10},
+	})
+	assert.Equal(t, 0, ignored)
+	_, found = buffer.Buffered(expired.ID)
+	assert.False(t, found)
+
+	// 最后一条曲线清理之后索引也删除
+	b, _ = buffer.lookup(active.ID)
+	b.atime = now - int64(buffer.opts.SeriesExpire) - 1
+	buffer.cleanup(now)
+
+	_, found = buffer.pushEntry("mock", "net.if.in.bytes/iface=eth0")
+	assert.False(t, found)
+
+	// 策略重新使用之后重新注册
+	buffer.GenerateAndSet(active, 12, []int{0})
+	entry, found = buffer.pushEntry("mock", "net.if.in.bytes/iface=eth0")
+	assert.True(t, found)
+	assert.Equal(t, []uint32{active.ID}, entry.IDs)
+}
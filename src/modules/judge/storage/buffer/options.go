@@ -18,6 +18,7 @@ var (
 	defaultStorageQueryMergeSize   = 30
 	defaultStorageShardsetSize     = 10
 	defaultStorageHistorySize      = 5
+	defaultStorageSeriesExpire     = 3600
 )
 
 type StorageBufferOption struct {
@@ -31,6 +32,7 @@ type StorageBufferOption struct {
 	QueuedQueryTimeout int `yaml:"queuedQueryTimeout"` // 异步读超时
 	ShardsetSize       int `yaml:"shardsetSize"`       // shardset的大小
 	HistorySize        int `yaml:"historySize"`        // 数据缓存的点数
+	SeriesExpire       int `yaml:"seriesExpire"`       // 曲线超过多久没有被策略使用就从缓存中清理, 单位秒
 }
 
 func Duration(n int) time.Duration {
@@ -49,5 +51,6 @@ func NewStorageBufferOption() StorageBufferOption {
 		QueuedQueryTimeout: defaultStorageQueuedQueryTimeout,
 		ShardsetSize:       defaultStorageShardsetSize,
 		HistorySize:        defaultStorageHistorySize,
+		SeriesExpire:       defaultStorageSeriesExpire,
 	}
 }
@@ -0,0 +1,172 @@
+package replay
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage/query"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage/series"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+var (
+	ErrorIndexNotFound = errors.New("id not found")
+)
+
+// ReplayStorage 回放历史数据时使用的storage:
+// 曲线ID只在本次回放内有效, 与全局storage无关;
+// 每条曲线第一次查询时, 从transfer查询到回放结束时刻的所有数据, 之后只在查询范围更早时补充查询
+type ReplayStorage struct {
+	sync.Mutex
+	query   query.SeriesQueryManager
+	end     int64 // 回放的结束时间
+	created uint32
+	keys    map[string]uint32 // series key -> ID
+	series  map[uint32]*replaySeries
+}
+
+type replaySeries struct {
+	*series.Series
+	from   int64              // 已经查询过的时间范围
+	to     int64              //
+	points []*dataobj.RRDData // 按时间排序
+}
+
+func NewReplayStorage(qm query.SeriesQueryManager, end int64) *ReplayStorage {
+	return &ReplayStorage{
+		query:  qm,
+		end:    end,
+		keys:   make(map[string]uint32),
+		series: make(map[uint32]*replaySeries),
+	}
+}
+
+func (r *ReplayStorage) Query(ID uint32, stime, etime int64, span int) ([]*dataobj.RRDData, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	s, found := r.series[ID]
+	if !found {
+		return nil, ErrorIndexNotFound
+	}
+
+	if len(s.points) == 0 && s.from == 0 && s.to == 0 {
+		if err := r.fetch(s, stime, max(etime, r.end)); err != nil {
+			return nil, err
+		}
+	} else if stime < s.from || etime > s.to {
+		if err := r.fetch(s, min(stime, s.from), max(etime, s.to)); err != nil {
+			return nil, err
+		}
+	}
+
+	// 和buffer保持一致, 包含两端
+	i := sort.Search(len(s.points), func(i int) bool { return s.points[i].Timestamp >= stime })
+	ret := make([]*dataobj.RRDData, 0)
+	for ; i < len(s.points) && s.points[i].Timestamp <= etime; i++ {
+		ret = append(ret, s.points[i])
+	}
+	return ret, nil
+}
+
+// fetch 查询 [from, to] 的数据, 替换已有的点
+func (r *ReplayStorage) fetch(s *replaySeries, from, to int64) error {
+	req, err := r.query.NewQueryRequest(s.Series, from, to)
+	if err != nil {
+		return err
+	}
+	resps, err := r.query.Query([]*dataobj.QueryData{req})
+	if err != nil {
+		return err
+	}
+
+	points := make([]*dataobj.RRDData, 0)
+	for _, resp := range resps {
+		if resp == nil {
+			continue
+		}
+		for _, p := range resp.Values {
+			if p == nil || math.IsNaN(float64(p.Value)) {
+				continue
+			}
+			points = append(points, p)
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Timestamp < points[j].Timestamp })
+
+	s.from, s.to, s.points = from, to, points
+	return nil
+}
+
+func (r *ReplayStorage) Index(req *storage.IndexRequest) ([]storage.Counter, error) {
+	return r.query.Index(req)
+}
+
+func (r *ReplayStorage) GenerateAndSet(s *series.Series, bufferSize int, spans []int) uint32 {
+	r.Lock()
+	defer r.Unlock()
+
+	key := s.Key()
+	if ID, found := r.keys[key]; found {
+		s.ID = ID
+		return ID
+	}
+	r.created++
+	s.ID = r.created
+	r.keys[key] = s.ID
+	r.series[s.ID] = &replaySeries{Series: s}
+	return s.ID
+}
+
+func (r *ReplayStorage) Get(ID uint32) (*series.Series, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	s, found := r.series[ID]
+	if !found {
+		return nil, false
+	}
+	return s.Series, true
+}
+
+// Push 回放时不接收推送的数据
+func (r *ReplayStorage) Push(items []*dataobj.JudgeItem) int {
+	return 0
+}
+
+func (r *ReplayStorage) Buffered(ID uint32) (map[int][]*dataobj.RRDData, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	s, found := r.series[ID]
+	if !found {
+		return nil, false
+	}
+	return map[int][]*dataobj.RRDData{0: s.points}, true
+}
+
+func (r *ReplayStorage) Cleanup() {
+	r.Lock()
+	defer r.Unlock()
+
+	r.keys = make(map[string]uint32)
+	r.series = make(map[uint32]*replaySeries)
+}
+
+func max(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func min(a, b int64) int64 {
+	if a > b {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,284 @@
+package replay
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/rpc"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema/entity"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage/query"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage/series"
+
+	codec "github.com/ugorji/go/codec"
+)
+
+const testBase = int64(1600000000)
+
+// Transfer 模拟transfer的Transfer.Query, 记录收到的查询
+type Transfer struct {
+	sync.Mutex
+	points   []*dataobj.RRDData
+	requests []*dataobj.QueryData
+}
+
+func (tr *Transfer) Query(reqs []*dataobj.QueryData, resp *dataobj.QueryDataResp) error {
+	tr.Lock()
+	defer tr.Unlock()
+
+	for _, req := range reqs {
+		tr.requests = append(tr.requests, req)
+
+		values := make([]*dataobj.RRDData, 0)
+		for _, p := range tr.points {
+			if p.Timestamp >= req.Start && p.Timestamp <= req.End {
+				values = append(values, p)
+			}
+		}
+		resp.Data = append(resp.Data, &dataobj.TsdbQueryResponse{
+			Start:    req.Start,
+			End:      req.End,
+			Endpoint: req.Endpoints[0],
+			Counter:  req.Counters[0],
+			DsType:   req.DsType,
+			Step:     req.Step,
+			Values:   values,
+		})
+	}
+	return nil
+}
+
+func (tr *Transfer) Requests() []*dataobj.QueryData {
+	tr.Lock()
+	defer tr.Unlock()
+	return append([]*dataobj.QueryData{}, tr.requests...)
+}
+
+// mockQuery 启动模拟的transfer和index, 返回的函数用于关闭
+func mockQuery(t *testing.T, points []*dataobj.RRDData) (query.SeriesQueryManager, *Transfer, func()) {
+	tr := &Transfer{points: points}
+	server := rpc.NewServer()
+	server.Register(tr)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mh codec.MsgpackHandle
+	mh.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			var bufconn = struct {
+				io.Closer
+				*bufio.Reader
+				*bufio.Writer
+			}{conn, bufio.NewReader(conn), bufio.NewWriter(conn)}
+
+			go server.ServeCodec(codec.MsgpackSpecRpc.ServerCodec(bufconn, &mh))
+		}
+	}()
+
+	index := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"dat":[{"endpoints":["mock"],"metric":"cpu.idle","tags":[],"step":10,"dstype":"GAUGE"}],"err":""}`))
+	}))
+
+	qm, err := query.NewSeriesQueryManager(query.NewSeriesQueryOption(
+		[]string{l.Addr().String()}, []string{index.URL}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return qm, tr, func() {
+		l.Close()
+		index.Close()
+	}
+}
+
+func newSeries(t *testing.T) *series.Series {
+	s, err := series.NewSeries("cpu.idle", map[string]string{"endpoint": "mock"}, 10, "GAUGE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func timestamps(points []*dataobj.RRDData) []int64 {
+	ret := make([]int64, 0, len(points))
+	for _, p := range points {
+		ret = append(ret, p.Timestamp)
+	}
+	return ret
+}
+
+func Test_ReplayStorage(t *testing.T) {
+	points := make([]*dataobj.RRDData, 0)
+	for ts := testBase; ts < testBase+200; ts += 10 {
+		value := float64(ts - testBase)
+		if ts == testBase+30 {
+			value = math.NaN()
+		}
+		points = append(points, dataobj.NewRRDData(ts, value))
+	}
+	qm, tr, stop := mockQuery(t, points)
+	defer stop()
+
+	r := NewReplayStorage(qm, testBase+150)
+
+	ID := r.GenerateAndSet(newSeries(t), 12, []int{0})
+	if again := r.GenerateAndSet(newSeries(t), 12, []int{0}); again != ID {
+		t.Fatalf("same series with different ID: %d, %d", ID, again)
+	}
+
+	if _, err := r.Query(ID+1, testBase, testBase+10, 0); err != ErrorIndexNotFound {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 第一次查询到回放结束时刻
+	ps, err := r.Query(ID, testBase+50, testBase+60, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := timestamps(ps); !reflect.DeepEqual(got, []int64{testBase + 50, testBase + 60}) {
+		t.Fatalf("unexpected points: %v", got)
+	}
+	reqs := tr.Requests()
+	if len(reqs) != 1 || reqs[0].Start != testBase+50 || reqs[0].End != testBase+150 {
+		t.Fatalf("unexpected requests: %+v", reqs)
+	}
+
+	// 已经查询过的范围不再查询
+	ps, err = r.Query(ID, testBase+100, testBase+150, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 6 || len(tr.Requests()) != 1 {
+		t.Fatalf("unexpected points: %v, requests: %d", timestamps(ps), len(tr.Requests()))
+	}
+
+	// 更早的范围补充查询, NaN丢弃
+	ps, err = r.Query(ID, testBase+20, testBase+40, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := timestamps(ps); !reflect.DeepEqual(got, []int64{testBase + 20, testBase + 40}) {
+		t.Fatalf("unexpected points: %v", got)
+	}
+	if reqs = tr.Requests(); len(reqs) != 2 || reqs[1].Start != testBase+20 || reqs[1].End != testBase+150 {
+		t.Fatalf("unexpected requests: %+v", reqs)
+	}
+
+	buffered, found := r.Buffered(ID)
+	if !found || len(buffered[0]) != 13 {
+		t.Fatalf("unexpected buffered points: %v", buffered)
+	}
+
+	if ignored := r.Push([]*dataobj.JudgeItem{{Endpoint: "mock", Metric: "cpu.idle"}}); ignored != 0 {
+		t.Fatalf("push should be ignored: %d", ignored)
+	}
+
+	r.Cleanup()
+	if _, found := r.Get(ID); found {
+		t.Fatal("series found after cleanup")
+	}
+}
+
+// Publisher 记录推送的事件, 回测不应该推送
+type Publisher struct {
+	sync.Mutex
+	events []*schema.Event
+}
+
+func (p *Publisher) Publish(event *schema.Event) error {
+	p.Lock()
+	defer p.Unlock()
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *Publisher) Close() {}
+
+// 和worker.Backtest一样, 策略实体使用ReplayStorage回放历史数据
+func Test_ReplayBacktest(t *testing.T) {
+	// cpu.idle < 10 报警: [base, base+90] 异常, [base+100, base+190] 正常
+	points := make([]*dataobj.RRDData, 0)
+	for ts := testBase; ts < testBase+200; ts += 10 {
+		value := 5.0
+		if ts >= testBase+100 {
+			value = 50
+		}
+		points = append(points, dataobj.NewRRDData(ts, value))
+	}
+	qm, _, stop := mockQuery(t, points)
+	defer stop()
+
+	stra := &schema.Strategy{
+		ID:        1,
+		Name:      "cpu.idle",
+		Priority:  1,
+		Category:  1,
+		Operator:  schema.LOGIC_OPERATOR_AND,
+		Endpoints: []string{"mock"},
+		Partition: "/falcon-ng/event/p1",
+		Judgements: []schema.StrategyJudgement{
+			{
+				Metric: "cpu.idle",
+				Execution: schema.StrategyExecution{
+					EffectiveDay:   []int{0, 1, 2, 3, 4, 5, 6},
+					EffectiveStart: 0,
+					EffectiveEnd:   1439,
+					Operator:       schema.LOGIC_OPERATOR_AND,
+					Expressions: []schema.StrategyExpression{
+						{
+							Func:       schema.TRIGGER_DURATION_HAPPEN,
+							Params:     []string{"10", "1"},
+							Operator:   schema.LOGIC_OPERATOR_AND,
+							Thresholds: []schema.StrategyThreshold{{Operator: "<", Threshold: 10}},
+						},
+					},
+				},
+			},
+		},
+		Alert: schema.StrategyAlert{
+			AlertCountThreshold:    1,
+			RecoverCountThreshold:  1,
+			LimitCountThreshold:    1,
+			LimitDurationThreshold: 3600,
+		},
+	}
+
+	pub := &Publisher{}
+	se := entity.NewStrategyEntity(stra, NewReplayStorage(qm, testBase+190), pub)
+	if se == nil {
+		t.Fatal("new strategy entity failed")
+	}
+
+	events := se.Backtest(testBase, testBase+190)
+	if len(events) != 2 {
+		t.Fatalf("unexpected events: %d", len(events))
+	}
+	if events[0].EventType != schema.EVENT_ALERT || events[0].Etime != testBase {
+		t.Fatalf("unexpected alert event: %s %d", events[0].EventType, events[0].Etime)
+	}
+	if events[1].EventType != schema.EVENT_RECOVER || events[1].Etime != testBase+100 {
+		t.Fatalf("unexpected recover event: %s %d", events[1].EventType, events[1].Etime)
+	}
+
+	pub.Lock()
+	defer pub.Unlock()
+	if len(pub.events) != 0 {
+		t.Fatalf("backtest published %d events", len(pub.events))
+	}
+}
@@ -11,6 +11,8 @@ type Storage interface {
 	Index(req *IndexRequest) ([]Counter, error)
 	GenerateAndSet(s *series.Series, bufferSize int, spans []int) uint32
 	Get(ID uint32) (*series.Series, bool)
+	Push(items []*dataobj.JudgeItem) int
+	Buffered(ID uint32) (map[int][]*dataobj.RRDData, bool) // 缓存中的点, span -> points
 	Cleanup()
 }
 
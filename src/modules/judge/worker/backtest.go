@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema/entity"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/storage/replay"
+)
+
+// 回测: 用transfer中的历史数据回放策略, 返回会产生的事件, 不推送, 也不影响正在运行的策略
+const (
+	maxBacktestRange = 7 * 24 * 3600 // 回放的最大时间范围
+)
+
+type BacktestResult struct {
+	Start   int64           `json:"start"`
+	End     int64           `json:"end"`
+	Alert   int             `json:"alert"`   // 报警事件数
+	Recover int             `json:"recover"` // 恢复事件数
+	Events  []*schema.Event `json:"events"`
+}
+
+// BacktestStra 回放portal格式的策略, 配置还没有保存时也可以先试
+func BacktestStra(s *model.Stra, start, end int64) (*BacktestResult, error) {
+	stra, err := parseStrategyFromRemote(s)
+	if err != nil {
+		return nil, err
+	}
+	return Backtest(stra, start, end)
+}
+
+// Backtest 回放 [start, end] 的历史数据
+func Backtest(s *schema.Strategy, start, end int64) (*BacktestResult, error) {
+	if s == nil {
+		return nil, errors.New("empty strategy")
+	}
+	if end <= start {
+		return nil, fmt.Errorf("illegal time range: [%d, %d]", start, end)
+	}
+	if end-start > maxBacktestRange {
+		return nil, fmt.Errorf("time range too large, max: %ds", maxBacktestRange)
+	}
+	if now := time.Now().Unix(); end > now {
+		end = now
+	}
+
+	se := entity.NewStrategyEntity(s, replay.NewReplayStorage(qm, end))
+	if se == nil {
+		return nil, errors.New("illegal strategy")
+	}
+
+	ret := &BacktestResult{
+		Start:  start,
+		End:    end,
+		Events: se.Backtest(start, end),
+	}
+	for _, event := range ret.Events {
+		switch event.EventType {
+		case schema.EVENT_ALERT:
+			ret.Alert++
+		case schema.EVENT_RECOVER:
+			ret.Recover++
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,250 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/open-falcon/falcon-ng/src/modules/judge/logger"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/rpc"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema/entity"
+
+	"github.com/parnurzeal/gorequest"
+)
+
+// judge集群成员:
+// 定期向portal上报心跳, portal根据存活的judge重建哈希环, 宕机的judge上的策略迁移到其他judge
+// 心跳中带上报警状态有变化的策略, 迁移后新的judge从portal恢复, 避免重复报警或者丢失恢复事件
+
+var (
+	_heartbeatLock sync.Mutex
+	_reported      = make(map[int64]string)                               // 已经上报的报警状态, 没有变化时不再上报
+	_handoff       = make(map[int64]map[string]*entity.JudgementSnapshot) // 已经迁走的策略, 下一次心跳时上报, 由_strategyLock保护
+	_httpAddr      string
+	_rpcAddr       string // transfer推送数据的地址, transfer从portal同步judge列表时使用
+)
+
+type heartbeatRequest struct {
+	Ident   string                    `json:"ident"`
+	Addr    string                    `json:"addr"`
+	Rpc     string                    `json:"rpc"`
+	StraNum int                       `json:"stra_num"`
+	Leaving bool                      `json:"leaving"`
+	States  map[int64]json.RawMessage `json:"states"`
+}
+
+type handoffState struct {
+	Sid   int64  `json:"sid"`
+	Ident string `json:"ident"`
+	State string `json:"state"`
+	Clock int64  `json:"clock"`
+}
+
+// initHeartbeat 管理接口和rpc监听在所有网卡时, 用identity代替
+func initHeartbeat(opts HTTPOption, rpcOpts rpc.RPCOption) {
+	if _options.HeartbeatInterval <= 0 {
+		_options.HeartbeatInterval = defaultHeartbeatInterval
+	}
+
+	_httpAddr = advertiseAddr(opts.Listen)
+	_rpcAddr = advertiseAddr(rpcOpts.Listen)
+}
+
+func advertiseAddr(listen string) string {
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return ""
+	}
+	if host == "" || host == "0.0.0.0" {
+		host = identity
+	}
+	return net.JoinHostPort(host, port)
+}
+
+func heartbeatLoop() {
+	if _options.HeartbeatApi == "" {
+		return
+	}
+	for {
+		time.Sleep(time.Duration(_options.HeartbeatInterval) * time.Millisecond)
+		if err := heartbeat(false); err != nil {
+			logger.Warningf(0, "heartbeat failed: %v", err)
+		}
+	}
+}
+
+// heartbeat leaving为true时上报所有策略的状态, portal立即把当前judge从哈希环中摘除
+func heartbeat(leaving bool) error {
+	if _options.HeartbeatApi == "" {
+		return nil
+	}
+
+	_heartbeatLock.Lock()
+	defer _heartbeatLock.Unlock()
+
+	_strategyLock.Lock()
+	ses := make(map[int64]*entity.StrategyEntity, len(_strategy))
+	for sid, se := range _strategy {
+		ses[sid] = se
+	}
+	handoff := _handoff
+	_handoff = make(map[int64]map[string]*entity.JudgementSnapshot)
+	_strategyLock.Unlock()
+
+	states := make(map[int64]string, len(ses)+len(handoff))
+	for sid, se := range ses {
+		states[sid] = marshalStates(se.Snapshot())
+	}
+	for sid, snapshot := range handoff {
+		states[sid] = marshalStates(snapshot)
+	}
+
+	req := heartbeatRequest{
+		Ident:   identity,
+		Addr:    _httpAddr,
+		Rpc:     _rpcAddr,
+		StraNum: len(ses),
+		Leaving: leaving,
+		States:  make(map[int64]json.RawMessage),
+	}
+	for sid, state := range states {
+		if last, found := _reported[sid]; found && last == state && !leaving {
+			continue
+		}
+		req.States[sid] = json.RawMessage(state)
+	}
+
+	if err := postHeartbeat(req); err != nil {
+		// 上报失败, 迁走的策略的状态下次重新上报
+		_strategyLock.Lock()
+		for sid, snapshot := range handoff {
+			if _, found := _handoff[sid]; !found {
+				_handoff[sid] = snapshot
+			}
+		}
+		_strategyLock.Unlock()
+		return err
+	}
+
+	for sid, state := range req.States {
+		_reported[sid] = string(state)
+	}
+	for sid := range _reported {
+		if _, found := ses[sid]; !found {
+			delete(_reported, sid)
+		}
+	}
+	return nil
+}
+
+func marshalStates(states map[string]*entity.JudgementSnapshot) string {
+	if len(states) == 0 {
+		return "{}"
+	}
+	bs, err := json.Marshal(states)
+	if err != nil {
+		return "{}"
+	}
+	return string(bs)
+}
+
+func postHeartbeat(req heartbeatRequest) error {
+	if len(_options.Addrs) == 0 {
+		return errors.New("empty config addr")
+	}
+
+	client := gorequest.New().
+		Timeout(time.Duration(_options.Timeout) * time.Millisecond)
+	resp := struct {
+		Err string `json:"err"`
+	}{}
+
+	var lastErr error
+	perm := rand.Perm(len(_options.Addrs))
+	for i := range perm {
+		url := fmt.Sprintf("http://%s%s", _options.Addrs[perm[i]], _options.HeartbeatApi)
+		res, _, errs := client.Post(url).Send(req).EndStruct(&resp)
+		if len(errs) != 0 {
+			lastErr = fmt.Errorf("%v", errs)
+			continue
+		}
+		if res == nil || res.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("heartbeat to %s failed, bad response", url)
+			continue
+		}
+		if resp.Err != "" {
+			lastErr = errors.New(resp.Err)
+			continue
+		}
+		return nil
+	}
+	return lastErr
+}
+
+// fetchHandoff 查询新分配到的策略在portal上的报警状态
+func fetchHandoff(ids []int64) map[int64]*handoffState {
+	ret := make(map[int64]*handoffState)
+	if _options.HandoffApi == "" || len(ids) == 0 || len(_options.Addrs) == 0 {
+		return ret
+	}
+
+	sids := make([]string, len(ids))
+	for i := range ids {
+		sids[i] = strconv.FormatInt(ids[i], 10)
+	}
+
+	client := gorequest.New().
+		Timeout(time.Duration(_options.Timeout) * time.Millisecond)
+	resp := struct {
+		Data []*handoffState `json:"dat"`
+		Err  string          `json:"err"`
+	}{}
+
+	perm := rand.Perm(len(_options.Addrs))
+	for i := range perm {
+		url := fmt.Sprintf("http://%s"+_options.HandoffApi, _options.Addrs[perm[i]], strings.Join(sids, ","))
+		res, _, errs := client.Get(url).EndStruct(&resp)
+		if len(errs) != 0 || res == nil || res.StatusCode != http.StatusOK || resp.Err != "" {
+			logger.Debugf(0, "get handoff state from %s failed, error:%v %s", url, errs, resp.Err)
+			continue
+		}
+
+		for _, state := range resp.Data {
+			if state != nil && state.Ident != identity {
+				ret[state.Sid] = state
+			}
+		}
+		break
+	}
+	return ret
+}
+
+// restoreStates 新增的策略, 本地保存的状态和其他judge交接的状态, 以较新的为准
+func restoreStates(adds map[int64]*entity.StrategyEntity, handoff map[int64]*handoffState) {
+	for ID, se := range adds {
+		local, hasLocal := _restoring[ID]
+		delete(_restoring, ID)
+
+		if remote, found := handoff[ID]; found && (!hasLocal || remote.Clock > _restoredAt) {
+			var states map[string]*entity.JudgementSnapshot
+			if err := json.Unmarshal([]byte(remote.State), &states); err != nil {
+				logger.Warningf(ID, "parse handoff state from %s failed: %v", remote.Ident, err)
+			} else {
+				logger.Infof(ID, "restore handoff state from %s, series:%d", remote.Ident, len(states))
+				se.Restore(states)
+				continue
+			}
+		}
+
+		if hasLocal {
+			se.Restore(local)
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package worker
 
 import (
+	"encoding/json"
 	"math"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/open-falcon/falcon-ng/src/modules/judge/logger"
@@ -20,6 +22,7 @@ import (
 var (
 	// schema/entity部分更多的关注到"逻辑的实现", 需要实体化的程序放在worker中
 	_nodataDrivers map[int64]map[string]entity.AlertDriverEntity
+	_nodataLock    sync.Mutex // _nodataDrivers 在保存报警状态时也会读取
 	_options       StrategyConfigOption
 )
 
@@ -154,6 +157,9 @@ func (s *NodataStrategy) Run(now time.Time) []*schema.Event {
 		}
 	}
 
+	_nodataLock.Lock()
+	defer _nodataLock.Unlock()
+
 	drivers, found := _nodataDrivers[s.ID]
 	if !found {
 		drivers = make(map[string]entity.AlertDriverEntity)
@@ -3,6 +3,7 @@ package worker
 import (
 	"log"
 
+	"github.com/open-falcon/falcon-ng/src/modules/judge/rpc"
 	"github.com/open-falcon/falcon-ng/src/modules/judge/schema/publish"
 	"github.com/open-falcon/falcon-ng/src/modules/judge/storage/buffer"
 	"github.com/open-falcon/falcon-ng/src/modules/judge/storage/query"
@@ -18,6 +19,9 @@ type Options struct {
 	Publisher publish.PublisherOption    `yaml:"publisher"`
 	Strategy  StrategyConfigOption       `yaml:"strategy"`
 	Identity  IdentityOption             `yaml:"identity"`
+	RPC       rpc.RPCOption              `yaml:"rpc"`
+	HTTP      HTTPOption                 `yaml:"http"`
+	State     StateOption                `yaml:"state"`
 }
 
 func InitOptions(cfg string) Options {
@@ -62,26 +66,49 @@ func NewLoggerOption() LoggerOption {
 	}
 }
 
+type HTTPOption struct {
+	Listen string `yaml:"listen"` // 为空时不启动http
+}
+
+var (
+	defaultStateInterval = 60
+	defaultStateMaxAge   = 3600
+)
+
+// StateOption 报警状态的持久化, 定期和退出时保存, 启动时恢复
+type StateOption struct {
+	Path     string `yaml:"path"`     // 状态文件, 为空时不保存
+	Interval int    `yaml:"interval"` // 定期保存的间隔, 单位秒
+	MaxAge   int    `yaml:"maxAge"`   // 状态文件中还没有恢复的状态最多保留多久, 单位秒
+}
+
 var (
 	defaultStrategyConfigTimeout        = 5000
 	defaultStrategyConfigUpdateInterval = 60000 // 1分钟
+	defaultHeartbeatInterval            = 10000
 )
 
 type StrategyConfigOption struct {
-	Addrs          []string `yaml:"addrs"` // 形如 http://IP:port/url
-	PartitionApi   string   `yaml:"partitionApi"`
-	Timeout        int      `yaml:"timeout"`
-	UpdateInterval int      `yaml:"updateInterval"`
-	IndexInterval  int      `yaml:"indexInterval"`
+	Addrs             []string `yaml:"addrs"` // 形如 http://IP:port/url
+	PartitionApi      string   `yaml:"partitionApi"`
+	Timeout           int      `yaml:"timeout"`
+	UpdateInterval    int      `yaml:"updateInterval"`
+	IndexInterval     int      `yaml:"indexInterval"`
+	HeartbeatApi      string   `yaml:"heartbeatApi"` // 向portal上报心跳和报警状态, 为空时不上报
+	HandoffApi        string   `yaml:"handoffApi"`   // 新分配到的策略, 从portal查询之前的judge交接的报警状态
+	HeartbeatInterval int      `yaml:"heartbeatInterval"`
 }
 
 func NewStrategyConfigOption(addrs []string) StrategyConfigOption {
 	return StrategyConfigOption{
-		Addrs:          addrs,
-		PartitionApi:   "/api/stra/effective?ip=%s",
-		Timeout:        defaultStrategyConfigTimeout,
-		UpdateInterval: defaultStrategyConfigUpdateInterval,
-		IndexInterval:  defaultStrategyConfigUpdateInterval,
+		Addrs:             addrs,
+		PartitionApi:      "/api/stra/effective?ip=%s",
+		Timeout:           defaultStrategyConfigTimeout,
+		UpdateInterval:    defaultStrategyConfigUpdateInterval,
+		IndexInterval:     defaultStrategyConfigUpdateInterval,
+		HeartbeatApi:      "/api/portal/judges/heartbeat",
+		HandoffApi:        "/api/portal/judges/states?sids=%s",
+		HeartbeatInterval: defaultHeartbeatInterval,
 	}
 }
 
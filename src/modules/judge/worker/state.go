@@ -0,0 +1,177 @@
+package worker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/open-falcon/falcon-ng/src/modules/judge/logger"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema/entity"
+)
+
+// 报警状态保存到本地文件, 重启后恢复:
+// 策略的曲线要等索引更新后才会生成, 恢复的状态先挂在策略实体上, 曲线生成时生效
+
+var (
+	_stateOptions StateOption
+	_restoring    map[int64]map[string]*entity.JudgementSnapshot // 启动时读到的状态, 策略实体创建时取走, 由_strategyLock保护
+	_restoredAt   int64                                          // 状态文件的保存时间
+)
+
+type StateSnapshot struct {
+	Timestamp  int64                                          `json:"timestamp"`
+	Strategies map[int64]map[string]*entity.JudgementSnapshot `json:"strategies"` // sid -> 曲线key -> 状态
+	Nodata     map[int64]map[string]*entity.AlertPointDriver  `json:"nodata"`     // sid -> counter -> driver
+}
+
+// loadState 读取状态文件, 恢复nodata的driver, 策略的状态在strategyManageLoop中恢复
+func loadState(opts StateOption) {
+	_stateOptions = opts
+	_restoring = make(map[int64]map[string]*entity.JudgementSnapshot)
+	if opts.Path == "" {
+		return
+	}
+	if opts.Interval <= 0 {
+		_stateOptions.Interval = defaultStateInterval
+	}
+	if opts.MaxAge <= 0 {
+		_stateOptions.MaxAge = defaultStateMaxAge
+	}
+
+	bs, err := ioutil.ReadFile(opts.Path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warningf(0, "load state from %s failed: %v", opts.Path, err)
+		}
+		return
+	}
+
+	var snapshot StateSnapshot
+	if err = json.Unmarshal(bs, &snapshot); err != nil {
+		logger.Warningf(0, "load state from %s failed: %v", opts.Path, err)
+		return
+	}
+
+	if snapshot.Strategies != nil {
+		_restoring = snapshot.Strategies
+	}
+	_restoredAt = snapshot.Timestamp
+
+	_nodataLock.Lock()
+	for sid, drivers := range snapshot.Nodata {
+		restored := make(map[string]entity.AlertDriverEntity, len(drivers))
+		for counter, driver := range drivers {
+			if driver != nil {
+				restored[counter] = driver
+			}
+		}
+		_nodataDrivers[sid] = restored
+	}
+	_nodataLock.Unlock()
+
+	logger.Infof(0, "load state from %s, saved at %d, strategy:%d, nodata:%d",
+		opts.Path, snapshot.Timestamp, len(snapshot.Strategies), len(snapshot.Nodata))
+}
+
+func stateSaveLoop() {
+	if _stateOptions.Path == "" {
+		return
+	}
+	for {
+		time.Sleep(time.Duration(_stateOptions.Interval) * time.Second)
+		if err := saveState(); err != nil {
+			logger.Warningf(0, "save state failed: %v", err)
+		}
+	}
+}
+
+// saveState 先写临时文件再rename, 避免进程退出时写了一半
+func saveState() error {
+	if _stateOptions.Path == "" {
+		return nil
+	}
+
+	snapshot := StateSnapshot{
+		Timestamp:  time.Now().Unix(),
+		Strategies: make(map[int64]map[string]*entity.JudgementSnapshot),
+		Nodata:     make(map[int64]map[string]*entity.AlertPointDriver),
+	}
+
+	_strategyLock.Lock()
+	ses := make(map[int64]*entity.StrategyEntity, len(_strategy))
+	for sid, se := range _strategy {
+		ses[sid] = se
+	}
+	// 还没有创建策略实体的, 没有过期就原样保存
+	pruneRestoring(nil, snapshot.Timestamp)
+	for sid, states := range _restoring {
+		snapshot.Strategies[sid] = states
+	}
+	_strategyLock.Unlock()
+
+	for sid, se := range ses {
+		if states := se.Snapshot(); len(states) > 0 {
+			snapshot.Strategies[sid] = states
+		}
+	}
+
+	_nodataLock.Lock()
+	for sid, drivers := range _nodataDrivers {
+		saved := make(map[string]*entity.AlertPointDriver, len(drivers))
+		for counter, driver := range drivers {
+			if d, ok := driver.(*entity.AlertPointDriver); ok {
+				saved[counter] = d
+			}
+		}
+		if len(saved) > 0 {
+			snapshot.Nodata[sid] = saved
+		}
+	}
+	// driver在锁内序列化
+	bs, err := json.Marshal(snapshot)
+	_nodataLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(_stateOptions.Path), 0755); err != nil {
+		return err
+	}
+	tmp := _stateOptions.Path + ".tmp"
+	if err = ioutil.WriteFile(tmp, bs, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, _stateOptions.Path); err != nil {
+		return err
+	}
+
+	logger.Debugf(0, "save state to %s, strategy:%d, nodata:%d",
+		_stateOptions.Path, len(snapshot.Strategies), len(snapshot.Nodata))
+	return nil
+}
+
+// pruneRestoring 清理不会再被恢复的状态: 超过MaxAge的, 以及newest不为空时不在当前策略列表中的
+// 调用方需要持有_strategyLock写锁
+func pruneRestoring(newest map[int64]struct{}, now int64) {
+	if len(_restoring) == 0 {
+		return
+	}
+
+	if _stateOptions.MaxAge > 0 && now-_restoredAt > int64(_stateOptions.MaxAge) {
+		logger.Infof(0, "drop expired restoring state, saved at %d, strategy:%d", _restoredAt, len(_restoring))
+		_restoring = make(map[int64]map[string]*entity.JudgementSnapshot)
+		return
+	}
+
+	if newest == nil {
+		return
+	}
+	for sid := range _restoring {
+		if _, found := newest[sid]; !found {
+			logger.Infof(sid, "drop restoring state, strategy not found")
+			delete(_restoring, sid)
+		}
+	}
+}
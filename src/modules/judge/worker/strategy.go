@@ -1,11 +1,13 @@
 package worker
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/open-falcon/falcon-ng/src/model"
@@ -103,7 +105,7 @@ func parseStrategyFromRemote(s *model.Stra) (*schema.Strategy, error) {
 		i++
 	}
 
-	return &schema.Strategy{
+	stra := &schema.Strategy{
 		ID:         s.Id,
 		Name:       s.Name,
 		Priority:   s.Priority,
@@ -115,7 +117,12 @@ func parseStrategyFromRemote(s *model.Stra) (*schema.Strategy, error) {
 		Judgements: judgements,
 		Alert:      alert,
 		Updated:    s.LastUpdated.Unix(),
-	}, nil
+	}
+	// 包含模型类算子的策略, 事件中会带上预测值, 其他策略保留原来的category
+	if stra.IsModel() {
+		stra.Category = schema.CATEGORY_MODEL
+	}
+	return stra, nil
 }
 
 func parseJudgement(s *model.Stra, exps []model.Exp,
@@ -172,8 +179,46 @@ func parseJudgement(s *model.Stra, exps []model.Exp,
 		case "nodata":
 			trigger = schema.TRIGGER_NODATA
 			params = append(params, strconv.Itoa(s.AlertDur))
+		case "ewma", "ewma_abs":
+			// 阈值为k-sigma中的k, params[0]为训练使用的历史数据长度, 单位s
+			if len(exps[i].Params) != 1 || exps[i].Params[0] <= 0 {
+				return nil, fmt.Errorf("func %s param illegal", exps[i].Func)
+			}
+			trigger = schema.TRIGGER_EWMA
+			params = append(params, strconv.Itoa(s.AlertDur))
+			params = append(params, strconv.Itoa(exps[i].Params[0]))
+			params = append(params, modelDeviation(exps[i].Func))
+		case "holtwinters", "holtwinters_abs":
+			// 阈值为k-sigma中的k, params[0]为周期长度, 单位s, params[1]为训练使用的周期个数, 默认2
+			if len(exps[i].Params) == 0 || len(exps[i].Params) > 2 || exps[i].Params[0] <= 0 {
+				return nil, fmt.Errorf("func %s param illegal", exps[i].Func)
+			}
+			seasons := 2
+			if len(exps[i].Params) == 2 {
+				seasons = exps[i].Params[1]
+			}
+			if seasons < 2 {
+				return nil, fmt.Errorf("func %s param illegal", exps[i].Func)
+			}
+			trigger = schema.TRIGGER_HOLT_WINTERS
+			params = append(params, strconv.Itoa(s.AlertDur))
+			params = append(params, strconv.Itoa(exps[i].Params[0]))
+			params = append(params, strconv.Itoa(seasons))
+			params = append(params, modelDeviation(exps[i].Func))
 		default:
-			return nil, errors.New("func not support")
+			// 同比: c_{max|min|avg|sum}[_rate][_abs], params[0]为对比的时间偏移, 单位s
+			stat, compare, ok := parseCompareFunc(exps[i].Func)
+			if !ok {
+				return nil, errors.New("func not support")
+			}
+			if len(exps[i].Params) != 1 || exps[i].Params[0] <= 0 {
+				return nil, fmt.Errorf("func %s param illegal", exps[i].Func)
+			}
+			trigger = schema.TRIGGER_PERIOD_COMPARE
+			params = append(params, strconv.Itoa(s.AlertDur))
+			params = append(params, strconv.Itoa(exps[i].Params[0]))
+			params = append(params, stat)
+			params = append(params, compare)
 		}
 		execution := schema.StrategyExecution{
 			EffectiveDay:   []int{0, 1, 2, 3, 4, 5, 6},
@@ -192,15 +237,60 @@ func parseJudgement(s *model.Stra, exps []model.Exp,
 				},
 			},
 		}
+		metric := exps[i].Metric
+		if len(exps[i].Expression) > 0 && len(metric) == 0 {
+			metric = exps[i].Expression
+		}
 		judgements = append(judgements, schema.StrategyJudgement{
-			Metric:    exps[i].Metric,
-			Tags:      filters,
-			Execution: execution,
+			Metric:     metric,
+			Expression: exps[i].Expression,
+			Tags:       filters,
+			Execution:  execution,
 		})
 	}
 	return judgements, nil
 }
 
+// parseCompareFunc 解析同比算子, 如 c_avg_rate_abs -> avg, rate_abs
+func parseCompareFunc(fn string) (stat string, compare string, ok bool) {
+	if !strings.HasPrefix(fn, "c_") {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(fn, "c_"), "_", 2)
+	switch parts[0] {
+	case schema.MATH_OPERATOR_MAX, schema.MATH_OPERATOR_MIN,
+		schema.MATH_OPERATOR_AVG, schema.MATH_OPERATOR_SUM:
+		stat = parts[0]
+	default:
+		return "", "", false
+	}
+
+	compare = schema.COMPARE_DIFF
+	if len(parts) == 2 {
+		switch parts[1] {
+		case "abs":
+			compare = schema.COMPARE_DIFF_ABS
+		case "rate":
+			compare = schema.COMPARE_RATE
+		case "rate_abs":
+			compare = schema.COMPARE_RATE_ABS
+		default:
+			return "", "", false
+		}
+	}
+
+	return stat, compare, true
+}
+
+// modelDeviation 模型算子以_abs结尾时, 判断偏离度的绝对值
+func modelDeviation(fn string) string {
+	if strings.HasSuffix(fn, "_abs") {
+		return schema.MODEL_DEVIATION_ABS
+	}
+	return schema.MODEL_DEVIATION
+}
+
 func parseAlert(s *model.Stra) (schema.StrategyAlert, error) {
 	return schema.StrategyAlert{
 		AlertCountThreshold:      1, // 统一设置为1, alertDuration 字段用于算子参数
@@ -5,12 +5,8 @@ import (
 	"net"
 	"strconv"
 	"strings"
-
-	"github.com/json-iterator/go"
 )
 
-var json = jsoniter.ConfigCompatibleWithStandardLibrary
-
 func IP() (string, error) {
 	ips, err := IntranetIP()
 	if err != nil {
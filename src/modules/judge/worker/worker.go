@@ -2,14 +2,19 @@ package worker
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/open-falcon/falcon-ng/src/modules/judge/logger"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/rpc"
 	"github.com/open-falcon/falcon-ng/src/modules/judge/schema/entity"
 	"github.com/open-falcon/falcon-ng/src/modules/judge/schema/publish"
 	filep "github.com/open-falcon/falcon-ng/src/modules/judge/schema/publish/file"
+	kafkap "github.com/open-falcon/falcon-ng/src/modules/judge/schema/publish/kafka"
+	nsqp "github.com/open-falcon/falcon-ng/src/modules/judge/schema/publish/nsq"
 	redisp "github.com/open-falcon/falcon-ng/src/modules/judge/schema/publish/redis"
 	"github.com/open-falcon/falcon-ng/src/modules/judge/storage"
 	"github.com/open-falcon/falcon-ng/src/modules/judge/storage/buffer"
@@ -17,19 +22,18 @@ import (
 )
 
 var (
-	stg      storage.Storage        // 全局 唯一storage对象
-	pub      publish.EventPublisher // 全局 唯一publisher对象
-	identity string                 // 全局, 分片信息
+	stg      storage.Storage          // 全局 唯一storage对象
+	pub      publish.EventPublisher   // 全局 唯一publisher对象
+	qm       query.SeriesQueryManager // 全局, 回测时查询历史数据
+	identity string                   // 全局, 分片信息
 
 	_strategy     = make(map[int64]*entity.StrategyEntity) // 全局 策略实体列表
 	_strategyLock = &sync.RWMutex{}                        // 策略实体列表加锁
+	_manageLock   = &sync.Mutex{}                          // 定时同步和Reload不能同时更新策略, 否则同一个策略会被重复添加
 )
 
 // Start 全局worker
-func Start(file string) {
-	// 初始化配置文件
-	opts := InitOptions(file)
-
+func Start(opts Options) {
 	ident, err := GetIdentity(opts.Identity)
 	if err != nil {
 		log.Fatalln("[F] cannot get identity:", err)
@@ -42,16 +46,25 @@ func Start(file string) {
 	InitLog(opts.Log)
 
 	// 初始化存储组件
-	qm, err := query.NewSeriesQueryManager(opts.Query)
+	qm, err = query.NewSeriesQueryManager(opts.Query)
 	if err != nil {
 		log.Fatalln("[F] init transfer/index failed:", err)
 	}
 	stg = buffer.NewStorageBuffer(opts.Storage, qm)
 
+	// 接收transfer推送的数据
+	if opts.RPC.Listen != "" {
+		go rpc.Start(opts.RPC, stg)
+	}
+
 	// 初始化publisher组件
 	switch opts.Publisher.Type {
 	case "redis":
 		pub, err = redisp.NewRedisPublisher(opts.Publisher.Redis)
+	case "nsq":
+		pub, err = nsqp.NewNsqPublisher(opts.Publisher.Nsq)
+	case "kafka":
+		pub, err = kafkap.NewKafkaPublisher(opts.Publisher.Kafka)
 	case "file":
 		pub, err = filep.NewFilePublisher(opts.Publisher.File)
 	default:
@@ -65,12 +78,25 @@ func Start(file string) {
 	_nodataDrivers = make(map[int64]map[string]entity.AlertDriverEntity)
 	_options = opts.Strategy
 
+	// 恢复重启前保存的报警状态
+	loadState(opts.State)
+
+	// 先上报一次心跳, portal把当前judge加入哈希环后才会分配策略
+	initHeartbeat(opts.HTTP, opts.RPC)
+	if err = heartbeat(false); err != nil {
+		logger.Warningf(0, "heartbeat failed: %v", err)
+	}
+
 	// 策略初始化
 	err = strategyManageLoop(true)
 	if err != nil {
 		log.Fatalln("[F] init strategy failed:", err)
 	}
 
+	// 定期保存报警状态
+	go stateSaveLoop()
+	go heartbeatLoop()
+
 	// 进入循环
 	go func() {
 		for {
@@ -92,6 +118,15 @@ func Stop() {
 	}
 	_strategyLock.Unlock()
 
+	if err := saveState(); err != nil {
+		logger.Warningf(0, "save state failed: %v", err)
+	}
+
+	// 交接所有策略的报警状态, 并从哈希环中摘除
+	if err := heartbeat(true); err != nil {
+		logger.Warningf(0, "heartbeat failed: %v", err)
+	}
+
 	pub.Close()
 }
 
@@ -125,7 +160,82 @@ func GetStrategySummary(ID int64) (*entity.StrategySummary, bool) {
 	return se.Summary(), true
 }
 
+// ListStrategySummary 返回所有加载的策略, 按ID排序
+func ListStrategySummary() []*entity.StrategySummary {
+	_strategyLock.RLock()
+	ret := make([]*entity.StrategySummary, 0, len(_strategy))
+	for _, se := range _strategy {
+		ret = append(ret, se.Summary())
+	}
+	_strategyLock.RUnlock()
+
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ID < ret[j].ID })
+	return ret
+}
+
+func getStrategyEntity(ID int64) (*entity.StrategyEntity, bool) {
+	_strategyLock.RLock()
+	defer _strategyLock.RUnlock()
+
+	se, found := _strategy[ID]
+	return se, found
+}
+
+func GetStrategySeries(ID int64) ([]*entity.SeriesDetail, bool) {
+	se, found := getStrategyEntity(ID)
+	if !found {
+		return nil, false
+	}
+	return se.Series(), true
+}
+
+func GetStrategyStates(ID int64) ([]*entity.JudgementState, bool) {
+	se, found := getStrategyEntity(ID)
+	if !found {
+		return nil, false
+	}
+	return se.States(), true
+}
+
+// Reload 立即从portal拉取策略, ID不为0时同时更新这个策略的配置和曲线
+func Reload(ID int64) error {
+	if err := strategyManageLoop(); err != nil {
+		return err
+	}
+
+	if ID == 0 {
+		return nil
+	}
+
+	se, found := getStrategyEntity(ID)
+	if !found {
+		return fmt.Errorf("strategy %d not found", ID)
+	}
+	se.Update(false)
+	se.Update(true)
+	return nil
+}
+
+// RunStrategy 通知策略的调度循环立即执行一次判断, 已经判断过的时间戳不会重复判断
+func RunStrategy(ID int64) error {
+	se, found := getStrategyEntity(ID)
+	if !found {
+		return fmt.Errorf("strategy %d not found", ID)
+	}
+
+	if status := se.Status(); status == entity.ENTITY_STATUS_STOPPING ||
+		status == entity.ENTITY_STATUS_STOPPED {
+		return fmt.Errorf("strategy %d is stopped", ID)
+	}
+
+	se.Trigger()
+	return nil
+}
+
 func strategyManageLoop(first ...bool) error {
+	_manageLock.Lock()
+	defer _manageLock.Unlock()
+
 	ss, err := GetStrategyFromRemote(_options)
 	if err != nil {
 		logger.Warningf(0, "GetStrategyFromRemote failed:%v", err)
@@ -167,8 +277,21 @@ func strategyManageLoop(first ...bool) error {
 	}
 	_strategyLock.RUnlock()
 
+	// 已经不属于本judge的策略, 状态文件中的状态不会再被恢复
+	_strategyLock.Lock()
+	pruneRestoring(newest, time.Now().Unix())
+	_strategyLock.Unlock()
+
 	if len(adds) > 0 {
+		// 从其他judge迁移过来的策略, 恢复之前的报警状态
+		ids := make([]int64, 0, len(adds))
+		for ID := range adds {
+			ids = append(ids, ID)
+		}
+		handoff := fetchHandoff(ids)
+
 		_strategyLock.Lock()
+		restoreStates(adds, handoff)
 		for ID, se := range adds {
 			se.Start(_options.IndexInterval)
 			_strategy[ID] = se
@@ -186,9 +309,17 @@ func strategyManageLoop(first ...bool) error {
 				delete(_strategy, ID)
 				continue
 			}
+			// 策略迁移到其他judge, 交接报警状态
+			if states := se.Snapshot(); len(states) > 0 {
+				_handoff[ID] = states
+			}
 			se.Stop()
 		}
 		_strategyLock.Unlock()
+
+		if _options.HeartbeatApi != "" {
+			go heartbeat(false)
+		}
 	}
 	logger.Infof(0, "strategyManageLoop finished, total:%d, add:%d, update:%d, delete:%d",
 		len(ss), len(adds), updated, len(deletes))
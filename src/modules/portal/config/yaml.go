@@ -15,6 +15,7 @@ type PortalYml struct {
 	LDAP   ldapSection       `yaml:"ldap"`
 	Proxy  proxySection      `yaml:"proxy"`
 	Judges map[string]string `yaml:"judges"`
+	Member memberSection     `yaml:"member"`
 }
 
 type loggerSection struct {
@@ -39,6 +40,12 @@ type ldapSection struct {
 	StartTLS   bool   `yaml:"startTLS"`
 }
 
+// memberSection judge通过心跳注册, 超过timeout没有心跳的judge从哈希环中摘除, 超过expire从成员列表删除
+type memberSection struct {
+	Timeout int `yaml:"timeout"` // 单位秒
+	Expire  int `yaml:"expire"`  // 单位秒
+}
+
 type proxySection struct {
 	Transfer string `yaml:"transfer"`
 	Index    string `yaml:"index"`
@@ -64,6 +71,13 @@ func Parse(ymlfile string) error {
 		return fmt.Errorf("cannot read yml[%s]: %v", ymlfile, err)
 	}
 
+	if c.Member.Timeout <= 0 {
+		c.Member.Timeout = 30
+	}
+	if c.Member.Expire <= 0 {
+		c.Member.Expire = 86400
+	}
+
 	lock.Lock()
 	yaml = &c
 	lock.Unlock()
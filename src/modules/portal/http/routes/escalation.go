@@ -0,0 +1,105 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/errors"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+)
+
+type EscalationForm struct {
+	Name   string                 `json:"name"`
+	Note   string                 `json:"note"`
+	Steps  []model.EscalationStep `json:"steps"`
+	Repeat int                    `json:"repeat"`
+}
+
+func (f EscalationForm) Fill(obj *model.Escalation) {
+	obj.Name = f.Name
+	obj.Note = f.Note
+	obj.Steps = f.Steps
+	obj.Repeat = f.Repeat
+
+	for i := range obj.Steps {
+		for _, id := range obj.Steps[i].Users {
+			mustUser(id)
+		}
+
+		for _, id := range obj.Steps[i].Oncalls {
+			mustOncall(id)
+		}
+	}
+
+	errors.Dangerous(obj.Encode())
+}
+
+func escalationPost(c *gin.Context) {
+	var f EscalationForm
+	errors.Dangerous(c.ShouldBind(&f))
+
+	obj := new(model.Escalation)
+	f.Fill(obj)
+	obj.Creator = loginUsername(c)
+	obj.LastUpdator = obj.Creator
+
+	errors.Dangerous(obj.Add())
+	renderData(c, obj.Id, nil)
+}
+
+func escalationGets(c *gin.Context) {
+	objs, err := model.EscalationGets(queryStr(c, "query", ""))
+	renderData(c, objs, err)
+}
+
+func escalationGet(c *gin.Context) {
+	renderData(c, mustEscalation(urlParamInt64(c, "id")), nil)
+}
+
+func escalationPut(c *gin.Context) {
+	obj := mustEscalation(urlParamInt64(c, "id"))
+
+	var f EscalationForm
+	errors.Dangerous(c.ShouldBind(&f))
+	f.Fill(obj)
+	obj.LastUpdator = loginUsername(c)
+
+	renderMessage(c, obj.Update("name", "note", "steps", "repeats", "last_updator"))
+}
+
+func escalationDel(c *gin.Context) {
+	renderMessage(c, model.EscalationDel(urlParamInt64(c, "id")))
+}
+
+type escalationLogData struct {
+	model.EscalationLog
+	Usernames []string `json:"usernames"`
+}
+
+// escalationTimeline 升级的时间线, 用户id转换为用户名
+func escalationTimeline(logs []model.EscalationLog) []escalationLogData {
+	ret := make([]escalationLogData, 0, len(logs))
+	for i := range logs {
+		names := []string{}
+		if logs[i].Users != "" && logs[i].Users != "[]" {
+			var err error
+			names, err = model.UserNameGetByIds(logs[i].Users)
+			errors.Dangerous(err)
+		}
+
+		ret = append(ret, escalationLogData{EscalationLog: logs[i], Usernames: names})
+	}
+	return ret
+}
+
+func mustEscalation(id int64) *model.Escalation {
+	obj, err := model.EscalationGet("id", id)
+	if err != nil {
+		errors.Bomb("cannot retrieve escalation[%d]: %v", id, err)
+	}
+
+	if obj == nil {
+		errors.Bomb("no such escalation[%d]", id)
+	}
+
+	return obj
+}
@@ -36,6 +36,8 @@ type eventData struct {
 	Claimants    []string            `json:"claimants,omitempty"`
 	NeedUpgrade  int                 `json:"need_upgrade"`
 	AlertUpgrade AlertUpgrade        `json:"alert_upgrade"`
+	Escalation   []escalationLogData `json:"escalation,omitempty"` // 升级的时间线, 只在详情中返回
+	Notifies     []model.NotifyLog   `json:"notifies,omitempty"`   // 通知的投递记录, 只在详情中返回
 }
 
 type AlertUpgrade struct {
@@ -279,6 +281,13 @@ func eventHisGetById(c *gin.Context) {
 		},
 	}
 
+	logs, err := model.EscalationLogGetsByEvent(event)
+	errors.Dangerous(err)
+	dat.Escalation = escalationTimeline(logs)
+
+	dat.Notifies, err = model.NotifyLogGetsByEvent(event.Id)
+	errors.Dangerous(err)
+
 	renderData(c, dat, nil)
 }
 
@@ -343,6 +352,13 @@ func eventCurGetById(c *gin.Context) {
 		},
 	}
 
+	logs, err := model.EscalationLogGets(eventCur.Id)
+	errors.Dangerous(err)
+	dat.Escalation = escalationTimeline(logs)
+
+	dat.Notifies, err = model.NotifyLogGetsByEventCur(eventCur)
+	errors.Dangerous(err)
+
 	renderData(c, dat, nil)
 }
 
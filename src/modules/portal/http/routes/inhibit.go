@@ -0,0 +1,88 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/errors"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+)
+
+type InhibitForm struct {
+	Nid       int64  `json:"nid"`
+	Name      string `json:"name"`
+	SrcSids   string `json:"src_sids"`
+	SrcMetric string `json:"src_metric"`
+	SrcTags   string `json:"src_tags"`
+	TgtSids   string `json:"tgt_sids"`
+	TgtMetric string `json:"tgt_metric"`
+	TgtTags   string `json:"tgt_tags"`
+	Equal     string `json:"equal"`
+	Action    string `json:"action"`
+}
+
+func (f InhibitForm) Fill(obj *model.Inhibit) {
+	mustNode(f.Nid)
+
+	obj.Nid = f.Nid
+	obj.Name = f.Name
+	obj.SrcSids = f.SrcSids
+	obj.SrcMetric = f.SrcMetric
+	obj.SrcTags = f.SrcTags
+	obj.TgtSids = f.TgtSids
+	obj.TgtMetric = f.TgtMetric
+	obj.TgtTags = f.TgtTags
+	obj.Equal = f.Equal
+	obj.Action = f.Action
+
+	errors.Dangerous(obj.Validate())
+}
+
+func inhibitPost(c *gin.Context) {
+	var f InhibitForm
+	errors.Dangerous(c.ShouldBind(&f))
+
+	obj := new(model.Inhibit)
+	f.Fill(obj)
+	obj.Creator = loginUsername(c)
+	obj.LastUpdator = obj.Creator
+
+	errors.Dangerous(obj.Add())
+	renderData(c, obj.Id, nil)
+}
+
+// inhibitGets 节点及其父节点上的规则
+func inhibitGets(c *gin.Context) {
+	objs, err := model.InhibitGets(urlParamInt64(c, "id"))
+	renderData(c, objs, err)
+}
+
+func inhibitGet(c *gin.Context) {
+	obj, err := model.InhibitGet("id", urlParamInt64(c, "id"))
+	errors.Dangerous(err)
+
+	if obj == nil {
+		errors.Bomb("inhibit is nil")
+	}
+
+	renderData(c, obj, nil)
+}
+
+func inhibitPut(c *gin.Context) {
+	obj, err := model.InhibitGet("id", urlParamInt64(c, "id"))
+	errors.Dangerous(err)
+
+	if obj == nil {
+		errors.Bomb("inhibit is nil")
+	}
+
+	var f InhibitForm
+	errors.Dangerous(c.ShouldBind(&f))
+	f.Fill(obj)
+	obj.LastUpdator = loginUsername(c)
+
+	renderMessage(c, obj.Update("nid", "name", "src_sids", "src_metric", "src_tags", "tgt_sids", "tgt_metric", "tgt_tags", "equal", "action", "last_updator"))
+}
+
+func inhibitDel(c *gin.Context) {
+	renderMessage(c, model.InhibitDel(urlParamInt64(c, "id")))
+}
@@ -0,0 +1,59 @@
+package routes
+
+import (
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/errors"
+	"github.com/toolkits/pkg/str"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+	"github.com/open-falcon/falcon-ng/src/modules/portal/scache"
+)
+
+// judgeHeartbeatForm states是judge上策略的报警状态, 策略迁移后由新的judge恢复
+type judgeHeartbeatForm struct {
+	Ident   string                    `json:"ident"`
+	Addr    string                    `json:"addr"`
+	Rpc     string                    `json:"rpc"`
+	StraNum int                       `json:"stra_num"`
+	Leaving bool                      `json:"leaving"`
+	States  map[int64]json.RawMessage `json:"states"`
+}
+
+func judgeHeartbeat(c *gin.Context) {
+	var f judgeHeartbeatForm
+	errors.Dangerous(c.ShouldBind(&f))
+
+	if f.Ident == "" {
+		errors.Bomb("arg[ident] is blank")
+	}
+
+	errors.Dangerous(model.JudgeHeartbeat(f.Ident, f.Addr, f.Rpc, f.StraNum))
+	if f.Leaving {
+		errors.Dangerous(model.JudgeMemberLeave(f.Ident))
+	}
+
+	states := make(map[int64]string, len(f.States))
+	for sid, state := range f.States {
+		if len(state) == 0 || string(state) == "null" || string(state) == "{}" {
+			states[sid] = ""
+			continue
+		}
+		states[sid] = string(state)
+	}
+	errors.Dangerous(model.JudgeStraStatesSave(f.Ident, states))
+
+	renderData(c, "ok", nil)
+}
+
+func judgeMembersGet(c *gin.Context) {
+	renderData(c, scache.JudgeNodes.Members(), nil)
+}
+
+// judgeStatesGet judge拿到新的策略时, 查询之前的judge交接的报警状态
+func judgeStatesGet(c *gin.Context) {
+	ids := str.IdsInt64(mustQueryStr(c, "sids"))
+	list, err := model.JudgeStraStateGets(ids)
+	renderData(c, list, err)
+}
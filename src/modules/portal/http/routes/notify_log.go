@@ -0,0 +1,47 @@
+package routes
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/errors"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+)
+
+// notifyLogGets 通知的投递记录, 默认最近一天, 可以按事件, 通道, 状态过滤
+func notifyLogGets(c *gin.Context) {
+	now := time.Now().Unix()
+	q := model.NotifyLogQuery{
+		EventId: queryInt64(c, "event_id", 0),
+		Channel: queryStr(c, "channel", ""),
+		Status:  queryStr(c, "status", ""),
+		Stime:   queryInt64(c, "stime", now-86400),
+		Etime:   queryInt64(c, "etime", now+1),
+	}
+	limit := queryInt(c, "limit", 20)
+
+	total, err := model.NotifyLogTotal(q)
+	errors.Dangerous(err)
+
+	list, err := model.NotifyLogGets(q, limit, offset(c, limit, total))
+	errors.Dangerous(err)
+
+	renderData(c, gin.H{
+		"list":  list,
+		"total": total,
+	}, nil)
+}
+
+func notifyLogGet(c *gin.Context) {
+	id := urlParamInt64(c, "id")
+
+	obj, err := model.NotifyLogGet(id)
+	errors.Dangerous(err)
+
+	if obj == nil {
+		errors.Bomb("no such notify log[%d]", id)
+	}
+
+	renderData(c, obj, nil)
+}
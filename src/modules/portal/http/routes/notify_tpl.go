@@ -0,0 +1,121 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/errors"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/notify/tpl"
+)
+
+type NotifyTplForm struct {
+	Name     string `json:"name"`
+	Channel  string `json:"channel"`
+	Priority int    `json:"priority"`
+	Sid      int64  `json:"sid"`
+	Nid      int64  `json:"nid"`
+	Subject  string `json:"subject"`
+	Content  string `json:"content"`
+}
+
+func (f NotifyTplForm) Fill(obj *model.NotifyTpl) {
+	if f.Nid > 0 {
+		mustNode(f.Nid)
+	}
+
+	obj.Name = f.Name
+	obj.Channel = f.Channel
+	obj.Priority = f.Priority
+	obj.Sid = f.Sid
+	obj.Nid = f.Nid
+	obj.Subject = f.Subject
+	obj.Content = f.Content
+
+	errors.Dangerous(obj.Validate())
+	errors.Dangerous(tpl.Validate(obj.Channel, obj.Subject, obj.Content))
+}
+
+func notifyTplPost(c *gin.Context) {
+	var f NotifyTplForm
+	errors.Dangerous(c.ShouldBind(&f))
+
+	obj := new(model.NotifyTpl)
+	f.Fill(obj)
+	obj.Creator = loginUsername(c)
+	obj.LastUpdator = obj.Creator
+
+	errors.Dangerous(obj.Add())
+	renderData(c, obj.Id, nil)
+}
+
+func notifyTplGets(c *gin.Context) {
+	objs, err := model.NotifyTplGets(queryStr(c, "channel", ""), queryInt64(c, "sid", 0), queryInt64(c, "nid", 0))
+	renderData(c, objs, err)
+}
+
+func notifyTplGet(c *gin.Context) {
+	renderData(c, mustNotifyTpl(urlParamInt64(c, "id")), nil)
+}
+
+func notifyTplPut(c *gin.Context) {
+	obj := mustNotifyTpl(urlParamInt64(c, "id"))
+
+	var f NotifyTplForm
+	errors.Dangerous(c.ShouldBind(&f))
+	f.Fill(obj)
+	obj.LastUpdator = loginUsername(c)
+
+	renderMessage(c, obj.Update("name", "channel", "priority", "sid", "nid", "subject", "content", "last_updator"))
+}
+
+func notifyTplDel(c *gin.Context) {
+	renderMessage(c, model.NotifyTplDel(urlParamInt64(c, "id")))
+}
+
+// notifyTplDefault 各个通道的默认模板, 新建模板时可以在此基础上修改
+func notifyTplDefault(c *gin.Context) {
+	ret := make(map[string]map[string]string)
+	for _, channel := range tpl.Channels {
+		subject, content := tpl.Default(channel)
+		ret[channel] = map[string]string{"subject": subject, "content": content}
+	}
+	renderData(c, ret, nil)
+}
+
+type notifyTplPreviewForm struct {
+	Id      int64  `json:"id"` // 不为空时预览已经保存的模板
+	Channel string `json:"channel"`
+	Subject string `json:"subject"`
+	Content string `json:"content"`
+}
+
+// notifyTplPreview 使用示例事件渲染模板
+func notifyTplPreview(c *gin.Context) {
+	var f notifyTplPreviewForm
+	errors.Dangerous(c.ShouldBind(&f))
+
+	if f.Id > 0 {
+		obj := mustNotifyTpl(f.Id)
+		f.Channel, f.Subject, f.Content = obj.Channel, obj.Subject, obj.Content
+	}
+
+	if f.Content == "" {
+		errors.Bomb("arg[content] empty")
+	}
+
+	subject, content, err := tpl.Render(f.Channel, f.Subject, f.Content, tpl.SampleData())
+	errors.Dangerous(err)
+
+	renderData(c, map[string]string{"subject": subject, "content": content}, nil)
+}
+
+func mustNotifyTpl(id int64) *model.NotifyTpl {
+	obj, err := model.NotifyTplGet("id", id)
+	errors.Dangerous(err)
+
+	if obj == nil {
+		errors.Bomb("notify tpl is nil")
+	}
+
+	return obj
+}
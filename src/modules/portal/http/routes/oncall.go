@@ -0,0 +1,184 @@
+package routes
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/errors"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+)
+
+type OncallForm struct {
+	Name     string              `json:"name"`
+	Note     string              `json:"note"`
+	Timezone string              `json:"timezone"`
+	Layers   []model.OncallLayer `json:"layers"`
+}
+
+func (f OncallForm) Fill(obj *model.Oncall) {
+	obj.Name = f.Name
+	obj.Note = f.Note
+	obj.Timezone = f.Timezone
+	obj.Layers = f.Layers
+
+	for i := range obj.Layers {
+		for _, id := range obj.Layers[i].Users {
+			mustUser(id)
+		}
+	}
+
+	errors.Dangerous(obj.Encode())
+}
+
+func oncallPost(c *gin.Context) {
+	var f OncallForm
+	errors.Dangerous(c.ShouldBind(&f))
+
+	obj := new(model.Oncall)
+	f.Fill(obj)
+	obj.Creator = loginUsername(c)
+	obj.LastUpdator = obj.Creator
+
+	errors.Dangerous(obj.Add())
+	renderData(c, obj.Id, nil)
+}
+
+func oncallGets(c *gin.Context) {
+	objs, err := model.OncallGets(queryStr(c, "query", ""))
+	renderData(c, objs, err)
+}
+
+func oncallGet(c *gin.Context) {
+	renderData(c, mustOncall(urlParamInt64(c, "id")), nil)
+}
+
+func oncallPut(c *gin.Context) {
+	obj := mustOncall(urlParamInt64(c, "id"))
+
+	var f OncallForm
+	errors.Dangerous(c.ShouldBind(&f))
+	f.Fill(obj)
+	obj.LastUpdator = loginUsername(c)
+
+	renderMessage(c, obj.Update("name", "note", "timezone", "layers", "last_updator"))
+}
+
+func oncallDel(c *gin.Context) {
+	renderMessage(c, model.OncallDel(urlParamInt64(c, "id")))
+}
+
+type oncallUser struct {
+	UserId   int64  `json:"user_id"`
+	Username string `json:"username"`
+	Dispname string `json:"dispname"`
+	Phone    string `json:"phone"`
+}
+
+// oncallNow 当前的值班人, 没有人值班时返回null
+func oncallNow(c *gin.Context) {
+	obj := mustOncall(urlParamInt64(c, "id"))
+
+	now := time.Now()
+	overrides, err := model.OncallOverrideGets(obj.Id, now.Unix(), now.Unix()+1)
+	errors.Dangerous(err)
+
+	uid := obj.UserAt(now, overrides)
+	if uid == 0 {
+		renderData(c, nil, nil)
+		return
+	}
+
+	user := mustUser(uid)
+	renderData(c, oncallUser{UserId: user.Id, Username: user.Username, Dispname: user.Dispname, Phone: user.Phone}, nil)
+}
+
+// oncallShifts 一段时间内最终的值班安排, 包括临时替班, 最多31天
+func oncallShifts(c *gin.Context) {
+	obj := mustOncall(urlParamInt64(c, "id"))
+	stime := mustQueryInt64(c, "stime")
+	etime := mustQueryInt64(c, "etime")
+
+	if etime <= stime {
+		errors.Bomb("stime must be less than etime")
+	}
+
+	if etime-stime > 31*86400 {
+		errors.Bomb("time range is too long, max 31 days")
+	}
+
+	overrides, err := model.OncallOverrideGets(obj.Id, stime, etime)
+	errors.Dangerous(err)
+
+	renderData(c, obj.Shifts(stime, etime, overrides), nil)
+}
+
+type OncallOverrideForm struct {
+	UserId int64  `json:"user_id"`
+	Stime  int64  `json:"stime"`
+	Etime  int64  `json:"etime"`
+	Note   string `json:"note"`
+}
+
+func oncallOverridePost(c *gin.Context) {
+	obj := mustOncall(urlParamInt64(c, "id"))
+
+	var f OncallOverrideForm
+	errors.Dangerous(c.ShouldBind(&f))
+	mustUser(f.UserId)
+
+	override := &model.OncallOverride{
+		OncallId: obj.Id,
+		UserId:   f.UserId,
+		Stime:    f.Stime,
+		Etime:    f.Etime,
+		Note:     f.Note,
+		Creator:  loginUsername(c),
+	}
+
+	errors.Dangerous(override.Add())
+	renderData(c, override.Id, nil)
+}
+
+func oncallOverrideGets(c *gin.Context) {
+	obj := mustOncall(urlParamInt64(c, "id"))
+
+	objs, err := model.OncallOverrideGets(obj.Id, queryInt64(c, "stime", time.Now().Unix()), queryInt64(c, "etime", time.Now().Unix()+31*86400))
+	renderData(c, objs, err)
+}
+
+func oncallOverrideDel(c *gin.Context) {
+	renderMessage(c, model.OncallOverrideDel(urlParamInt64(c, "id"), urlParamInt64(c, "oid")))
+}
+
+// oncallPageGets 通知时呼叫值班人的记录
+func oncallPageGets(c *gin.Context) {
+	obj := mustOncall(urlParamInt64(c, "id"))
+	stime := mustQueryInt64(c, "stime")
+	etime := mustQueryInt64(c, "etime")
+	limit := queryInt(c, "limit", 20)
+
+	total, err := model.OncallPageTotal(obj.Id, stime, etime)
+	errors.Dangerous(err)
+
+	list, err := model.OncallPageGets(obj.Id, stime, etime, limit, offset(c, limit, total))
+	errors.Dangerous(err)
+
+	renderData(c, gin.H{
+		"list":  list,
+		"total": total,
+	}, nil)
+}
+
+func mustOncall(id int64) *model.Oncall {
+	obj, err := model.OncallGet("id", id)
+	if err != nil {
+		errors.Bomb("cannot retrieve oncall[%d]: %v", id, err)
+	}
+
+	if obj == nil {
+		errors.Bomb("no such oncall[%d]", id)
+	}
+
+	return obj
+}
@@ -84,6 +84,7 @@ func Config(r *gin.Engine) {
 		node.POST("/:id/endpoint-bind", endpointBind)
 		node.POST("/:id/endpoint-unbind", endpointUnbind)
 		node.GET("/:id/maskconf", maskconfGets)
+		node.GET("/:id/inhibit", inhibitGets)
 		node.GET("/:id/screen", screenGets)
 		node.POST("/:id/screen", screenPost)
 	}
@@ -103,6 +104,66 @@ func Config(r *gin.Engine) {
 		maskconf.DELETE("/:id", maskconfDel)
 	}
 
+	inhibit := r.Group("/api/portal/inhibit").Use(middleware.GetCookieUser())
+	{
+		inhibit.POST("", inhibitPost)
+		inhibit.GET("/:id", inhibitGet)
+		inhibit.PUT("/:id", inhibitPut)
+		inhibit.DELETE("/:id", inhibitDel)
+	}
+
+	oncall := r.Group("/api/portal/oncall").Use(middleware.GetCookieUser())
+	{
+		oncall.GET("", oncallGets)
+		oncall.POST("", oncallPost)
+		oncall.GET("/:id", oncallGet)
+		oncall.PUT("/:id", oncallPut)
+		oncall.DELETE("/:id", oncallDel)
+		oncall.GET("/:id/now", oncallNow)
+		oncall.GET("/:id/shifts", oncallShifts)
+		oncall.GET("/:id/override", oncallOverrideGets)
+		oncall.POST("/:id/override", oncallOverridePost)
+		oncall.DELETE("/:id/override/:oid", oncallOverrideDel)
+		oncall.GET("/:id/pages", oncallPageGets)
+	}
+
+	escalation := r.Group("/api/portal/escalation").Use(middleware.GetCookieUser())
+	{
+		escalation.GET("", escalationGets)
+		escalation.POST("", escalationPost)
+		escalation.GET("/:id", escalationGet)
+		escalation.PUT("/:id", escalationPut)
+		escalation.DELETE("/:id", escalationDel)
+	}
+
+	webhook := r.Group("/api/portal/webhook").Use(middleware.GetCookieUser())
+	{
+		webhook.GET("", webhookGets)
+		webhook.POST("", webhookPost)
+		webhook.GET("/:id", webhookGet)
+		webhook.PUT("/:id", webhookPut)
+		webhook.DELETE("/:id", webhookDel)
+		webhook.GET("/:id/dead-letter", webhookDeadLetterGets)
+		webhook.POST("/:id/dead-letter/:lid/replay", webhookDeadLetterReplay)
+	}
+
+	notifyLog := r.Group("/api/portal/notify-log").Use(middleware.GetCookieUser())
+	{
+		notifyLog.GET("", notifyLogGets)
+		notifyLog.GET("/:id", notifyLogGet)
+	}
+
+	notifyTpl := r.Group("/api/portal/notify-tpl").Use(middleware.GetCookieUser())
+	{
+		notifyTpl.GET("", notifyTplGets)
+		notifyTpl.POST("", notifyTplPost)
+		notifyTpl.GET("/default", notifyTplDefault)
+		notifyTpl.POST("/preview", notifyTplPreview)
+		notifyTpl.GET("/:id", notifyTplGet)
+		notifyTpl.PUT("/:id", notifyTplPut)
+		notifyTpl.DELETE("/:id", notifyTplDel)
+	}
+
 	screen := r.Group("/api/portal/screen").Use(middleware.GetCookieUser())
 	{
 		screen.PUT("/:id", screenPut)
@@ -178,9 +239,17 @@ func Config(r *gin.Engine) {
 	stras := r.Group("/api/portal/stras")
 	{
 		stras.GET("/effective", effectiveStrasGet)
+		stras.GET("/effective/all", effectiveStrasAll)
 		stras.GET("", strasAll)
 	}
 
+	judges := r.Group("/api/portal/judges")
+	{
+		judges.GET("", judgeMembersGet)
+		judges.POST("/heartbeat", judgeHeartbeat)
+		judges.GET("/states", judgeStatesGet)
+	}
+
 	transferProxy := r.Group("/api/transfer")
 	{
 		transferProxy.GET("/req", transferReq)
@@ -22,6 +22,17 @@ func straPost(c *gin.Context) {
 	stra.LastUpdator = me.Username
 
 	errors.Dangerous(stra.Encode())
+	for _, id := range stra.NotifyOncall {
+		mustOncall(id)
+	}
+
+	if stra.EscalationId > 0 {
+		mustEscalation(stra.EscalationId)
+	}
+
+	for _, id := range stra.NotifyWebhook {
+		mustWebhook(id)
+	}
 
 	oldStra, _ := model.StraGet("name", stra.Name)
 	if oldStra != nil && oldStra.Nid == stra.Nid {
@@ -46,6 +57,17 @@ func straPut(c *gin.Context) {
 
 	stra.LastUpdator = me.Username
 	errors.Dangerous(stra.Encode())
+	for _, id := range stra.NotifyOncall {
+		mustOncall(id)
+	}
+
+	if stra.EscalationId > 0 {
+		mustEscalation(stra.EscalationId)
+	}
+
+	for _, id := range stra.NotifyWebhook {
+		mustWebhook(id)
+	}
 
 	oldStra, _ := model.StraGet("name", stra.Name)
 	if oldStra != nil && oldStra.Id != stra.Id && oldStra.Nid == stra.Nid {
@@ -113,9 +135,19 @@ func effectiveStrasGet(c *gin.Context) {
 	renderData(c, stras, nil)
 }
 
+// effectiveStrasAll 所有生效的策略, 供transfer判断数据需要推送给哪些judge
+func effectiveStrasAll(c *gin.Context) {
+	renderData(c, scache.StraCache.GetAll(), nil)
+}
+
 func GetNodeBy(ip string) (string, error) {
 	logger.Debug(ip)
 
+	// 通过心跳注册的judge
+	if node, found := scache.JudgeNodes.GetNode(ip); found {
+		return node, nil
+	}
+
 	cluster := config.Get().Judges
 	logger.Debug(cluster)
 	for node, ipv := range cluster {
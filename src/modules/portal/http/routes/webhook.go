@@ -0,0 +1,139 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/errors"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/notify/tpl"
+)
+
+type WebhookForm struct {
+	Name    string            `json:"name"`
+	Note    string            `json:"note"`
+	Url     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Secret  string            `json:"secret"` // 修改时为空表示不修改
+	Body    string            `json:"body"`
+	Timeout int               `json:"timeout"`
+}
+
+func (f WebhookForm) Fill(obj *model.Webhook) {
+	obj.Name = f.Name
+	obj.Note = f.Note
+	obj.Url = f.Url
+	obj.Headers = f.Headers
+	obj.Body = f.Body
+	obj.Timeout = f.Timeout
+	if f.Secret != "" {
+		obj.Secret = f.Secret
+	}
+
+	if obj.Body != "" {
+		errors.Dangerous(tpl.Validate(tpl.CHANNEL_WEBHOOK, "", obj.Body))
+	}
+
+	errors.Dangerous(obj.Encode())
+}
+
+func webhookPost(c *gin.Context) {
+	var f WebhookForm
+	errors.Dangerous(c.ShouldBind(&f))
+
+	obj := new(model.Webhook)
+	f.Fill(obj)
+	obj.Creator = loginUsername(c)
+	obj.LastUpdator = obj.Creator
+
+	errors.Dangerous(obj.Add())
+	renderData(c, obj.Id, nil)
+}
+
+func webhookGets(c *gin.Context) {
+	objs, err := model.WebhookGets(queryStr(c, "query", ""))
+	for i := range objs {
+		objs[i].Secret = maskSecret(objs[i].Secret)
+	}
+	renderData(c, objs, err)
+}
+
+func webhookGet(c *gin.Context) {
+	obj := mustWebhook(urlParamInt64(c, "id"))
+	obj.Secret = maskSecret(obj.Secret)
+	renderData(c, obj, nil)
+}
+
+func webhookPut(c *gin.Context) {
+	obj := mustWebhook(urlParamInt64(c, "id"))
+
+	var f WebhookForm
+	errors.Dangerous(c.ShouldBind(&f))
+	f.Fill(obj)
+	obj.LastUpdator = loginUsername(c)
+
+	renderMessage(c, obj.Update("name", "note", "url", "headers", "secret", "body", "timeout", "last_updator"))
+}
+
+func webhookDel(c *gin.Context) {
+	renderMessage(c, model.WebhookDel(urlParamInt64(c, "id")))
+}
+
+// webhookDeadLetterGets 投递失败的记录, status为空时返回所有状态
+func webhookDeadLetterGets(c *gin.Context) {
+	obj := mustWebhook(urlParamInt64(c, "id"))
+	status := queryStr(c, "status", "")
+	limit := queryInt(c, "limit", 20)
+
+	total, err := model.WebhookDeadLetterTotal(obj.Id, status)
+	errors.Dangerous(err)
+
+	list, err := model.WebhookDeadLetterGets(obj.Id, status, limit, offset(c, limit, total))
+	errors.Dangerous(err)
+
+	renderData(c, gin.H{
+		"list":  list,
+		"total": total,
+	}, nil)
+}
+
+// webhookDeadLetterReplay 请求重放, sender使用webhook当前的配置重新投递
+func webhookDeadLetterReplay(c *gin.Context) {
+	obj := mustWebhook(urlParamInt64(c, "id"))
+
+	letter, err := model.WebhookDeadLetterGet(urlParamInt64(c, "lid"))
+	errors.Dangerous(err)
+
+	if letter == nil || letter.WebhookId != obj.Id {
+		errors.Bomb("no such dead letter")
+	}
+
+	ok, err := letter.Replay(loginUsername(c))
+	errors.Dangerous(err)
+
+	if !ok {
+		errors.Bomb("dead letter is already replayed")
+	}
+
+	renderMessage(c, nil)
+}
+
+// maskSecret 不返回密钥, 只表示是否配置了密钥
+func maskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "******"
+}
+
+func mustWebhook(id int64) *model.Webhook {
+	obj, err := model.WebhookGet("id", id)
+	if err != nil {
+		errors.Bomb("cannot retrieve webhook[%d]: %v", id, err)
+	}
+
+	if obj == nil {
+		errors.Bomb("no such webhook[%d]", id)
+	}
+
+	return obj
+}
@@ -26,8 +26,10 @@ func Init() {
 	StraCache = NewStraCache()
 	CollectCache = NewCollectCache()
 	JudgeHashRing = NewConsistentHashRing(int32(500), nodes)
+	syncJudges()
 
 	go SyncStras()
+	go SyncJudges()
 	go SyncCollects()
 }
 
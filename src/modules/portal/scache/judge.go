@@ -0,0 +1,139 @@
+package scache
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/toolkits/pkg/logger"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+	"github.com/open-falcon/falcon-ng/src/modules/portal/config"
+)
+
+// judge集群成员: 配置文件中的judges 和 通过心跳注册的judge
+// 配置文件中的judge如果从未上报过心跳(老版本), 认为一直存活; 上报过心跳的judge, 超过timeout没有心跳则从哈希环中摘除
+// 哈希环变化后立即重新分配策略, judge下一次拉取策略时生效
+
+type JudgeNodeMap struct {
+	sync.RWMutex
+	nodes   map[string]string // ident -> 哈希环上的节点名
+	members []*model.JudgeMember
+}
+
+var JudgeNodes = &JudgeNodeMap{nodes: make(map[string]string)}
+
+func (j *JudgeNodeMap) GetNode(ident string) (string, bool) {
+	j.RLock()
+	defer j.RUnlock()
+
+	node, found := j.nodes[ident]
+	return node, found
+}
+
+func (j *JudgeNodeMap) Members() []*model.JudgeMember {
+	j.RLock()
+	defer j.RUnlock()
+
+	return j.members
+}
+
+// Set 返回存活的节点是否有变化
+func (j *JudgeNodeMap) Set(nodes map[string]string, members []*model.JudgeMember) bool {
+	j.Lock()
+	defer j.Unlock()
+
+	changed := len(nodes) != len(j.nodes)
+	for ident, node := range nodes {
+		if old, found := j.nodes[ident]; !found || old != node {
+			changed = true
+			break
+		}
+	}
+
+	j.nodes = nodes
+	j.members = members
+	return changed
+}
+
+func SyncJudges() {
+	t1 := time.NewTicker(time.Duration(5) * time.Second)
+
+	logger.Info("[cron] sync judges start...")
+	for {
+		<-t1.C
+		if syncJudges() {
+			syncStras()
+		}
+	}
+}
+
+func syncJudges() bool {
+	cfg := config.Get()
+	now := time.Now().Unix()
+
+	members, err := model.JudgeMembers()
+	if err != nil {
+		logger.Error("sync judges err:", err)
+		return false
+	}
+
+	static := make(map[string]string)
+	for node, ip := range cfg.Judges {
+		static[ip] = node
+	}
+
+	nodes := make(map[string]string)
+	registered := make(map[string]struct{})
+	all := make([]*model.JudgeMember, 0, len(members))
+	for _, m := range members {
+		registered[m.Ident] = struct{}{}
+		// 配置文件中的judge继续保留, 避免重新变为一直存活
+		if _, found := static[m.Ident]; !found && now-m.Clock > int64(cfg.Member.Expire) {
+			if err := model.JudgeMemberDel(m.Ident); err != nil {
+				logger.Warningf("delete judge member %s err:%v", m.Ident, err)
+			}
+			continue
+		}
+
+		m.Node = m.Ident
+		if node, found := static[m.Ident]; found {
+			m.Node = node
+		}
+		m.Alive = now-m.Clock <= int64(cfg.Member.Timeout)
+		if m.Alive {
+			nodes[m.Ident] = m.Node
+		}
+		all = append(all, m)
+	}
+
+	for ip, node := range static {
+		if _, found := registered[ip]; found {
+			continue
+		}
+		nodes[ip] = node
+		all = append(all, &model.JudgeMember{Ident: ip, Node: node, Alive: true})
+	}
+
+	if err := model.JudgeStraStateClean(now - int64(cfg.Member.Expire)); err != nil {
+		logger.Warningf("clean judge stra state err:%v", err)
+	}
+
+	if len(nodes) == 0 {
+		logger.Warning("no judge alive, keep the hash ring")
+		return false
+	}
+
+	if !JudgeNodes.Set(nodes, all) {
+		return false
+	}
+
+	list := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		list = append(list, node)
+	}
+	sort.Strings(list)
+	RebuildConsistentHashRing(JudgeHashRing, list, 500)
+	logger.Infof("judge hash ring rebuilt, nodes:%v", list)
+	return true
+}
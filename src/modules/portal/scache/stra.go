@@ -24,6 +24,17 @@ func (s *StraCacheMap) GetByNode(node string) []*model.Stra {
 	return s.Data[node]
 }
 
+func (s *StraCacheMap) GetAll() []*model.Stra {
+	s.RLock()
+	defer s.RUnlock()
+
+	stras := []*model.Stra{}
+	for _, v := range s.Data {
+		stras = append(stras, v...)
+	}
+	return stras
+}
+
 func (s *StraCacheMap) Set(node string, stras []*model.Stra) {
 	s.Lock()
 	defer s.Unlock()
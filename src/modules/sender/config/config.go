@@ -14,6 +14,7 @@ type CfgYml struct {
 	Worker  WorkerSection       `yaml:"worker"`
 	Api     ApiSection          `yaml:"api"`
 	Smtp    SmtpSection         `yaml:"smtp"`
+	Webhook WebhookSection      `yaml:"webhook"`
 	Queue   QueueSection        `yaml:"queue"`
 	Redis   RedisSection        `yaml:"redis"`
 	Auths   []string            `yaml:"auths"`
@@ -34,10 +35,11 @@ type TimeoutSection struct {
 }
 
 type QueueSection struct {
-	IM    string `yaml:"im"`
-	Sms   string `yaml:"sms"`
-	Mail  string `yaml:"mail"`
-	Voice string `yaml:"voice"`
+	IM      string `yaml:"im"`
+	Sms     string `yaml:"sms"`
+	Mail    string `yaml:"mail"`
+	Voice   string `yaml:"voice"`
+	Webhook string `yaml:"webhook"`
 }
 
 type SmtpSection struct {
@@ -52,10 +54,20 @@ type SmtpSection struct {
 }
 
 type WorkerSection struct {
-	IM    int `yaml:"im"`
-	Sms   int `yaml:"sms"`
-	Mail  int `yaml:"mail"`
-	Voice int `yaml:"voice"`
+	IM      int `yaml:"im"`
+	Sms     int `yaml:"sms"`
+	Mail    int `yaml:"mail"`
+	Voice   int `yaml:"voice"`
+	Webhook int `yaml:"webhook"`
+}
+
+// webhook投递失败时按指数退避重试: Backoff, 2*Backoff, 4*Backoff ... 最大MaxBackoff, 单位毫秒
+// 重试Retries次之后仍然失败的进入死信列表
+type WebhookSection struct {
+	Timeout    int `yaml:"timeout"`
+	Retries    int `yaml:"retries"`
+	Backoff    int `yaml:"backoff"`
+	MaxBackoff int `yaml:"maxBackoff"`
 }
 
 type ApiSection struct {
@@ -103,6 +115,26 @@ func ParseCfg(ymlfile string) error {
 	lock.Lock()
 	defer lock.Unlock()
 
+	if c.Worker.Webhook <= 0 {
+		c.Worker.Webhook = 10
+	}
+
+	if c.Webhook.Timeout <= 0 {
+		c.Webhook.Timeout = 5000
+	}
+
+	if c.Webhook.Retries < 0 {
+		c.Webhook.Retries = 0
+	}
+
+	if c.Webhook.Backoff <= 0 {
+		c.Webhook.Backoff = 1000
+	}
+
+	if c.Webhook.MaxBackoff < c.Webhook.Backoff {
+		c.Webhook.MaxBackoff = 60000
+	}
+
 	c.AuthMap = make(map[string]struct{})
 	for i := 0; i < len(c.Auths); i++ {
 		c.AuthMap[c.Auths[i]] = struct{}{}
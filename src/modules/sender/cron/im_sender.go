@@ -1,6 +1,7 @@
 package cron
 
 import (
+	"fmt"
 	"path"
 	"strings"
 	"time"
@@ -43,35 +44,47 @@ func SendIM(im *dataobj.Notify) {
 		<-IMWorkerChan
 	}()
 
+	var (
+		response string
+		err      error
+	)
+
 	cfg := config.GetCfgYml()
 	switch cfg.Send.IM {
 	case "api":
-		sendIMByApi(im)
+		response, err = sendIMByApi(im)
 	case "shell":
-		sendIMByShell(im)
+		response, err = sendIMByShell(im)
 	default:
-		logger.Errorf("not support %s to send im, im: %v", cfg.Send.Mail, *im)
+		err = fmt.Errorf("not support %s to send im", cfg.Send.IM)
+		logger.Errorf("not support %s to send im, im: %v", cfg.Send.IM, *im)
 	}
+
+	report(im, 1, response, err)
 }
 
-func sendIMByApi(im *dataobj.Notify) {
+func sendIMByApi(im *dataobj.Notify) (string, error) {
 	cfg := config.GetCfgYml()
 	url := cfg.Api.IM
-	_, err := httplib.PostJSON(url, 5, IM{
+	resp, err := httplib.PostJSON(url, 5, IM{
 		Tos:     im.Tos,
 		Content: im.Content,
 	}, map[string]string{})
 	logger.Infof("sendIM use api, tos: %v, content: %v, err: %v", im.Tos, im.Content, err)
-	return
+	return string(resp), err
 }
 
-func sendIMByShell(im *dataobj.Notify) {
+func sendIMByShell(im *dataobj.Notify) (string, error) {
 	im_shell := path.Join(file.SelfDir(), "script", "send_im")
 	if !file.IsExist(im_shell) {
 		logger.Errorf("%s not found", im_shell)
-		return
+		return "", fmt.Errorf("%s not found", im_shell)
 	}
 
 	output, err, isTimeout := sys.CmdRunT(time.Second*10, im_shell, strings.Join(im.Tos, ","), im.Content)
 	logger.Infof("sendIM use shell, tos: %v, content: %v, output: %v, err: %v, isTimeout: %v", im.Tos, im.Content, output, err, isTimeout)
+	if isTimeout {
+		return output, fmt.Errorf("timeout")
+	}
+	return output, err
 }
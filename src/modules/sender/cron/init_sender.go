@@ -7,6 +7,8 @@ var (
 	SmsWorkerChan   chan int
 	VoiceWorkerChan chan int
 	MailWorkerChan  chan int
+
+	WebhookWorkerChan chan int
 )
 
 func InitSenderWorker() {
@@ -15,4 +17,5 @@ func InitSenderWorker() {
 	SmsWorkerChan = make(chan int, cfg.Worker.Sms)
 	VoiceWorkerChan = make(chan int, cfg.Worker.Voice)
 	MailWorkerChan = make(chan int, cfg.Worker.Mail)
+	WebhookWorkerChan = make(chan int, cfg.Worker.Webhook)
 }
@@ -46,31 +46,39 @@ func SendMail(mail *dataobj.Notify) {
 		<-MailWorkerChan
 	}()
 
-	cfg := config.GetCfgYml()
+	var (
+		response string
+		err      error
+	)
 
+	cfg := config.GetCfgYml()
 	switch cfg.Send.Mail {
 	case "api":
-		sendMailByApi(mail)
+		response, err = sendMailByApi(mail)
 	case "smtp":
-		sendMailBySmtp(mail)
+		response, err = sendMailBySmtp(mail)
 	case "shell":
-		sendMailByShell(mail)
+		response, err = sendMailByShell(mail)
 	default:
+		err = fmt.Errorf("not support %s to send mail", cfg.Send.Mail)
 		logger.Errorf("not support %s to send mail, mail: %v", cfg.Send.Mail, *mail)
 	}
+
+	report(mail, 1, response, err)
 }
 
-func sendMailByApi(mail *dataobj.Notify) {
+func sendMailByApi(mail *dataobj.Notify) (string, error) {
 	cfg := config.GetCfgYml()
-	_, err := httplib.PostJSON(cfg.Api.Mail, 5, Mail{
+	resp, err := httplib.PostJSON(cfg.Api.Mail, 5, Mail{
 		Tos:     mail.Tos,
 		Subject: mail.Subject,
 		Content: mail.Content,
 	}, map[string]string{})
 	logger.Infof("sendMail use api, tos: %v, subject: %v, content: %v, err: %v", mail.Tos, mail.Subject, mail.Content, err)
+	return string(resp), err
 }
 
-func sendMailBySmtp(mail *dataobj.Notify) {
+func sendMailBySmtp(mail *dataobj.Notify) (string, error) {
 	cfg := config.GetCfgYml()
 	smtp := email.NewSMTP(
 		cfg.Smtp.FromMail,
@@ -89,24 +97,30 @@ func sendMailBySmtp(mail *dataobj.Notify) {
 		Content: mail.Content,
 	})
 	logger.Infof("sendMail use smtp, tos: %v, subject: %v, content: %v, err: %v", mail.Tos, mail.Subject, mail.Content, err)
+	return "", err
 }
 
-func sendMailByShell(mail *dataobj.Notify) {
+func sendMailByShell(mail *dataobj.Notify) (string, error) {
 	mail_shell := path.Join(file.SelfDir(), "script", "send_mail")
 	if !file.IsExist(mail_shell) {
 		logger.Errorf("%s not found", mail_shell)
-		return
+		return "", fmt.Errorf("%s not found", mail_shell)
 	}
 
 	fp := fmt.Sprintf("/tmp/n9e.mail.content.%d", time.Now().UnixNano())
 	_, err := file.WriteString(fp, mail.Content)
 	if err != nil {
 		logger.Errorf("cannot write string to %s", fp)
-		return
+		return "", err
 	}
 
 	output, err, isTimeout := sys.CmdRunT(time.Second*10, mail_shell, strings.Join(mail.Tos, ","), mail.Subject, fp)
 	logger.Infof("sendMail use shell, tos: %v, subject: %v, content: %v, output:%v, err: %v, isTimeout: %v", mail.Tos, mail.Subject, mail.Content, output, err, isTimeout)
 
 	file.Unlink(fp)
+
+	if isTimeout {
+		return output, fmt.Errorf("timeout")
+	}
+	return output, err
 }
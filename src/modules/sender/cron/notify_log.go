@@ -0,0 +1,25 @@
+package cron
+
+import (
+	"github.com/toolkits/pkg/logger"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/model"
+)
+
+// report 记录发送的结果和通道的返回
+func report(notify *dataobj.Notify, attempts int, response string, err error) {
+	status := model.NOTIFY_SENT
+	if err != nil {
+		status = model.NOTIFY_FAILED
+		if response == "" {
+			response = err.Error()
+		} else {
+			response = err.Error() + ", " + response
+		}
+	}
+
+	if err := model.NotifyLogUpdate(notify.Id, status, response, attempts); err != nil {
+		logger.Errorf("update notify log[%d] failed, status: %s, err: %v", notify.Id, status, err)
+	}
+}
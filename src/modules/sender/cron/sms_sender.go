@@ -1,6 +1,7 @@
 package cron
 
 import (
+	"fmt"
 	"path"
 	"strings"
 	"time"
@@ -43,36 +44,47 @@ func SendSms(sms *dataobj.Notify) {
 		<-SmsWorkerChan
 	}()
 
-	cfg := config.GetCfgYml()
+	var (
+		response string
+		err      error
+	)
 
+	cfg := config.GetCfgYml()
 	switch cfg.Send.Sms {
 	case "api":
-		sendSmsByApi(sms)
+		response, err = sendSmsByApi(sms)
 	case "shell":
-		sendSmsByShell(sms)
+		response, err = sendSmsByShell(sms)
 	default:
-		logger.Errorf("not support %s to send sms, sms: %v", cfg.Send.Mail, *sms)
+		err = fmt.Errorf("not support %s to send sms", cfg.Send.Sms)
+		logger.Errorf("not support %s to send sms, sms: %v", cfg.Send.Sms, *sms)
 	}
 
+	report(sms, 1, response, err)
 }
 
-func sendSmsByApi(sms *dataobj.Notify) {
+func sendSmsByApi(sms *dataobj.Notify) (string, error) {
 	cfg := config.GetCfgYml()
 	url := cfg.Api.Sms
 
-	_, err := httplib.PostJSON(url, 5, Sms{
+	resp, err := httplib.PostJSON(url, 5, Sms{
 		Tos:     sms.Tos,
 		Content: sms.Content,
 	}, map[string]string{})
 	logger.Infof("sendSms use api, tos: %v, content: %v, err: %v", sms.Tos, sms.Content, err)
+	return string(resp), err
 }
 
-func sendSmsByShell(sms *dataobj.Notify) {
+func sendSmsByShell(sms *dataobj.Notify) (string, error) {
 	sms_shell := path.Join(file.SelfDir(), "script", "send_sms")
 	if !file.IsExist(sms_shell) {
 		logger.Errorf("%s not found", sms_shell)
-		return
+		return "", fmt.Errorf("%s not found", sms_shell)
 	}
 	output, err, isTimeout := sys.CmdRunT(time.Second*10, sms_shell, strings.Join(sms.Tos, ","), sms.Content)
 	logger.Infof("sendSms use shell, tos: %v, content: %v, output:%v, err: %v, isTimeout: %v", sms.Tos, sms.Content, output, err, isTimeout)
+	if isTimeout {
+		return output, fmt.Errorf("timeout")
+	}
+	return output, err
 }
@@ -1,6 +1,7 @@
 package cron
 
 import (
+	"fmt"
 	"path"
 	"strings"
 	"time"
@@ -43,36 +44,47 @@ func SendVoice(voice *dataobj.Notify) {
 		<-VoiceWorkerChan
 	}()
 
-	cfg := config.GetCfgYml()
+	var (
+		response string
+		err      error
+	)
 
+	cfg := config.GetCfgYml()
 	switch cfg.Send.Voice {
 	case "api":
-		sendVoiceByApi(voice)
+		response, err = sendVoiceByApi(voice)
 	case "shell":
-		sendVoiceByShell(voice)
+		response, err = sendVoiceByShell(voice)
 	default:
-		logger.Errorf("not support %s to send voice, voice: %v", cfg.Send.Mail, *voice)
+		err = fmt.Errorf("not support %s to send voice", cfg.Send.Voice)
+		logger.Errorf("not support %s to send voice, voice: %v", cfg.Send.Voice, *voice)
 	}
 
+	report(voice, 1, response, err)
 }
 
-func sendVoiceByApi(voice *dataobj.Notify) {
+func sendVoiceByApi(voice *dataobj.Notify) (string, error) {
 	cfg := config.GetCfgYml()
 	url := cfg.Api.Voice
 
-	_, err := httplib.PostJSON(url, 5, Voice{
+	resp, err := httplib.PostJSON(url, 5, Voice{
 		Tos:     voice.Tos,
 		Content: voice.Content,
 	}, map[string]string{})
 	logger.Infof("sendVoice use api, tos: %v, content: %v, err: %v", voice.Tos, voice.Content, err)
+	return string(resp), err
 }
 
-func sendVoiceByShell(voice *dataobj.Notify) {
+func sendVoiceByShell(voice *dataobj.Notify) (string, error) {
 	voice_shell := path.Join(file.SelfDir(), "script", "send_voice")
 	if !file.IsExist(voice_shell) {
 		logger.Errorf("%s not found", voice_shell)
-		return
+		return "", fmt.Errorf("%s not found", voice_shell)
 	}
 	output, err, isTimeout := sys.CmdRunT(time.Second*10, voice_shell, strings.Join(voice.Tos, ","), voice.Content)
 	logger.Infof("sendVoice use shell, tos: %v, content: %v, output:%v, err: %v, isTimeout: %v", voice.Tos, voice.Content, output, err, isTimeout)
+	if isTimeout {
+		return output, fmt.Errorf("timeout")
+	}
+	return output, err
 }
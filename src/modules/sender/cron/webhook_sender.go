@@ -0,0 +1,268 @@
+package cron
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/toolkits/pkg/logger"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/model"
+	"github.com/open-falcon/falcon-ng/src/modules/sender/config"
+	"github.com/open-falcon/falcon-ng/src/modules/sender/redi"
+)
+
+// webhook的tos是webhook的id, content是请求的body
+// 签名: X-Falcon-Signature = sha256=hex(hmac_sha256(secret, timestamp + "." + body)), timestamp见X-Falcon-Timestamp
+
+const (
+	HEADER_TIMESTAMP = "X-Falcon-Timestamp"
+	HEADER_SIGNATURE = "X-Falcon-Signature"
+)
+
+func ConsumeWebhook() {
+	for {
+		webhookList := redi.Pop(1, "webhook")
+		if len(webhookList) == 0 {
+			time.Sleep(time.Millisecond * 200)
+			continue
+		}
+		SendWebhookList(webhookList)
+	}
+}
+
+func SendWebhookList(webhookList []*dataobj.Notify) {
+	for _, webhook := range webhookList {
+		WebhookWorkerChan <- 1
+		go SendWebhook(webhook)
+	}
+}
+
+func SendWebhook(webhook *dataobj.Notify) {
+	defer func() {
+		<-WebhookWorkerChan
+	}()
+
+	var (
+		attempts  int
+		responses []string
+		lastErr   error
+	)
+
+	for _, to := range webhook.Tos {
+		id, err := strconv.ParseInt(to, 10, 64)
+		if err != nil {
+			logger.Errorf("illegal webhook id: %s", to)
+			lastErr = fmt.Errorf("illegal webhook id: %s", to)
+			continue
+		}
+
+		hook, err := model.WebhookGet("id", id)
+		if err != nil {
+			logger.Errorf("get webhook[%d] failed, err: %v", id, err)
+			deadLetter(webhook.Id, &model.Webhook{Id: id}, webhook.Content, 0, err)
+			lastErr = err
+			continue
+		}
+
+		if hook == nil {
+			logger.Errorf("webhook[%d] not found, content: %s", id, webhook.Content)
+			lastErr = fmt.Errorf("webhook[%d] not found", id)
+			continue
+		}
+
+		n, response, err := deliverWebhook(webhook.Id, hook, webhook.Content)
+		attempts += n
+		if err != nil {
+			lastErr = err
+		}
+		responses = append(responses, fmt.Sprintf("webhook[%d]: %s", id, response))
+	}
+
+	report(webhook, attempts, strings.Join(responses, "; "), lastErr)
+}
+
+// deliverWebhook 失败时按指数退避重试, 重试之后仍然失败的进入死信列表, 返回请求次数和最后一次的返回
+func deliverWebhook(notifyId int64, hook *model.Webhook, body string) (int, string, error) {
+	cfg := config.GetCfgYml().Webhook
+
+	var (
+		response string
+		err      error
+	)
+
+	attempts := 0
+	for {
+		attempts++
+
+		var retry bool
+		response, retry, err = postWebhook(hook, body)
+		if err == nil {
+			logger.Infof("send webhook[%d] success, url: %s, attempts: %d", hook.Id, hook.Url, attempts)
+			return attempts, response, nil
+		}
+
+		logger.Warningf("send webhook[%d] failed, url: %s, attempts: %d, err: %v", hook.Id, hook.Url, attempts, err)
+		if !retry || attempts > cfg.Retries {
+			break
+		}
+
+		if err := model.NotifyLogUpdate(notifyId, model.NOTIFY_RETRIED, err.Error(), attempts); err != nil {
+			logger.Errorf("update notify log[%d] failed, err: %v", notifyId, err)
+		}
+
+		time.Sleep(webhookBackoff(attempts, cfg.Backoff, cfg.MaxBackoff))
+	}
+
+	deadLetter(notifyId, hook, body, attempts, err)
+	return attempts, response, err
+}
+
+// postWebhook 返回的bool表示失败之后是否需要重试: 网络错误, 429 和 5xx 重试, 其他的4xx重试也不会成功
+func postWebhook(hook *model.Webhook, body string) (string, bool, error) {
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = config.GetCfgYml().Webhook.Timeout
+	}
+
+	req, err := http.NewRequest("POST", hook.Url, bytes.NewBufferString(body))
+	if err != nil {
+		return "", false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	for k, v := range hook.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if hook.Secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(HEADER_TIMESTAMP, ts)
+		req.Header.Set(HEADER_SIGNATURE, "sha256="+SignWebhook(hook.Secret, ts, body))
+	}
+
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Millisecond}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", true, err
+	}
+	defer resp.Body.Close()
+
+	bs, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	response := fmt.Sprintf("status code: %d, response: %s", resp.StatusCode, string(bs))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return response, false, nil
+	}
+
+	return response, resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, fmt.Errorf("status code: %d", resp.StatusCode)
+}
+
+// SignWebhook 接收方用同样的方式计算签名并比较, 同时检查timestamp防止重放
+func SignWebhook(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBackoff 第n次失败之后等待的时间
+func webhookBackoff(n, backoff, maxBackoff int) time.Duration {
+	wait := backoff
+	for i := 1; i < n && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+
+	return time.Duration(wait) * time.Millisecond
+}
+
+func deadLetter(notifyId int64, hook *model.Webhook, body string, attempts int, err error) {
+	letter := newDeadLetter(notifyId, hook, body, attempts, err, time.Now().Unix())
+	if err := letter.Add(); err != nil {
+		logger.Errorf("add webhook dead letter failed, letter: %+v, err: %v", letter, err)
+		return
+	}
+
+	logger.Errorf("webhook[%d] moved to dead letter[%d], attempts: %d, err: %s", hook.Id, letter.Id, attempts, letter.Error)
+}
+
+// newDeadLetter 错误信息最多保存1024个字节
+func newDeadLetter(notifyId int64, hook *model.Webhook, body string, attempts int, err error, clock int64) *model.WebhookDeadLetter {
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+		if len(msg) > 1024 {
+			msg = msg[:1024]
+		}
+	}
+
+	return &model.WebhookDeadLetter{
+		WebhookId: hook.Id,
+		NotifyId:  notifyId,
+		Url:       hook.Url,
+		Body:      body,
+		Attempts:  attempts,
+		Error:     msg,
+		Status:    model.WEBHOOK_DEAD,
+		Clock:     clock,
+	}
+}
+
+// ReplayWebhookLoop 重新投递请求重放的死信, 使用webhook当前的配置
+func ReplayWebhookLoop() {
+	for {
+		time.Sleep(time.Second * 5)
+		ReplayWebhook()
+	}
+}
+
+func ReplayWebhook() {
+	letters, err := model.WebhookDeadLetterPending(100)
+	if err != nil {
+		logger.Errorf("get pending webhook dead letters failed, err: %v", err)
+		return
+	}
+
+	for i := range letters {
+		claimed, err := letters[i].Claim()
+		if err != nil {
+			logger.Errorf("claim webhook dead letter[%d] failed, err: %v", letters[i].Id, err)
+			continue
+		}
+
+		if !claimed {
+			continue
+		}
+
+		logger.Infof("replay webhook dead letter[%d], webhook: %d, replayer: %s", letters[i].Id, letters[i].WebhookId, letters[i].Replayer)
+
+		// 重放使用原来的通知记录, 状态从retried重新开始
+		response := fmt.Sprintf("replay dead letter[%d] by %s", letters[i].Id, letters[i].Replayer)
+		if err := model.NotifyLogUpdate(letters[i].NotifyId, model.NOTIFY_RETRIED, response, letters[i].Attempts); err != nil {
+			logger.Errorf("update notify log[%d] failed, err: %v", letters[i].NotifyId, err)
+		}
+
+		WebhookWorkerChan <- 1
+		go SendWebhook(replayNotify(&letters[i]))
+	}
+}
+
+// replayNotify 死信重新投递给原来的webhook, 使用原来的body
+func replayNotify(letter *model.WebhookDeadLetter) *dataobj.Notify {
+	return &dataobj.Notify{
+		Id:      letter.NotifyId,
+		Tos:     []string{strconv.FormatInt(letter.WebhookId, 10)},
+		Content: letter.Body,
+	}
+}
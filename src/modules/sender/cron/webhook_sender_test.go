@@ -0,0 +1,245 @@
+package cron
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/open-falcon/falcon-ng/src/model"
+	"github.com/open-falcon/falcon-ng/src/modules/alarm/notify/tpl"
+)
+
+func Test_SignWebhook(t *testing.T) {
+	// echo -n "$timestamp.$body" | openssl dgst -sha256 -hmac "$secret"
+	cases := []struct {
+		secret    string
+		timestamp string
+		body      string
+		want      string
+	}{
+		{"secret", "1600000000", "{}", "1e56a11da123b137c26fa37b7c222060bdf22988aa9b3248c31244f8b2ef4a28"},
+		{"secret", "1600000000", "", "2656d4a000c1d669a0e25dbd7e6b3a68d06b60c561133705ccf200fdf1764cda"},
+		{"secret", "1600000000", `{"event":1}`, "1f431352613c517f3e2d0c7c05bc0cfc8328c742e4417df4a534744ac70fb0dd"},
+		{"", "1600000000", "{}", "d882a7c1a8c06274398990bd69707c9b9d1fdbd88660626439c6d7b84fe91665"},
+	}
+
+	for _, c := range cases {
+		if got := SignWebhook(c.secret, c.timestamp, c.body); got != c.want {
+			t.Fatalf("sign(%q, %q, %q) = %s, want %s", c.secret, c.timestamp, c.body, got, c.want)
+		}
+	}
+}
+
+func Test_WebhookBackoff(t *testing.T) {
+	cases := []struct {
+		n          int
+		backoff    int
+		maxBackoff int
+		want       time.Duration
+	}{
+		{1, 1000, 60000, time.Second},
+		{2, 1000, 60000, 2 * time.Second},
+		{3, 1000, 60000, 4 * time.Second},
+		{6, 1000, 60000, 32 * time.Second},
+		{7, 1000, 60000, 60 * time.Second},
+		{100, 1000, 60000, 60 * time.Second},
+		{2, 1000, 1500, 1500 * time.Millisecond},
+		{1, 1000, 1000, time.Second},
+	}
+
+	for _, c := range cases {
+		if got := webhookBackoff(c.n, c.backoff, c.maxBackoff); got != c.want {
+			t.Fatalf("backoff(%d, %d, %d) = %v, want %v", c.n, c.backoff, c.maxBackoff, got, c.want)
+		}
+	}
+}
+
+// received webhook服务端收到的请求
+type received struct {
+	body      string
+	timestamp string
+	signature string
+	header    string
+}
+
+func mockWebhook(status int, got *received) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, _ := ioutil.ReadAll(r.Body)
+		*got = received{
+			body:      string(bs),
+			timestamp: r.Header.Get(HEADER_TIMESTAMP),
+			signature: r.Header.Get(HEADER_SIGNATURE),
+			header:    r.Header.Get("X-Token"),
+		}
+		w.WriteHeader(status)
+		w.Write([]byte("ok"))
+	}))
+}
+
+func Test_PostWebhook(t *testing.T) {
+	cases := []struct {
+		status int
+		retry  bool
+		fail   bool
+	}{
+		{http.StatusOK, false, false},
+		{http.StatusNoContent, false, false},
+		{http.StatusBadRequest, false, true},
+		{http.StatusUnauthorized, false, true},
+		{http.StatusNotFound, false, true},
+		{http.StatusTooManyRequests, true, true},
+		{http.StatusInternalServerError, true, true},
+		{http.StatusBadGateway, true, true},
+		{http.StatusServiceUnavailable, true, true},
+	}
+
+	for _, c := range cases {
+		var got received
+		server := mockWebhook(c.status, &got)
+
+		hook := &model.Webhook{Id: 1, Url: server.URL, Secret: "secret", Timeout: 1000, Headers: map[string]string{"X-Token": "token"}}
+		_, retry, err := postWebhook(hook, "{}")
+		server.Close()
+
+		if retry != c.retry || (err != nil) != c.fail {
+			t.Fatalf("status %d: retry = %v, err = %v, want retry %v, fail %v", c.status, retry, err, c.retry, c.fail)
+		}
+
+		if got.body != "{}" || got.header != "token" {
+			t.Fatalf("status %d: unexpected request: %+v", c.status, got)
+		}
+
+		if got.signature != "sha256="+SignWebhook("secret", got.timestamp, got.body) {
+			t.Fatalf("status %d: signature mismatch: %+v", c.status, got)
+		}
+	}
+
+	// 网络错误重试
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+
+	if _, retry, err := postWebhook(&model.Webhook{Id: 1, Url: url, Timeout: 1000}, "{}"); err == nil || !retry {
+		t.Fatalf("network error should be retried, retry = %v, err = %v", retry, err)
+	}
+
+	// 请求都构造不出来的, 重试也不会成功
+	if _, retry, err := postWebhook(&model.Webhook{Id: 1, Url: "://bad", Timeout: 1000}, "{}"); err == nil || retry {
+		t.Fatalf("illegal url should not be retried, retry = %v, err = %v", retry, err)
+	}
+
+	// 没有secret不签名
+	var got received
+	server = mockWebhook(http.StatusOK, &got)
+	defer server.Close()
+	if _, _, err := postWebhook(&model.Webhook{Id: 1, Url: server.URL, Timeout: 1000}, "{}"); err != nil {
+		t.Fatal(err)
+	}
+	if got.timestamp != "" || got.signature != "" {
+		t.Fatalf("unexpected signature without secret: %+v", got)
+	}
+}
+
+// alarm渲染的body原样作为请求的body
+func Test_WebhookBody(t *testing.T) {
+	_, defaultBody := tpl.Default(tpl.CHANNEL_WEBHOOK)
+
+	cases := []struct {
+		body string
+		want map[string]interface{}
+	}{
+		{
+			defaultBody,
+			map[string]interface{}{"status": "P1 报警", "is_alert": true, "is_upgrade": false, "endpoint": "10.0.0.1(app-01)", "metric": "cpu.idle"},
+		},
+		{
+			`{"text":{{json .Info}},"sid":{{.Event.Sid}},"tags":{{json .Tags}}}`,
+			map[string]interface{}{"text": "cpu.idle all(#2) < 5", "sid": float64(1), "tags": "cpu=cpu-total"},
+		},
+		{
+			`{"text":"{{.Sname}}: {{upper .Event.EventType}}"}`,
+			map[string]interface{}{"text": "cpu idle too low: ALERT"},
+		},
+	}
+
+	data := tpl.SampleData()
+	for _, c := range cases {
+		_, body, err := tpl.Render(tpl.CHANNEL_WEBHOOK, "", c.body, data)
+		if err != nil {
+			t.Fatalf("render %s failed: %v", c.body, err)
+		}
+
+		var got received
+		server := mockWebhook(http.StatusOK, &got)
+		_, _, err = postWebhook(&model.Webhook{Id: 1, Url: server.URL, Timeout: 1000}, body)
+		server.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got.body != body {
+			t.Fatalf("body changed, want %s, got %s", body, got.body)
+		}
+
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(got.body), &fields); err != nil {
+			t.Fatalf("body is not json: %s, err: %v", got.body, err)
+		}
+		for k, v := range c.want {
+			if !reflect.DeepEqual(fields[k], v) {
+				t.Fatalf("field %s = %v, want %v, body: %s", k, fields[k], v, got.body)
+			}
+		}
+	}
+
+	if err := tpl.Validate(tpl.CHANNEL_WEBHOOK, "", `{"text":{{.NoSuchField}}}`); err == nil {
+		t.Fatal("expect error on unknown field")
+	}
+}
+
+func Test_WebhookDeadLetter(t *testing.T) {
+	hook := &model.Webhook{Id: 3, Url: "http://127.0.0.1/hook"}
+	long := strings.Repeat("x", 2000)
+
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{nil, ""},
+		{errors.New("status code: 500"), "status code: 500"},
+		{errors.New(long), long[:1024]},
+	}
+
+	for _, c := range cases {
+		letter := newDeadLetter(10, hook, `{"event":1}`, 4, c.err, 1600000000)
+		if letter.Error != c.want {
+			t.Fatalf("unexpected error message: %d bytes, want %d bytes", len(letter.Error), len(c.want))
+		}
+
+		want := model.WebhookDeadLetter{
+			WebhookId: 3,
+			NotifyId:  10,
+			Url:       hook.Url,
+			Body:      `{"event":1}`,
+			Attempts:  4,
+			Error:     c.want,
+			Status:    model.WEBHOOK_DEAD,
+			Clock:     1600000000,
+		}
+		if *letter != want {
+			t.Fatalf("unexpected dead letter: %+v", letter)
+		}
+
+		// 重放投递给原来的webhook, 沿用原来的通知记录和body
+		notify := replayNotify(letter)
+		if notify.Id != 10 || !reflect.DeepEqual(notify.Tos, []string{"3"}) || notify.Content != `{"event":1}` {
+			t.Fatalf("unexpected replay notify: %+v", notify)
+		}
+	}
+}
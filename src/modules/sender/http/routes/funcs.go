@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"strconv"
+
 	"github.com/gin-gonic/gin"
 	"github.com/toolkits/pkg/errors"
 
@@ -21,6 +23,38 @@ func renderMessage(c *gin.Context, v interface{}) {
 	}
 }
 
+func renderData(c *gin.Context, data interface{}, err error) {
+	if err == nil {
+		c.JSON(200, gin.H{"dat": data, "err": ""})
+		return
+	}
+
+	renderMessage(c, err.Error())
+}
+
+func urlParamInt64(c *gin.Context, field string) int64 {
+	intval, err := strconv.ParseInt(c.Param(field), 10, 64)
+	if err != nil {
+		errors.Bomb("cannot convert %s to int64", c.Param(field))
+	}
+
+	return intval
+}
+
+func queryInt64(c *gin.Context, key string, defaultVal int64) int64 {
+	strv := c.Query(key)
+	if strv == "" {
+		return defaultVal
+	}
+
+	intv, err := strconv.ParseInt(strv, 10, 64)
+	if err != nil {
+		errors.Bomb("cannot convert [%s] to int64", strv)
+	}
+
+	return intv
+}
+
 func auth(c *gin.Context) {
 	val := c.GetHeader("x-srv-token")
 	if _, exists := config.GetCfgYml().AuthMap[val]; !exists {
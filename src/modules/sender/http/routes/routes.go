@@ -20,6 +20,11 @@ func Config(r *gin.Engine) {
 		sender.POST("/mail", mail)
 		sender.POST("/sms", sms)
 		sender.POST("/voice", voice)
+		sender.POST("/webhook", webhook)
+		sender.GET("/notify-log/:id", notifyLogGet)
+		sender.GET("/webhook/dead-letter", webhookDeadLetterGets)
+		sender.GET("/webhook/dead-letter/:id", webhookDeadLetterGet)
+		sender.POST("/webhook/dead-letter/:id/replay", webhookDeadLetterReplay)
 	}
 
 }
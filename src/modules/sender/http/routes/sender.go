@@ -2,9 +2,12 @@ package routes
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/json-iterator/go"
 	"github.com/toolkits/pkg/errors"
+	"github.com/toolkits/pkg/logger"
 
 	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/model"
 	"github.com/open-falcon/falcon-ng/src/modules/sender/redi"
 )
 
@@ -19,9 +22,7 @@ func im(c *gin.Context) {
 		return
 	}
 
-	redi.Write(&f, "im")
-
-	renderMessage(c, "")
+	enqueue(c, &f, "im")
 }
 
 func mail(c *gin.Context) {
@@ -35,9 +36,7 @@ func mail(c *gin.Context) {
 		return
 	}
 
-	redi.Write(&f, "mail")
-
-	renderMessage(c, "")
+	enqueue(c, &f, "mail")
 }
 
 func sms(c *gin.Context) {
@@ -51,9 +50,7 @@ func sms(c *gin.Context) {
 		return
 	}
 
-	redi.Write(&f, "sms")
-
-	renderMessage(c, "")
+	enqueue(c, &f, "sms")
 }
 
 func voice(c *gin.Context) {
@@ -67,7 +64,52 @@ func voice(c *gin.Context) {
 		return
 	}
 
-	redi.Write(&f, "voice")
+	enqueue(c, &f, "voice")
+}
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+// enqueue 生成通知记录之后写入队列, 返回通知记录的id, 记录生成失败时不影响发送, id为0
+// 返回值之前只有err, 现在多了dat, 见doc/api.md
+func enqueue(c *gin.Context, f *dataobj.Notify, notifyType string) {
+	f.Id = 0
+
+	tos, _ := json.Marshal(f.Tos)
+	log := &model.NotifyLog{
+		EventId: f.EventId,
+		Channel: notifyType,
+		Tos:     string(tos),
+		Subject: f.Subject,
+		Content: f.Content,
+	}
+
+	if err := log.Add(); err != nil {
+		logger.Errorf("add notify log failed, notify: %+v, err: %v", f, err)
+	} else {
+		f.Id = log.Id
+	}
+
+	if err := redi.Write(f, notifyType); err != nil {
+		if err := model.NotifyLogUpdate(f.Id, model.NOTIFY_FAILED, err.Error(), 0); err != nil {
+			logger.Errorf("update notify log[%d] failed, err: %v", f.Id, err)
+		}
+		renderMessage(c, err)
+		return
+	}
+
+	renderData(c, f.Id, nil)
+}
+
+// notifyLogGet 查询通知的状态, id为提交通知时返回的id
+func notifyLogGet(c *gin.Context) {
+	auth(c)
+
+	log, err := model.NotifyLogGet(urlParamInt64(c, "id"))
+	errors.Dangerous(err)
+
+	if log == nil {
+		errors.Bomb("no such notify log")
+	}
 
-	renderMessage(c, "")
+	renderData(c, log, nil)
 }
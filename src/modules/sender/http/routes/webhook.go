@@ -0,0 +1,103 @@
+package routes
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/errors"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/model"
+)
+
+// webhook tos是webhook的id, content是请求的body
+func webhook(c *gin.Context) {
+	auth(c)
+
+	var f dataobj.Notify
+	errors.Dangerous(c.BindJSON(&f))
+
+	if len(f.Tos) == 0 || len(f.Content) == 0 {
+		renderMessage(c, "tos or content cannot be empty")
+		return
+	}
+
+	for _, to := range f.Tos {
+		if _, err := strconv.ParseInt(to, 10, 64); err != nil {
+			renderMessage(c, "tos must be webhook ids")
+			return
+		}
+	}
+
+	enqueue(c, &f, "webhook")
+}
+
+// webhookDeadLetterGets webhook_id为0或status为空时不过滤
+func webhookDeadLetterGets(c *gin.Context) {
+	auth(c)
+
+	webhookId := queryInt64(c, "webhook_id", 0)
+	status := c.Query("status")
+	limit := int(queryInt64(c, "limit", 20))
+	page := int(queryInt64(c, "p", 1))
+	if limit <= 0 {
+		limit = 20
+	}
+	if page <= 0 {
+		page = 1
+	}
+
+	total, err := model.WebhookDeadLetterTotal(webhookId, status)
+	errors.Dangerous(err)
+
+	list, err := model.WebhookDeadLetterGets(webhookId, status, limit, (page-1)*limit)
+	errors.Dangerous(err)
+
+	renderData(c, gin.H{
+		"list":  list,
+		"total": total,
+	}, nil)
+}
+
+func webhookDeadLetterGet(c *gin.Context) {
+	auth(c)
+	renderData(c, mustWebhookDeadLetter(urlParamInt64(c, "id")), nil)
+}
+
+type webhookReplayForm struct {
+	Replayer string `json:"replayer"`
+}
+
+// webhookDeadLetterReplay 只是请求重放, 由ReplayWebhookLoop重新投递
+func webhookDeadLetterReplay(c *gin.Context) {
+	auth(c)
+
+	letter := mustWebhookDeadLetter(urlParamInt64(c, "id"))
+
+	var f webhookReplayForm
+	c.ShouldBindJSON(&f)
+	if f.Replayer == "" {
+		f.Replayer = "api"
+	}
+
+	ok, err := letter.Replay(f.Replayer)
+	errors.Dangerous(err)
+
+	if !ok {
+		renderMessage(c, "dead letter is already replayed")
+		return
+	}
+
+	renderMessage(c, "")
+}
+
+func mustWebhookDeadLetter(id int64) *model.WebhookDeadLetter {
+	letter, err := model.WebhookDeadLetterGet(id)
+	errors.Dangerous(err)
+
+	if letter == nil {
+		errors.Bomb("no such dead letter[%d]", id)
+	}
+
+	return letter
+}
@@ -16,6 +16,8 @@ var (
 	IM_QUEUE_NAME    string
 	VOICE_QUEUE_NAME string
 	MAIL_QUEUE_NAME  string
+
+	WEBHOOK_QUEUE_NAME string
 )
 
 func InitRedis() {
@@ -34,6 +36,7 @@ func InitRedis() {
 	IM_QUEUE_NAME = cfg.Queue.IM
 	MAIL_QUEUE_NAME = cfg.Queue.Mail
 	VOICE_QUEUE_NAME = cfg.Queue.Voice
+	WEBHOOK_QUEUE_NAME = cfg.Queue.Webhook
 
 	RedisConnPool = &redis.Pool{
 		MaxIdle:     maxIdle,
@@ -81,6 +84,8 @@ func ChoiceQueue(notifyType string) string {
 		return SMS_QUEUE_NAME
 	case "voice":
 		return VOICE_QUEUE_NAME
+	case "webhook":
+		return WEBHOOK_QUEUE_NAME
 	}
 
 	return ""
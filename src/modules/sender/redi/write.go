@@ -9,18 +9,19 @@ import (
 	"github.com/open-falcon/falcon-ng/src/dataobj"
 )
 
-func lpush(queue, message string) {
+func lpush(queue, message string) error {
 	rc := RedisConnPool.Get()
 	defer rc.Close()
 	_, err := rc.Do("LPUSH", queue, message)
 	if err != nil {
 		logger.Error("LPUSH redis", queue, "fail:", err, "message:", message)
 	}
+	return err
 }
 
-func Write(data *dataobj.Notify, notifyType string) {
+func Write(data *dataobj.Notify, notifyType string) error {
 	if data == nil {
-		return
+		return nil
 	}
 
 	data.Tos = removeEmptyString(data.Tos)
@@ -28,13 +29,16 @@ func Write(data *dataobj.Notify, notifyType string) {
 	var json = jsoniter.ConfigCompatibleWithStandardLibrary
 	bs, err := json.Marshal(data)
 	if err != nil {
-		logger.Error("marshal mail failed, dat: %+v, err: %v", data, err)
-		return
+		logger.Errorf("marshal mail failed, dat: %+v, err: %v", data, err)
+		return err
 	}
 
 	queue := ChoiceQueue(notifyType)
-	lpush(queue, string(bs))
+	if err := lpush(queue, string(bs)); err != nil {
+		return err
+	}
 	logger.Debugf("write mail to queue, mail:%v, queue:%s", data, queue)
+	return nil
 }
 
 func removeEmptyString(s []string) []string {
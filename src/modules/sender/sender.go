@@ -61,6 +61,8 @@ func main() {
 	go cron.ConsumeMail()
 	go cron.ConsumeSms()
 	go cron.ConsumeVoice()
+	go cron.ConsumeWebhook()
+	go cron.ReplayWebhookLoop()
 
 	http.Start()
 	ending()
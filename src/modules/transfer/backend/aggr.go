@@ -16,6 +16,23 @@ var (
 		"avg": struct{}{},
 		"max": struct{}{},
 		"min": struct{}{},
+
+		"count":  struct{}{},
+		"stddev": struct{}{},
+		"p50":    struct{}{},
+		"p90":    struct{}{},
+		"p99":    struct{}{},
+
+		// 先对每条曲线求导, 再把同一时刻的结果相加
+		"rate":  struct{}{},
+		"irate": struct{}{},
+		"delta": struct{}{},
+	}
+
+	percentiles = map[string]float64{
+		"p50": 0.5,
+		"p90": 0.9,
+		"p99": 0.99,
 	}
 )
 
@@ -88,15 +105,22 @@ func GetAggrCounter(input dataobj.QueryDataForUI) map[string][]map[string]string
 	return groupCounter
 }
 
-func compute(f string, datas []*dataobj.TsdbQueryResponse) []*dataobj.RRDData {
+// compute 聚合多条曲线, step是对齐的周期, 各曲线的时间戳先对齐到step的整数倍上再计算
+func compute(f string, step int, datas []*dataobj.TsdbQueryResponse) []*dataobj.RRDData {
 	datasLen := len(datas)
 	if datasLen < 1 {
 		return nil
 	}
 
+	switch f {
+	case "rate", "irate", "delta":
+		datas = derive(f, datas)
+	}
+	datas = align(f, step, datas)
+
 	dataMap := make(map[int64]*AggrTsValue)
 	switch f {
-	case "sum":
+	case "sum", "rate", "irate", "delta":
 		dataMap = sum(datas)
 	case "avg":
 		dataMap = avg(datas)
@@ -104,6 +128,12 @@ func compute(f string, datas []*dataobj.TsdbQueryResponse) []*dataobj.RRDData {
 		dataMap = max(datas)
 	case "min":
 		dataMap = min(datas)
+	case "count":
+		dataMap = count(datas)
+	case "stddev":
+		dataMap = stddev(datas)
+	case "p50", "p90", "p99":
+		dataMap = percentile(datas, percentiles[f])
 	}
 
 	var tmpValues dataobj.RRDValues
@@ -118,6 +148,142 @@ func compute(f string, datas []*dataobj.TsdbQueryResponse) []*dataobj.RRDData {
 	return tmpValues
 }
 
+// alignStep 聚合的周期, 没有指定时取各曲线中最大的周期
+func alignStep(step int, datas []*dataobj.TsdbQueryResponse) int {
+	if step > 0 {
+		return step
+	}
+
+	for _, data := range datas {
+		s := data.Step
+		if s <= 0 {
+			s = guessStep(data.Values)
+		}
+		if s > step {
+			step = s
+		}
+	}
+	return step
+}
+
+// guessStep 曲线没有周期时取相邻两个点的最小间隔
+func guessStep(values []*dataobj.RRDData) int {
+	step := int64(0)
+	for i := 1; i < len(values); i++ {
+		d := values[i].Timestamp - values[i-1].Timestamp
+		if d > 0 && (step == 0 || d < step) {
+			step = d
+		}
+	}
+	return int(step)
+}
+
+// align 把每条曲线的时间戳向下对齐到step的整数倍, 同一个周期内有多个点时,
+// irate取最后一个点, delta取和, 其他取平均值
+func align(f string, step int, datas []*dataobj.TsdbQueryResponse) []*dataobj.TsdbQueryResponse {
+	if step <= 0 {
+		return datas
+	}
+
+	aligned := make([]*dataobj.TsdbQueryResponse, 0, len(datas))
+	for _, data := range datas {
+		buckets := make(map[int64]*AggrTsValue)
+		for _, v := range sortedValues(data.Values) {
+			if math.IsNaN(float64(v.Value)) {
+				continue
+			}
+
+			ts := v.Timestamp - v.Timestamp%int64(step)
+			b, exists := buckets[ts]
+			if !exists {
+				buckets[ts] = &AggrTsValue{Value: v.Value, Count: 1}
+				continue
+			}
+
+			b.Count++
+			switch f {
+			case "irate":
+				b.Value = v.Value
+			case "delta":
+				b.Value += v.Value
+			default:
+				b.Value += (v.Value - b.Value) / dataobj.JsonFloat(b.Count)
+			}
+		}
+
+		var values dataobj.RRDValues
+		for ts, b := range buckets {
+			values = append(values, &dataobj.RRDData{Timestamp: ts, Value: b.Value})
+		}
+		sort.Sort(values)
+
+		tmp := *data
+		tmp.Step = step
+		tmp.Values = values
+		aligned = append(aligned, &tmp)
+	}
+	return aligned
+}
+
+// derive 计算每条曲线的速率(rate/irate)或者差值(delta).
+// COUNTER|DERIVE类型在tsdb中存储的已经是每秒速率, rate/irate直接使用, delta用速率乘以间隔;
+// 其他类型按原始的计数值计算, 值变小时认为计数器被重置
+func derive(f string, datas []*dataobj.TsdbQueryResponse) []*dataobj.TsdbQueryResponse {
+	derived := make([]*dataobj.TsdbQueryResponse, 0, len(datas))
+	for _, data := range datas {
+		isRate := data.DsType == dataobj.COUNTER || data.DsType == dataobj.DERIVE
+
+		var values dataobj.RRDValues
+		var prev *dataobj.RRDData
+		for _, v := range sortedValues(data.Values) {
+			if math.IsNaN(float64(v.Value)) {
+				continue
+			}
+
+			if prev == nil {
+				prev = v
+				if isRate && f != "delta" {
+					values = append(values, v)
+				}
+				continue
+			}
+
+			interval := dataobj.JsonFloat(v.Timestamp - prev.Timestamp)
+			var value dataobj.JsonFloat
+			switch {
+			case isRate && f == "delta":
+				value = v.Value * interval
+			case isRate:
+				value = v.Value
+			default:
+				value = v.Value - prev.Value
+				if value < 0 && f != "delta" {
+					value = v.Value
+				}
+				if f != "delta" {
+					value /= interval
+				}
+			}
+
+			values = append(values, &dataobj.RRDData{Timestamp: v.Timestamp, Value: value})
+			prev = v
+		}
+
+		tmp := *data
+		tmp.DsType = dataobj.GAUGE
+		tmp.Values = values
+		derived = append(derived, &tmp)
+	}
+	return derived
+}
+
+func sortedValues(values []*dataobj.RRDData) dataobj.RRDValues {
+	sorted := make(dataobj.RRDValues, len(values))
+	copy(sorted, values)
+	sort.Sort(sorted)
+	return sorted
+}
+
 func sum(datas []*dataobj.TsdbQueryResponse) map[int64]*AggrTsValue {
 	dataMap := make(map[int64]*AggrTsValue)
 	datasLen := len(datas)
@@ -214,3 +380,71 @@ func min(datas []*dataobj.TsdbQueryResponse) map[int64]*AggrTsValue {
 	}
 	return dataMap
 }
+
+func count(datas []*dataobj.TsdbQueryResponse) map[int64]*AggrTsValue {
+	dataMap := make(map[int64]*AggrTsValue)
+	for ts, values := range collect(datas) {
+		dataMap[ts] = &AggrTsValue{
+			Value: dataobj.JsonFloat(len(values)),
+			Count: len(values),
+		}
+	}
+	return dataMap
+}
+
+func stddev(datas []*dataobj.TsdbQueryResponse) map[int64]*AggrTsValue {
+	dataMap := make(map[int64]*AggrTsValue)
+	for ts, values := range collect(datas) {
+		var mean float64
+		for _, v := range values {
+			mean += v
+		}
+		mean /= float64(len(values))
+
+		var variance float64
+		for _, v := range values {
+			variance += (v - mean) * (v - mean)
+		}
+
+		dataMap[ts] = &AggrTsValue{
+			Value: dataobj.JsonFloat(math.Sqrt(variance / float64(len(values)))),
+			Count: len(values),
+		}
+	}
+	return dataMap
+}
+
+// percentile 同一时刻各曲线的分位值, 在相邻的两个值之间线性插值
+func percentile(datas []*dataobj.TsdbQueryResponse, q float64) map[int64]*AggrTsValue {
+	dataMap := make(map[int64]*AggrTsValue)
+	for ts, values := range collect(datas) {
+		sort.Float64s(values)
+
+		rank := q * float64(len(values)-1)
+		lower := int(math.Floor(rank))
+		upper := int(math.Ceil(rank))
+		weight := rank - float64(lower)
+
+		dataMap[ts] = &AggrTsValue{
+			Value: dataobj.JsonFloat(values[lower]*(1-weight) + values[upper]*weight),
+			Count: len(values),
+		}
+	}
+	return dataMap
+}
+
+// collect 按时间戳收集各曲线的值, 忽略NaN
+func collect(datas []*dataobj.TsdbQueryResponse) map[int64][]float64 {
+	tsValues := make(map[int64][]float64)
+	for i := 0; i < len(datas); i++ {
+		for j := 0; j < len(datas[i].Values); j++ {
+			value := float64(datas[i].Values[j].Value)
+			if math.IsNaN(value) {
+				continue
+			}
+			ts := datas[i].Values[j].Timestamp
+			tsValues[ts] = append(tsValues[ts], value)
+		}
+	}
+	return tsValues
+}
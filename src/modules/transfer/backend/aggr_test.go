@@ -0,0 +1,62 @@
+package backend
+
+import (
+	"math"
+	"testing"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+func newResp(dstype string, step int, points ...[2]float64) *dataobj.TsdbQueryResponse {
+	resp := &dataobj.TsdbQueryResponse{DsType: dstype, Step: step}
+	for _, p := range points {
+		resp.Values = append(resp.Values, dataobj.NewRRDData(int64(p[0]), p[1]))
+	}
+	return resp
+}
+
+func checkValues(t *testing.T, f string, got []*dataobj.RRDData, expect map[int64]float64) {
+	if len(got) != len(expect) {
+		t.Fatalf("%s: expect %v, got %v", f, expect, got)
+	}
+	for _, v := range got {
+		e, exists := expect[v.Timestamp]
+		if !exists || math.Abs(float64(v.Value)-e) > 1e-9 {
+			t.Fatalf("%s: expect %v, got %v", f, expect, got)
+		}
+	}
+}
+
+func Test_ComputeAlign(t *testing.T) {
+	// 两条曲线的时间戳错开了几秒, 对齐之后才能聚合到同一个时间点上
+	datas := []*dataobj.TsdbQueryResponse{
+		newResp(dataobj.GAUGE, 10, [2]float64{100, 1}, [2]float64{110, 2}),
+		newResp(dataobj.GAUGE, 10, [2]float64{103, 3}, [2]float64{113, 4}),
+		newResp(dataobj.GAUGE, 10, [2]float64{107, 5}, [2]float64{117, math.NaN()}),
+	}
+
+	checkValues(t, "sum", compute("sum", alignStep(0, datas), datas), map[int64]float64{100: 9, 110: 6})
+	checkValues(t, "count", compute("count", 10, datas), map[int64]float64{100: 3, 110: 2})
+	checkValues(t, "p50", compute("p50", 10, datas), map[int64]float64{100: 3, 110: 3})
+	checkValues(t, "p90", compute("p90", 10, datas), map[int64]float64{100: 4.6, 110: 3.8})
+	checkValues(t, "stddev", compute("stddev", 10, datas), map[int64]float64{100: math.Sqrt(8.0 / 3), 110: 1})
+
+	// 按更大的周期对齐时, 同一个周期内的点取平均值
+	checkValues(t, "avg", compute("avg", 20, datas[:1]), map[int64]float64{100: 1.5})
+}
+
+func Test_ComputeRate(t *testing.T) {
+	datas := []*dataobj.TsdbQueryResponse{
+		// 原始的计数值, 在130时被重置
+		newResp(dataobj.GAUGE, 10, [2]float64{100, 0}, [2]float64{110, 100}, [2]float64{120, 300}, [2]float64{130, 50}),
+		// tsdb中存储的已经是速率
+		newResp(dataobj.COUNTER, 10, [2]float64{100, 1}, [2]float64{110, 1}, [2]float64{120, 2}, [2]float64{130, 2}),
+	}
+
+	checkValues(t, "rate", compute("rate", 10, datas), map[int64]float64{100: 1, 110: 11, 120: 22, 130: 7})
+	checkValues(t, "delta", compute("delta", 10, datas), map[int64]float64{110: 110, 120: 220, 130: -230})
+
+	// 按20s对齐时, rate取周期内的平均速率, irate取最后一个点的速率
+	checkValues(t, "rate", compute("rate", 20, datas), map[int64]float64{100: 11, 120: 14.5})
+	checkValues(t, "irate", compute("irate", 20, datas), map[int64]float64{100: 11, 120: 7})
+}
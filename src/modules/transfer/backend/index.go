@@ -0,0 +1,184 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	nsq "github.com/bitly/go-nsq"
+	"github.com/toolkits/pkg/container/list"
+	"github.com/toolkits/pkg/logger"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	. "github.com/open-falcon/falcon-ng/src/modules/transfer/config"
+)
+
+// 把收到的数据转换为IndexModel, 通过nsq发布给index:
+// 第一次见到的series(或者step/dstype发生变化)立即发布到incrTopic,
+// 已知的series每隔fullInterval全量发布到fullTopic, 避免index中的数据过期
+
+type indexEntry struct {
+	model    *dataobj.IndexModel
+	lastSeen int64 // 最后一次收到数据的时间
+}
+
+var (
+	IndexQueue = list.NewSafeListLimited(DefaultSendQueueMaxSize)
+
+	indexLock  sync.Mutex
+	indexKnown = make(map[string]*indexEntry) // pk -> entry
+
+	indexProducers []*nsq.Producer
+)
+
+func indexEnabled() bool {
+	return Config.Index.Publish.Enabled
+}
+
+func initIndexPublisher() {
+	if !indexEnabled() {
+		return
+	}
+
+	conf := nsq.NewConfig()
+	for _, addr := range Config.Index.Publish.Nsqds {
+		p, err := nsq.NewProducer(addr, conf)
+		if err != nil {
+			logger.Errorf("create nsq producer %s failed: %v", addr, err)
+			continue
+		}
+		p.SetLogger(nil, nsq.LogLevelError)
+		indexProducers = append(indexProducers, p)
+	}
+
+	go sendIncrIndex()
+	go sendFullIndex()
+}
+
+// Push2IndexQueue 新的series放入发送队列, 已知的series只更新最后收到数据的时间
+func Push2IndexQueue(items []*dataobj.MetricValue) {
+	now := time.Now().Unix()
+
+	indexLock.Lock()
+	defer indexLock.Unlock()
+
+	for _, item := range items {
+		pk := item.PK()
+		entry, exists := indexKnown[pk]
+		if exists && entry.model.Step == int(item.Step) && entry.model.DsType == item.CounterType {
+			entry.lastSeen = now
+			entry.model.Timestamp = item.Timestamp
+			continue
+		}
+
+		entry = &indexEntry{model: convert2IndexModel(item), lastSeen: now}
+		indexKnown[pk] = entry
+
+		m := *entry.model
+		if !IndexQueue.PushFront(&m) {
+			// 队列满了, 等下次全量发布
+			logger.Warningf("index queue is full, drop %s", pk)
+		}
+	}
+}
+
+func convert2IndexModel(d *dataobj.MetricValue) *dataobj.IndexModel {
+	tags := make(map[string]string, len(d.TagsMap))
+	for k, v := range d.TagsMap {
+		tags[k] = v
+	}
+
+	return &dataobj.IndexModel{
+		Endpoint:  d.Endpoint,
+		Metric:    d.Metric,
+		DsType:    d.CounterType,
+		Step:      int(d.Step),
+		Tags:      tags,
+		Timestamp: d.Timestamp,
+	}
+}
+
+func sendIncrIndex() {
+	batch := Config.Index.Publish.Batch
+	for {
+		items := IndexQueue.PopBackBy(batch)
+		if len(items) == 0 {
+			time.Sleep(time.Millisecond * 200)
+			continue
+		}
+
+		models := make([]*dataobj.IndexModel, 0, len(items))
+		for _, item := range items {
+			models = append(models, item.(*dataobj.IndexModel))
+		}
+
+		if err := publishIndex(Config.Index.Publish.IncrTopic, models); err != nil {
+			logger.Errorf("publish %d incr index failed: %v", len(models), err)
+		}
+	}
+}
+
+func sendFullIndex() {
+	interval := Config.Index.Publish.FullInterval
+	for {
+		time.Sleep(time.Duration(interval) * time.Second)
+
+		// 超过两个周期没有数据的series不再发布
+		models := indexSnapshot(time.Now().Unix() - int64(interval*2))
+
+		batch := Config.Index.Publish.Batch
+		failed := 0
+		for i := 0; i < len(models); i += batch {
+			end := i + batch
+			if end > len(models) {
+				end = len(models)
+			}
+
+			if err := publishIndex(Config.Index.Publish.FullTopic, models[i:end]); err != nil {
+				logger.Errorf("publish full index failed: %v", err)
+				failed += end - i
+			}
+		}
+
+		logger.Infof("publish full index: %d series, %d failed", len(models), failed)
+	}
+}
+
+// indexSnapshot 返回since之后有数据的series, 同时删除其他的
+func indexSnapshot(since int64) []*dataobj.IndexModel {
+	indexLock.Lock()
+	defer indexLock.Unlock()
+
+	models := make([]*dataobj.IndexModel, 0, len(indexKnown))
+	for pk, entry := range indexKnown {
+		if entry.lastSeen < since {
+			delete(indexKnown, pk)
+			continue
+		}
+
+		m := *entry.model
+		models = append(models, &m)
+	}
+	return models
+}
+
+// publishIndex 依次尝试各个nsqd, 有一个成功即可
+func publishIndex(topic string, models []*dataobj.IndexModel) error {
+	if len(indexProducers) == 0 {
+		return fmt.Errorf("no nsqd available")
+	}
+
+	body, err := json.Marshal(models)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range indexProducers {
+		if err = p.Publish(topic, body); err == nil {
+			return nil
+		}
+		logger.Warningf("publish to %s failed: %v", p, err)
+	}
+	return err
+}
@@ -0,0 +1,38 @@
+package backend
+
+import (
+	"testing"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+func Test_Push2IndexQueue(t *testing.T) {
+	item := func(ts, step int64) *dataobj.MetricValue {
+		return &dataobj.MetricValue{
+			Endpoint:    "host1",
+			Metric:      "cpu.idle",
+			Step:        step,
+			CounterType: dataobj.GAUGE,
+			TagsMap:     map[string]string{"core": "0"},
+			Timestamp:   ts,
+		}
+	}
+
+	// 只有新的series和step变化的series立即发布
+	Push2IndexQueue([]*dataobj.MetricValue{item(100, 10)})
+	Push2IndexQueue([]*dataobj.MetricValue{item(110, 10)})
+	Push2IndexQueue([]*dataobj.MetricValue{item(120, 20)})
+	if n := IndexQueue.Len(); n != 2 {
+		t.Fatalf("expect 2 incr index, got %d", n)
+	}
+
+	models := indexSnapshot(0)
+	if len(models) != 1 || models[0].Step != 20 || models[0].Timestamp != 120 || models[0].Tags["core"] != "0" {
+		t.Fatalf("unexpected snapshot %v", models)
+	}
+
+	// 很久没有数据的series不再全量发布
+	if models = indexSnapshot(1 << 62); len(models) != 0 || len(indexKnown) != 0 {
+		t.Fatalf("expect expired series removed, got %v", models)
+	}
+}
@@ -1,6 +1,9 @@
 package backend
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -28,6 +31,13 @@ var (
 	JudgeQueues = make(map[string]*list.SafeListLimited)
 	TsdbQueues  = make(map[string]*list.SafeListLimited)
 
+	// judge节点的地址 node -> addr, 从portal同步时会动态增加, 和JudgeQueues一起由JudgeQueuesLock保护
+	JudgeAddrs      = make(map[string]string)
+	JudgeQueuesLock = new(sync.RWMutex)
+
+	// 落盘队列 node+addr -> spill_queue, 没有开启落盘时为空
+	TsdbSpills = make(map[string]*SpillQueue)
+
 	// 连接池 node_address -> connection_pool
 	JudgeConnPools *ConnPools = &ConnPools{M: make(map[string]*pool.ConnPool)}
 	TsdbConnPools  *ConnPools = &ConnPools{M: make(map[string]*pool.ConnPool)}
@@ -52,15 +62,26 @@ func Init() {
 	initHashRing()
 	initConnPools()
 	initSendQueues()
+	initSpillQueues()
+	initQueryCache()
+	initIndexPublisher()
 
 	startSendTasks()
-	if Config.Judge.Enabled {
+	if repairEnabled() {
+		go repairLoop()
+	}
+	// 从portal同步时, 存活的judge以portal为准
+	if Config.Judge.Enabled && !Config.Judge.FromPortal {
 		go checkJudgeNodes()
 	}
 }
 
 func initHashRing() {
-	JudgeHashRing = NewConsistentHashRing(int32(Config.Judge.Replicas), str.KeysOfMap(Config.Judge.Cluster))
+	judgeReplicas := Config.Judge.Replicas
+	if Config.Judge.FromPortal {
+		judgeReplicas = JudgeRingReplicas
+	}
+	JudgeHashRing = NewConsistentHashRing(int32(judgeReplicas), str.KeysOfMap(Config.Judge.Cluster))
 	TsdbNodeRing = NewConsistentHashRing(int32(Config.Tsdb.Replicas), str.KeysOfMap(Config.Tsdb.Cluster))
 }
 
@@ -83,9 +104,10 @@ func initConnPools() {
 }
 
 func initSendQueues() {
-	for node := range Config.Judge.Cluster {
+	for node, addr := range Config.Judge.Cluster {
 		Q := list.NewSafeListLimited(DefaultSendQueueMaxSize)
 		JudgeQueues[node] = Q
+		JudgeAddrs[node] = addr
 	}
 
 	for node, item := range Config.Tsdb.ClusterList {
@@ -96,6 +118,34 @@ func initSendQueues() {
 	}
 }
 
+func initSpillQueues() {
+	if !Config.Tsdb.Enabled || !Config.Tsdb.Spill.Enabled {
+		return
+	}
+
+	for node, item := range Config.Tsdb.ClusterList {
+		for _, addr := range item.Addrs {
+			dir := filepath.Join(Config.Tsdb.Spill.Dir, node+"_"+strings.Replace(addr, ":", "_", -1))
+			Q, err := NewSpillQueue(dir, Config.Tsdb.Spill.MaxSize*1024*1024)
+			if err != nil {
+				logger.Fatalf("init spill queue %s failed: %v", dir, err)
+				os.Exit(1)
+			}
+
+			if n := Q.Len(); n > 0 {
+				logger.Infof("spill queue %s has %d batches to replay", dir, n)
+			}
+			TsdbSpills[node+addr] = Q
+		}
+	}
+}
+
+func initQueryCache() {
+	if Config.Cache.Enabled {
+		UICache = NewQueryCache(Config.Cache.Bucket, Config.Cache.MaxSize*1024*1024)
+	}
+}
+
 func checkJudgeNodes() {
 	if !Config.Judge.Enabled {
 		return
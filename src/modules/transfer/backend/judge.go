@@ -0,0 +1,88 @@
+package backend
+
+import (
+	"sort"
+
+	"github.com/toolkits/pkg/container/list"
+	"github.com/toolkits/pkg/logger"
+)
+
+// judge集群从portal同步(judge.fromPortal):
+// portal根据judge的心跳维护哈希环, 按策略id把策略分配到judge; transfer使用同样的节点名和副本数重建哈希环,
+// 数据才能推送到策略所在的judge. judge的地址使用心跳中上报的rpc地址
+
+// JudgeRingReplicas 与portal中judge哈希环的副本数一致
+const JudgeRingReplicas = 500
+
+func judgeQueue(node string) (*list.SafeListLimited, bool) {
+	JudgeQueuesLock.RLock()
+	defer JudgeQueuesLock.RUnlock()
+
+	Q, exists := JudgeQueues[node]
+	return Q, exists
+}
+
+func judgeAddr(node string) (string, bool) {
+	JudgeQueuesLock.RLock()
+	defer JudgeQueuesLock.RUnlock()
+
+	addr, exists := JudgeAddrs[node]
+	return addr, exists
+}
+
+// UpdateJudgeNodes nodes是存活的judge, node -> rpc地址
+// 没有地址的节点也要加入哈希环, 否则其他策略的分片会和portal不一致; 已经下线的节点保留队列, 剩下的数据继续发送
+func UpdateJudgeNodes(nodes map[string]string) {
+	if len(nodes) == 0 {
+		logger.Warning("no judge alive, keep the hash ring")
+		return
+	}
+
+	JudgeQueuesLock.Lock()
+	for node, addr := range nodes {
+		if addr == "" {
+			logger.Warningf("judge node %s has no rpc addr", node)
+			continue
+		}
+
+		if old, exists := JudgeAddrs[node]; !exists || old != addr {
+			logger.Infof("judge node %s addr: %s", node, addr)
+			JudgeConnPools.Add(addr)
+			JudgeAddrs[node] = addr
+		}
+
+		if _, exists := JudgeQueues[node]; !exists {
+			Q := list.NewSafeListLimited(DefaultSendQueueMaxSize)
+			JudgeQueues[node] = Q
+			go Send2JudgeTask(Q, node, judgeWorkerNum())
+		}
+	}
+	JudgeQueuesLock.Unlock()
+
+	names := make([]string, 0, len(nodes))
+	for node := range nodes {
+		names = append(names, node)
+	}
+	sort.Strings(names)
+
+	members := JudgeHashRing.GetRing().Members()
+	sort.Strings(members)
+	if equalStrings(names, members) {
+		return
+	}
+
+	RebuildConsistentHashRing(JudgeHashRing, names, JudgeRingReplicas)
+	logger.Infof("judge hash ring rebuilt, nodes:%v", names)
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package backend
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/toolkits/pkg/container/list"
+
+	. "github.com/open-falcon/falcon-ng/src/modules/transfer/config"
+)
+
+func Test_UpdateJudgeNodes(t *testing.T) {
+	Config = &ConfYaml{Judge: JudgeSection{Enabled: true, FromPortal: true}}
+	JudgeConnPools = CreateConnPools(1, 1, 1000, 1000, nil)
+	JudgeHashRing = NewConsistentHashRing(JudgeRingReplicas, nil)
+	JudgeQueues = make(map[string]*list.SafeListLimited)
+	JudgeAddrs = make(map[string]string)
+
+	// 配置文件中的judge01, 通过心跳注册的judge以ident作为节点名, 10.0.0.3没有上报rpc地址
+	UpdateJudgeNodes(map[string]string{
+		"judge01":  "10.0.0.1:8033",
+		"10.0.0.2": "10.0.0.2:8033",
+		"10.0.0.3": "",
+	})
+
+	// 和portal中syncJudges重建的哈希环一致
+	portal := NewConsistentHashRing(JudgeRingReplicas, []string{"10.0.0.2", "10.0.0.3", "judge01"})
+	for sid := 1; sid <= 1000; sid++ {
+		want, _ := portal.GetNode(strconv.Itoa(sid))
+		got, err := JudgeHashRing.GetNode(strconv.Itoa(sid))
+		if err != nil || got != want {
+			t.Fatalf("sid %d: want node %s, got %s, err: %v", sid, want, got, err)
+		}
+	}
+
+	if addr, exists := judgeAddr("10.0.0.2"); !exists || addr != "10.0.0.2:8033" {
+		t.Fatalf("unexpected addr: %s", addr)
+	}
+	if _, exists := judgeQueue("judge01"); !exists {
+		t.Fatal("judge01 queue not created")
+	}
+	if _, exists := judgeQueue("10.0.0.3"); exists {
+		t.Fatal("queue created without addr")
+	}
+	if _, exists := JudgeConnPools.Get("10.0.0.1:8033"); !exists {
+		t.Fatal("conn pool not created")
+	}
+
+	// 没有存活的judge时保留哈希环
+	UpdateJudgeNodes(map[string]string{})
+	if members := JudgeHashRing.GetRing().Members(); len(members) != 3 {
+		t.Fatalf("unexpected members: %v", members)
+	}
+
+	// judge下线后从哈希环中摘除, 队列保留
+	UpdateJudgeNodes(map[string]string{"judge01": "10.0.0.1:8033"})
+	if members := JudgeHashRing.GetRing().Members(); len(members) != 1 || members[0] != "judge01" {
+		t.Fatalf("unexpected members: %v", members)
+	}
+	if _, exists := judgeQueue("10.0.0.2"); !exists {
+		t.Fatal("queue of removed judge dropped")
+	}
+}
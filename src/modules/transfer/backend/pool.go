@@ -103,6 +103,18 @@ func (this *ConnPools) Call(addr, method string, args interface{}, resp interfac
 	}
 }
 
+// Add 地址还没有连接池时创建, 用于动态加入的节点
+func (this *ConnPools) Add(address string) {
+	this.Lock()
+	defer this.Unlock()
+
+	if _, exists := this.M[address]; exists {
+		return
+	}
+	ct := time.Duration(this.ConnTimeout) * time.Millisecond
+	this.M[address] = createOnePool(address, address, ct, this.MaxConns, this.MaxIdle)
+}
+
 func (this *ConnPools) Get(address string) (*pool.ConnPool, bool) {
 	this.RLock()
 	defer this.RUnlock()
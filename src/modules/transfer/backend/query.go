@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"sort"
 	"time"
 
 	"github.com/toolkits/pkg/logger"
@@ -31,7 +32,15 @@ func FetchData(inputs []dataobj.QueryData) []*dataobj.TsdbQueryResponse {
 	return resp
 }
 
+// FetchDataForUI 开启缓存时相同的查询在一个bucket内只请求一次tsdb
 func FetchDataForUI(input dataobj.QueryDataForUI) []*dataobj.TsdbQueryResponse {
+	if UICache != nil {
+		return UICache.Fetch(input, fetchDataForUI)
+	}
+	return fetchDataForUI(input)
+}
+
+func fetchDataForUI(input dataobj.QueryDataForUI) []*dataobj.TsdbQueryResponse {
 	resp := []*dataobj.TsdbQueryResponse{}
 
 	if input.AggrFunc != "" && AggrFuncValide(input.AggrFunc) {
@@ -76,7 +85,12 @@ func FetchDataForUI(input dataobj.QueryDataForUI) []*dataobj.TsdbQueryResponse {
 				res = append(res, d)
 			}
 
-			aggrData.Values = compute(input.AggrFunc, res)
+			aggrData.Step = alignStep(input.Step, res)
+			aggrData.Values = compute(input.AggrFunc, aggrData.Step, res)
+			switch input.AggrFunc {
+			case "rate", "irate", "delta":
+				aggrData.DsType = dataobj.GAUGE
+			}
 			logger.Debugf("aggr compute:%v ", aggrData.Values)
 
 			resp = append(resp, &aggrData)
@@ -209,8 +223,9 @@ func GenQParam(start, end int64, consolFunc, endpoint, counter string, step int)
 	}
 }
 
+// QueryOne 查询series所在node的副本: 先并发查询ReadQuorum个副本, 失败时换下一个副本,
+// 多个副本的结果合并后返回, 副本之间缺失的点互相补齐; 可用的副本不够时返回部分结果
 func QueryOne(para dataobj.TsdbQueryParam) (resp *dataobj.TsdbQueryResponse, err error) {
-	start, end := para.Start, para.End
 	resp = &dataobj.TsdbQueryResponse{}
 
 	pk := dataobj.PKWithCounter(para.Endpoint, para.Counter)
@@ -219,76 +234,155 @@ func QueryOne(para dataobj.TsdbQueryParam) (resp *dataobj.TsdbQueryResponse, err
 		return resp, err
 	}
 
-	count := len(pools)
-	for _, i := range rand.Perm(count) {
-		pool := pools[i].Pool
-		addr := pools[i].Addr
+	quorum := Config.Tsdb.Replica.ReadQuorum
+	if quorum > len(pools) {
+		quorum = len(pools)
+	}
+	if quorum < 1 {
+		quorum = 1
+	}
 
-		conn, err := pool.Fetch()
-		if err != nil {
-			logger.Warning(err)
+	type ChResult struct {
+		Err  error
+		Resp *dataobj.TsdbQueryResponse
+	}
+
+	ch := make(chan *ChResult, len(pools))
+	order := rand.Perm(len(pools))
+	next := 0
+	launch := func() {
+		p := pools[order[next]]
+		next++
+		go func() {
+			r, err := queryReplica(p, para)
+			ch <- &ChResult{Err: err, Resp: r}
+		}()
+	}
+
+	for next < quorum {
+		launch()
+	}
+
+	resps := []*dataobj.TsdbQueryResponse{}
+	for pending := quorum; pending > 0; pending-- {
+		r := <-ch
+		if r.Err != nil {
+			logger.Warning(r.Err)
+			if next < len(pools) {
+				launch()
+				pending++
+			}
 			continue
 		}
+		resps = append(resps, r.Resp)
+	}
+
+	if len(resps) == 0 {
+		return resp, fmt.Errorf("get data error")
+	}
+
+	if len(resps) < quorum {
+		logger.Warningf("query %s: only %d of %d replicas returned, the result may be partial", pk, len(resps), quorum)
+	}
+
+	return mergeResponses(resps), nil
+}
+
+func queryReplica(p Pool, para dataobj.TsdbQueryParam) (*dataobj.TsdbQueryResponse, error) {
+	start, end := para.Start, para.End
+	pool, addr := p.Pool, p.Addr
+
+	conn, err := pool.Fetch()
+	if err != nil {
+		return nil, err
+	}
 
-		rpcConn := conn.(RpcClient)
-		if rpcConn.Closed() {
+	rpcConn := conn.(RpcClient)
+	if rpcConn.Closed() {
+		pool.ForceClose(conn)
+		return nil, errors.New("conn closed")
+	}
+
+	type ChResult struct {
+		Err  error
+		Resp *dataobj.TsdbQueryResponse
+	}
+
+	ch := make(chan *ChResult, 1)
+	go func() {
+		resp := &dataobj.TsdbQueryResponse{}
+		err := rpcConn.Call("Tsdb.Query", para, resp)
+		ch <- &ChResult{Err: err, Resp: resp}
+	}()
+
+	select {
+	case <-time.After(time.Duration(callTimeout) * time.Millisecond):
+		pool.ForceClose(conn)
+		return nil, fmt.Errorf("%s, call timeout. proc: %s", addr, pool.Proc())
+	case r := <-ch:
+		if r.Err != nil {
 			pool.ForceClose(conn)
+			return nil, fmt.Errorf("%s, call failed, err %v. proc: %s", addr, r.Err, pool.Proc())
+		}
 
-			err = errors.New("conn closed")
-			logger.Warning(err)
-			continue
+		pool.Release(conn)
+		if len(r.Resp.Values) < 1 {
+			r.Resp.Values = []*dataobj.RRDData{}
+			return r.Resp, nil
 		}
 
-		type ChResult struct {
-			Err  error
-			Resp *dataobj.TsdbQueryResponse
+		fixed := []*dataobj.RRDData{}
+		for _, v := range r.Resp.Values {
+			if v == nil || !(v.Timestamp >= start && v.Timestamp <= end) {
+				continue
+			}
+
+			if (r.Resp.DsType == "DERIVE" || r.Resp.DsType == "COUNTER") && v.Value < 0 {
+				fixed = append(fixed, &dataobj.RRDData{Timestamp: v.Timestamp, Value: dataobj.JsonFloat(math.NaN())})
+			} else {
+				fixed = append(fixed, v)
+			}
 		}
+		r.Resp.Values = fixed
+		return r.Resp, nil
+	}
+}
 
-		ch := make(chan *ChResult, 1)
-		go func() {
-			resp := &dataobj.TsdbQueryResponse{}
-			err := rpcConn.Call("Tsdb.Query", para, resp)
-			ch <- &ChResult{Err: err, Resp: resp}
-		}()
+// mergeResponses 合并多个副本的查询结果, 某个时间点上一个副本没有数据时使用其他副本的值
+func mergeResponses(resps []*dataobj.TsdbQueryResponse) *dataobj.TsdbQueryResponse {
+	if len(resps) == 1 {
+		return resps[0]
+	}
 
-		select {
-		case <-time.After(time.Duration(callTimeout) * time.Millisecond):
-			pool.ForceClose(conn)
-			logger.Warning("%s, call timeout. proc: %s", addr, pool.Proc())
-			break
-		case r := <-ch:
-			if r.Err != nil {
-				pool.ForceClose(conn)
-				logger.Warning("%s, call failed, err %v. proc: %s", addr, r.Err, pool.Proc())
-				break
+	// 以点数最多的副本为准, step不同的结果无法合并
+	base := resps[0]
+	for _, r := range resps[1:] {
+		if len(r.Values) > len(base.Values) {
+			base = r
+		}
+	}
 
-			} else {
-				pool.Release(conn)
-				if len(r.Resp.Values) < 1 {
-					r.Resp.Values = []*dataobj.RRDData{}
-					return r.Resp, nil
-				}
+	values := make(map[int64]dataobj.JsonFloat)
+	for _, r := range resps {
+		if r.Step != base.Step {
+			continue
+		}
 
-				fixed := []*dataobj.RRDData{}
-				for _, v := range r.Resp.Values {
-					if v == nil || !(v.Timestamp >= start && v.Timestamp <= end) {
-						continue
-					}
-
-					if (r.Resp.DsType == "DERIVE" || r.Resp.DsType == "COUNTER") && v.Value < 0 {
-						fixed = append(fixed, &dataobj.RRDData{Timestamp: v.Timestamp, Value: dataobj.JsonFloat(math.NaN())})
-					} else {
-						fixed = append(fixed, v)
-					}
-				}
-				r.Resp.Values = fixed
+		for _, v := range r.Values {
+			if old, exists := values[v.Timestamp]; !exists || math.IsNaN(float64(old)) {
+				values[v.Timestamp] = v.Value
 			}
-			return r.Resp, nil
 		}
+	}
 
+	merged := *base
+	merged.Values = make([]*dataobj.RRDData, 0, len(values))
+	for ts, v := range values {
+		merged.Values = append(merged.Values, &dataobj.RRDData{Timestamp: ts, Value: v})
 	}
-	return resp, fmt.Errorf("get data error")
+	sort.Sort(dataobj.RRDValues(merged.Values))
 
+	return &merged
 }
 
 type Pool struct {
@@ -0,0 +1,214 @@
+package backend
+
+import (
+	"container/list"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+// UICache /api/transfer/data/ui 的查询结果缓存, 没有开启时为nil
+var UICache *QueryCache
+
+// QueryCache 按时间对齐的查询结果缓存, 按LRU淘汰.
+// 查询的start向下, end向上对齐到bucket, 同一个bucket内相同的查询共用一份结果, 不会截掉最新的点;
+// 相同的查询正在进行时, 后来的请求等待它的结果, 不再重复请求tsdb
+type QueryCache struct {
+	sync.Mutex
+	bucket   int64
+	maxBytes int64
+	bytes    int64
+
+	lru      *list.List // 最近使用的在前面
+	entries  map[string]*list.Element
+	inflight map[string]*inflightQuery
+
+	hits      int64
+	misses    int64
+	coalesced int64
+	evictions int64
+}
+
+type cacheEntry struct {
+	key      string
+	resp     []*dataobj.TsdbQueryResponse
+	size     int64
+	expireAt int64
+}
+
+type inflightQuery struct {
+	wg   sync.WaitGroup
+	resp []*dataobj.TsdbQueryResponse
+}
+
+type CacheStats struct {
+	Enabled   bool    `json:"enabled"`
+	Entries   int     `json:"entries"`
+	Bytes     int64   `json:"bytes"`
+	MaxBytes  int64   `json:"maxBytes"`
+	Hits      int64   `json:"hits"`
+	Misses    int64   `json:"misses"`
+	Coalesced int64   `json:"coalesced"` // 等待其他相同查询结果的次数
+	Evictions int64   `json:"evictions"`
+	HitRate   float64 `json:"hitRate"`
+}
+
+func NewQueryCache(bucket, maxBytes int64) *QueryCache {
+	return &QueryCache{
+		bucket:   bucket,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		inflight: make(map[string]*inflightQuery),
+	}
+}
+
+// Fetch 优先从缓存中取结果, 没有时调用fetch查询, 返回的结果是共享的, 调用方不能修改
+func (c *QueryCache) Fetch(input dataobj.QueryDataForUI,
+	fetch func(dataobj.QueryDataForUI) []*dataobj.TsdbQueryResponse) []*dataobj.TsdbQueryResponse {
+	start, end := input.Start-input.Start%c.bucket, input.End
+	if end%c.bucket != 0 {
+		end += c.bucket - end%c.bucket
+	}
+	if end-start <= c.bucket {
+		// 时间范围比bucket还小, 对齐之后没有意义
+		return fetch(input)
+	}
+	input.Start, input.End = start, end
+
+	b, err := json.Marshal(input)
+	if err != nil {
+		return fetch(input)
+	}
+	key := string(b)
+
+	c.Lock()
+	if resp, found := c.get(key); found {
+		c.hits++
+		c.Unlock()
+		return resp
+	}
+
+	if call, exists := c.inflight[key]; exists {
+		c.coalesced++
+		c.Unlock()
+		call.wg.Wait()
+		return call.resp
+	}
+
+	c.misses++
+	call := &inflightQuery{}
+	call.wg.Add(1)
+	c.inflight[key] = call
+	c.Unlock()
+
+	c.do(key, call, input, fetch)
+	return call.resp
+}
+
+// do 执行查询并唤醒等待的请求, fetch panic时不缓存结果, 等待的请求拿到空结果, panic继续抛给调用方
+func (c *QueryCache) do(key string, call *inflightQuery, input dataobj.QueryDataForUI,
+	fetch func(dataobj.QueryDataForUI) []*dataobj.TsdbQueryResponse) {
+	defer func() {
+		r := recover()
+
+		c.Lock()
+		delete(c.inflight, key)
+		if r == nil {
+			c.set(key, call.resp)
+		}
+		c.Unlock()
+		call.wg.Done()
+
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	call.resp = fetch(input)
+}
+
+func (c *QueryCache) get(key string) ([]*dataobj.TsdbQueryResponse, bool) {
+	elem, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cacheEntry)
+	if entry.expireAt <= time.Now().Unix() {
+		c.remove(elem)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(elem)
+	return entry.resp, true
+}
+
+func (c *QueryCache) set(key string, resp []*dataobj.TsdbQueryResponse) {
+	if elem, exists := c.entries[key]; exists {
+		c.remove(elem)
+	}
+
+	entry := &cacheEntry{
+		key:      key,
+		resp:     resp,
+		size:     estimateSize(key, resp),
+		expireAt: time.Now().Unix() + c.bucket,
+	}
+	if entry.size > c.maxBytes {
+		return
+	}
+
+	for c.bytes+entry.size > c.maxBytes {
+		c.remove(c.lru.Back())
+		c.evictions++
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+	c.bytes += entry.size
+}
+
+func (c *QueryCache) remove(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+}
+
+func (c *QueryCache) Stats() CacheStats {
+	c.Lock()
+	defer c.Unlock()
+
+	stats := CacheStats{
+		Enabled:   true,
+		Entries:   len(c.entries),
+		Bytes:     c.bytes,
+		MaxBytes:  c.maxBytes,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Coalesced: c.coalesced,
+		Evictions: c.evictions,
+	}
+	if total := c.hits + c.misses + c.coalesced; total > 0 {
+		stats.HitRate = float64(c.hits+c.coalesced) / float64(total)
+	}
+	return stats
+}
+
+func GetCacheStats() CacheStats {
+	if UICache == nil {
+		return CacheStats{}
+	}
+	return UICache.Stats()
+}
+
+// estimateSize 估算一份结果占用的内存
+func estimateSize(key string, resp []*dataobj.TsdbQueryResponse) int64 {
+	size := int64(len(key)) + 128
+	for _, r := range resp {
+		size += int64(len(r.Endpoint)+len(r.Counter)+len(r.DsType)) + 128
+		size += int64(len(r.Values)) * 40 // RRDData 16字节, 指针8字节, 再加上分配的开销
+	}
+	return size
+}
@@ -0,0 +1,109 @@
+package backend
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+func Test_QueryCache(t *testing.T) {
+	c := NewQueryCache(30, 1024*1024)
+
+	var calls int32
+	fetch := func(input dataobj.QueryDataForUI) []*dataobj.TsdbQueryResponse {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return []*dataobj.TsdbQueryResponse{{Start: input.Start, End: input.End, Counter: input.Metric}}
+	}
+
+	// 同一个bucket内的并发查询只请求一次
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp := c.Fetch(dataobj.QueryDataForUI{Start: 1000 + int64(i), End: 4600 + int64(i), Metric: "cpu.idle"}, fetch)
+			// end向上对齐, 不会截掉最新的点
+			if len(resp) != 1 || resp[0].Start != 990 || resp[0].End != 4620 {
+				t.Errorf("unexpected resp %v", resp[0])
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	c.Fetch(dataobj.QueryDataForUI{Start: 1000, End: 4600, Metric: "cpu.idle"}, fetch)
+	if calls != 1 {
+		t.Fatalf("expect 1 fetch, got %d", calls)
+	}
+
+	stats := c.Stats()
+	if stats.Misses != 1 || stats.Hits+stats.Coalesced != 10 || stats.Entries != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// 超过内存上限时淘汰最久没有使用的
+	c.maxBytes = c.bytes * 2
+	c.Fetch(dataobj.QueryDataForUI{Start: 1000, End: 4600, Metric: "mem.used"}, fetch)
+	c.Fetch(dataobj.QueryDataForUI{Start: 1000, End: 4600, Metric: "disk.used"}, fetch)
+	if stats = c.Stats(); stats.Evictions == 0 || stats.Bytes > c.maxBytes {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+// fetch panic之后等待的请求被唤醒, 下一次查询重新请求
+func Test_QueryCachePanic(t *testing.T) {
+	c := NewQueryCache(30, 1024*1024)
+	input := dataobj.QueryDataForUI{Start: 1000, End: 4600, Metric: "cpu.idle"}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() { panicked <- recover() }()
+		c.Fetch(input, func(dataobj.QueryDataForUI) []*dataobj.TsdbQueryResponse {
+			close(started)
+			<-release
+			panic("tsdb conn pool broken")
+		})
+	}()
+
+	<-started
+	done := make(chan []*dataobj.TsdbQueryResponse, 1)
+	go func() {
+		done <- c.Fetch(input, func(dataobj.QueryDataForUI) []*dataobj.TsdbQueryResponse {
+			t.Error("waiter should not fetch")
+			return nil
+		})
+	}()
+
+	// 等待的请求加入之后再panic
+	for c.Stats().Coalesced == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+
+	if r := <-panicked; r == nil {
+		t.Fatal("panic should be passed to the caller")
+	}
+
+	select {
+	case resp := <-done:
+		if resp != nil {
+			t.Fatalf("unexpected resp %v", resp)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter blocked after panic")
+	}
+
+	var calls int32
+	resp := c.Fetch(input, func(input dataobj.QueryDataForUI) []*dataobj.TsdbQueryResponse {
+		atomic.AddInt32(&calls, 1)
+		return []*dataobj.TsdbQueryResponse{{Start: input.Start, End: input.End}}
+	})
+	if calls != 1 || len(resp) != 1 {
+		t.Fatalf("expect fetch again after panic, calls: %d, resp: %v", calls, resp)
+	}
+}
@@ -0,0 +1,24 @@
+package backend
+
+import (
+	"math"
+	"testing"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+func Test_MergeResponses(t *testing.T) {
+	nan := math.NaN()
+
+	// 两个副本各自缺失了一部分点
+	a := newResp(dataobj.GAUGE, 10, [2]float64{100, 1}, [2]float64{110, nan}, [2]float64{120, 3})
+	b := newResp(dataobj.GAUGE, 10, [2]float64{100, 1}, [2]float64{110, 2}, [2]float64{120, nan}, [2]float64{130, 4})
+	// step不同的结果不参与合并
+	c := newResp(dataobj.GAUGE, 60, [2]float64{140, 5})
+
+	merged := mergeResponses([]*dataobj.TsdbQueryResponse{a, b, c})
+	if merged.Step != 10 {
+		t.Fatalf("step: %d", merged.Step)
+	}
+	checkValues(t, "merged", merged.Values, map[int64]float64{100: 1, 110: 2, 120: 3, 130: 4})
+}
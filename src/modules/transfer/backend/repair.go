@@ -0,0 +1,232 @@
+package backend
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/toolkits/pkg/concurrent/semaphore"
+	"github.com/toolkits/pkg/logger"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	. "github.com/open-falcon/falcon-ng/src/modules/transfer/config"
+)
+
+// 副本修复: 记录最近写入过的series, 定期查询它们在各个副本上的数据,
+// 某个副本缺失而其他副本有的点通过 Tsdb.Backfill 补写到这个副本上
+
+type repairSeries struct {
+	Endpoint string
+	Metric   string
+	Tags     string
+	Step     int
+	DsType   string
+	lastSeen int64
+}
+
+type seriesTracker struct {
+	sync.Mutex
+	M map[string]map[string]*repairSeries // node -> pk -> series
+}
+
+var tracker = &seriesTracker{M: make(map[string]map[string]*repairSeries)}
+
+type RepairStats struct {
+	Enabled        bool  `json:"enabled"`
+	Runs           int64 `json:"runs"`
+	SeriesTracked  int64 `json:"seriesTracked"`
+	SeriesChecked  int64 `json:"seriesChecked"`
+	PointsRepaired int64 `json:"pointsRepaired"`
+	Errors         int64 `json:"errors"`
+	LastRun        int64 `json:"lastRun"`
+	LastCost       int64 `json:"lastCost"` // 单位ms
+}
+
+var (
+	repairStats RepairStats
+	repairLock  sync.RWMutex
+)
+
+func repairEnabled() bool {
+	return Config.Tsdb.Enabled && Config.Tsdb.Replica.Repair.Enabled
+}
+
+// trackSeries 记录写入到多副本node的series
+func trackSeries(node string, item *dataobj.TsdbItem) {
+	pk := item.PrimaryKey()
+	now := time.Now().Unix()
+
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	series, exists := tracker.M[node]
+	if !exists {
+		series = make(map[string]*repairSeries)
+		tracker.M[node] = series
+	}
+
+	s, exists := series[pk]
+	if !exists {
+		s = &repairSeries{Endpoint: item.Endpoint, Metric: item.Metric, Tags: item.Tags}
+		series[pk] = s
+	}
+	s.Step, s.DsType, s.lastSeen = item.Step, item.DsType, now
+}
+
+// snapshot 返回需要检查的series, 同时清理很久没有数据的series
+func (t *seriesTracker) snapshot(since int64) (map[string][]*repairSeries, int) {
+	t.Lock()
+	defer t.Unlock()
+
+	ret := make(map[string][]*repairSeries, len(t.M))
+	total := 0
+	for node, series := range t.M {
+		for pk, s := range series {
+			if s.lastSeen < since {
+				delete(series, pk)
+				continue
+			}
+			tmp := *s
+			ret[node] = append(ret[node], &tmp)
+			total++
+		}
+	}
+	return ret, total
+}
+
+func repairLoop() {
+	cfg := Config.Tsdb.Replica.Repair
+	for {
+		time.Sleep(time.Duration(cfg.Interval) * time.Second)
+		repairOnce(time.Now().Unix())
+	}
+}
+
+func repairOnce(now int64) {
+	cfg := Config.Tsdb.Replica.Repair
+	end := now - int64(cfg.Delay)
+	start := end - int64(cfg.Window)
+	begin := time.Now()
+
+	nodes, total := tracker.snapshot(start)
+
+	var checked, repaired, errCnt int64
+	var wg sync.WaitGroup
+	sema := semaphore.NewSemaphore(cfg.Concurrency)
+	for node, series := range nodes {
+		cnode, exists := Config.Tsdb.ClusterList[node]
+		if !exists || len(cnode.Addrs) < 2 {
+			continue
+		}
+
+		for _, s := range series {
+			sema.Acquire()
+			wg.Add(1)
+			go func(s *repairSeries, addrs []string) {
+				defer func() {
+					sema.Release()
+					wg.Done()
+				}()
+
+				n, err := repairOne(addrs, s, start, end)
+				atomic.AddInt64(&checked, 1)
+				atomic.AddInt64(&repaired, int64(n))
+				if err != nil {
+					atomic.AddInt64(&errCnt, 1)
+					logger.Warningf("repair %s/%s/%s failed: %v", s.Endpoint, s.Metric, s.Tags, err)
+				}
+			}(s, cnode.Addrs)
+		}
+	}
+	wg.Wait()
+
+	cost := time.Since(begin)
+	logger.Infof("repair replicas: %d series checked, %d points repaired, %d errors, cost %v", checked, repaired, errCnt, cost)
+
+	repairLock.Lock()
+	repairStats.Runs++
+	repairStats.SeriesTracked = int64(total)
+	repairStats.SeriesChecked = checked
+	repairStats.PointsRepaired += repaired
+	repairStats.Errors += errCnt
+	repairStats.LastRun = now
+	repairStats.LastCost = int64(cost / time.Millisecond)
+	repairLock.Unlock()
+}
+
+// repairOne 对比一个series在各个副本上[start, end]内的数据, 返回补写的点数.
+// 有副本查询失败时无法判断缺失的点, 等下次再检查
+func repairOne(addrs []string, s *repairSeries, start, end int64) (int, error) {
+	counter := dataobj.PKWithTags(s.Metric, s.Tags)
+	param := GenQParam(start, end, "AVERAGE", s.Endpoint, counter, s.Step)
+
+	replicas := make(map[string]map[int64]float64, len(addrs))
+	for _, addr := range addrs {
+		resp := &dataobj.TsdbQueryResponse{}
+		if err := TsdbConnPools.Call(addr, "Tsdb.Query", param, resp); err != nil {
+			return 0, err
+		}
+
+		// 只有按照series本身的step查询时, 结果才是原始的点
+		if resp.Step != 0 && resp.Step != s.Step {
+			return 0, nil
+		}
+
+		points := make(map[int64]float64)
+		for _, v := range resp.Values {
+			if v != nil && !math.IsNaN(float64(v.Value)) {
+				points[v.Timestamp] = float64(v.Value)
+			}
+		}
+		replicas[addr] = points
+	}
+
+	repaired := 0
+	for _, addr := range addrs {
+		items := []*dataobj.TsdbItem{}
+		for _, other := range addrs {
+			if other == addr {
+				continue
+			}
+
+			for ts, v := range replicas[other] {
+				if _, exists := replicas[addr][ts]; exists {
+					continue
+				}
+				replicas[addr][ts] = v
+
+				items = append(items, &dataobj.TsdbItem{
+					Endpoint:  s.Endpoint,
+					Metric:    s.Metric,
+					Tags:      s.Tags,
+					Value:     v,
+					Timestamp: ts,
+					DsType:    s.DsType,
+					Step:      s.Step,
+				})
+			}
+		}
+
+		if len(items) == 0 {
+			continue
+		}
+
+		resp := &dataobj.SimpleRpcResponse{}
+		if err := TsdbConnPools.Call(addr, "Tsdb.Backfill", items, resp); err != nil {
+			return repaired, err
+		}
+		repaired += len(items)
+	}
+
+	return repaired, nil
+}
+
+func GetRepairStats() RepairStats {
+	repairLock.RLock()
+	defer repairLock.RUnlock()
+
+	stats := repairStats
+	stats.Enabled = repairEnabled()
+	return stats
+}
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/toolkits/pkg/concurrent/semaphore"
@@ -8,6 +9,7 @@ import (
 	"github.com/toolkits/pkg/logger"
 
 	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/cache"
 	. "github.com/open-falcon/falcon-ng/src/modules/transfer/config"
 )
 
@@ -22,21 +24,29 @@ var (
 )
 
 func startSendTasks() {
-	judgeConcurrent := Config.Judge.WorkerNum
-	if judgeConcurrent < 1 {
-		judgeConcurrent = 1
-	}
+	judgeConcurrent := judgeWorkerNum()
 
 	tsdbConcurrent := Config.Tsdb.WorkerNum
 	if tsdbConcurrent < 1 {
 		tsdbConcurrent = 1
 	}
 
+	if Config.Judge.Enabled {
+		for node := range Config.Judge.Cluster {
+			queue := JudgeQueues[node]
+			go Send2JudgeTask(queue, node, judgeConcurrent)
+		}
+	}
+
 	if Config.Tsdb.Enabled {
 		for node, item := range Config.Tsdb.ClusterList {
 			for _, addr := range item.Addrs {
 				queue := TsdbQueues[node+addr]
 				go Send2TsdbTask(queue, node, addr, tsdbConcurrent)
+
+				if spill, exists := TsdbSpills[node+addr]; exists {
+					go spill.Replay(tsdbSender(addr), time.Duration(Config.Tsdb.Spill.RetryInterval)*time.Millisecond)
+				}
 			}
 		}
 	}
@@ -46,20 +56,33 @@ func Send2TsdbTask(Q *list.SafeListLimited, node string, addr string, concurrent
 	batch := Config.Tsdb.Batch // 一次发送,最多batch条数据
 	Q = TsdbQueues[node+addr]
 
+	spill := TsdbSpills[node+addr]
+
 	sema := semaphore.NewSemaphore(concurrent)
 
 	for {
-		items := Q.PopBackBy(batch)
-		count := len(items)
+		var tsdbItems []*dataobj.TsdbItem
+		if spill != nil {
+			items, spilled, err := spill.Pop(Q, batch)
+			if err != nil {
+				logger.Errorf("spill items of tsdb %s:%s fail: %v", node, addr, err)
+			}
+			// 磁盘上还有没重放完的数据, 新数据排在后面, 否则tsdb会把旧数据当做乱序丢弃
+			if spilled {
+				continue
+			}
+			tsdbItems = items
+		} else {
+			tsdbItems = toTsdbItems(Q.PopBackBy(batch))
+		}
 
+		count := len(tsdbItems)
 		if count == 0 {
 			time.Sleep(DefaultSendTaskSleepInterval)
 			continue
 		}
 
-		tsdbItems := make([]*dataobj.TsdbItem, count)
 		for i := 0; i < count; i++ {
-			tsdbItems[i] = items[i].(*dataobj.TsdbItem)
 			logger.Debug("send to tsdb->: ", tsdbItems[i])
 		}
 
@@ -85,14 +108,169 @@ func Send2TsdbTask(Q *list.SafeListLimited, node string, addr string, concurrent
 			if !sendOk {
 				logger.Errorf("send %v to tsdb %s:%s fail: %v", tsdbItems, node, addr, err)
 			} else {
-				logger.Info("send to tsdb %s:%s ok", node, addr)
+				logger.Infof("send to tsdb %s:%s ok", node, addr)
+			}
+
+			// 发送失败的数据放回磁盘队头, 在这之后写入磁盘的数据都比它新
+			if spill != nil {
+				if err := spill.Done(tsdbItems, err); err != nil {
+					logger.Errorf("spill %d items of tsdb %s:%s fail: %v", count, node, addr, err)
+				}
 			}
 		}(addr, tsdbItems, count)
 	}
 }
 
+func toTsdbItems(items []interface{}) []*dataobj.TsdbItem {
+	tsdbItems := make([]*dataobj.TsdbItem, len(items))
+	for i := range items {
+		tsdbItems[i] = items[i].(*dataobj.TsdbItem)
+	}
+	return tsdbItems
+}
+
+func judgeWorkerNum() int {
+	if Config.Judge.WorkerNum < 1 {
+		return 1
+	}
+	return Config.Judge.WorkerNum
+}
+
+// Send2JudgeTask 每次发送前取node当前的地址, 从portal同步时judge的地址可能变化
+func Send2JudgeTask(Q *list.SafeListLimited, node string, concurrent int) {
+	batch := Config.Judge.Batch // 一次发送,最多batch条数据
+	if batch < 1 {
+		batch = 200
+	}
+
+	sema := semaphore.NewSemaphore(concurrent)
+
+	for {
+		items := Q.PopBackBy(batch)
+		count := len(items)
+
+		if count == 0 {
+			time.Sleep(DefaultSendTaskSleepInterval)
+			continue
+		}
+
+		judgeItems := make([]*dataobj.JudgeItem, count)
+		for i := 0; i < count; i++ {
+			judgeItems[i] = items[i].(*dataobj.JudgeItem)
+			logger.Debug("send to judge->: ", judgeItems[i])
+		}
+
+		addr, exists := judgeAddr(node)
+		if !exists {
+			logger.Errorf("send %d items to judge %s fail: no addr", count, node)
+			continue
+		}
+
+		//控制并发
+		sema.Acquire()
+		go func(addr string, judgeItems []*dataobj.JudgeItem, count int) {
+			defer sema.Release()
+
+			resp := &dataobj.SimpleRpcResponse{}
+			var err error
+			sendOk := false
+			for i := 0; i < 3; i++ { //最多重试3次
+				err = JudgeConnPools.Call(addr, "Judge.Send", judgeItems, resp)
+				if err == nil {
+					sendOk = true
+					break
+				}
+				time.Sleep(time.Millisecond * 10)
+			}
+
+			if !sendOk {
+				logger.Errorf("send %d items to judge %s:%s fail: %v", count, node, addr, err)
+			} else {
+				logger.Debugf("send %d items to judge %s:%s ok", count, node, addr)
+			}
+		}(addr, judgeItems, count)
+	}
+}
+
+func tsdbSender(addr string) func(items []*dataobj.TsdbItem) error {
+	return func(items []*dataobj.TsdbItem) error {
+		resp := &dataobj.SimpleRpcResponse{}
+		return TsdbConnPools.Call(addr, "Tsdb.Send", items, resp)
+	}
+}
+
+// 将数据 打入 judge的发送缓存队列, 只推送有策略关联的数据
+// 策略在portal中按照策略id在judge哈希环上分片, 这里用同样的key找到策略所在的judge
+func Push2JudgeSendQueue(items []*dataobj.MetricValue) {
+	errCnt := 0
+	for _, item := range items {
+		sids := cache.StraCache.GetBy(item.Endpoint, item.Metric)
+		if len(sids) == 0 {
+			continue
+		}
+
+		judgeItem := convert2JudgeItem(item)
+
+		nodes := make(map[string]struct{})
+		for _, sid := range sids {
+			node, err := JudgeHashRing.GetNode(strconv.FormatInt(sid, 10))
+			if err != nil {
+				logger.Error("E:", err)
+				continue
+			}
+			nodes[node] = struct{}{}
+		}
+
+		for node := range nodes {
+			Q, exists := judgeQueue(node)
+			if !exists {
+				continue
+			}
+
+			logger.Debug("->push judge queue: ", judgeItem)
+			if !Q.PushFront(judgeItem) {
+				errCnt += 1
+			}
+		}
+	}
+
+	// statistics
+	if errCnt > 0 {
+		logger.Error("Push2JudgeSendQueue err num: ", errCnt)
+	}
+}
+
+func convert2JudgeItem(d *dataobj.MetricValue) *dataobj.JudgeItem {
+	item := &dataobj.JudgeItem{
+		Endpoint:  d.Endpoint,
+		Metric:    d.Metric,
+		Value:     d.Value,
+		Timestamp: d.Timestamp,
+		Tags:      d.Tags,
+		TagsMap:   d.TagsMap,
+		DsType:    d.CounterType,
+		Step:      int(d.Step),
+	}
+
+	if item.Step < MinStep {
+		item.Step = MinStep
+	}
+
+	if item.DsType != dataobj.COUNTER && item.DsType != dataobj.DERIVE {
+		item.DsType = dataobj.GAUGE
+	}
+
+	// 与tsdb中的时间戳保持一致
+	item.Timestamp = alignTs(item.Timestamp, int64(item.Step))
+
+	return item
+}
+
 // 将数据 打入 某个Tsdb的发送缓存队列, 具体是哪一个Tsdb 由一致性哈希 决定
 func Push2TsdbSendQueue(items []*dataobj.MetricValue) {
+	// 内存队列满了的数据, 开启落盘时写入磁盘
+	overflow := make(map[string][]*dataobj.TsdbItem)
+
 	for _, item := range items {
 		tsdbItem, err := convert2TsdbItem(item)
 		if err != nil {
@@ -107,11 +285,24 @@ func Push2TsdbSendQueue(items []*dataobj.MetricValue) {
 		}
 
 		cnode := Config.Tsdb.ClusterList[node]
+		if len(cnode.Addrs) > 1 && repairEnabled() {
+			trackSeries(node, tsdbItem)
+		}
+
 		errCnt := 0
 		for _, addr := range cnode.Addrs {
 			Q := TsdbQueues[node+addr]
 			logger.Debug("->push queue: ", tsdbItem)
+			// 已经溢出的队列, 后面的数据也要排在溢出的数据后面
+			if _, exists := overflow[node+addr]; exists {
+				overflow[node+addr] = append(overflow[node+addr], tsdbItem)
+				continue
+			}
 			if !Q.PushFront(tsdbItem) {
+				if _, exists := TsdbSpills[node+addr]; exists {
+					overflow[node+addr] = append(overflow[node+addr], tsdbItem)
+					continue
+				}
 				errCnt += 1
 			}
 		}
@@ -121,6 +312,12 @@ func Push2TsdbSendQueue(items []*dataobj.MetricValue) {
 			logger.Error("Push2TsdbSendQueue err num: ", errCnt)
 		}
 	}
+
+	for key, tsdbItems := range overflow {
+		if err := TsdbSpills[key].Overflow(TsdbQueues[key], tsdbItems); err != nil {
+			logger.Errorf("spill %d overflow items fail: %v", len(tsdbItems), err)
+		}
+	}
 }
 
 // 打到Tsdb的数据,要根据rrdtool的特定 来限制 step、counterType、timestamp
@@ -0,0 +1,341 @@
+package backend
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/toolkits/pkg/container/list"
+	"github.com/toolkits/pkg/file"
+	"github.com/toolkits/pkg/logger"
+	"github.com/ugorji/go/codec"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	. "github.com/open-falcon/falcon-ng/src/modules/transfer/config"
+)
+
+// SpillQueue 发送失败或者内存队列满了的数据落盘, tsdb恢复后按顺序重放
+// 每个batch一个文件, 文件名是序号: ${dir}/${seq}.batch, 追加到队尾的序号递增, 放回队头的序号递减
+// tsdb会丢弃时间戳不大于最新点的数据, 所以落盘的数据必须和内存队列一起保持先进先出
+type SpillQueue struct {
+	sync.Mutex
+	dir     string
+	maxSize int64 // 单位byte, 超过后新的数据直接丢弃
+
+	seqs    []int64 // 磁盘上的batch, 按发送顺序排列
+	sizes   map[int64]int64
+	size    int64
+	nextSeq int64
+	dropped int64
+
+	// order 保证内存队列出队和落盘的先后顺序, inflight 是从内存队列直接发送还没有返回的batch数
+	order    sync.Mutex
+	inflight int64
+}
+
+type SpillStats struct {
+	Batches int   `json:"batches"`
+	Size    int64 `json:"size"`
+	Dropped int64 `json:"dropped"`
+}
+
+const spillSuffix = ".batch"
+
+var spillHandle = func() *codec.MsgpackHandle {
+	var mh codec.MsgpackHandle
+	mh.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return &mh
+}()
+
+func NewSpillQueue(dir string, maxSize int64) (*SpillQueue, error) {
+	if err := file.EnsureDir(dir); err != nil {
+		return nil, err
+	}
+
+	q := &SpillQueue{
+		dir:     dir,
+		maxSize: maxSize,
+		sizes:   make(map[int64]int64),
+	}
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fi := range fis {
+		name := fi.Name()
+		if fi.IsDir() || !strings.HasSuffix(name, spillSuffix) {
+			// 写了一半的临时文件
+			if strings.HasSuffix(name, ".tmp") {
+				os.Remove(filepath.Join(dir, name))
+			}
+			continue
+		}
+
+		seq, err := strconv.ParseInt(strings.TrimSuffix(name, spillSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		q.seqs = append(q.seqs, seq)
+		q.sizes[seq] = fi.Size()
+		q.size += fi.Size()
+		if seq >= q.nextSeq {
+			q.nextSeq = seq + 1
+		}
+	}
+
+	sort.Slice(q.seqs, func(i, j int) bool { return q.seqs[i] < q.seqs[j] })
+	return q, nil
+}
+
+func (q *SpillQueue) path(seq int64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", seq, spillSuffix))
+}
+
+// Put 把一个batch追加到队尾
+func (q *SpillQueue) Put(items []*dataobj.TsdbItem) error {
+	return q.put(items, false)
+}
+
+// PutFront 把一个batch放回队头, 发送失败的数据比磁盘上的数据更早, 需要先重放
+func (q *SpillQueue) PutFront(items []*dataobj.TsdbItem) error {
+	return q.put(items, true)
+}
+
+func (q *SpillQueue) put(items []*dataobj.TsdbItem, front bool) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	if q.maxSize > 0 && q.size >= q.maxSize {
+		q.dropped += int64(len(items))
+		return fmt.Errorf("spill queue %s is full, size: %d", q.dir, q.size)
+	}
+
+	seq := q.nextSeq
+	if front && len(q.seqs) > 0 {
+		seq = q.seqs[0] - 1
+	}
+	path := q.path(seq)
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	err = codec.NewEncoder(w, spillHandle).Encode(items)
+	if err == nil {
+		err = w.Flush()
+	}
+	f.Close()
+
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if seq == q.nextSeq {
+		q.nextSeq++
+		q.seqs = append(q.seqs, seq)
+	} else {
+		q.seqs = append([]int64{seq}, q.seqs...)
+	}
+	q.sizes[seq] = fi.Size()
+	q.size += fi.Size()
+	return nil
+}
+
+// Peek 读取队头的batch, 不会删除
+func (q *SpillQueue) Peek() (int64, []*dataobj.TsdbItem, error) {
+	q.Lock()
+	if len(q.seqs) == 0 {
+		q.Unlock()
+		return 0, nil, nil
+	}
+	seq := q.seqs[0]
+	q.Unlock()
+
+	f, err := os.Open(q.path(seq))
+	if err != nil {
+		return seq, nil, err
+	}
+	defer f.Close()
+
+	var items []*dataobj.TsdbItem
+	err = codec.NewDecoder(bufio.NewReader(f), spillHandle).Decode(&items)
+	return seq, items, err
+}
+
+// Remove 删除已经发送成功(或者已经损坏)的batch
+func (q *SpillQueue) Remove(seq int64) {
+	q.Lock()
+	defer q.Unlock()
+
+	if len(q.seqs) == 0 || q.seqs[0] != seq {
+		return
+	}
+
+	if err := os.Remove(q.path(seq)); err != nil && !os.IsNotExist(err) {
+		logger.Errorf("remove spill batch %s failed: %v", q.path(seq), err)
+	}
+
+	q.seqs = q.seqs[1:]
+	q.size -= q.sizes[seq]
+	delete(q.sizes, seq)
+}
+
+// Overflow 内存队列满了, 先把内存队列中更早的数据落盘, 再落盘溢出的数据, 之后的数据都经过磁盘按顺序发送
+func (q *SpillQueue) Overflow(Q *list.SafeListLimited, items []*dataobj.TsdbItem) error {
+	q.order.Lock()
+	defer q.order.Unlock()
+
+	if err := q.Put(toTsdbItems(Q.PopBackBy(Q.Len()))); err != nil {
+		return err
+	}
+	return q.Put(items)
+}
+
+// Pop 从内存队列取出最早的一批数据, 磁盘上还有没重放完的数据时追加到磁盘队尾, spilled为true
+// 否则返回的数据需要直接发送, 发送结束后调用Done
+func (q *SpillQueue) Pop(Q *list.SafeListLimited, batch int) (items []*dataobj.TsdbItem, spilled bool, err error) {
+	q.order.Lock()
+	defer q.order.Unlock()
+
+	items = toTsdbItems(Q.PopBackBy(batch))
+	if len(items) == 0 {
+		return nil, false, nil
+	}
+
+	if q.Len() > 0 {
+		return nil, true, q.Put(items)
+	}
+
+	atomic.AddInt64(&q.inflight, 1)
+	return items, false, nil
+}
+
+// Done 直接发送的batch结束, 发送失败的数据放回队头
+func (q *SpillQueue) Done(items []*dataobj.TsdbItem, err error) error {
+	defer atomic.AddInt64(&q.inflight, -1)
+
+	if err == nil {
+		return nil
+	}
+	return q.PutFront(items)
+}
+
+func (q *SpillQueue) Len() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.seqs)
+}
+
+func (q *SpillQueue) Stats() SpillStats {
+	q.Lock()
+	defer q.Unlock()
+
+	return SpillStats{
+		Batches: len(q.seqs),
+		Size:    q.size,
+		Dropped: q.dropped,
+	}
+}
+
+// Replay 按顺序把落盘的数据重新发送, 发送失败时等待interval之后重试, 保证不会乱序
+func (q *SpillQueue) Replay(send func(items []*dataobj.TsdbItem) error, interval time.Duration) {
+	for {
+		// 直接发送的数据更早, 等发送结束, 失败的数据会放回队头
+		if atomic.LoadInt64(&q.inflight) > 0 {
+			time.Sleep(DefaultSendTaskSleepInterval)
+			continue
+		}
+
+		seq, items, err := q.Peek()
+		if err != nil {
+			if os.IsNotExist(err) {
+				q.Remove(seq)
+				continue
+			}
+			logger.Errorf("read spill batch %s failed, skip it: %v", q.path(seq), err)
+			q.Remove(seq)
+			continue
+		}
+
+		if items == nil {
+			time.Sleep(DefaultSendTaskSleepInterval)
+			continue
+		}
+
+		if err = send(items); err != nil {
+			logger.Warningf("replay spill batch %s failed: %v", q.path(seq), err)
+			time.Sleep(interval)
+			continue
+		}
+
+		q.Remove(seq)
+		logger.Debugf("replay spill batch %s ok, %d items", q.path(seq), len(items))
+	}
+}
+
+type QueueStat struct {
+	Type  string      `json:"type"` // tsdb|judge
+	Node  string      `json:"node"`
+	Addr  string      `json:"addr"`
+	Depth int         `json:"depth"` // 内存队列中等待发送的点数
+	Spill *SpillStats `json:"spill,omitempty"`
+}
+
+// GetQueueStats 返回所有发送队列的堆积情况
+func GetQueueStats() []QueueStat {
+	stats := []QueueStat{}
+	JudgeQueuesLock.RLock()
+	for node, addr := range JudgeAddrs {
+		if Q, exists := JudgeQueues[node]; exists {
+			stats = append(stats, QueueStat{Type: "judge", Node: node, Addr: addr, Depth: Q.Len()})
+		}
+	}
+	JudgeQueuesLock.RUnlock()
+
+	for node, item := range Config.Tsdb.ClusterList {
+		for _, addr := range item.Addrs {
+			Q, exists := TsdbQueues[node+addr]
+			if !exists {
+				continue
+			}
+
+			stat := QueueStat{Type: "tsdb", Node: node, Addr: addr, Depth: Q.Len()}
+			if spill, exists := TsdbSpills[node+addr]; exists {
+				s := spill.Stats()
+				stat.Spill = &s
+			}
+			stats = append(stats, stat)
+		}
+	}
+
+	return stats
+}
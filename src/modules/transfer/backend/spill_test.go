@@ -0,0 +1,154 @@
+package backend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/toolkits/pkg/container/list"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+func Test_SpillQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := NewSpillQueue(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		items := []*dataobj.TsdbItem{{Endpoint: "host1", Metric: "cpu.idle", Value: float64(i), Timestamp: int64(i)}}
+		if err := q.Put(items); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 重新打开, 验证数据可以从磁盘恢复, 并且保持写入顺序
+	q, err = NewSpillQueue(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if q.Len() != 3 {
+		t.Fatalf("got %d batches, expect 3", q.Len())
+	}
+
+	for i := 0; i < 3; i++ {
+		seq, items, err := q.Peek()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(items) != 1 || items[0].Value != float64(i) || items[0].Endpoint != "host1" {
+			t.Fatalf("batch %d: got %v", i, items)
+		}
+		q.Remove(seq)
+	}
+
+	if stats := q.Stats(); stats.Batches != 0 || stats.Size != 0 {
+		t.Fatalf("stats after remove: %+v", stats)
+	}
+
+	// 超过容量之后丢弃新的数据
+	q.maxSize = 1
+	q.Put([]*dataobj.TsdbItem{{Endpoint: "host1"}})
+	if err := q.Put([]*dataobj.TsdbItem{{Endpoint: "host1"}}); err == nil || q.Stats().Dropped != 1 {
+		t.Fatalf("expect queue full, stats: %+v", q.Stats())
+	}
+}
+
+// tsdb故障期间内存队列写满, 重放的顺序和写入的顺序一致
+func Test_SpillOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := NewSpillQueue(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Q := list.NewSafeListLimited(4)
+	var ts int64
+	push := func(n int) {
+		var overflow []*dataobj.TsdbItem
+		for i := 0; i < n; i++ {
+			ts++
+			item := &dataobj.TsdbItem{Endpoint: "host1", Metric: "cpu.idle", Timestamp: ts}
+			if len(overflow) > 0 || !Q.PushFront(item) {
+				overflow = append(overflow, item)
+			}
+		}
+		if len(overflow) > 0 {
+			if err := q.Overflow(Q, overflow); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// 1-2 直接发送, 还没有返回
+	push(4)
+	inflight, spilled, err := q.Pop(Q, 2)
+	if err != nil || spilled || len(inflight) != 2 || inflight[0].Timestamp != 1 {
+		t.Fatalf("pop: %v, %v, %v", inflight, spilled, err)
+	}
+
+	// 队列满了, 内存队列中的 3-6 先于溢出的 7-9 落盘
+	push(5)
+	if Q.Len() != 0 || q.Len() != 2 {
+		t.Fatalf("memory queue: %d, spill: %d", Q.Len(), q.Len())
+	}
+
+	// 磁盘上有数据, 新的数据也经过磁盘
+	push(2)
+	if items, spilled, err := q.Pop(Q, 2); err != nil || !spilled || items != nil {
+		t.Fatalf("pop: %v, %v, %v", items, spilled, err)
+	}
+
+	// 直接发送的 1-2 失败了, 放回队头
+	if err := q.Done(inflight, fmt.Errorf("connection refused")); err != nil {
+		t.Fatal(err)
+	}
+
+	// tsdb恢复
+	var got []int64
+	for q.Len() > 0 {
+		seq, items, err := q.Peek()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range items {
+			got = append(got, item.Timestamp)
+		}
+		q.Remove(seq)
+	}
+
+	for i, ts := range got {
+		if ts != int64(i+1) {
+			t.Fatalf("replay out of order: %v", got)
+		}
+	}
+	if len(got) != 11 {
+		t.Fatalf("got %d items, expect 11: %v", len(got), got)
+	}
+
+	// 重启之后放回队头的数据还是在最前面
+	q.Put([]*dataobj.TsdbItem{{Timestamp: 2}})
+	q.PutFront([]*dataobj.TsdbItem{{Timestamp: 1}})
+	q, err = NewSpillQueue(dir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, items, err := q.Peek(); err != nil || len(items) != 1 || items[0].Timestamp != 1 {
+		t.Fatalf("peek after reopen: %v, %v", items, err)
+	}
+}
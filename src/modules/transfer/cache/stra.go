@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"sync"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+// StraCacheMap 用于判断数据需要推送给哪些judge
+// key: endpoint/metric
+// value: 关联的策略id
+type StraCacheMap struct {
+	sync.RWMutex
+	Data map[string][]int64
+}
+
+var StraCache = NewStraCache()
+
+func NewStraCache() *StraCacheMap {
+	return &StraCacheMap{
+		Data: make(map[string][]int64),
+	}
+}
+
+func (this *StraCacheMap) SetAll(m map[string][]int64) {
+	this.Lock()
+	defer this.Unlock()
+	this.Data = m
+}
+
+func (this *StraCacheMap) GetBy(endpoint, metric string) []int64 {
+	this.RLock()
+	defer this.RUnlock()
+
+	return this.Data[dataobj.PKWithCounter(endpoint, metric)]
+}
@@ -17,11 +17,78 @@ type ConfYaml struct {
 	Judge   JudgeSection  `yaml:"judge"`
 	Tsdb    TsdbSection   `yaml:"tsdb"`
 	Index   IndexSection  `yaml:"index"`
+	API     APISection    `yaml:"api"`
+
+	Prometheus PrometheusSection `yaml:"prometheus"`
+	Receiver   ReceiverSection   `yaml:"receiver"`
+	Cache      CacheSection      `yaml:"cache"`
+}
+
+// /api/transfer/data/ui 查询结果的缓存
+type CacheSection struct {
+	Enabled bool  `yaml:"enabled"`
+	Bucket  int64 `yaml:"bucket"`  // 查询的start向下, end向上按bucket对齐, 同时也是缓存的有效期, 单位秒
+	MaxSize int64 `yaml:"maxSize"` // 缓存占用内存的上限, 单位MB
+}
+
+// 兼容opentsdb/graphite协议的数据接收端口
+type ReceiverSection struct {
+	OpenTSDB OpenTSDBSection `yaml:"opentsdb"`
+	Graphite GraphiteSection `yaml:"graphite"`
+}
+
+type OpenTSDBSection struct {
+	Enabled      bool     `yaml:"enabled"`
+	TCP          string   `yaml:"tcp"` // 为空时不监听
+	UDP          string   `yaml:"udp"`
+	Step         int64    `yaml:"step"`
+	EndpointTags []string `yaml:"endpointTags"` // 依次查找作为endpoint的tag
+}
+
+type GraphiteSection struct {
+	Enabled         bool           `yaml:"enabled"`
+	TCP             string         `yaml:"tcp"`
+	UDP             string         `yaml:"udp"`
+	Step            int64          `yaml:"step"`
+	Rules           []GraphiteRule `yaml:"rules"`
+	DefaultTemplate string         `yaml:"defaultTemplate"` // 没有匹配的规则时使用
+}
+
+// GraphiteRule path匹配filter时, 按照template把path拆分为endpoint, metric和tags
+type GraphiteRule struct {
+	Filter   string `yaml:"filter"`
+	Template string `yaml:"template"`
+}
+
+// prometheus remote write
+type PrometheusSection struct {
+	EndpointLabels []string `yaml:"endpointLabels"`
+	StripPort      bool     `yaml:"stripPort"`
+	Step           int64    `yaml:"step"`
+}
+
+type APISection struct {
+	Portal ServerSection `yaml:"portal"`
+}
+
+type ServerSection struct {
+	Server []string `yaml:"server"`
 }
 
 type IndexSection struct {
-	Addrs   []string `yaml:"addrs"`
-	Timeout int      `yaml:"timeout"`
+	Addrs   []string            `yaml:"addrs"`
+	Timeout int                 `yaml:"timeout"`
+	Publish IndexPublishSection `yaml:"publish"`
+}
+
+// 把收到的series通过nsq发布给index
+type IndexPublishSection struct {
+	Enabled      bool     `yaml:"enabled"`
+	Nsqds        []string `yaml:"nsqds"` // nsqd的tcp地址
+	FullTopic    string   `yaml:"fullTopic"`
+	IncrTopic    string   `yaml:"incrTopic"`
+	Batch        int      `yaml:"batch"`
+	FullInterval int      `yaml:"fullInterval"` // 全量发布的周期, 单位s, 要小于index的缓存时间
 }
 
 type LoggerSection struct {
@@ -52,6 +119,7 @@ type JudgeSection struct {
 	MaxIdle     int               `yaml:"maxIdle"`
 	Replicas    int               `yaml:"replicas"`
 	Cluster     map[string]string `yaml:"cluster"`
+	FromPortal  bool              `yaml:"fromPortal"` // 从portal同步judge列表, 与portal分配策略使用同一个哈希环
 }
 
 type TsdbSection struct {
@@ -65,6 +133,31 @@ type TsdbSection struct {
 	Replicas    int                     `yaml:"replicas"`
 	Cluster     map[string]string       `yaml:"cluster"`
 	ClusterList map[string]*ClusterNode `json:"clusterList"`
+	Spill       SpillSection            `yaml:"spill"`
+	Replica     ReplicaSection          `yaml:"replica"`
+}
+
+// 一个node配置了多个地址时, 每个地址是一个副本
+type ReplicaSection struct {
+	ReadQuorum int           `yaml:"readQuorum"` // 查询时等待多少个副本返回并合并结果
+	Repair     RepairSection `yaml:"repair"`
+}
+
+// 定期对比副本的数据, 把缺失的点补写到副本上
+type RepairSection struct {
+	Enabled     bool `yaml:"enabled"`
+	Interval    int  `yaml:"interval"`    // 单位秒
+	Window      int  `yaml:"window"`      // 每次检查最近多长时间的数据, 单位秒
+	Delay       int  `yaml:"delay"`       // 最近的数据可能还在发送队列中, 不做检查, 单位秒
+	Concurrency int  `yaml:"concurrency"` // 同时检查的series数
+}
+
+// 发送失败的数据落盘, tsdb恢复后重放
+type SpillSection struct {
+	Enabled       bool   `yaml:"enabled"`
+	Dir           string `yaml:"dir"`
+	MaxSize       int64  `yaml:"maxSize"`       // 每个tsdb实例最多落盘的数据, 单位MB, 0表示不限制
+	RetryInterval int    `yaml:"retryInterval"` // 重放失败后的等待时间, 单位ms
 }
 
 var (
@@ -110,6 +203,70 @@ func Parse(conf string) error {
 	}
 	c.Tsdb.ClusterList = formatClusterItems(c.Tsdb.Cluster)
 
+	if len(c.Prometheus.EndpointLabels) == 0 {
+		c.Prometheus.EndpointLabels = []string{"endpoint", "instance"}
+	}
+
+	if len(c.Receiver.OpenTSDB.EndpointTags) == 0 {
+		c.Receiver.OpenTSDB.EndpointTags = []string{"endpoint", "host"}
+	}
+
+	if c.Receiver.Graphite.DefaultTemplate == "" {
+		c.Receiver.Graphite.DefaultTemplate = "endpoint.metric*"
+	}
+
+	if c.Tsdb.Replica.ReadQuorum <= 0 {
+		c.Tsdb.Replica.ReadQuorum = 1
+	}
+
+	if c.Tsdb.Replica.Repair.Interval <= 0 {
+		c.Tsdb.Replica.Repair.Interval = 600
+	}
+
+	if c.Tsdb.Replica.Repair.Window <= 0 {
+		c.Tsdb.Replica.Repair.Window = 3600
+	}
+
+	if c.Tsdb.Replica.Repair.Delay <= 0 {
+		c.Tsdb.Replica.Repair.Delay = 120
+	}
+
+	if c.Tsdb.Replica.Repair.Concurrency <= 0 {
+		c.Tsdb.Replica.Repair.Concurrency = 10
+	}
+
+	if c.Index.Publish.FullTopic == "" {
+		c.Index.Publish.FullTopic = "full_index"
+	}
+
+	if c.Index.Publish.IncrTopic == "" {
+		c.Index.Publish.IncrTopic = "incr_index"
+	}
+
+	if c.Index.Publish.Batch <= 0 {
+		c.Index.Publish.Batch = 200
+	}
+
+	if c.Index.Publish.FullInterval <= 0 {
+		c.Index.Publish.FullInterval = 3600
+	}
+
+	if c.Cache.Bucket <= 0 {
+		c.Cache.Bucket = 30
+	}
+
+	if c.Cache.MaxSize <= 0 {
+		c.Cache.MaxSize = 256
+	}
+
+	if c.Tsdb.Spill.Dir == "" {
+		c.Tsdb.Spill.Dir = "./data/spill"
+	}
+
+	if c.Tsdb.Spill.RetryInterval <= 0 {
+		c.Tsdb.Spill.RetryInterval = 1000
+	}
+
 	lock.Lock()
 	defer lock.Unlock()
 	Config = &c
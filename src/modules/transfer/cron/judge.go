@@ -0,0 +1,101 @@
+package cron
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/toolkits/pkg/logger"
+
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/backend"
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/config"
+)
+
+const judgeSyncInterval = 10
+
+type judgeMember struct {
+	Ident string `json:"ident"`
+	Node  string `json:"node"` // 在portal哈希环上的节点名
+	Rpc   string `json:"rpc"`
+	Alive bool   `json:"alive"`
+}
+
+type judgeMemberResp struct {
+	Dat []judgeMember `json:"dat"`
+	Err string        `json:"err"`
+}
+
+func SyncJudgeLoop() {
+	for {
+		SyncJudge()
+		time.Sleep(time.Second * time.Duration(judgeSyncInterval))
+	}
+}
+
+// SyncJudge 从portal同步存活的judge, 节点名和portal分配策略时一致
+// 配置文件中的judge(没有上报过心跳)没有rpc地址, 使用judge.cluster中同名节点的地址
+func SyncJudge() error {
+	client := http.Client{
+		Timeout: time.Second * 10,
+	}
+
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	servers := config.Config.API.Portal.Server
+	for i := range servers {
+		url := servers[i]
+		if !(strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")) {
+			url = "http://" + url
+		}
+
+		url = fmt.Sprintf("%s/api/portal/judges", url)
+		resp, err := client.Get(url)
+		if err != nil {
+			logger.Errorf("sync judge failed, url: %s, err: %v", url, err)
+			continue
+		}
+
+		response, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			logger.Errorf("read response body failed, err: %v", err)
+			continue
+		}
+
+		var dat judgeMemberResp
+		if err = json.Unmarshal(response, &dat); err != nil {
+			logger.Errorf("unmarshal response failed, response: %s, err: %v", string(response), err)
+			continue
+		}
+
+		if dat.Err != "" {
+			logger.Errorf("response err: %s", dat.Err)
+			continue
+		}
+
+		backend.UpdateJudgeNodes(judgeNodes(dat.Dat))
+		return nil
+	}
+
+	return fmt.Errorf("sync judge failed from all portal servers: %v", servers)
+}
+
+// judgeNodes 返回存活的judge, node -> rpc地址
+func judgeNodes(members []judgeMember) map[string]string {
+	nodes := make(map[string]string)
+	for _, m := range members {
+		if !m.Alive || m.Node == "" {
+			continue
+		}
+
+		addr := m.Rpc
+		if addr == "" {
+			addr = config.Config.Judge.Cluster[m.Node]
+		}
+		nodes[m.Node] = addr
+	}
+	return nodes
+}
@@ -0,0 +1,107 @@
+package cron
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/json-iterator/go"
+	"github.com/toolkits/pkg/logger"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/modules/judge/schema/expression"
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/cache"
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/config"
+)
+
+const straSyncInterval = 60
+
+func SyncStraLoop() {
+	for {
+		SyncStra()
+		time.Sleep(time.Second * time.Duration(straSyncInterval))
+	}
+}
+
+// SyncStra 从portal同步所有生效的策略, 建立 endpoint/metric -> 策略id 的索引
+func SyncStra() error {
+	client := http.Client{
+		Timeout: time.Second * 10,
+	}
+
+	var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+	servers := config.Config.API.Portal.Server
+	for i := range servers {
+		url := servers[i]
+		if !(strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")) {
+			url = "http://" + url
+		}
+
+		url = fmt.Sprintf("%s/api/portal/stras/effective/all", url)
+		resp, err := client.Get(url)
+		if err != nil {
+			logger.Errorf("sync stra failed, url: %s, err: %v", url, err)
+			continue
+		}
+
+		response, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			logger.Errorf("read response body failed, err: %v", err)
+			continue
+		}
+
+		var dat dataobj.StraData
+		if err = json.Unmarshal(response, &dat); err != nil {
+			logger.Errorf("unmarshal response failed, response: %s, err: %v", string(response), err)
+			continue
+		}
+
+		if dat.Err != "" {
+			logger.Errorf("response err: %s", dat.Err)
+			continue
+		}
+
+		straMap := buildStraMap(dat.Dat)
+		cache.StraCache.SetAll(straMap)
+		logger.Infof("sync stra succ, stra count: %d, series key count: %d", len(dat.Dat), len(straMap))
+		return nil
+	}
+
+	return fmt.Errorf("sync stra failed from all portal servers: %v", servers)
+}
+
+// buildStraMap 按策略关联的指标建立索引, 多指标运算的策略用表达式中的每个指标建立索引
+// 运算结果的指标名不会上报, judge需要收到参与运算的指标才能计算
+func buildStraMap(stras []dataobj.Stra) map[string][]int64 {
+	straMap := make(map[string][]int64)
+	for i := 0; i < len(stras); i++ {
+		stra := stras[i]
+		for _, exp := range stra.Exprs {
+			metrics := expMetrics(exp)
+			for _, endpoint := range stra.Endpoints {
+				for _, metric := range metrics {
+					key := dataobj.PKWithCounter(endpoint, metric)
+					straMap[key] = append(straMap[key], stra.ID)
+				}
+			}
+		}
+	}
+	return straMap
+}
+
+func expMetrics(exp dataobj.Exp) []string {
+	if exp.Expression == "" {
+		return []string{exp.Metric}
+	}
+
+	e, err := expression.Parse(exp.Expression)
+	if err != nil {
+		logger.Warningf("parse expression %s failed: %v", exp.Expression, err)
+		return []string{exp.Metric}
+	}
+	return e.Metrics()
+}
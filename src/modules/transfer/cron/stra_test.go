@@ -0,0 +1,54 @@
+package cron
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+func Test_BuildStraMap(t *testing.T) {
+	stras := []dataobj.Stra{
+		{
+			ID:        1,
+			Endpoints: []string{"host1", "host2"},
+			Exprs:     []dataobj.Exp{{Metric: "cpu.idle"}},
+		},
+		{
+			ID:        2,
+			Endpoints: []string{"host1"},
+			Exprs:     []dataobj.Exp{{Metric: "error.rate", Expression: "errors / requests * 100"}},
+		},
+		{
+			// 表达式不合法的按指标名索引
+			ID:        3,
+			Endpoints: []string{"host1"},
+			Exprs:     []dataobj.Exp{{Metric: "mem.used", Expression: "mem.used +"}},
+		},
+	}
+
+	straMap := buildStraMap(stras)
+
+	cases := []struct {
+		endpoint string
+		metric   string
+		sids     []int64
+	}{
+		{"host1", "cpu.idle", []int64{1}},
+		{"host2", "cpu.idle", []int64{1}},
+		{"host1", "errors", []int64{2}},
+		{"host1", "requests", []int64{2}},
+		{"host1", "error.rate", nil},
+		{"host2", "errors", nil},
+		{"host1", "mem.used", []int64{3}},
+	}
+
+	for _, c := range cases {
+		sids := straMap[dataobj.PKWithCounter(c.endpoint, c.metric)]
+		sort.Slice(sids, func(i, j int) bool { return sids[i] < sids[j] })
+		if !reflect.DeepEqual(sids, c.sids) {
+			t.Fatalf("%s/%s: got %v, want %v", c.endpoint, c.metric, sids, c.sids)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+const (
+	defaultMaxPoints = 720   // 不指定step时, 结果最多的点数
+	maxPoints        = 11000 // 单条曲线最多的点数
+	minStep          = 10
+)
+
+// Fetcher 查询曲线的原始数据, tagkv为空时只查询不带tag的counter
+// step为0时使用曲线本身的周期
+type Fetcher func(endpoints []string, metric string, tagkv map[string][]string,
+	start, end int64, step int) ([]*dataobj.TsdbQueryResponse, error)
+
+type Evaluator struct {
+	Start     int64
+	End       int64
+	Step      int64
+	Endpoints []string // 表达式中没有指定endpoint时使用
+	Fetch     Fetcher
+
+	grid []int64
+}
+
+// series 对齐到统一时间轴上的曲线, 缺失的点是NaN
+type series struct {
+	metric string
+	labels map[string]string // 包括endpoint
+	dstype string
+	values []float64
+}
+
+// value 表达式的计算结果, 标量或者一组曲线
+type value struct {
+	scalar   float64
+	isScalar bool
+	vector   []*series
+}
+
+// Query 计算表达式, 结果的每条曲线都对齐到 [start, end] 内step的整数倍的时间点上
+func (e *Evaluator) Query(input string) ([]*dataobj.TsdbQueryResponse, error) {
+	node, err := Parse(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = e.init(); err != nil {
+		return nil, err
+	}
+
+	v, err := e.eval(node)
+	if err != nil {
+		return nil, err
+	}
+
+	if v.isScalar {
+		values := make([]float64, len(e.grid))
+		for i := range values {
+			values[i] = v.scalar
+		}
+		v.vector = []*series{{labels: map[string]string{}, values: values}}
+	}
+
+	resp := make([]*dataobj.TsdbQueryResponse, 0, len(v.vector))
+	for _, s := range v.vector {
+		resp = append(resp, e.toResponse(s, input))
+	}
+	return resp, nil
+}
+
+func (e *Evaluator) init() error {
+	if e.Start >= e.End {
+		return fmt.Errorf("start(%d) must be before end(%d)", e.Start, e.End)
+	}
+
+	if e.Step <= 0 {
+		e.Step = (e.End - e.Start + defaultMaxPoints - 1) / defaultMaxPoints
+		if r := e.Step % minStep; r != 0 {
+			e.Step += minStep - r
+		}
+		if e.Step < minStep {
+			e.Step = minStep
+		}
+	}
+
+	first := e.Start
+	if r := first % e.Step; r != 0 {
+		first += e.Step - r
+	}
+
+	if (e.End-first)/e.Step+1 > maxPoints {
+		return fmt.Errorf("too many points, use a larger step")
+	}
+
+	e.grid = []int64{}
+	for ts := first; ts <= e.End; ts += e.Step {
+		e.grid = append(e.grid, ts)
+	}
+
+	if len(e.grid) == 0 {
+		return fmt.Errorf("no point between start and end with step %d", e.Step)
+	}
+	return nil
+}
+
+func (e *Evaluator) toResponse(s *series, input string) *dataobj.TsdbQueryResponse {
+	tags := make(map[string]string, len(s.labels))
+	for k, v := range s.labels {
+		if k != "endpoint" {
+			tags[k] = v
+		}
+	}
+
+	counter := dataobj.SortedTags(tags)
+	if s.metric != "" {
+		counter = dataobj.PKWithTags(s.metric, counter)
+	}
+	if counter == "" && s.labels["endpoint"] == "" {
+		counter = input
+	}
+
+	dstype := s.dstype
+	if dstype == "" {
+		dstype = dataobj.GAUGE
+	}
+
+	values := make([]*dataobj.RRDData, len(e.grid))
+	for i, ts := range e.grid {
+		values[i] = dataobj.NewRRDData(ts, s.values[i])
+	}
+
+	return &dataobj.TsdbQueryResponse{
+		Start:    e.Start,
+		End:      e.End,
+		Endpoint: s.labels["endpoint"],
+		Counter:  counter,
+		DsType:   dstype,
+		Step:     int(e.Step),
+		Values:   values,
+	}
+}
+
+func (e *Evaluator) eval(node Node) (*value, error) {
+	switch n := node.(type) {
+	case *NumberLiteral:
+		return &value{scalar: n.Val, isScalar: true}, nil
+
+	case *Selector:
+		if n.Range > 0 {
+			return nil, fmt.Errorf("range selector %s[%ds] must be used in functions", n.Metric, n.Range)
+		}
+		return e.evalSelector(n)
+
+	case *Call:
+		return e.evalCall(n)
+
+	case *Aggregate:
+		return e.evalAggregate(n)
+
+	case *BinaryExpr:
+		return e.evalBinary(n)
+	}
+
+	return nil, fmt.Errorf("unknown node %T", node)
+}
+
+// rawSeries 从tsdb查询到的原始点, 按时间排序, 不包含NaN
+type rawSeries struct {
+	metric string
+	labels map[string]string
+	dstype string
+	step   int64
+	points []*dataobj.RRDData
+}
+
+func (e *Evaluator) fetch(sel *Selector, lookback int64, step int) ([]*rawSeries, error) {
+	endpoints := sel.Matchers["endpoint"]
+	if len(endpoints) == 0 {
+		endpoints = e.Endpoints
+	}
+
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no endpoint for %s", sel.Metric)
+	}
+
+	tagkv := make(map[string][]string)
+	for k, v := range sel.Matchers {
+		if k != "endpoint" {
+			tagkv[k] = v
+		}
+	}
+
+	resps, err := e.Fetch(endpoints, sel.Metric, tagkv, e.grid[0]-lookback, e.grid[len(e.grid)-1], step)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*rawSeries{}
+	for _, resp := range resps {
+		if resp == nil {
+			continue
+		}
+
+		rs := &rawSeries{
+			metric: sel.Metric,
+			labels: map[string]string{"endpoint": resp.Endpoint},
+			dstype: resp.DsType,
+			step:   int64(resp.Step),
+		}
+
+		if tags := strings.TrimPrefix(resp.Counter, sel.Metric); strings.HasPrefix(tags, "/") {
+			tagMap, err := dataobj.SplitTagsString(tags[1:])
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range tagMap {
+				rs.labels[k] = v
+			}
+		}
+
+		for _, p := range resp.Values {
+			if p == nil || math.IsNaN(float64(p.Value)) {
+				continue
+			}
+			rs.points = append(rs.points, p)
+		}
+
+		// 查询不存在的曲线时会返回全是NaN的点
+		if len(rs.points) == 0 {
+			continue
+		}
+
+		sort.Sort(dataobj.RRDValues(rs.points))
+		ret = append(ret, rs)
+	}
+
+	return ret, nil
+}
+
+// evalSelector 每个时间点取 (ts-lookback, ts] 内最新的点
+func (e *Evaluator) evalSelector(sel *Selector) (*value, error) {
+	raws, err := e.fetch(sel, e.Step, int(e.Step))
+	if err != nil {
+		return nil, err
+	}
+
+	vector := make([]*series, 0, len(raws))
+	for _, rs := range raws {
+		lookback := e.Step
+		if rs.step > lookback {
+			lookback = rs.step
+		}
+
+		s := e.newSeries(rs.metric, rs.labels, rs.dstype)
+		j := 0
+		for i, ts := range e.grid {
+			for j < len(rs.points) && rs.points[j].Timestamp <= ts {
+				j++
+			}
+			if j > 0 && rs.points[j-1].Timestamp > ts-lookback {
+				s.values[i] = float64(rs.points[j-1].Value)
+			}
+		}
+		vector = append(vector, s)
+	}
+
+	return &value{vector: vector}, nil
+}
+
+func (e *Evaluator) newSeries(metric string, labels map[string]string, dstype string) *series {
+	values := make([]float64, len(e.grid))
+	for i := range values {
+		values[i] = math.NaN()
+	}
+	return &series{metric: metric, labels: labels, dstype: dstype, values: values}
+}
+
+func (e *Evaluator) evalBinary(n *BinaryExpr) (*value, error) {
+	lhs, err := e.eval(n.LHS)
+	if err != nil {
+		return nil, err
+	}
+
+	rhs, err := e.eval(n.RHS)
+	if err != nil {
+		return nil, err
+	}
+
+	op := func(a, b float64) float64 {
+		switch n.Op {
+		case tokAdd:
+			return a + b
+		case tokSub:
+			return a - b
+		case tokMul:
+			return a * b
+		default:
+			return a / b
+		}
+	}
+
+	if lhs.isScalar && rhs.isScalar {
+		return &value{scalar: op(lhs.scalar, rhs.scalar), isScalar: true}, nil
+	}
+
+	if lhs.isScalar || rhs.isScalar {
+		vector := rhs.vector
+		if rhs.isScalar {
+			vector = lhs.vector
+		}
+
+		ret := make([]*series, 0, len(vector))
+		for _, s := range vector {
+			r := e.newSeries("", s.labels, "")
+			for i, v := range s.values {
+				if lhs.isScalar {
+					r.values[i] = op(lhs.scalar, v)
+				} else {
+					r.values[i] = op(v, rhs.scalar)
+				}
+			}
+			ret = append(ret, r)
+		}
+		return &value{vector: ret}, nil
+	}
+
+	return &value{vector: e.matchVectors(lhs.vector, rhs.vector, op)}, nil
+}
+
+// matchVectors 两组曲线之间的运算: 一边只有一条曲线时和另一边的每一条计算,
+// 否则按照标签(endpoint和tags)完全相同的曲线一一对应, 没有对应的曲线被丢弃
+func (e *Evaluator) matchVectors(lhs, rhs []*series, op func(a, b float64) float64) []*series {
+	ret := []*series{}
+
+	calc := func(l, r *series, labels map[string]string) {
+		s := e.newSeries("", labels, "")
+		for i := range s.values {
+			s.values[i] = op(l.values[i], r.values[i])
+		}
+		ret = append(ret, s)
+	}
+
+	if len(rhs) == 1 {
+		for _, l := range lhs {
+			calc(l, rhs[0], l.labels)
+		}
+		return ret
+	}
+
+	if len(lhs) == 1 {
+		for _, r := range rhs {
+			calc(lhs[0], r, r.labels)
+		}
+		return ret
+	}
+
+	index := make(map[string]*series, len(rhs))
+	for _, r := range rhs {
+		index[signature(r.labels)] = r
+	}
+
+	for _, l := range lhs {
+		if r, exists := index[signature(l.labels)]; exists {
+			calc(l, r, l.labels)
+		}
+	}
+	return ret
+}
+
+func signature(labels map[string]string) string {
+	return dataobj.SortedTags(labels)
+}
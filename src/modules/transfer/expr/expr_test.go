@@ -0,0 +1,159 @@
+package expr
+
+import (
+	"math"
+	"testing"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+type fakeSeries struct {
+	endpoint string
+	metric   string
+	tags     map[string]string
+	value    func(ts int64) float64
+}
+
+var fakeData = []fakeSeries{
+	{"host1", "net.in", map[string]string{"iface": "eth0"}, func(ts int64) float64 { return float64(ts * 10) }},
+	{"host2", "net.in", map[string]string{"iface": "eth0"}, func(ts int64) float64 { return float64(ts * 20) }},
+	{"host1", "net.in", map[string]string{"iface": "eth1"}, func(ts int64) float64 { return float64(ts * 30) }},
+	{"host1", "cpu.idle", nil, func(ts int64) float64 { return 10 }},
+	{"host2", "cpu.idle", nil, func(ts int64) float64 { return 30 }},
+	{"host3", "cpu.idle", nil, func(ts int64) float64 { return 50 }},
+}
+
+func fakeFetch(endpoints []string, metric string, tagkv map[string][]string,
+	start, end int64, step int) ([]*dataobj.TsdbQueryResponse, error) {
+	ret := []*dataobj.TsdbQueryResponse{}
+	for _, s := range fakeData {
+		if s.metric != metric || !contains(endpoints, s.endpoint) {
+			continue
+		}
+
+		matched := true
+		for k, v := range tagkv {
+			matched = matched && contains(v, s.tags[k])
+		}
+		if !matched {
+			continue
+		}
+
+		resp := &dataobj.TsdbQueryResponse{
+			Endpoint: s.endpoint,
+			Counter:  dataobj.PKWithTags(s.metric, dataobj.SortedTags(s.tags)),
+			DsType:   dataobj.GAUGE,
+			Step:     10,
+		}
+		for ts := start - start%10; ts <= end; ts += 10 {
+			resp.Values = append(resp.Values, dataobj.NewRRDData(ts, s.value(ts)))
+		}
+		ret = append(ret, resp)
+	}
+	return ret, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func query(t *testing.T, input string) map[string]float64 {
+	e := &Evaluator{
+		Start:     1000,
+		End:       1100,
+		Step:      10,
+		Endpoints: []string{"host1", "host2", "host3"},
+		Fetch:     fakeFetch,
+	}
+
+	resp, err := e.Query(input)
+	if err != nil {
+		t.Fatalf("%s: %v", input, err)
+	}
+
+	// 每条曲线取最后一个点
+	ret := make(map[string]float64)
+	for _, r := range resp {
+		if len(r.Values) != 11 {
+			t.Fatalf("%s: expect 11 points, got %d", input, len(r.Values))
+		}
+		ret[r.Endpoint+"/"+r.Counter] = float64(r.Values[len(r.Values)-1].Value)
+	}
+	return ret
+}
+
+func Test_Parse(t *testing.T) {
+	valid := []string{
+		`cpu.idle`,
+		`cpu.idle{endpoint="host1|host2"} * 2`,
+		`rate(net.in{iface="eth0"}[5m])`,
+		`sum by (iface) (rate(net.in[1m]))`,
+		`sum(rate(net.in[1m])) without (endpoint)`,
+		`topk(3, cpu.idle)`,
+		`-cpu.idle + 100`,
+	}
+	for _, input := range valid {
+		if _, err := Parse(input); err != nil {
+			t.Errorf("%s: %v", input, err)
+		}
+	}
+
+	invalid := []string{
+		`cpu.idle{endpoint="host1"`,
+		`unknown(cpu.idle)`,
+		`topk(cpu.idle)`,
+		`rate(net.in[5x])`,
+		`cpu.idle +`,
+	}
+	for _, input := range invalid {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("%s: expect error", input)
+		}
+	}
+}
+
+func Test_Query(t *testing.T) {
+	cases := []struct {
+		expr   string
+		expect map[string]float64
+	}{
+		{`cpu.idle{endpoint="host1"}`, map[string]float64{"host1/cpu.idle": 10}},
+		{`cpu.idle * 2 + 1`, map[string]float64{"host1/": 21, "host2/": 61, "host3/": 101}},
+		{`rate(net.in{iface="eth0"}[1m])`, map[string]float64{"host1/iface=eth0": 10, "host2/iface=eth0": 20}},
+		{`sum by (iface) (rate(net.in[1m]))`, map[string]float64{"/iface=eth0": 30, "/iface=eth1": 30}},
+		{`avg(cpu.idle) without (endpoint)`, map[string]float64{"/" + `avg(cpu.idle) without (endpoint)`: 30}},
+		{`topk(1, cpu.idle)`, map[string]float64{"host3/cpu.idle": 50}},
+		{`quantile(0.25, cpu.idle)`, map[string]float64{"/" + `quantile(0.25, cpu.idle)`: 20}},
+		{`cpu.idle{endpoint="host1"} / cpu.idle{endpoint="host2"}`, map[string]float64{"host1/": 10.0 / 30}},
+	}
+
+	for _, c := range cases {
+		got := query(t, c.expr)
+		if len(got) != len(c.expect) {
+			t.Errorf("%s: expect %v, got %v", c.expr, c.expect, got)
+			continue
+		}
+		for k, v := range c.expect {
+			if math.Abs(got[k]-v) > 1e-9 {
+				t.Errorf("%s: expect %v, got %v", c.expr, c.expect, got)
+			}
+		}
+	}
+}
+
+func Test_QueryError(t *testing.T) {
+	e := &Evaluator{Start: 1000, End: 1100, Step: 10, Fetch: fakeFetch}
+	if _, err := e.Query(`cpu.idle`); err == nil {
+		t.Error("expect error when endpoint is missing")
+	}
+
+	e.Endpoints = []string{"host1"}
+	if _, err := e.Query(`rate(cpu.idle)`); err == nil {
+		t.Error("expect error when rate is applied to an instant selector")
+	}
+}
@@ -0,0 +1,364 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+// rangeFunc 根据窗口内的点计算一个值, 窗口内没有足够的点时返回NaN
+// rangeSeconds是区间的长度, counter表示原始曲线是COUNTER/DERIVE, 存储的已经是每秒的速率
+type rangeFunc func(points []*dataobj.RRDData, rangeSeconds int64, counter bool) float64
+
+type function struct {
+	rangeFn   rangeFunc             // 参数是区间
+	instantFn func(float64) float64 // 参数是曲线
+}
+
+var functions = map[string]*function{
+	"rate":          {rangeFn: rateFn},
+	"irate":         {rangeFn: irateFn},
+	"increase":      {rangeFn: increaseFn},
+	"delta":         {rangeFn: deltaFn},
+	"avg_over_time": {rangeFn: avgOverTime},
+	"max_over_time": {rangeFn: maxOverTime},
+	"min_over_time": {rangeFn: minOverTime},
+	"sum_over_time": {rangeFn: sumOverTime},
+	"abs":           {instantFn: math.Abs},
+}
+
+func (e *Evaluator) evalCall(n *Call) (*value, error) {
+	fn := functions[n.Func]
+	if len(n.Args) != 1 {
+		return nil, fmt.Errorf("%s expects 1 argument, got %d", n.Func, len(n.Args))
+	}
+
+	if fn.instantFn != nil {
+		v, err := e.eval(n.Args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if v.isScalar {
+			return &value{scalar: fn.instantFn(v.scalar), isScalar: true}, nil
+		}
+
+		ret := make([]*series, 0, len(v.vector))
+		for _, s := range v.vector {
+			r := e.newSeries("", s.labels, "")
+			for i, val := range s.values {
+				r.values[i] = fn.instantFn(val)
+			}
+			ret = append(ret, r)
+		}
+		return &value{vector: ret}, nil
+	}
+
+	sel, ok := n.Args[0].(*Selector)
+	if !ok || sel.Range <= 0 {
+		return nil, fmt.Errorf("%s expects a range selector, like %s(metric[5m])", n.Func, n.Func)
+	}
+
+	raws, err := e.fetch(sel, sel.Range, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*series, 0, len(raws))
+	for _, rs := range raws {
+		counter := rs.dstype == dataobj.COUNTER || rs.dstype == dataobj.DERIVE
+		s := e.newSeries("", rs.labels, "")
+
+		// 窗口是 (ts-range, ts]
+		lo, hi := 0, 0
+		for i, ts := range e.grid {
+			for hi < len(rs.points) && rs.points[hi].Timestamp <= ts {
+				hi++
+			}
+			for lo < hi && rs.points[lo].Timestamp <= ts-sel.Range {
+				lo++
+			}
+			if lo < hi {
+				s.values[i] = fn.rangeFn(rs.points[lo:hi], sel.Range, counter)
+			}
+		}
+		ret = append(ret, s)
+	}
+
+	return &value{vector: ret}, nil
+}
+
+func rateFn(points []*dataobj.RRDData, rangeSeconds int64, counter bool) float64 {
+	if counter {
+		return avgOverTime(points, rangeSeconds, counter)
+	}
+
+	if len(points) < 2 {
+		return math.NaN()
+	}
+
+	// 值变小认为是计数器被重置, 从0重新开始累加
+	var inc float64
+	for i := 1; i < len(points); i++ {
+		cur, prev := float64(points[i].Value), float64(points[i-1].Value)
+		if cur < prev {
+			inc += cur
+		} else {
+			inc += cur - prev
+		}
+	}
+
+	return inc / float64(points[len(points)-1].Timestamp-points[0].Timestamp)
+}
+
+func irateFn(points []*dataobj.RRDData, rangeSeconds int64, counter bool) float64 {
+	if counter {
+		return float64(points[len(points)-1].Value)
+	}
+
+	if len(points) < 2 {
+		return math.NaN()
+	}
+
+	last, prev := points[len(points)-1], points[len(points)-2]
+	inc := float64(last.Value - prev.Value)
+	if inc < 0 {
+		inc = float64(last.Value)
+	}
+	return inc / float64(last.Timestamp-prev.Timestamp)
+}
+
+func increaseFn(points []*dataobj.RRDData, rangeSeconds int64, counter bool) float64 {
+	return rateFn(points, rangeSeconds, counter) * float64(rangeSeconds)
+}
+
+func deltaFn(points []*dataobj.RRDData, rangeSeconds int64, counter bool) float64 {
+	if len(points) < 2 {
+		return math.NaN()
+	}
+	return float64(points[len(points)-1].Value - points[0].Value)
+}
+
+func avgOverTime(points []*dataobj.RRDData, rangeSeconds int64, counter bool) float64 {
+	return sumOverTime(points, rangeSeconds, counter) / float64(len(points))
+}
+
+func sumOverTime(points []*dataobj.RRDData, rangeSeconds int64, counter bool) float64 {
+	var sum float64
+	for _, p := range points {
+		sum += float64(p.Value)
+	}
+	return sum
+}
+
+func maxOverTime(points []*dataobj.RRDData, rangeSeconds int64, counter bool) float64 {
+	max := float64(points[0].Value)
+	for _, p := range points[1:] {
+		max = math.Max(max, float64(p.Value))
+	}
+	return max
+}
+
+func minOverTime(points []*dataobj.RRDData, rangeSeconds int64, counter bool) float64 {
+	min := float64(points[0].Value)
+	for _, p := range points[1:] {
+		min = math.Min(min, float64(p.Value))
+	}
+	return min
+}
+
+type group struct {
+	labels  map[string]string
+	members []*series
+}
+
+func (e *Evaluator) evalAggregate(n *Aggregate) (*value, error) {
+	var param float64
+	if n.Param != nil {
+		v, err := e.eval(n.Param)
+		if err != nil {
+			return nil, err
+		}
+		if !v.isScalar {
+			return nil, fmt.Errorf("the first argument of %s must be a number", n.Op)
+		}
+		param = v.scalar
+	}
+
+	v, err := e.eval(n.Expr)
+	if err != nil {
+		return nil, err
+	}
+	if v.isScalar {
+		return nil, fmt.Errorf("%s expects a vector, got a number", n.Op)
+	}
+
+	groups := e.groupBy(v.vector, n.Grouping, n.Without)
+
+	ret := []*series{}
+	for _, g := range groups {
+		switch n.Op {
+		case "topk", "bottomk":
+			ret = append(ret, e.topk(g.members, int(param), n.Op == "bottomk")...)
+		default:
+			s := e.newSeries("", g.labels, "")
+			buf := make([]float64, 0, len(g.members))
+			for i := range e.grid {
+				buf = buf[:0]
+				for _, m := range g.members {
+					if !math.IsNaN(m.values[i]) {
+						buf = append(buf, m.values[i])
+					}
+				}
+				if len(buf) > 0 {
+					s.values[i] = aggregate(n.Op, param, buf)
+				}
+			}
+			ret = append(ret, s)
+		}
+	}
+
+	return &value{vector: ret}, nil
+}
+
+// groupBy 按照by/without分组, 保持曲线原来的顺序
+func (e *Evaluator) groupBy(vector []*series, grouping []string, without bool) []*group {
+	groups := []*group{}
+	index := make(map[string]*group)
+
+	for _, s := range vector {
+		labels := make(map[string]string)
+		if without {
+			for k, v := range s.labels {
+				labels[k] = v
+			}
+			for _, k := range grouping {
+				delete(labels, k)
+			}
+		} else {
+			for _, k := range grouping {
+				if v, exists := s.labels[k]; exists {
+					labels[k] = v
+				}
+			}
+		}
+
+		key := signature(labels)
+		g, exists := index[key]
+		if !exists {
+			g = &group{labels: labels}
+			index[key] = g
+			groups = append(groups, g)
+		}
+		g.members = append(g.members, s)
+	}
+
+	return groups
+}
+
+// aggregate 计算一个时间点上的聚合值, values中没有NaN且不为空
+func aggregate(op string, param float64, values []float64) float64 {
+	switch op {
+	case "sum":
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		return sum
+	case "avg":
+		return aggregate("sum", 0, values) / float64(len(values))
+	case "max":
+		max := values[0]
+		for _, v := range values[1:] {
+			max = math.Max(max, v)
+		}
+		return max
+	case "min":
+		min := values[0]
+		for _, v := range values[1:] {
+			min = math.Min(min, v)
+		}
+		return min
+	case "count":
+		return float64(len(values))
+	case "stddev":
+		avg := aggregate("avg", 0, values)
+		var variance float64
+		for _, v := range values {
+			variance += (v - avg) * (v - avg)
+		}
+		return math.Sqrt(variance / float64(len(values)))
+	case "quantile":
+		return quantile(param, values)
+	}
+	return math.NaN()
+}
+
+// quantile 和prometheus一样在相邻的两个值之间线性插值
+func quantile(q float64, values []float64) float64 {
+	if q < 0 {
+		return math.Inf(-1)
+	}
+	if q > 1 {
+		return math.Inf(1)
+	}
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	rank := q * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	weight := rank - float64(lower)
+	return sorted[lower]*(1-weight) + sorted[upper]*weight
+}
+
+// topk 每个时间点选出最大(bottomk时最小)的k条曲线, 没有被选中的时间点是NaN,
+// 任何时间点都没有被选中的曲线不返回
+func (e *Evaluator) topk(members []*series, k int, bottom bool) []*series {
+	if k <= 0 {
+		return nil
+	}
+
+	ret := make([]*series, len(members))
+	for i, m := range members {
+		ret[i] = e.newSeries(m.metric, m.labels, m.dstype)
+	}
+	selected := make([]bool, len(members))
+
+	idx := make([]int, 0, len(members))
+	for i := range e.grid {
+		idx = idx[:0]
+		for j, m := range members {
+			if !math.IsNaN(m.values[i]) {
+				idx = append(idx, j)
+			}
+		}
+
+		sort.SliceStable(idx, func(a, b int) bool {
+			if bottom {
+				return members[idx[a]].values[i] < members[idx[b]].values[i]
+			}
+			return members[idx[a]].values[i] > members[idx[b]].values[i]
+		})
+
+		for n, j := range idx {
+			if n >= k {
+				break
+			}
+			ret[j].values[i] = members[j].values[i]
+			selected[j] = true
+		}
+	}
+
+	result := []*series{}
+	for j, s := range ret {
+		if selected[j] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
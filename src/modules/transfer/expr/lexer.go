@@ -0,0 +1,202 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenType int
+
+const (
+	tokEOF tokenType = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokDuration
+	tokLParen
+	tokRParen
+	tokLBrace
+	tokRBrace
+	tokLBracket
+	tokRBracket
+	tokComma
+	tokEq
+	tokRegexEq
+	tokAdd
+	tokSub
+	tokMul
+	tokDiv
+)
+
+type token struct {
+	typ tokenType
+	val string
+	pos int
+}
+
+func (t token) String() string {
+	if t.typ == tokEOF {
+		return "EOF"
+	}
+	return fmt.Sprintf("%q", t.val)
+}
+
+var punctuations = map[byte]tokenType{
+	'(': tokLParen,
+	')': tokRParen,
+	'{': tokLBrace,
+	'}': tokRBrace,
+	',': tokComma,
+	'+': tokAdd,
+	'-': tokSub,
+	'*': tokMul,
+	'/': tokDiv,
+}
+
+// lex 把表达式拆分成token, metric名字中可以包含 "." 和 ":"
+func lex(input string) ([]token, error) {
+	tokens := []token{}
+
+	for i := 0; i < len(input); {
+		c := input[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '=':
+			if i+1 < len(input) && input[i+1] == '~' {
+				tokens = append(tokens, token{tokRegexEq, "=~", i})
+				i += 2
+			} else {
+				tokens = append(tokens, token{tokEq, "=", i})
+				i++
+			}
+
+		case c == '[':
+			// 区间, 比如 [5m]
+			end := strings.IndexByte(input[i:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unclosed '[' at %d", i)
+			}
+			tokens = append(tokens,
+				token{tokLBracket, "[", i},
+				token{tokDuration, strings.TrimSpace(input[i+1 : i+end]), i + 1},
+				token{tokRBracket, "]", i + end})
+			i += end + 1
+
+		case c == '"' || c == '\'':
+			s, n, err := lexString(input[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%v at %d", err, i)
+			}
+			tokens = append(tokens, token{tokString, s, i})
+			i += n
+
+		case isDigit(c) || (c == '.' && i+1 < len(input) && isDigit(input[i+1])):
+			n := lexNumber(input[i:])
+			tokens = append(tokens, token{tokNumber, input[i : i+n], i})
+			i += n
+
+		case isIdentStart(c):
+			n := 1
+			for i+n < len(input) && isIdentChar(input[i+n]) {
+				n++
+			}
+			tokens = append(tokens, token{tokIdent, input[i : i+n], i})
+			i += n
+
+		default:
+			typ, ok := punctuations[c]
+			if !ok {
+				return nil, fmt.Errorf("unexpected character %q at %d", c, i)
+			}
+			tokens = append(tokens, token{typ, string(c), i})
+			i++
+		}
+	}
+
+	return append(tokens, token{tokEOF, "", len(input)}), nil
+}
+
+func lexString(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unclosed string")
+}
+
+func lexNumber(s string) int {
+	n := 0
+	for n < len(s) && (isDigit(s[n]) || s[n] == '.') {
+		n++
+	}
+
+	// 科学计数法
+	if n < len(s) && (s[n] == 'e' || s[n] == 'E') {
+		m := n + 1
+		if m < len(s) && (s[m] == '+' || s[m] == '-') {
+			m++
+		}
+		if m < len(s) && isDigit(s[m]) {
+			for m < len(s) && isDigit(s[m]) {
+				m++
+			}
+			n = m
+		}
+	}
+	return n
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || unicode.IsLetter(rune(c))
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '.' || c == ':'
+}
+
+// parseDuration 支持 s/m/h/d/w, 比如 30s, 5m, 1h, 不带单位时是秒
+func parseDuration(s string) (int64, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty duration")
+	}
+
+	unit := int64(1)
+	switch s[len(s)-1] {
+	case 's':
+		s = s[:len(s)-1]
+	case 'm':
+		unit, s = 60, s[:len(s)-1]
+	case 'h':
+		unit, s = 3600, s[:len(s)-1]
+	case 'd':
+		unit, s = 86400, s[:len(s)-1]
+	case 'w':
+		unit, s = 7*86400, s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid duration: %s", s)
+	}
+	return n * unit, nil
+}
@@ -0,0 +1,346 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Node 表达式语法树的节点
+type Node interface{}
+
+type NumberLiteral struct {
+	Val float64
+}
+
+// Selector 选择曲线, 比如 net.in.bits{endpoint="host1|host2", iface="eth0"}[5m]
+// tag需要写全(index fullmatch), 多个值用 "|" 分隔
+type Selector struct {
+	Metric   string
+	Matchers map[string][]string
+	Range    int64 // 单位秒, 0表示不是区间
+}
+
+type Call struct {
+	Func string
+	Args []Node
+}
+
+type Aggregate struct {
+	Op       string
+	Param    Node // topk/bottomk的k, quantile的q
+	Expr     Node
+	Grouping []string
+	Without  bool
+}
+
+type BinaryExpr struct {
+	Op  tokenType
+	LHS Node
+	RHS Node
+}
+
+var aggregateOps = map[string]bool{
+	"sum":      false,
+	"avg":      false,
+	"max":      false,
+	"min":      false,
+	"count":    false,
+	"stddev":   false,
+	"topk":     true, // 是否需要参数
+	"bottomk":  true,
+	"quantile": true,
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Parse 解析表达式, 语法是PromQL的一个子集
+func Parse(input string) (Node, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	node, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.typ != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at %d", t, t.pos)
+	}
+	return node, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.typ != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(typ tokenType, what string) (token, error) {
+	t := p.next()
+	if t.typ != typ {
+		return t, fmt.Errorf("expected %s but got %s at %d", what, t, t.pos)
+	}
+	return t, nil
+}
+
+// expr := term (('+'|'-') term)*
+func (p *parser) parseExpr() (Node, error) {
+	lhs, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		if t.typ != tokAdd && t.typ != tokSub {
+			return lhs, nil
+		}
+		p.next()
+
+		rhs, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{Op: t.typ, LHS: lhs, RHS: rhs}
+	}
+}
+
+// term := unary (('*'|'/') unary)*
+func (p *parser) parseTerm() (Node, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		if t.typ != tokMul && t.typ != tokDiv {
+			return lhs, nil
+		}
+		p.next()
+
+		rhs, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		lhs = &BinaryExpr{Op: t.typ, LHS: lhs, RHS: rhs}
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.peek().typ == tokSub {
+		p.next()
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &BinaryExpr{Op: tokSub, LHS: &NumberLiteral{Val: 0}, RHS: node}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+	switch t.typ {
+	case tokNumber:
+		v, err := strconv.ParseFloat(t.val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s at %d", t.val, t.pos)
+		}
+		return &NumberLiteral{Val: v}, nil
+
+	case tokLParen:
+		node, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err = p.expect(tokRParen, "')'"); err != nil {
+			return nil, err
+		}
+		return node, nil
+
+	case tokIdent:
+		if _, isAggr := aggregateOps[t.val]; isAggr {
+			next := p.peek()
+			if next.typ == tokLParen || (next.typ == tokIdent && (next.val == "by" || next.val == "without")) {
+				return p.parseAggregate(t.val)
+			}
+		}
+
+		if p.peek().typ == tokLParen {
+			return p.parseCall(t.val)
+		}
+		return p.parseSelector(t.val)
+	}
+
+	return nil, fmt.Errorf("unexpected %s at %d", t, t.pos)
+}
+
+func (p *parser) parseSelector(metric string) (Node, error) {
+	sel := &Selector{Metric: metric, Matchers: make(map[string][]string)}
+
+	if p.peek().typ == tokLBrace {
+		p.next()
+		for p.peek().typ != tokRBrace {
+			key, err := p.expect(tokIdent, "tag key")
+			if err != nil {
+				return nil, err
+			}
+
+			// =~ 只支持 "a|b" 这种多个值的写法
+			op := p.next()
+			if op.typ != tokEq && op.typ != tokRegexEq {
+				return nil, fmt.Errorf("expected '=' or '=~' but got %s at %d", op, op.pos)
+			}
+
+			val, err := p.expect(tokString, "tag value")
+			if err != nil {
+				return nil, err
+			}
+
+			for _, v := range strings.Split(val.val, "|") {
+				if v = strings.TrimSpace(v); v != "" {
+					sel.Matchers[key.val] = append(sel.Matchers[key.val], v)
+				}
+			}
+
+			if p.peek().typ == tokComma {
+				p.next()
+			} else if p.peek().typ != tokRBrace {
+				t := p.peek()
+				return nil, fmt.Errorf("expected ',' or '}' but got %s at %d", t, t.pos)
+			}
+		}
+		p.next()
+	}
+
+	if p.peek().typ == tokLBracket {
+		p.next()
+		d := p.next()
+		r, err := parseDuration(d.val)
+		if err != nil {
+			return nil, fmt.Errorf("%v at %d", err, d.pos)
+		}
+		sel.Range = r
+		p.next()
+	}
+
+	return sel, nil
+}
+
+func (p *parser) parseArgs() ([]Node, error) {
+	if _, err := p.expect(tokLParen, "'('"); err != nil {
+		return nil, err
+	}
+
+	args := []Node{}
+	if p.peek().typ == tokRParen {
+		p.next()
+		return args, nil
+	}
+
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		t := p.next()
+		if t.typ == tokRParen {
+			return args, nil
+		}
+		if t.typ != tokComma {
+			return nil, fmt.Errorf("expected ',' or ')' but got %s at %d", t, t.pos)
+		}
+	}
+}
+
+func (p *parser) parseCall(name string) (Node, error) {
+	if _, exists := functions[name]; !exists {
+		return nil, fmt.Errorf("unknown function: %s", name)
+	}
+
+	args, err := p.parseArgs()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Call{Func: name, Args: args}, nil
+}
+
+// sum by (a, b) (expr) 或者 sum(expr) by (a, b)
+func (p *parser) parseAggregate(op string) (Node, error) {
+	aggr := &Aggregate{Op: op}
+
+	if p.peek().typ == tokIdent {
+		if err := p.parseGrouping(aggr); err != nil {
+			return nil, err
+		}
+	}
+
+	args, err := p.parseArgs()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().typ == tokIdent && (p.peek().val == "by" || p.peek().val == "without") {
+		if aggr.Grouping != nil {
+			return nil, fmt.Errorf("duplicated grouping of %s", op)
+		}
+		if err := p.parseGrouping(aggr); err != nil {
+			return nil, err
+		}
+	}
+
+	if aggregateOps[op] {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%s expects 2 arguments, got %d", op, len(args))
+		}
+		aggr.Param, aggr.Expr = args[0], args[1]
+	} else {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s expects 1 argument, got %d", op, len(args))
+		}
+		aggr.Expr = args[0]
+	}
+
+	return aggr, nil
+}
+
+func (p *parser) parseGrouping(aggr *Aggregate) error {
+	t := p.next()
+	aggr.Without = t.val == "without"
+
+	if _, err := p.expect(tokLParen, "'('"); err != nil {
+		return err
+	}
+
+	aggr.Grouping = []string{}
+	for p.peek().typ != tokRParen {
+		label, err := p.expect(tokIdent, "label")
+		if err != nil {
+			return err
+		}
+		aggr.Grouping = append(aggr.Grouping, label.val)
+
+		if p.peek().typ == tokComma {
+			p.next()
+		}
+	}
+	p.next()
+	return nil
+}
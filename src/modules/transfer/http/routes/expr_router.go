@@ -0,0 +1,66 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/errors"
+	"github.com/toolkits/pkg/logger"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/backend"
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/expr"
+)
+
+type ExprQueryReq struct {
+	Expr      string   `json:"expr"`
+	Start     int64    `json:"start"`
+	End       int64    `json:"end"`
+	Step      int64    `json:"step"`      // 为0时根据时间范围自动计算
+	Endpoints []string `json:"endpoints"` // 表达式中没有指定endpoint时使用
+}
+
+// QueryExpr 表达式查询, 比如 sum by (iface) (rate(net.in.bits{endpoint="host1|host2"}[5m])) * 8
+func QueryExpr(c *gin.Context) {
+	var input ExprQueryReq
+	errors.Dangerous(c.ShouldBindJSON(&input))
+
+	if input.Expr == "" {
+		renderMessage(c, "expr is blank")
+		return
+	}
+
+	e := &expr.Evaluator{
+		Start:     input.Start,
+		End:       input.End,
+		Step:      input.Step,
+		Endpoints: input.Endpoints,
+		Fetch:     fetchSeries,
+	}
+
+	resp, err := e.Query(input.Expr)
+	if err != nil {
+		logger.Warningf("query expr %s failed: %v", input.Expr, err)
+	}
+	renderData(c, resp, err)
+}
+
+// fetchSeries 通过index查询完整的counter, 再从tsdb查询数据
+func fetchSeries(endpoints []string, metric string, tagkv map[string][]string,
+	start, end int64, step int) ([]*dataobj.TsdbQueryResponse, error) {
+	req := SeriesReq{Endpoints: endpoints, Metric: metric}
+	for k, v := range tagkv {
+		req.Tagkv = append(req.Tagkv, &Tagkv{TagK: k, TagV: v})
+	}
+
+	queryData, err := GetSeries(start, end, []SeriesReq{req})
+	if err != nil {
+		return nil, err
+	}
+
+	if step > 0 {
+		for i := range queryData {
+			queryData[i].Step = step
+		}
+	}
+
+	return backend.FetchData(queryData), nil
+}
@@ -0,0 +1,78 @@
+package routes
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/toolkits/pkg/logger"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/backend"
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/config"
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/prompb"
+)
+
+// PushPrometheus prometheus remote write, body是snappy压缩的protobuf
+// 请求本身有问题时返回4xx, prometheus不会重试
+func PushPrometheus(c *gin.Context) {
+	compressed, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	buf, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req prompb.WriteRequest
+	if err := proto.Unmarshal(buf, &req); err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cfg := config.Config.Prometheus
+	step := cfg.Step
+	if step <= 0 {
+		step = int64(backend.MinStep)
+	}
+
+	recvMetricValues, invalid := prompb.Metadata.ToMetricValues(&req, prompb.ConvertOption{
+		EndpointLabels: cfg.EndpointLabels,
+		StripPort:      cfg.StripPort,
+		Step:           step,
+	})
+
+	metricValues := make([]*dataobj.MetricValue, 0, len(recvMetricValues))
+	for _, v := range recvMetricValues {
+		if err := v.CheckValidity(); err != nil {
+			logger.Debugf("recv prometheus metric %v err:%v", v, err)
+			invalid++
+			continue
+		}
+		metricValues = append(metricValues, v)
+	}
+
+	if invalid > 0 {
+		logger.Warningf("recv prometheus samples total:%d, invalid:%d", len(metricValues)+invalid, invalid)
+	}
+
+	if config.Config.Tsdb.Enabled {
+		backend.Push2TsdbSendQueue(metricValues)
+	}
+
+	if config.Config.Judge.Enabled {
+		backend.Push2JudgeSendQueue(metricValues)
+	}
+
+	if config.Config.Index.Publish.Enabled {
+		backend.Push2IndexQueue(metricValues)
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -9,7 +9,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/open-falcon/falcon-ng/src/dataobj"
 	"github.com/open-falcon/falcon-ng/src/modules/transfer/backend"
-	. "github.com/open-falcon/falcon-ng/src/modules/transfer/config"
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/config"
 )
 
 func PushData(c *gin.Context) {
@@ -34,10 +34,18 @@ func PushData(c *gin.Context) {
 		metricValues = append(metricValues, v)
 	}
 
-	if Config.Tsdb.Enabled {
+	if config.Config.Tsdb.Enabled {
 		backend.Push2TsdbSendQueue(metricValues)
 	}
 
+	if config.Config.Judge.Enabled {
+		backend.Push2JudgeSendQueue(metricValues)
+	}
+
+	if config.Config.Index.Publish.Enabled {
+		backend.Push2IndexQueue(metricValues)
+	}
+
 	if msg != "" {
 		renderMessage(c, "blank body")
 	}
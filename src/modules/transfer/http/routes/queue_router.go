@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/backend"
+)
+
+// 发送队列的堆积情况, 包括落盘的数据
+func queueStats(c *gin.Context) {
+	renderData(c, backend.GetQueueStats(), nil)
+}
+
+// ui查询缓存的命中情况
+func cacheStats(c *gin.Context) {
+	renderData(c, backend.GetCacheStats(), nil)
+}
+
+// tsdb副本修复任务的统计
+func repairStats(c *gin.Context) {
+	renderData(c, backend.GetRepairStats(), nil)
+}
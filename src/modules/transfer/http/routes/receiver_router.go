@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/receiver"
+)
+
+// opentsdb/graphite监听收到的合法/非法行数
+func receiverStats(c *gin.Context) {
+	renderData(c, receiver.GetStats(), nil)
+}
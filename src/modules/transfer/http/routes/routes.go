@@ -14,8 +14,15 @@ func Config(r *gin.Engine) {
 		sys.GET("/addr", addr)
 
 		sys.POST("/push", PushData)
+		sys.POST("/prometheus/write", PushPrometheus)
 		sys.POST("/data", QueryDataForJudge)
 		sys.POST("/data/ui", QueryDataForUI)
+		sys.POST("/expr", QueryExpr)
+
+		sys.GET("/queues", queueStats)
+		sys.GET("/receivers", receiverStats)
+		sys.GET("/cache", cacheStats)
+		sys.GET("/repair", repairStats)
 	}
 
 	v2 := r.Group("/api/transfer/v2")
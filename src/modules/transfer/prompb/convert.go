@@ -0,0 +1,163 @@
+package prompb
+
+import (
+	"math"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+const metricNameLabel = "__name__"
+
+type ConvertOption struct {
+	EndpointLabels []string // 依次查找作为endpoint的label, 找到第一个即停止
+	StripPort      bool     // endpoint形如 host:port 时去掉端口, instance label一般是这种格式
+	Step           int64    // remote write中没有周期信息, 统一使用配置的周期
+}
+
+// MetadataCache 记录remote write上报的metric类型, metadata和数据是分开上报的
+type MetadataCache struct {
+	sync.RWMutex
+	Data map[string]MetricType // metric family -> type
+}
+
+var Metadata = NewMetadataCache()
+
+func NewMetadataCache() *MetadataCache {
+	return &MetadataCache{Data: make(map[string]MetricType)}
+}
+
+func (m *MetadataCache) Set(metadata []*MetricMetadata) {
+	if len(metadata) == 0 {
+		return
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	for _, md := range metadata {
+		if md == nil || md.MetricFamilyName == "" {
+			continue
+		}
+		m.Data[md.MetricFamilyName] = md.Type
+	}
+}
+
+func (m *MetadataCache) Get(family string) (MetricType, bool) {
+	m.RLock()
+	defer m.RUnlock()
+
+	t, exists := m.Data[family]
+	return t, exists
+}
+
+// CounterType 推断metric的类型, 优先使用metadata, 没有metadata时按照prometheus的命名规范判断:
+// counter以_total结尾, histogram/summary的_count, _sum, _bucket也是单调递增的
+func (m *MetadataCache) CounterType(metric string) string {
+	if t, exists := m.Get(metric); exists {
+		if t == MetricTypeCounter {
+			return dataobj.COUNTER
+		}
+		return dataobj.GAUGE
+	}
+
+	for _, suffix := range []string{"_total", "_count", "_sum", "_bucket"} {
+		if !strings.HasSuffix(metric, suffix) {
+			continue
+		}
+
+		family := strings.TrimSuffix(metric, suffix)
+		if t, exists := m.Get(family); exists {
+			switch t {
+			case MetricTypeCounter, MetricTypeHistogram, MetricTypeSummary:
+				return dataobj.COUNTER
+			default:
+				return dataobj.GAUGE
+			}
+		}
+
+		return dataobj.COUNTER
+	}
+
+	return dataobj.GAUGE
+}
+
+// ToMetricValues 把remote write请求转换为MetricValue, 返回的数据还需要经过CheckValidity
+// __name__作为metric, EndpointLabels中的一个作为endpoint, 其余的label作为tags, 以__开头的内部label直接忽略
+func (m *MetadataCache) ToMetricValues(req *WriteRequest, opts ConvertOption) ([]*dataobj.MetricValue, int) {
+	m.Set(req.Metadata)
+
+	items := []*dataobj.MetricValue{}
+	invalid := 0
+
+	for _, ts := range req.Timeseries {
+		if ts == nil {
+			continue
+		}
+
+		var metric, endpoint, endpointLabel string
+		labels := make(map[string]string, len(ts.Labels))
+		for _, l := range ts.Labels {
+			if l == nil {
+				continue
+			}
+			if l.Name == metricNameLabel {
+				metric = l.Value
+				continue
+			}
+			labels[l.Name] = l.Value
+		}
+
+		for _, name := range opts.EndpointLabels {
+			if v, exists := labels[name]; exists && v != "" {
+				endpoint = v
+				endpointLabel = name
+				break
+			}
+		}
+
+		if metric == "" || endpoint == "" {
+			invalid += len(ts.Samples)
+			continue
+		}
+
+		if opts.StripPort {
+			if host, _, err := net.SplitHostPort(endpoint); err == nil {
+				endpoint = host
+			}
+		}
+
+		tags := make(map[string]string, len(labels))
+		for k, v := range labels {
+			if k == endpointLabel || strings.HasPrefix(k, "__") || v == "" {
+				continue
+			}
+			k, _ = dataobj.ReplaceReservedWords(k)
+			v, _ = dataobj.ReplaceReservedWords(v)
+			tags[k] = v
+		}
+
+		counterType := m.CounterType(metric)
+		for _, s := range ts.Samples {
+			// NaN是prometheus的staleness标记
+			if s == nil || math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+				invalid++
+				continue
+			}
+
+			items = append(items, &dataobj.MetricValue{
+				Metric:       metric,
+				Endpoint:     endpoint,
+				Timestamp:    s.Timestamp / 1000,
+				Step:         opts.Step,
+				ValueUntyped: s.Value,
+				CounterType:  counterType,
+				TagsMap:      tags,
+			})
+		}
+	}
+
+	return items, invalid
+}
@@ -0,0 +1,82 @@
+package prompb
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+func Test_SampleWireFormat(t *testing.T) {
+	// prometheus编码的Sample{Value: 1.5, Timestamp: 1000}
+	b := []byte{0x09, 0, 0, 0, 0, 0, 0, 0xf8, 0x3f, 0x10, 0xe8, 0x07}
+
+	var s Sample
+	if err := proto.Unmarshal(b, &s); err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Value != 1.5 || s.Timestamp != 1000 {
+		t.Fatalf("got %v", s)
+	}
+}
+
+func Test_ToMetricValues(t *testing.T) {
+	req := &WriteRequest{
+		Timeseries: []*TimeSeries{
+			{
+				Labels: []*Label{
+					{Name: "__name__", Value: "http_requests_total"},
+					{Name: "instance", Value: "10.0.0.1:9100"},
+					{Name: "job", Value: "node"},
+					{Name: "path", Value: "/a,b"},
+				},
+				Samples: []*Sample{{Value: 10, Timestamp: 1560000000000}},
+			},
+			{
+				Labels: []*Label{
+					{Name: "__name__", Value: "up"},
+				},
+				Samples: []*Sample{{Value: 1, Timestamp: 1560000000000}},
+			},
+		},
+		Metadata: []*MetricMetadata{{Type: MetricTypeGauge, MetricFamilyName: "go_goroutines"}},
+	}
+
+	b, err := proto.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded WriteRequest
+	if err := proto.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewMetadataCache()
+	items, invalid := m.ToMetricValues(&decoded, ConvertOption{
+		EndpointLabels: []string{"endpoint", "instance"},
+		StripPort:      true,
+		Step:           15,
+	})
+
+	// 第二条没有endpoint
+	if len(items) != 1 || invalid != 1 {
+		t.Fatalf("items: %d, invalid: %d", len(items), invalid)
+	}
+
+	item := items[0]
+	if err := item.CheckValidity(); err != nil {
+		t.Fatal(err)
+	}
+
+	if item.Endpoint != "10.0.0.1" || item.Metric != "http_requests_total" || item.CounterType != dataobj.COUNTER ||
+		item.Timestamp != 1560000000 || item.Value != 10 || item.Tags != "job=node,path=/a_b" {
+		t.Fatalf("got %v, counterType: %s", item, item.CounterType)
+	}
+
+	if m.CounterType("go_goroutines") != dataobj.GAUGE || m.CounterType("go_gc_duration_seconds_count") != dataobj.COUNTER {
+		t.Fatal("counter type infer failed")
+	}
+}
@@ -0,0 +1,67 @@
+// Package prompb Prometheus remote write协议中用到的消息, 与prometheus/prompb中的定义保持一致
+// 只保留了transfer需要的字段, 未知字段在反序列化时会被忽略
+package prompb
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+type MetricType int32
+
+const (
+	MetricTypeUnknown        MetricType = 0
+	MetricTypeCounter        MetricType = 1
+	MetricTypeGauge          MetricType = 2
+	MetricTypeHistogram      MetricType = 3
+	MetricTypeGaugeHistogram MetricType = 4
+	MetricTypeSummary        MetricType = 5
+	MetricTypeInfo           MetricType = 6
+	MetricTypeStateset       MetricType = 7
+)
+
+type WriteRequest struct {
+	Timeseries []*TimeSeries     `protobuf:"bytes,1,rep,name=timeseries" json:"timeseries,omitempty"`
+	Metadata   []*MetricMetadata `protobuf:"bytes,3,rep,name=metadata" json:"metadata,omitempty"`
+}
+
+func (m *WriteRequest) Reset()         { *m = WriteRequest{} }
+func (m *WriteRequest) String() string { return proto.CompactTextString(m) }
+func (*WriteRequest) ProtoMessage()    {}
+
+type TimeSeries struct {
+	Labels  []*Label  `protobuf:"bytes,1,rep,name=labels" json:"labels,omitempty"`
+	Samples []*Sample `protobuf:"bytes,2,rep,name=samples" json:"samples,omitempty"`
+}
+
+func (m *TimeSeries) Reset()         { *m = TimeSeries{} }
+func (m *TimeSeries) String() string { return proto.CompactTextString(m) }
+func (*TimeSeries) ProtoMessage()    {}
+
+type Label struct {
+	Name  string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Value string `protobuf:"bytes,2,opt,name=value" json:"value,omitempty"`
+}
+
+func (m *Label) Reset()         { *m = Label{} }
+func (m *Label) String() string { return proto.CompactTextString(m) }
+func (*Label) ProtoMessage()    {}
+
+type Sample struct {
+	Value     float64 `protobuf:"fixed64,1,opt,name=value" json:"value,omitempty"`
+	Timestamp int64   `protobuf:"varint,2,opt,name=timestamp" json:"timestamp,omitempty"` // 单位ms
+}
+
+func (m *Sample) Reset()         { *m = Sample{} }
+func (m *Sample) String() string { return proto.CompactTextString(m) }
+func (*Sample) ProtoMessage()    {}
+
+type MetricMetadata struct {
+	Type             MetricType `protobuf:"varint,1,opt,name=type,enum=prometheus.MetricMetadata_MetricType" json:"type,omitempty"`
+	MetricFamilyName string     `protobuf:"bytes,2,opt,name=metric_family_name,json=metricFamilyName" json:"metric_family_name,omitempty"`
+	Help             string     `protobuf:"bytes,4,opt,name=help" json:"help,omitempty"`
+	Unit             string     `protobuf:"bytes,5,opt,name=unit" json:"unit,omitempty"`
+}
+
+func (m *MetricMetadata) Reset()         { *m = MetricMetadata{} }
+func (m *MetricMetadata) String() string { return proto.CompactTextString(m) }
+func (*MetricMetadata) ProtoMessage()    {}
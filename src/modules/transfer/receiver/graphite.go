@@ -0,0 +1,195 @@
+package receiver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/config"
+)
+
+// GraphiteParser 解析graphite plaintext协议: <path> <value> <timestamp>
+// path也可以带tag(graphite 1.1): a.b.c;tag1=v1;tag2=v2
+//
+// path按照规则拆分, 规则由filter和template组成, 都用"."分隔.
+// filter逐段匹配path的前缀, "*"匹配任意一段, 按配置顺序取第一个匹配的规则.
+// template与path逐段对应, endpoint/metric表示这一段属于endpoint/metric, 多段用"."拼接,
+// "_"表示丢弃这一段, 其他的名字表示这一段作为该名字的tag, 最后一段可以以"*"结尾, 表示剩下的所有段都按这一段处理.
+// 例如 filter: "servers.*", template: "_.endpoint.metric*", servers.host1.cpu.idle -> endpoint: host1, metric: cpu.idle
+type GraphiteParser struct {
+	Step            int64
+	rules           []*graphiteRule
+	defaultTemplate *graphiteTemplate
+}
+
+type graphiteRule struct {
+	filter   []string
+	template *graphiteTemplate
+}
+
+type graphiteTemplate struct {
+	parts  []string
+	greedy bool // 最后一段是否匹配剩下所有的段
+}
+
+func NewGraphiteParser(step int64, rules []config.GraphiteRule, defaultTemplate string) (*GraphiteParser, error) {
+	p := &GraphiteParser{Step: step}
+
+	var err error
+	p.defaultTemplate, err = parseGraphiteTemplate(defaultTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range rules {
+		tpl, err := parseGraphiteTemplate(r.Template)
+		if err != nil {
+			return nil, err
+		}
+
+		p.rules = append(p.rules, &graphiteRule{
+			filter:   strings.Split(r.Filter, "."),
+			template: tpl,
+		})
+	}
+
+	return p, nil
+}
+
+func parseGraphiteTemplate(s string) (*graphiteTemplate, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty graphite template")
+	}
+
+	tpl := &graphiteTemplate{parts: strings.Split(s, ".")}
+	for i, part := range tpl.parts {
+		if !strings.HasSuffix(part, "*") {
+			continue
+		}
+
+		if i != len(tpl.parts)-1 {
+			return nil, fmt.Errorf("graphite template %s: only the last part can end with *", s)
+		}
+		tpl.parts[i] = strings.TrimSuffix(part, "*")
+		tpl.greedy = true
+	}
+
+	hasEndpoint, hasMetric := false, false
+	for _, part := range tpl.parts {
+		hasEndpoint = hasEndpoint || part == "endpoint"
+		hasMetric = hasMetric || part == "metric"
+	}
+
+	if !hasEndpoint || !hasMetric {
+		return nil, fmt.Errorf("graphite template %s: endpoint and metric are required", s)
+	}
+
+	return tpl, nil
+}
+
+func (r *graphiteRule) match(segs []string) bool {
+	if len(segs) < len(r.filter) {
+		return false
+	}
+
+	for i, f := range r.filter {
+		if f != "*" && f != segs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *graphiteTemplate) apply(segs []string) (endpoint, metric string, tags map[string]string, err error) {
+	if len(segs) < len(t.parts) || (!t.greedy && len(segs) != len(t.parts)) {
+		err = fmt.Errorf("path has %d parts, template has %d", len(segs), len(t.parts))
+		return
+	}
+
+	values := make(map[string][]string)
+	for i, seg := range segs {
+		part := t.parts[len(t.parts)-1]
+		if i < len(t.parts) {
+			part = t.parts[i]
+		}
+
+		if part == "_" || part == "" {
+			continue
+		}
+		values[part] = append(values[part], seg)
+	}
+
+	endpoint = strings.Join(values["endpoint"], ".")
+	metric = strings.Join(values["metric"], ".")
+	delete(values, "endpoint")
+	delete(values, "metric")
+
+	tags = make(map[string]string, len(values))
+	for k, v := range values {
+		tags[k] = strings.Join(v, ".")
+	}
+	return
+}
+
+func (p *GraphiteParser) Parse(line string) (*dataobj.MetricValue, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, fmt.Errorf("invalid graphite line: %s", line)
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value: %s", fields[1])
+	}
+
+	// 没有时间戳或者时间戳为-1时使用当前时间
+	ts := time.Now().Unix()
+	if len(fields) == 3 && fields[2] != "-1" {
+		t, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp: %s", fields[2])
+		}
+		ts = int64(t)
+	}
+
+	path := fields[0]
+	var pathTags []string
+	if idx := strings.IndexRune(path, ';'); idx != -1 {
+		pathTags = strings.Split(path[idx+1:], ";")
+		path = path[:idx]
+	}
+
+	segs := strings.Split(path, ".")
+	tpl := p.defaultTemplate
+	for _, r := range p.rules {
+		if r.match(segs) {
+			tpl = r.template
+			break
+		}
+	}
+
+	endpoint, metric, tags, err := tpl.apply(segs)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	for _, tag := range pathTags {
+		idx := strings.IndexRune(tag, '=')
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid tag: %s", tag)
+		}
+		tags[tag[:idx]] = tag[idx+1:]
+	}
+
+	return &dataobj.MetricValue{
+		Metric:       metric,
+		Endpoint:     endpoint,
+		Timestamp:    ts,
+		Step:         p.Step,
+		ValueUntyped: value,
+		CounterType:  dataobj.GAUGE,
+		TagsMap:      tags,
+	}, nil
+}
@@ -0,0 +1,72 @@
+package receiver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+// OpenTSDBParser 解析opentsdb telnet协议: put <metric> <timestamp> <value> <tagk1=tagv1 ...>
+type OpenTSDBParser struct {
+	Step         int64
+	EndpointTags []string
+}
+
+func (p *OpenTSDBParser) Parse(line string) (*dataobj.MetricValue, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || fields[0] != "put" {
+		return nil, fmt.Errorf("invalid opentsdb line: %s", line)
+	}
+
+	ts, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp: %s", fields[2])
+	}
+
+	value, err := strconv.ParseFloat(fields[3], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value: %s", fields[3])
+	}
+
+	tags := make(map[string]string)
+	for _, tag := range fields[4:] {
+		idx := strings.IndexRune(tag, '=')
+		if idx <= 0 || idx == len(tag)-1 {
+			return nil, fmt.Errorf("invalid tag: %s", tag)
+		}
+		tags[tag[:idx]] = tag[idx+1:]
+	}
+
+	var endpoint string
+	for _, k := range p.EndpointTags {
+		if v, exists := tags[k]; exists {
+			endpoint = v
+			delete(tags, k)
+			break
+		}
+	}
+
+	if endpoint == "" {
+		return nil, fmt.Errorf("no endpoint tag: %s", line)
+	}
+
+	return &dataobj.MetricValue{
+		Metric:       fields[1],
+		Endpoint:     endpoint,
+		Timestamp:    normalizeTs(ts),
+		Step:         p.Step,
+		ValueUntyped: value,
+		CounterType:  dataobj.GAUGE,
+		TagsMap:      tags,
+	}, nil
+}
+
+// opentsdb的时间戳可以是毫秒
+func normalizeTs(ts int64) int64 {
+	if ts > 1e11 {
+		return ts / 1000
+	}
+	return ts
+}
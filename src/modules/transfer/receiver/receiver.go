@@ -0,0 +1,231 @@
+package receiver
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/toolkits/pkg/logger"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/backend"
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/config"
+)
+
+const (
+	batchSize     = 200
+	maxLineLength = 64 * 1024
+)
+
+type Parser interface {
+	Parse(line string) (*dataobj.MetricValue, error)
+}
+
+// Listener 一个协议在一个端口上的监听
+type Listener struct {
+	Name     string
+	Network  string // tcp|udp
+	Addr     string
+	parser   Parser
+	accepted int64
+	rejected int64
+}
+
+type ListenerStat struct {
+	Name     string `json:"name"`
+	Network  string `json:"network"`
+	Addr     string `json:"addr"`
+	Accepted int64  `json:"accepted"`
+	Rejected int64  `json:"rejected"`
+}
+
+var listeners []*Listener
+
+// Start 按配置启动opentsdb/graphite的监听
+func Start() {
+	cfg := config.Config.Receiver
+
+	if cfg.OpenTSDB.Enabled {
+		parser := &OpenTSDBParser{
+			Step:         stepOrDefault(cfg.OpenTSDB.Step),
+			EndpointTags: cfg.OpenTSDB.EndpointTags,
+		}
+		listen("opentsdb", cfg.OpenTSDB.TCP, cfg.OpenTSDB.UDP, parser)
+	}
+
+	if cfg.Graphite.Enabled {
+		parser, err := NewGraphiteParser(stepOrDefault(cfg.Graphite.Step), cfg.Graphite.Rules, cfg.Graphite.DefaultTemplate)
+		if err != nil {
+			logger.Fatalf("init graphite parser failed: %v", err)
+			os.Exit(1)
+		}
+		listen("graphite", cfg.Graphite.TCP, cfg.Graphite.UDP, parser)
+	}
+}
+
+func stepOrDefault(step int64) int64 {
+	if step <= 0 {
+		return int64(backend.MinStep)
+	}
+	return step
+}
+
+func listen(name, tcpAddr, udpAddr string, parser Parser) {
+	if tcpAddr != "" {
+		l := &Listener{Name: name, Network: "tcp", Addr: tcpAddr, parser: parser}
+		listeners = append(listeners, l)
+		go l.serveTCP()
+	}
+
+	if udpAddr != "" {
+		l := &Listener{Name: name, Network: "udp", Addr: udpAddr, parser: parser}
+		listeners = append(listeners, l)
+		go l.serveUDP()
+	}
+}
+
+// GetStats 返回各个监听收到的合法/非法行数
+func GetStats() []ListenerStat {
+	stats := []ListenerStat{}
+	for _, l := range listeners {
+		stats = append(stats, ListenerStat{
+			Name:     l.Name,
+			Network:  l.Network,
+			Addr:     l.Addr,
+			Accepted: atomic.LoadInt64(&l.accepted),
+			Rejected: atomic.LoadInt64(&l.rejected),
+		})
+	}
+	return stats
+}
+
+func (l *Listener) serveTCP() {
+	ln, err := net.Listen("tcp", l.Addr)
+	if err != nil {
+		logger.Fatalf("%s cannot listen tcp %s: %v", l.Name, l.Addr, err)
+		os.Exit(1)
+	}
+	logger.Infof("%s listening tcp %s", l.Name, l.Addr)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			logger.Warning("listener accept error: ", err)
+			time.Sleep(time.Duration(100) * time.Millisecond)
+			continue
+		}
+
+		go l.handleConn(conn)
+	}
+}
+
+func (l *Listener) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReaderSize(conn, maxLineLength)
+	items := make([]*dataobj.MetricValue, 0, batchSize)
+	for {
+		line, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			logger.Warningf("%s line from %s is too long, close the connection", l.Name, conn.RemoteAddr())
+			atomic.AddInt64(&l.rejected, 1)
+			break
+		}
+
+		if item := l.parse(string(line)); item != nil {
+			items = append(items, item)
+		}
+
+		// 攒够一批, 或者连接上暂时没有更多的数据时发送, 避免数据长时间积压在这里
+		if len(items) >= batchSize || (len(items) > 0 && r.Buffered() == 0) {
+			push(items)
+			items = make([]*dataobj.MetricValue, 0, batchSize)
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				logger.Warningf("%s read from %s error: %v", l.Name, conn.RemoteAddr(), err)
+			}
+			break
+		}
+	}
+
+	push(items)
+}
+
+func (l *Listener) serveUDP() {
+	addr, err := net.ResolveUDPAddr("udp", l.Addr)
+	if err != nil {
+		logger.Fatalf("%s cannot resolve udp %s: %v", l.Name, l.Addr, err)
+		os.Exit(1)
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		logger.Fatalf("%s cannot listen udp %s: %v", l.Name, l.Addr, err)
+		os.Exit(1)
+	}
+	logger.Infof("%s listening udp %s", l.Name, l.Addr)
+
+	buf := make([]byte, maxLineLength)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			logger.Warningf("%s read udp error: %v", l.Name, err)
+			continue
+		}
+
+		// 一个包里可能有多行
+		items := []*dataobj.MetricValue{}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			if item := l.parse(line); item != nil {
+				items = append(items, item)
+			}
+		}
+		push(items)
+	}
+}
+
+// parse 解析一行数据并校验, 非法的行返回nil
+func (l *Listener) parse(line string) *dataobj.MetricValue {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+
+	item, err := l.parser.Parse(line)
+	if err == nil {
+		err = item.CheckValidity()
+	}
+
+	if err != nil {
+		atomic.AddInt64(&l.rejected, 1)
+		logger.Debugf("%s %s recv invalid line: %v", l.Name, l.Network, err)
+		return nil
+	}
+
+	atomic.AddInt64(&l.accepted, 1)
+	return item
+}
+
+func push(items []*dataobj.MetricValue) {
+	if len(items) == 0 {
+		return
+	}
+
+	if config.Config.Tsdb.Enabled {
+		backend.Push2TsdbSendQueue(items)
+	}
+
+	if config.Config.Judge.Enabled {
+		backend.Push2JudgeSendQueue(items)
+	}
+
+	if config.Config.Index.Publish.Enabled {
+		backend.Push2IndexQueue(items)
+	}
+}
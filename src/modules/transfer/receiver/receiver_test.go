@@ -0,0 +1,75 @@
+package receiver
+
+import (
+	"testing"
+
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/config"
+)
+
+func Test_OpenTSDBParse(t *testing.T) {
+	p := &OpenTSDBParser{Step: 10, EndpointTags: []string{"endpoint", "host"}}
+
+	item, err := p.Parse("put sys.cpu.user 1560000000123 42.5 host=web01 cpu=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = item.CheckValidity(); err != nil {
+		t.Fatal(err)
+	}
+
+	if item.Endpoint != "web01" || item.Metric != "sys.cpu.user" || item.Timestamp != 1560000000 ||
+		item.Value != 42.5 || item.Tags != "cpu=0" {
+		t.Fatalf("got %v", item)
+	}
+
+	for _, line := range []string{
+		"put sys.cpu.user 1560000000 42.5 cpu=0",
+		"put sys.cpu.user 1560000000 abc host=web01",
+		"version",
+	} {
+		if _, err := p.Parse(line); err == nil {
+			t.Fatalf("expect error: %s", line)
+		}
+	}
+}
+
+func Test_GraphiteParse(t *testing.T) {
+	p, err := NewGraphiteParser(60, []config.GraphiteRule{
+		{Filter: "servers.*", Template: "_.endpoint.metric*"},
+		{Filter: "apps.*.*", Template: "_.app.endpoint.metric*"},
+	}, "endpoint.metric*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		line     string
+		endpoint string
+		metric   string
+		tags     string
+	}{
+		{"servers.web01.cpu.idle 98.5 1560000000", "web01", "cpu.idle", ""},
+		{"apps.api.web02.req.count 10 1560000000", "web02", "req.count", "app=api"},
+		{"web03.mem.used;dc=bj 1024 1560000000", "web03", "mem.used", "dc=bj"},
+	}
+
+	for _, c := range cases {
+		item, err := p.Parse(c.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = item.CheckValidity(); err != nil {
+			t.Fatal(err)
+		}
+
+		if item.Endpoint != c.endpoint || item.Metric != c.metric || item.Tags != c.tags || item.Timestamp != 1560000000 {
+			t.Fatalf("%s: got %v", c.line, item)
+		}
+	}
+
+	if _, err := NewGraphiteParser(60, nil, "metric*.endpoint"); err == nil {
+		t.Fatal("expect template error")
+	}
+}
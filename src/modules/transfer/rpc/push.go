@@ -54,6 +54,15 @@ func (this *Transfer) Push(args []*dataobj.MetricValue, reply *TransferResp) err
 	if Config.Tsdb.Enabled {
 		backend.Push2TsdbSendQueue(items)
 	}
+
+	if Config.Judge.Enabled {
+		backend.Push2JudgeSendQueue(items)
+	}
+
+	if Config.Index.Publish.Enabled {
+		backend.Push2IndexQueue(items)
+	}
+
 	if reply.Invalid == 0 {
 		reply.Msg = "ok"
 	}
@@ -9,7 +9,9 @@ import (
 
 	"github.com/open-falcon/falcon-ng/src/modules/transfer/backend"
 	"github.com/open-falcon/falcon-ng/src/modules/transfer/config"
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/cron"
 	"github.com/open-falcon/falcon-ng/src/modules/transfer/http"
+	"github.com/open-falcon/falcon-ng/src/modules/transfer/receiver"
 	"github.com/open-falcon/falcon-ng/src/modules/transfer/rpc"
 
 	"github.com/toolkits/pkg/file"
@@ -50,6 +52,14 @@ func main() {
 	config.InitLogger()
 
 	backend.Init()
+	receiver.Start()
+
+	if config.Config.Judge.Enabled {
+		go cron.SyncStraLoop()
+		if config.Config.Judge.FromPortal {
+			go cron.SyncJudgeLoop()
+		}
+	}
 
 	go rpc.Start()
 	http.Start()
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/toolkits/pkg/file"
+)
+
+type ConfYaml struct {
+	Debug   bool           `yaml:"debug"`
+	Logger  LoggerSection  `yaml:"logger"`
+	HTTP    HTTPSection    `yaml:"http"`
+	RPC     RPCSection     `yaml:"rpc"`
+	Storage StorageSection `yaml:"storage"`
+}
+
+type LoggerSection struct {
+	Level     string `yaml:"level"`
+	Dir       string `yaml:"dir"`
+	Rotatenum int    `yaml:"rotatenum"`
+	Rotatemb  uint64 `yaml:"rotatemb"`
+}
+
+type HTTPSection struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"`
+	Access  string `yaml:"access"`
+}
+
+type RPCSection struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"`
+}
+
+type StorageSection struct {
+	Dir           string `yaml:"dir"`           // 数据文件目录
+	FlushInterval int    `yaml:"flushInterval"` // 内存中的chunk多久落盘一次,单位sec
+	ChunkPoints   int    `yaml:"chunkPoints"`   // 单个chunk最多容纳的点数,超过即落盘
+	Retention     int    `yaml:"retention"`     // 原始数据保留天数
+	MaxPoints     int    `yaml:"maxPoints"`     // 单次查询最多返回的点数,超过则自动放大step
+
+	Rollups []RollupSection `yaml:"rollups"` // 降采样层级, 为空时只保留原始数据
+}
+
+type RollupSection struct {
+	Step      int `yaml:"step"`      // 单位sec
+	Retention int `yaml:"retention"` // 单位day
+}
+
+var (
+	Config *ConfYaml
+	lock   = new(sync.RWMutex)
+)
+
+func GetCfgYml() *ConfYaml {
+	lock.RLock()
+	defer lock.RUnlock()
+	return Config
+}
+
+func Parse(conf string) error {
+	var c ConfYaml
+	err := file.ReadYaml(conf, &c)
+	if err != nil {
+		return fmt.Errorf("cannot read yml[%s]: %v", conf, err)
+	}
+
+	if c.Storage.Dir == "" {
+		c.Storage.Dir = "./data"
+	}
+
+	if c.Storage.FlushInterval <= 0 {
+		c.Storage.FlushInterval = 300
+	}
+
+	if c.Storage.ChunkPoints <= 0 {
+		c.Storage.ChunkPoints = 120
+	}
+
+	if c.Storage.Retention <= 0 {
+		c.Storage.Retention = 30
+	}
+
+	if c.Storage.MaxPoints <= 0 {
+		c.Storage.MaxPoints = 1440
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	Config = &c
+
+	return err
+}
@@ -0,0 +1,3 @@
+package config
+
+const Version = 1
@@ -0,0 +1,26 @@
+package routes
+
+import "github.com/gin-gonic/gin"
+
+func renderMessage(c *gin.Context, v interface{}) {
+	if v == nil {
+		c.JSON(200, gin.H{"err": ""})
+		return
+	}
+
+	switch t := v.(type) {
+	case string:
+		c.JSON(200, gin.H{"err": t})
+	case error:
+		c.JSON(200, gin.H{"err": t.Error()})
+	}
+}
+
+func renderData(c *gin.Context, data interface{}, err error) {
+	if err == nil {
+		c.JSON(200, gin.H{"dat": data, "err": ""})
+		return
+	}
+
+	renderMessage(c, err.Error())
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// Config routes
+func Config(r *gin.Engine) {
+	sys := r.Group("/api/tsdb")
+	{
+		sys.GET("/ping", ping)
+		sys.GET("/version", version)
+		sys.GET("/pid", pid)
+		sys.GET("/addr", addr)
+
+		sys.GET("/stats", stats)
+		sys.POST("/query", query)
+	}
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/errors"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/modules/tsdb/storage"
+)
+
+func stats(c *gin.Context) {
+	renderData(c, storage.Store.Stats(), nil)
+}
+
+func query(c *gin.Context) {
+	var param dataobj.TsdbQueryParam
+	errors.Dangerous(c.ShouldBindJSON(&param))
+
+	resp, err := storage.Store.Query(param)
+	renderData(c, resp, err)
+}
@@ -0,0 +1,34 @@
+package rpc
+
+import (
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/modules/tsdb/storage"
+)
+
+func (this *Tsdb) Ping(args string, reply *string) error {
+	*reply = args
+	return nil
+}
+
+func (this *Tsdb) Send(items []*dataobj.TsdbItem, resp *dataobj.SimpleRpcResponse) error {
+	storage.Store.Push(items)
+	resp.Code = 0
+	return nil
+}
+
+// Backfill 补写副本之间缺失的点, 由transfer的修复任务调用
+func (this *Tsdb) Backfill(items []*dataobj.TsdbItem, resp *dataobj.SimpleRpcResponse) error {
+	storage.Store.Backfill(items)
+	resp.Code = 0
+	return nil
+}
+
+func (this *Tsdb) Query(param dataobj.TsdbQueryParam, resp *dataobj.TsdbQueryResponse) error {
+	r, err := storage.Store.Query(param)
+	if err != nil {
+		return err
+	}
+
+	*resp = *r
+	return nil
+}
@@ -0,0 +1,284 @@
+package storage
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Chunk 参考Facebook Gorilla的压缩方式:
+// 时间戳使用delta-of-delta编码, 数值与前一个值XOR后只记录有效bit
+type Chunk struct {
+	b        bstream
+	num      uint16
+	mint     int64
+	maxt     int64
+	t        int64
+	tDelta   int64
+	v        float64
+	leading  uint8
+	trailing uint8
+}
+
+func NewChunk() *Chunk {
+	return &Chunk{
+		b:       bstream{stream: make([]byte, 0, 128)},
+		leading: 0xff,
+	}
+}
+
+func (c *Chunk) NumPoints() int {
+	return int(c.num)
+}
+
+func (c *Chunk) MinTime() int64 {
+	return c.mint
+}
+
+func (c *Chunk) MaxTime() int64 {
+	return c.maxt
+}
+
+// Bytes 返回编码后数据的拷贝, 可以在chunk继续写入的同时安全使用
+func (c *Chunk) Bytes() []byte {
+	src := c.b.bytes()
+	ret := make([]byte, len(src))
+	copy(ret, src)
+	return ret
+}
+
+// Append 时间戳必须单调递增, 由调用方保证
+func (c *Chunk) Append(t int64, v float64) {
+	if c.num == 0 {
+		c.b.writeBits(uint64(t), 64)
+		c.b.writeBits(math.Float64bits(v), 64)
+		c.mint = t
+	} else {
+		tDelta := t - c.t
+		c.writeDod(tDelta - c.tDelta)
+		c.writeVDelta(v)
+		c.tDelta = tDelta
+	}
+
+	c.t = t
+	c.v = v
+	c.maxt = t
+	c.num++
+}
+
+func (c *Chunk) writeDod(dod int64) {
+	switch {
+	case dod == 0:
+		c.b.writeBit(false)
+	case bitRange(dod, 14):
+		c.b.writeBits(0x02, 2) // '10'
+		c.b.writeBits(uint64(dod), 14)
+	case bitRange(dod, 17):
+		c.b.writeBits(0x06, 3) // '110'
+		c.b.writeBits(uint64(dod), 17)
+	case bitRange(dod, 20):
+		c.b.writeBits(0x0e, 4) // '1110'
+		c.b.writeBits(uint64(dod), 20)
+	default:
+		c.b.writeBits(0x0f, 4) // '1111'
+		c.b.writeBits(uint64(dod), 64)
+	}
+}
+
+func (c *Chunk) writeVDelta(v float64) {
+	vDelta := math.Float64bits(v) ^ math.Float64bits(c.v)
+
+	if vDelta == 0 {
+		c.b.writeBit(false)
+		return
+	}
+	c.b.writeBit(true)
+
+	leading := uint8(bits.LeadingZeros64(vDelta))
+	trailing := uint8(bits.TrailingZeros64(vDelta))
+
+	// leading只用5个bit记录
+	if leading >= 32 {
+		leading = 31
+	}
+
+	if c.leading != 0xff && leading >= c.leading && trailing >= c.trailing {
+		c.b.writeBit(false)
+		c.b.writeBits(vDelta>>c.trailing, 64-int(c.leading)-int(c.trailing))
+		return
+	}
+
+	c.leading, c.trailing = leading, trailing
+
+	c.b.writeBit(true)
+	c.b.writeBits(uint64(leading), 5)
+
+	// sigbits为64时写入的是0, 读取时还原
+	sigbits := 64 - leading - trailing
+	c.b.writeBits(uint64(sigbits), 6)
+	c.b.writeBits(vDelta>>trailing, int(sigbits))
+}
+
+// bitRange x能否用nbits个bit表示
+func bitRange(x int64, nbits uint8) bool {
+	return -((1<<(nbits-1))-1) <= x && x <= 1<<(nbits-1)
+}
+
+// ChunkIterator 顺序解码一个chunk
+type ChunkIterator struct {
+	br       *bstream
+	numTotal uint16
+	numRead  uint16
+
+	t      int64
+	tDelta int64
+	v      float64
+
+	leading  uint8
+	trailing uint8
+
+	err error
+}
+
+func NewChunkIterator(b []byte, num int) *ChunkIterator {
+	return &ChunkIterator{
+		br:       newBReader(b),
+		numTotal: uint16(num),
+	}
+}
+
+func (it *ChunkIterator) At() (int64, float64) {
+	return it.t, it.v
+}
+
+func (it *ChunkIterator) Err() error {
+	return it.err
+}
+
+func (it *ChunkIterator) Next() bool {
+	if it.err != nil || it.numRead == it.numTotal {
+		return false
+	}
+
+	if it.numRead == 0 {
+		t, err := it.br.readBits(64)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		v, err := it.br.readBits(64)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.t = int64(t)
+		it.v = math.Float64frombits(v)
+		it.numRead++
+		return true
+	}
+
+	var d byte
+	for i := 0; i < 4; i++ {
+		d <<= 1
+		bit, err := it.br.readBit()
+		if err != nil {
+			it.err = err
+			return false
+		}
+		if !bit {
+			break
+		}
+		d |= 1
+	}
+
+	var sz uint8
+	var dod int64
+	switch d {
+	case 0x00:
+		// dod == 0
+	case 0x02:
+		sz = 14
+	case 0x06:
+		sz = 17
+	case 0x0e:
+		sz = 20
+	case 0x0f:
+		bits, err := it.br.readBits(64)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		dod = int64(bits)
+	}
+
+	if sz != 0 {
+		bits, err := it.br.readBits(int(sz))
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		// 还原负数
+		if bits > (1 << (sz - 1)) {
+			bits = bits - (1 << sz)
+		}
+		dod = int64(bits)
+	}
+
+	it.tDelta = it.tDelta + dod
+	it.t += it.tDelta
+
+	return it.readValue()
+}
+
+func (it *ChunkIterator) readValue() bool {
+	bit, err := it.br.readBit()
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	if bit {
+		bit, err = it.br.readBit()
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		if bit {
+			bits, err := it.br.readBits(5)
+			if err != nil {
+				it.err = err
+				return false
+			}
+			it.leading = uint8(bits)
+
+			bits, err = it.br.readBits(6)
+			if err != nil {
+				it.err = err
+				return false
+			}
+
+			mbits := uint8(bits)
+			if mbits == 0 {
+				mbits = 64
+			}
+			it.trailing = 64 - it.leading - mbits
+		}
+
+		mbits := int(64 - it.leading - it.trailing)
+		bits, err := it.br.readBits(mbits)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		vbits := math.Float64bits(it.v)
+		vbits ^= bits << it.trailing
+		it.v = math.Float64frombits(vbits)
+	}
+
+	it.numRead++
+	return true
+}
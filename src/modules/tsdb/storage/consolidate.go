@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"math"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+// ConsolFunc 与RRD中的概念保持一致
+const (
+	AVERAGE = "AVERAGE"
+	MAX     = "MAX"
+	MIN     = "MIN"
+	LAST    = "LAST"
+)
+
+// resolveStep 计算查询结果的step: 不能小于series的step, 必须是series step的整数倍,
+// 并且结果点数不能超过maxPoints
+func resolveStep(want, seriesStep int, start, end int64, maxPoints int) int {
+	if seriesStep <= 0 {
+		seriesStep = 1
+	}
+
+	step := want
+	if step < seriesStep {
+		step = seriesStep
+	}
+
+	if maxPoints > 0 && (end-start)/int64(step) > int64(maxPoints) {
+		step = int((end-start)/int64(maxPoints)) + 1
+	}
+
+	if step%seriesStep != 0 {
+		step += seriesStep - step%seriesStep
+	}
+
+	return step
+}
+
+// consolidate 按step对原始点做降采样, 和RRD一样每个时间戳代表(ts-step, ts]这个区间,
+// 没有数据的区间返回NaN
+func consolidate(pts []point, start, end int64, step int, consolFunc string) []*dataobj.RRDData {
+	ret := []*dataobj.RRDData{}
+	if step <= 0 || start > end {
+		return ret
+	}
+
+	s := int64(step)
+	first := alignUp(start, s)
+	if first > end {
+		return ret
+	}
+
+	n := int((end-first)/s) + 1
+	vals := make([]float64, n)
+	cnts := make([]int, n)
+
+	for _, p := range pts {
+		if math.IsNaN(p.v) {
+			continue
+		}
+
+		i := int((alignUp(p.t, s) - first) / s)
+		if i < 0 || i >= n {
+			continue
+		}
+
+		if cnts[i] == 0 {
+			vals[i] = p.v
+			cnts[i] = 1
+			continue
+		}
+
+		switch consolFunc {
+		case MAX:
+			if p.v > vals[i] {
+				vals[i] = p.v
+			}
+		case MIN:
+			if p.v < vals[i] {
+				vals[i] = p.v
+			}
+		case LAST:
+			vals[i] = p.v
+		default:
+			vals[i] += p.v
+		}
+		cnts[i]++
+	}
+
+	for i := 0; i < n; i++ {
+		v := math.NaN()
+		if cnts[i] > 0 {
+			v = vals[i]
+			if consolFunc != MAX && consolFunc != MIN && consolFunc != LAST {
+				v = v / float64(cnts[i])
+			}
+		}
+		ret = append(ret, dataobj.NewRRDData(first+int64(i)*s, v))
+	}
+
+	return ret
+}
+
+func alignUp(ts, step int64) int64 {
+	if r := ts % step; r != 0 {
+		return ts - r + step
+	}
+	return ts
+}
@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/toolkits/pkg/file"
+	"github.com/toolkits/pkg/str"
+)
+
+// 每个series一个数据文件, 路径: ${dir}/${md5[0:2]}/${md5}.tsd
+//
+// 文件格式:
+//   header: magic(4) | version(1) | endpointLen(2) | endpoint | counterLen(2) | counter
+//   record: mint(8) | maxt(8) | num(2) | step(4) | dstypeLen(1) | dstype | dataLen(4) | data | crc32(4)
+//
+// record是落盘的chunk, 只追加不修改, 过期数据由retention任务重写文件删除
+
+const (
+	fileMagic   = "FNTS"
+	fileVersion = 1
+	fileSuffix  = ".tsd"
+)
+
+var (
+	ErrBadMagic  = errors.New("bad tsdb file magic")
+	ErrBadRecord = errors.New("bad tsdb file record")
+)
+
+type fileHeader struct {
+	Endpoint string
+	Counter  string
+}
+
+type chunkRecord struct {
+	Mint   int64
+	Maxt   int64
+	Num    int
+	Step   int
+	DsType string
+	Data   []byte
+}
+
+func seriesFilePath(dir, key string) string {
+	md5 := str.MD5(key)
+	return filepath.Join(dir, md5[0:2], md5+fileSuffix)
+}
+
+func writeHeader(w io.Writer, h *fileHeader) error {
+	buf := make([]byte, 0, 9+len(h.Endpoint)+len(h.Counter))
+	buf = append(buf, fileMagic...)
+	buf = append(buf, fileVersion)
+	buf = appendString16(buf, h.Endpoint)
+	buf = appendString16(buf, h.Counter)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+func readHeader(r io.Reader) (*fileHeader, error) {
+	magic := make([]byte, 5)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+
+	if string(magic[:4]) != fileMagic {
+		return nil, ErrBadMagic
+	}
+
+	if magic[4] != fileVersion {
+		return nil, fmt.Errorf("unsupported tsdb file version %d", magic[4])
+	}
+
+	endpoint, err := readString16(r)
+	if err != nil {
+		return nil, err
+	}
+
+	counter, err := readString16(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileHeader{Endpoint: endpoint, Counter: counter}, nil
+}
+
+func encodeRecord(rec *chunkRecord) []byte {
+	buf := make([]byte, 0, 31+len(rec.DsType)+len(rec.Data))
+
+	var b8 [8]byte
+	binary.BigEndian.PutUint64(b8[:], uint64(rec.Mint))
+	buf = append(buf, b8[:]...)
+	binary.BigEndian.PutUint64(b8[:], uint64(rec.Maxt))
+	buf = append(buf, b8[:]...)
+	binary.BigEndian.PutUint16(b8[:2], uint16(rec.Num))
+	buf = append(buf, b8[:2]...)
+	binary.BigEndian.PutUint32(b8[:4], uint32(rec.Step))
+	buf = append(buf, b8[:4]...)
+	buf = append(buf, byte(len(rec.DsType)))
+	buf = append(buf, rec.DsType...)
+	binary.BigEndian.PutUint32(b8[:4], uint32(len(rec.Data)))
+	buf = append(buf, b8[:4]...)
+	buf = append(buf, rec.Data...)
+	binary.BigEndian.PutUint32(b8[:4], crc32.ChecksumIEEE(rec.Data))
+	buf = append(buf, b8[:4]...)
+
+	return buf
+}
+
+// readRecord 读取下一个record, need不为nil且返回false时跳过数据部分只返回元信息
+func readRecord(r *bufio.Reader, need func(rec *chunkRecord) bool) (*chunkRecord, error) {
+	head := make([]byte, 23)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+
+	rec := &chunkRecord{
+		Mint: int64(binary.BigEndian.Uint64(head[0:8])),
+		Maxt: int64(binary.BigEndian.Uint64(head[8:16])),
+		Num:  int(binary.BigEndian.Uint16(head[16:18])),
+		Step: int(binary.BigEndian.Uint32(head[18:22])),
+	}
+
+	dstype := make([]byte, int(head[22]))
+	if _, err := io.ReadFull(r, dstype); err != nil {
+		return nil, toUnexpectedEOF(err)
+	}
+	rec.DsType = string(dstype)
+
+	var b4 [4]byte
+	if _, err := io.ReadFull(r, b4[:]); err != nil {
+		return nil, toUnexpectedEOF(err)
+	}
+	size := int(binary.BigEndian.Uint32(b4[:]))
+
+	if need != nil && !need(rec) {
+		if _, err := r.Discard(size + 4); err != nil {
+			return nil, toUnexpectedEOF(err)
+		}
+		return rec, nil
+	}
+
+	data := make([]byte, size+4)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, toUnexpectedEOF(err)
+	}
+
+	rec.Data = data[:size]
+	if crc32.ChecksumIEEE(rec.Data) != binary.BigEndian.Uint32(data[size:]) {
+		return nil, ErrBadRecord
+	}
+
+	return rec, nil
+}
+
+// appendRecord 把chunk追加到series文件末尾, 文件不存在时先写header
+func appendRecord(path string, h *fileHeader, rec *chunkRecord) error {
+	if err := file.EnsureDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	buf := encodeRecord(rec)
+	if fi.Size() == 0 {
+		w := bufio.NewWriterSize(f, len(buf)+64)
+		if err = writeHeader(w, h); err != nil {
+			return err
+		}
+		if _, err = w.Write(buf); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+
+	_, err = f.Write(buf)
+	return err
+}
+
+// scanFile 顺序遍历文件中的record, fn返回false时停止遍历
+// need用来判断是否需要读取record的数据部分, 为nil表示全部读取, 跳过的record其Data为nil
+// 文件末尾不完整的record(比如进程异常退出时写了一半)会被忽略
+func scanFile(path string, need func(rec *chunkRecord) bool, fn func(rec *chunkRecord) bool) (*fileHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		rec, err := readRecord(r, need)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return h, nil
+		}
+
+		if err != nil {
+			return h, err
+		}
+
+		if !fn(rec) {
+			return h, nil
+		}
+	}
+}
+
+// rewriteFile 只保留keep返回true的record, 先写临时文件再rename
+// 返回保留下来的record数, 一个都不剩时删除文件
+func rewriteFile(path string, keep func(rec *chunkRecord) bool) (int, error) {
+	recs := []*chunkRecord{}
+	h, err := scanFile(path, nil, func(rec *chunkRecord) bool {
+		if keep(rec) {
+			recs = append(recs, rec)
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if len(recs) == 0 {
+		return 0, os.Remove(path)
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	w := bufio.NewWriter(f)
+	err = writeHeader(w, h)
+	for i := 0; i < len(recs) && err == nil; i++ {
+		_, err = w.Write(encodeRecord(recs[i]))
+	}
+
+	if err == nil {
+		err = w.Flush()
+	}
+	f.Close()
+
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+
+	return len(recs), os.Rename(tmp, path)
+}
+
+func appendString16(buf []byte, s string) []byte {
+	var b2 [2]byte
+	binary.BigEndian.PutUint16(b2[:], uint16(len(s)))
+	buf = append(buf, b2[:]...)
+	return append(buf, s...)
+}
+
+func readString16(r io.Reader) (string, error) {
+	var b2 [2]byte
+	if _, err := io.ReadFull(r, b2[:]); err != nil {
+		return "", toUnexpectedEOF(err)
+	}
+
+	s := make([]byte, int(binary.BigEndian.Uint16(b2[:])))
+	if _, err := io.ReadFull(r, s); err != nil {
+		return "", toUnexpectedEOF(err)
+	}
+
+	return string(s), nil
+}
+
+func toUnexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,298 @@
+package storage
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/toolkits/pkg/logger"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+// 降采样的数据放在 ${dir}/rollup/${step}/{avg,max,min}/ 下, 文件格式和原始数据相同
+const rollupDir = "rollup"
+
+// Tier 一个保留层级, Step为0表示原始数据
+type Tier struct {
+	Step      int
+	Retention int // 单位day
+}
+
+var rollupFuncs = []string{AVERAGE, MAX, MIN}
+
+// rollup series在一个层级上的降采样, 和consolidate一样每个时间戳代表(ts-step, ts]这个区间.
+// 区间内的原始点都写入之后(收到下一个区间的点)才把avg/max/min写入对应的series,
+// 进程重启时正在聚合的区间会丢失
+type rollup struct {
+	step   int64
+	series map[string]*Series // consolFunc -> series
+
+	bucket   int64
+	sum      float64
+	cnt      int
+	max, min float64
+}
+
+func newRollup(dir string, step int, endpoint, counter string) *rollup {
+	r := &rollup{
+		step:   int64(step),
+		series: make(map[string]*Series, len(rollupFuncs)),
+	}
+
+	for _, fn := range rollupFuncs {
+		s := newSeries(rollupSeriesDir(dir, step, fn), endpoint, counter)
+		if _, err := os.Stat(s.path); err == nil {
+			if loaded, err := loadSeries(s.path); err != nil {
+				logger.Errorf("load rollup file %s failed: %v", s.path, err)
+			} else {
+				loaded.Endpoint, loaded.Counter = endpoint, counter
+				s = loaded
+			}
+		}
+
+		// 已经写入的区间不再重复聚合
+		if s.lastTs > r.bucket {
+			r.bucket = s.lastTs
+		}
+		r.series[fn] = s
+	}
+
+	return r
+}
+
+func rollupSeriesDir(dir string, step int, fn string) string {
+	return filepath.Join(dir, rollupDir, strconv.Itoa(step), fn)
+}
+
+// add 加入一个原始点, 调用方持有raw series的锁, 点是按时间递增的
+func (r *rollup) add(t int64, v float64, dsType string, chunkPoints int) {
+	if math.IsNaN(v) {
+		return
+	}
+
+	bucket := alignUp(t, r.step)
+	if bucket < r.bucket || (bucket == r.bucket && r.cnt == 0) {
+		// 这个区间已经写入过了
+		return
+	}
+
+	if bucket != r.bucket {
+		r.emit(dsType, chunkPoints)
+		r.bucket, r.sum, r.cnt, r.max, r.min = bucket, 0, 0, v, v
+	}
+
+	r.sum += v
+	r.cnt++
+	r.max = math.Max(r.max, v)
+	r.min = math.Min(r.min, v)
+}
+
+func (r *rollup) emit(dsType string, chunkPoints int) {
+	if r.cnt == 0 {
+		return
+	}
+
+	values := map[string]float64{
+		AVERAGE: r.sum / float64(r.cnt),
+		MAX:     r.max,
+		MIN:     r.min,
+	}
+
+	for fn, s := range r.series {
+		if err := s.appendRollup(r.bucket, values[fn], int(r.step), dsType, chunkPoints); err != nil {
+			logger.Error(err)
+		}
+	}
+	r.cnt = 0
+}
+
+// appendRollup 直接写入聚合好的值, 不需要再按DsType计算
+func (s *Series) appendRollup(t int64, v float64, step int, dsType string, chunkPoints int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if t <= s.lastTs {
+		return nil
+	}
+
+	s.DsType = dsType
+	s.Step = step
+
+	if s.head == nil {
+		s.head = NewChunk()
+	}
+
+	s.head.Append(t, v)
+	s.lastTs = t
+
+	if s.head.NumPoints() >= chunkPoints {
+		return s.flushLocked()
+	}
+	return nil
+}
+
+func (r *rollup) flush() {
+	for _, s := range r.series {
+		if err := s.flush(); err != nil {
+			logger.Error(err)
+		}
+	}
+}
+
+// retain 返回这个层级是否已经没有数据
+func (r *rollup) retain(cutoff int64) bool {
+	empty := true
+	for _, s := range r.series {
+		e, err := s.retain(cutoff)
+		if err != nil {
+			logger.Errorf("retain rollup %s/%s failed: %v", s.Endpoint, s.Counter, err)
+			e = false
+		}
+		empty = empty && e
+	}
+	return empty
+}
+
+func (r *rollup) empty() bool {
+	for _, s := range r.series {
+		s.RLock()
+		e := s.diskMint == 0 && (s.head == nil || s.head.NumPoints() == 0)
+		s.RUnlock()
+		if !e {
+			return false
+		}
+	}
+	return true
+}
+
+// loadRollupOnly 原始数据已经全部过期但是还有降采样数据的series, 也要加载到索引中
+func (s *Storage) loadRollupOnly() error {
+	dir := filepath.Join(s.opts.Dir, rollupDir)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		if strings.HasSuffix(path, fileSuffix+".tmp") {
+			os.Remove(path)
+			return nil
+		}
+
+		if !strings.HasSuffix(path, fileSuffix) {
+			return nil
+		}
+
+		h, err := scanFile(path, nil, func(*chunkRecord) bool { return false })
+		if err != nil {
+			logger.Errorf("load rollup file %s failed: %v", path, err)
+			return nil
+		}
+
+		key := dataobj.PKWithCounter(h.Endpoint, h.Counter)
+		if _, exists := s.series[key]; exists {
+			return nil
+		}
+
+		series := newSeries(s.opts.Dir, h.Endpoint, h.Counter)
+		s.attachRollups(series)
+		s.series[key] = series
+		return nil
+	})
+}
+
+// pickTier 根据查询的时间范围和step选择层级, tiers按step从小到大排列, 第一个是原始数据.
+// 在能覆盖start的层级中选择step不超过期望step的最粗的一个, 点数最少;
+// 没有这样的层级时选择能覆盖start的最细的层级, 都覆盖不了时选择保留最久的层级
+func pickTier(tiers []Tier, start int64, want int, now int64) int {
+	covered := func(t Tier) bool {
+		return start >= now-int64(t.Retention)*86400
+	}
+
+	chosen := -1
+	for i, t := range tiers {
+		if covered(t) && t.Step <= want {
+			chosen = i
+		}
+	}
+	if chosen != -1 {
+		return chosen
+	}
+
+	for i, t := range tiers {
+		if covered(t) {
+			return i
+		}
+	}
+
+	longest := 0
+	for i, t := range tiers {
+		if t.Retention > tiers[longest].Retention {
+			longest = i
+		}
+	}
+	return longest
+}
+
+func (s *Storage) tiers() []Tier {
+	tiers := []Tier{{Step: 0, Retention: s.opts.Retention}}
+	return append(tiers, s.opts.Rollups...)
+}
+
+func (s *Storage) attachRollups(series *Series) {
+	for _, t := range s.opts.Rollups {
+		series.rollups = append(series.rollups, newRollup(s.opts.Dir, t.Step, series.Endpoint, series.Counter))
+	}
+}
+
+// RetainRollups 按各层级的保留时间删除降采样的数据
+func (s *Storage) RetainRollups(now int64) {
+	for _, series := range s.all() {
+		series.RLock()
+		rollups := series.rollups
+		series.RUnlock()
+
+		for i, r := range rollups {
+			r.retain(now - int64(s.opts.Rollups[i].Retention)*86400)
+		}
+	}
+}
+
+func (s *Storage) retentionLoop() {
+	for {
+		now := time.Now().Unix()
+		s.Retain(now - int64(s.opts.Retention)*86400)
+		s.RetainRollups(now)
+		time.Sleep(time.Hour)
+	}
+}
+
+// queryRollup 从降采样的数据中查询, rollup的点已经是区间的聚合值
+func (s *Series) queryRollup(tier int, consolFunc string, start, end int64) ([]point, string, int, error) {
+	s.RLock()
+	r := s.rollups[tier-1]
+	dsType := s.DsType
+	s.RUnlock()
+
+	fn := consolFunc
+	if _, exists := r.series[fn]; !exists {
+		fn = AVERAGE
+	}
+
+	pts, _, _, err := r.series[fn].query(start, end)
+	if dsType == "" {
+		dsType = dataobj.GAUGE
+	}
+	return pts, dsType, int(r.step), err
+}
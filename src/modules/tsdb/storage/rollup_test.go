@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+func Test_PickTier(t *testing.T) {
+	now := int64(1560000000)
+	tiers := []Tier{{Step: 10, Retention: 2}, {Step: 300, Retention: 30}, {Step: 3600, Retention: 365}}
+
+	cases := []struct {
+		start  int64
+		want   int
+		expect int
+	}{
+		{now - 3600, 10, 0},         // 最近的数据用原始点
+		{now - 86400, 300, 1},       // 期望的step较大时用降采样数据
+		{now - 10*86400, 10, 1},     // 超过原始数据的保留时间
+		{now - 100*86400, 600, 2},   // 只有1h层级能覆盖
+		{now - 1000*86400, 3600, 2}, // 都覆盖不了时用保留最久的
+	}
+
+	for _, c := range cases {
+		if got := pickTier(tiers, c.start, c.want, now); got != c.expect {
+			t.Errorf("start: %d, want: %d, expect tier %d, got %d", now-c.start, c.want, c.expect, got)
+		}
+	}
+}
+
+func Test_StorageRollup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := Options{Dir: dir, ChunkPoints: 50, Retention: 2, MaxPoints: 1000, Rollups: []Tier{{Step: 60, Retention: 30}}}
+	s, err := NewStorage(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Unix() - 3600
+	start -= start % 60
+	items := []*dataobj.TsdbItem{}
+	for i := 1; i <= 360; i++ {
+		items = append(items, &dataobj.TsdbItem{
+			Endpoint:  "host1",
+			Metric:    "cpu.idle",
+			Value:     float64(i),
+			Timestamp: start + int64(i*10),
+			DsType:    dataobj.GAUGE,
+			Step:      10,
+			Min:       "U",
+			Max:       "U",
+		})
+	}
+	s.Push(items)
+	s.Flush()
+
+	// 重新加载, 验证降采样的数据也可以从磁盘读出
+	s, err = NewStorage(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := func(consolFunc string, step int) *dataobj.TsdbQueryResponse {
+		resp, err := s.Query(dataobj.TsdbQueryParam{
+			Start:      start + 60,
+			End:        start + 3600,
+			ConsolFunc: consolFunc,
+			Endpoint:   "host1",
+			Counter:    "cpu.idle",
+			Step:       step,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := query(AVERAGE, 10)
+	if resp.Step != 10 || len(resp.Values) != 355 {
+		t.Fatalf("raw: step %d, values %d", resp.Step, len(resp.Values))
+	}
+
+	// (start, start+60] 内的点是1~6, 最后一个区间还没有结束, 不会写入降采样数据
+	for _, fn := range []string{AVERAGE, MAX, MIN} {
+		resp = query(fn, 60)
+		expect := map[string]float64{AVERAGE: 3.5, MAX: 6, MIN: 1}[fn]
+		if resp.Step != 60 || len(resp.Values) != 60 || float64(resp.Values[0].Value) != expect {
+			t.Fatalf("%s: step %d, values %v", fn, resp.Step, resp.Values[:2])
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+// 单个chunk最多容纳的点数, 受record中num字段(uint16)限制
+const maxChunkPoints = math.MaxUint16
+
+// errSeriesRemoved series已经被Retain从索引中移除, 需要重新获取
+var errSeriesRemoved = fmt.Errorf("series removed")
+
+type point struct {
+	t int64
+	v float64
+}
+
+type Series struct {
+	sync.RWMutex
+	Endpoint string
+	Counter  string
+	DsType   string
+	Step     int
+
+	path string
+	head *Chunk
+
+	lastTs   int64 // 最后写入的时间戳, 乱序和重复的点直接丢弃
+	diskMint int64 // 磁盘上最早的数据时间, 0表示磁盘上没有数据
+
+	// COUNTER|DERIVE 需要前一个原始值来计算速率
+	rawTs  int64
+	rawVal float64
+
+	// 各个降采样层级, 和Options.Rollups一一对应
+	rollups []*rollup
+
+	removed bool
+}
+
+func newSeries(dir, endpoint, counter string) *Series {
+	return &Series{
+		Endpoint: endpoint,
+		Counter:  counter,
+		path:     seriesFilePath(dir, dataobj.PKWithCounter(endpoint, counter)),
+	}
+}
+
+func (s *Series) header() *fileHeader {
+	return &fileHeader{Endpoint: s.Endpoint, Counter: s.Counter}
+}
+
+// push 写入一个点, 返回该点是否被接受
+func (s *Series) push(item *dataobj.TsdbItem, chunkPoints int) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.removed {
+		return false, errSeriesRemoved
+	}
+
+	dsType := formatDsType(item.DsType)
+	if dsType != s.DsType || item.Step != s.Step {
+		// 类型或周期发生变化, 之前的数据先落盘, 速率重新计算
+		if err := s.flushLocked(); err != nil {
+			return false, err
+		}
+
+		s.DsType = dsType
+		s.Step = item.Step
+		s.rawTs = 0
+	}
+
+	value, ok := s.calc(item)
+	if !ok {
+		return false, nil
+	}
+
+	if item.Timestamp <= s.lastTs {
+		return false, nil
+	}
+
+	if s.head == nil {
+		s.head = NewChunk()
+	}
+
+	s.head.Append(item.Timestamp, value)
+	s.lastTs = item.Timestamp
+
+	for _, r := range s.rollups {
+		r.add(item.Timestamp, value, s.DsType, chunkPoints)
+	}
+
+	if s.head.NumPoints() >= chunkPoints {
+		if err := s.flushLocked(); err != nil {
+			// 落盘一直失败时丢弃内存中的数据, 避免chunk无限增长
+			if s.head.NumPoints() >= maxChunkPoints {
+				s.head = nil
+			}
+			return true, err
+		}
+	}
+
+	return true, nil
+}
+
+// calc 按照DsType计算要存储的值, COUNTER|DERIVE存储的是每秒速率
+func (s *Series) calc(item *dataobj.TsdbItem) (float64, bool) {
+	value := item.Value
+
+	if s.DsType == dataobj.COUNTER || s.DsType == dataobj.DERIVE {
+		if item.Timestamp <= s.rawTs {
+			return 0, false
+		}
+
+		prevTs, prevVal := s.rawTs, s.rawVal
+		s.rawTs, s.rawVal = item.Timestamp, item.Value
+
+		heartbeat := int64(item.Heartbeat)
+		if heartbeat <= 0 {
+			heartbeat = int64(item.Step * 2)
+		}
+
+		// 第一个点或者间隔超过heartbeat, 无法计算速率
+		if prevTs == 0 || item.Timestamp-prevTs > heartbeat {
+			return 0, false
+		}
+
+		value = (item.Value - prevVal) / float64(item.Timestamp-prevTs)
+
+		// 计数器重置或者回绕
+		if s.DsType == dataobj.COUNTER && value < 0 {
+			return 0, false
+		}
+	}
+
+	if min, err := strconv.ParseFloat(item.Min, 64); err == nil && value < min {
+		return 0, false
+	}
+
+	if max, err := strconv.ParseFloat(item.Max, 64); err == nil && value > max {
+		return 0, false
+	}
+
+	return value, true
+}
+
+func (s *Series) flush() error {
+	s.Lock()
+	defer s.Unlock()
+	return s.flushLocked()
+}
+
+func (s *Series) flushLocked() error {
+	if s.head == nil || s.head.NumPoints() == 0 {
+		return nil
+	}
+
+	rec := &chunkRecord{
+		Mint:   s.head.MinTime(),
+		Maxt:   s.head.MaxTime(),
+		Num:    s.head.NumPoints(),
+		Step:   s.Step,
+		DsType: s.DsType,
+		Data:   s.head.Bytes(),
+	}
+
+	if err := appendRecord(s.path, s.header(), rec); err != nil {
+		return fmt.Errorf("flush series %s/%s failed: %v", s.Endpoint, s.Counter, err)
+	}
+
+	if s.diskMint == 0 || rec.Mint < s.diskMint {
+		s.diskMint = rec.Mint
+	}
+	s.head = nil
+
+	return nil
+}
+
+// query 读取[start, end]之间的原始点, 按时间有序
+func (s *Series) query(start, end int64) ([]point, string, int, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	pts := []point{}
+
+	if s.diskMint != 0 {
+		overlap := func(rec *chunkRecord) bool {
+			return rec.Maxt >= start && rec.Mint <= end
+		}
+
+		var derr error
+		_, err := scanFile(s.path, overlap, func(rec *chunkRecord) bool {
+			if rec.Data == nil {
+				return true
+			}
+			pts, derr = decodeRange(pts, rec.Data, rec.Num, start, end)
+			return derr == nil
+		})
+
+		if err != nil && !os.IsNotExist(err) {
+			return nil, s.DsType, s.Step, err
+		}
+
+		if derr != nil {
+			return nil, s.DsType, s.Step, derr
+		}
+	}
+
+	if s.head != nil && s.head.NumPoints() > 0 && s.head.MaxTime() >= start && s.head.MinTime() <= end {
+		var err error
+		pts, err = decodeRange(pts, s.head.Bytes(), s.head.NumPoints(), start, end)
+		if err != nil {
+			return nil, s.DsType, s.Step, err
+		}
+	}
+
+	// 补写的chunk时间上可能和之前的chunk重叠
+	sort.Slice(pts, func(i, j int) bool { return pts[i].t < pts[j].t })
+
+	return pts, s.DsType, s.Step, nil
+}
+
+// backfill 补写副本之间缺失的点, 值已经是存储的值(COUNTER|DERIVE为速率), 不再计算.
+// 点直接作为一个单独的chunk落盘, 不影响正在写入的head, 也不写入降采样数据
+func (s *Series) backfill(pts []point, step int, dsType string) error {
+	if len(pts) == 0 {
+		return nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.removed {
+		return errSeriesRemoved
+	}
+
+	if s.DsType == "" {
+		s.DsType = formatDsType(dsType)
+		s.Step = step
+	}
+
+	sort.Slice(pts, func(i, j int) bool { return pts[i].t < pts[j].t })
+
+	for len(pts) > 0 {
+		n := len(pts)
+		if n > maxChunkPoints {
+			n = maxChunkPoints
+		}
+
+		c := NewChunk()
+		for _, p := range pts[:n] {
+			c.Append(p.t, p.v)
+		}
+
+		rec := &chunkRecord{
+			Mint:   c.MinTime(),
+			Maxt:   c.MaxTime(),
+			Num:    c.NumPoints(),
+			Step:   s.Step,
+			DsType: s.DsType,
+			Data:   c.Bytes(),
+		}
+
+		if err := appendRecord(s.path, s.header(), rec); err != nil {
+			return fmt.Errorf("backfill series %s/%s failed: %v", s.Endpoint, s.Counter, err)
+		}
+
+		if s.diskMint == 0 || rec.Mint < s.diskMint {
+			s.diskMint = rec.Mint
+		}
+		if rec.Maxt > s.lastTs {
+			s.lastTs = rec.Maxt
+		}
+		pts = pts[n:]
+	}
+
+	return nil
+}
+
+// retain 删除磁盘上早于cutoff的chunk, 返回series是否已经没有任何数据
+func (s *Series) retain(cutoff int64) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.diskMint != 0 && s.diskMint < cutoff {
+		var mint int64
+		kept, err := rewriteFile(s.path, func(rec *chunkRecord) bool {
+			if rec.Maxt < cutoff {
+				return false
+			}
+			if mint == 0 || rec.Mint < mint {
+				mint = rec.Mint
+			}
+			return true
+		})
+		if err != nil {
+			return false, err
+		}
+
+		if kept == 0 {
+			mint = 0
+		}
+		s.diskMint = mint
+	}
+
+	return s.emptyLocked(cutoff), nil
+}
+
+func (s *Series) emptyLocked(cutoff int64) bool {
+	return s.diskMint == 0 && (s.head == nil || s.head.NumPoints() == 0) && s.lastTs < cutoff
+}
+
+func decodeRange(pts []point, data []byte, num int, start, end int64) ([]point, error) {
+	it := NewChunkIterator(data, num)
+	for it.Next() {
+		t, v := it.At()
+		if t < start {
+			continue
+		}
+		if t > end {
+			break
+		}
+		pts = append(pts, point{t: t, v: v})
+	}
+
+	return pts, it.Err()
+}
+
+// 其他类型统一转为 GAUGE
+func formatDsType(dsType string) string {
+	switch dsType {
+	case dataobj.COUNTER, dataobj.DERIVE:
+		return dsType
+	default:
+		return dataobj.GAUGE
+	}
+}
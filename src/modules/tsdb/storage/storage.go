@@ -0,0 +1,421 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/toolkits/pkg/file"
+	"github.com/toolkits/pkg/logger"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+	"github.com/open-falcon/falcon-ng/src/modules/tsdb/config"
+)
+
+type Options struct {
+	Dir         string
+	ChunkPoints int
+	Retention   int // 原始数据保留的天数
+	MaxPoints   int
+	Rollups     []Tier // 降采样的层级, 按step从小到大排列
+}
+
+type Storage struct {
+	sync.RWMutex
+	opts   Options
+	series map[string]*Series
+
+	pointsIn         int64
+	pointsDropped    int64
+	pointsBackfilled int64
+}
+
+type Stats struct {
+	Series           int   `json:"series"`
+	PointsIn         int64 `json:"pointsIn"`
+	PointsDropped    int64 `json:"pointsDropped"`
+	PointsBackfilled int64 `json:"pointsBackfilled"`
+}
+
+var Store *Storage
+
+func Init() {
+	cfg := config.Config.Storage
+
+	rollups := []Tier{}
+	for _, r := range cfg.Rollups {
+		rollups = append(rollups, Tier{Step: r.Step, Retention: r.Retention})
+	}
+
+	var err error
+	Store, err = NewStorage(Options{
+		Dir:         cfg.Dir,
+		ChunkPoints: cfg.ChunkPoints,
+		Retention:   cfg.Retention,
+		MaxPoints:   cfg.MaxPoints,
+		Rollups:     rollups,
+	})
+	if err != nil {
+		logger.Fatalf("init tsdb storage failed: %v", err)
+		os.Exit(1)
+	}
+
+	go Store.flushLoop(time.Duration(cfg.FlushInterval) * time.Second)
+	go Store.retentionLoop()
+}
+
+// NewStorage 创建存储并从磁盘加载已有的series
+func NewStorage(opts Options) (*Storage, error) {
+	if opts.ChunkPoints <= 0 || opts.ChunkPoints > maxChunkPoints {
+		opts.ChunkPoints = 120
+	}
+
+	if err := file.EnsureDir(opts.Dir); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(opts.Rollups, func(i, j int) bool { return opts.Rollups[i].Step < opts.Rollups[j].Step })
+	for _, t := range opts.Rollups {
+		if t.Step <= 0 || t.Retention <= 0 {
+			return nil, fmt.Errorf("invalid rollup tier: step %d, retention %d", t.Step, t.Retention)
+		}
+	}
+
+	s := &Storage{
+		opts:   opts,
+		series: make(map[string]*Series),
+	}
+
+	return s, s.load()
+}
+
+func (s *Storage) load() error {
+	start := time.Now()
+
+	err := filepath.Walk(s.opts.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			// 降采样的数据随着原始series一起加载
+			if path == filepath.Join(s.opts.Dir, rollupDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// 上次retention重写文件时异常退出留下的临时文件
+		if strings.HasSuffix(path, fileSuffix+".tmp") {
+			os.Remove(path)
+			return nil
+		}
+
+		if !strings.HasSuffix(path, fileSuffix) {
+			return nil
+		}
+
+		series, err := loadSeries(path)
+		if err != nil {
+			logger.Errorf("load tsdb file %s failed: %v", path, err)
+			return nil
+		}
+
+		s.attachRollups(series)
+		s.series[dataobj.PKWithCounter(series.Endpoint, series.Counter)] = series
+		return nil
+	})
+
+	if err == nil {
+		err = s.loadRollupOnly()
+	}
+
+	logger.Infof("load %d series from %s, cost %v", len(s.series), s.opts.Dir, time.Since(start))
+	return err
+}
+
+func loadSeries(path string) (*Series, error) {
+	series := &Series{path: path}
+
+	h, err := scanFile(path, func(*chunkRecord) bool { return false }, func(rec *chunkRecord) bool {
+		if series.diskMint == 0 || rec.Mint < series.diskMint {
+			series.diskMint = rec.Mint
+		}
+
+		if rec.Maxt > series.lastTs {
+			series.lastTs = rec.Maxt
+		}
+
+		series.DsType = rec.DsType
+		series.Step = rec.Step
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	series.Endpoint = h.Endpoint
+	series.Counter = h.Counter
+	return series, nil
+}
+
+func (s *Storage) get(key string) *Series {
+	s.RLock()
+	defer s.RUnlock()
+	return s.series[key]
+}
+
+func (s *Storage) getOrCreate(item *dataobj.TsdbItem) *Series {
+	return s.getOrCreateByCounter(item.Endpoint, dataobj.PKWithTags(item.Metric, item.Tags))
+}
+
+func (s *Storage) getOrCreateByCounter(endpoint, counter string) *Series {
+	key := dataobj.PKWithCounter(endpoint, counter)
+
+	if series := s.get(key); series != nil {
+		return series
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	series, exists := s.series[key]
+	if !exists {
+		series = newSeries(s.opts.Dir, endpoint, counter)
+		s.attachRollups(series)
+		s.series[key] = series
+	}
+
+	return series
+}
+
+func (s *Storage) all() []*Series {
+	s.RLock()
+	defer s.RUnlock()
+
+	ret := make([]*Series, 0, len(s.series))
+	for _, series := range s.series {
+		ret = append(ret, series)
+	}
+	return ret
+}
+
+// Push 写入数据, 返回被丢弃的点数
+func (s *Storage) Push(items []*dataobj.TsdbItem) int {
+	dropped := 0
+	for _, item := range items {
+		if item == nil || item.Endpoint == "" || item.Metric == "" || item.Step <= 0 {
+			logger.Warningf("invalid tsdb item: %v", item)
+			dropped++
+			continue
+		}
+
+		ok, err := s.getOrCreate(item).push(item, s.opts.ChunkPoints)
+		if err == errSeriesRemoved {
+			ok, err = s.getOrCreate(item).push(item, s.opts.ChunkPoints)
+		}
+		if err != nil {
+			logger.Error(err)
+		}
+
+		if !ok {
+			dropped++
+		}
+	}
+
+	atomic.AddInt64(&s.pointsIn, int64(len(items)))
+	atomic.AddInt64(&s.pointsDropped, int64(dropped))
+	return dropped
+}
+
+// Backfill 补写数据, 用于副本之间的修复, 返回被丢弃的点数
+func (s *Storage) Backfill(items []*dataobj.TsdbItem) int {
+	type batch struct {
+		series *Series
+		step   int
+		dsType string
+		pts    []point
+	}
+
+	batches := make(map[*Series]*batch)
+	dropped := 0
+	for _, item := range items {
+		if item == nil || item.Endpoint == "" || item.Metric == "" || item.Step <= 0 {
+			dropped++
+			continue
+		}
+
+		series := s.getOrCreate(item)
+		b, exists := batches[series]
+		if !exists {
+			b = &batch{series: series, step: item.Step, dsType: item.DsType}
+			batches[series] = b
+		}
+		b.pts = append(b.pts, point{t: item.Timestamp, v: item.Value})
+	}
+
+	for _, b := range batches {
+		err := b.series.backfill(b.pts, b.step, b.dsType)
+		if err == errSeriesRemoved {
+			err = s.getOrCreateByCounter(b.series.Endpoint, b.series.Counter).backfill(b.pts, b.step, b.dsType)
+		}
+		if err != nil {
+			logger.Error(err)
+			dropped += len(b.pts)
+		}
+	}
+
+	atomic.AddInt64(&s.pointsBackfilled, int64(len(items)-dropped))
+	return dropped
+}
+
+func (s *Storage) Query(param dataobj.TsdbQueryParam) (*dataobj.TsdbQueryResponse, error) {
+	resp := &dataobj.TsdbQueryResponse{
+		Start:    param.Start,
+		End:      param.End,
+		Endpoint: param.Endpoint,
+		Counter:  param.Counter,
+		DsType:   param.DsType,
+		Step:     param.Step,
+		Values:   []*dataobj.RRDData{},
+	}
+
+	if param.Start > param.End {
+		return resp, fmt.Errorf("start(%d) is after end(%d)", param.Start, param.End)
+	}
+
+	series := s.get(dataobj.PKWithCounter(param.Endpoint, param.Counter))
+	if series == nil {
+		return resp, nil
+	}
+
+	series.RLock()
+	seriesStep := series.Step
+	series.RUnlock()
+
+	// 时间范围超过原始数据的保留时间, 或者需要的step比较大时, 从降采样的数据中查询
+	tiers := s.tiers()
+	tiers[0].Step = seriesStep
+	want := resolveStep(param.Step, seriesStep, param.Start, param.End, s.opts.MaxPoints)
+	tier := pickTier(tiers, param.Start, want, time.Now().Unix())
+	if tier > 0 {
+		seriesStep = tiers[tier].Step
+	}
+
+	step := resolveStep(param.Step, seriesStep, param.Start, param.End, s.opts.MaxPoints)
+
+	// 第一个区间是(first-step, first], 要把这部分的原始点也读出来
+	from := alignUp(param.Start, int64(step)) - int64(step) + 1
+
+	var pts []point
+	var dsType string
+	var err error
+	if tier == 0 {
+		pts, dsType, _, err = series.query(from, param.End)
+	} else {
+		pts, dsType, _, err = series.queryRollup(tier, param.ConsolFunc, from, param.End)
+	}
+	if err != nil {
+		return resp, err
+	}
+
+	resp.DsType = dsType
+	resp.Step = step
+	resp.Values = consolidate(pts, param.Start, param.End, step, param.ConsolFunc)
+
+	return resp, nil
+}
+
+// Flush 所有内存中的数据落盘
+func (s *Storage) Flush() {
+	for _, series := range s.all() {
+		if err := series.flush(); err != nil {
+			logger.Error(err)
+		}
+
+		for _, r := range series.rollups {
+			r.flush()
+		}
+	}
+}
+
+func (s *Storage) flushLoop(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		s.Flush()
+	}
+}
+
+// Retain 删除cutoff之前的原始数据, 原始数据和降采样数据都没有的series从索引中移除
+func (s *Storage) Retain(cutoff int64) {
+	for _, series := range s.all() {
+		empty, err := series.retain(cutoff)
+		if err != nil {
+			logger.Errorf("retain series %s/%s failed: %v", series.Endpoint, series.Counter, err)
+			continue
+		}
+
+		for _, r := range series.rollups {
+			empty = empty && r.empty()
+		}
+
+		if empty {
+			s.remove(series, cutoff)
+		}
+	}
+}
+
+// remove 持有索引的写锁重新检查, 检查和删除之间可能有新的数据写入
+func (s *Storage) remove(series *Series, cutoff int64) {
+	s.Lock()
+	defer s.Unlock()
+
+	key := dataobj.PKWithCounter(series.Endpoint, series.Counter)
+	if s.series[key] != series {
+		return
+	}
+
+	for _, r := range series.rollups {
+		if !r.empty() {
+			return
+		}
+	}
+
+	series.Lock()
+	defer series.Unlock()
+
+	if !series.emptyLocked(cutoff) {
+		return
+	}
+
+	// 已经拿到这个series的写入会返回errSeriesRemoved, 然后重新获取
+	series.removed = true
+	delete(s.series, key)
+}
+
+func (s *Storage) Stats() Stats {
+	s.RLock()
+	num := len(s.series)
+	s.RUnlock()
+
+	return Stats{
+		Series:           num,
+		PointsIn:         atomic.LoadInt64(&s.pointsIn),
+		PointsDropped:    atomic.LoadInt64(&s.pointsDropped),
+		PointsBackfilled: atomic.LoadInt64(&s.pointsBackfilled),
+	}
+}
+
+func Close() {
+	if Store == nil {
+		return
+	}
+
+	Store.Flush()
+	logger.Info("tsdb storage flushed")
+}
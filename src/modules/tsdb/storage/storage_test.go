@@ -0,0 +1,279 @@
+package storage
+
+import (
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/open-falcon/falcon-ng/src/dataobj"
+)
+
+func Test_ChunkRoundTrip(t *testing.T) {
+	c := NewChunk()
+
+	ts := int64(1560000000)
+	v := 100.0
+	expect := []point{}
+	for i := 0; i < 1000; i++ {
+		// 偶尔有丢点、抖动和较大的数值变化
+		ts += int64(10 + rand.Intn(3)*rand.Intn(2)*1000)
+		switch rand.Intn(4) {
+		case 0:
+		case 1:
+			v += 1
+		case 2:
+			v = rand.Float64() * 1e6
+		default:
+			v = -v / 3
+		}
+
+		c.Append(ts, v)
+		expect = append(expect, point{t: ts, v: v})
+	}
+
+	it := NewChunkIterator(c.Bytes(), c.NumPoints())
+	i := 0
+	for it.Next() {
+		pt, pv := it.At()
+		if pt != expect[i].t || pv != expect[i].v {
+			t.Fatalf("point %d: got (%d, %v), expect (%d, %v)", i, pt, pv, expect[i].t, expect[i].v)
+		}
+		i++
+	}
+
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	}
+
+	if i != len(expect) {
+		t.Fatalf("got %d points, expect %d", i, len(expect))
+	}
+}
+
+func Test_StorageQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewStorage(Options{Dir: dir, ChunkPoints: 50, Retention: 1, MaxPoints: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := int64(1560000000)
+	items := []*dataobj.TsdbItem{}
+	for i := 0; i < 120; i++ {
+		items = append(items, &dataobj.TsdbItem{
+			Endpoint:  "host1",
+			Metric:    "cpu.idle",
+			Tags:      "core=0",
+			Value:     float64(i),
+			Timestamp: start + int64(i*10),
+			DsType:    dataobj.GAUGE,
+			Step:      10,
+			Min:       "U",
+			Max:       "U",
+		})
+
+		items = append(items, &dataobj.TsdbItem{
+			Endpoint:  "host1",
+			Metric:    "net.in.bytes",
+			Value:     float64(i * 100),
+			Timestamp: start + int64(i*10),
+			DsType:    dataobj.COUNTER,
+			Step:      10,
+			Min:       "0",
+			Max:       "U",
+		})
+	}
+	s.Push(items)
+	s.Flush()
+
+	// 重新加载, 验证数据可以从磁盘读出
+	s, err = NewStorage(Options{Dir: dir, ChunkPoints: 50, Retention: 1, MaxPoints: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := s.Query(dataobj.TsdbQueryParam{
+		Start:    start,
+		End:      start + 1190,
+		Endpoint: "host1",
+		Counter:  "cpu.idle/core=0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Step != 10 || len(resp.Values) != 120 {
+		t.Fatalf("step: %d, values: %d", resp.Step, len(resp.Values))
+	}
+
+	for i, v := range resp.Values {
+		if float64(v.Value) != float64(i) {
+			t.Fatalf("value %d: got %v", i, v.Value)
+		}
+	}
+
+	resp, err = s.Query(dataobj.TsdbQueryParam{
+		Start:      start,
+		End:        start + 1190,
+		ConsolFunc: MAX,
+		Endpoint:   "host1",
+		Counter:    "cpu.idle/core=0",
+		Step:       60,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// (ts-60, ts] 区间内的最大值
+	if resp.Step != 60 || len(resp.Values) != 20 || resp.Values[1].Value != 6 {
+		t.Fatalf("consolidated: %v", resp.Values)
+	}
+
+	resp, err = s.Query(dataobj.TsdbQueryParam{
+		Start:    start,
+		End:      start + 1190,
+		Endpoint: "host1",
+		Counter:  "net.in.bytes",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.DsType != dataobj.COUNTER || !math.IsNaN(float64(resp.Values[0].Value)) || resp.Values[1].Value != 10 {
+		t.Fatalf("counter: %s %v", resp.DsType, resp.Values[:2])
+	}
+
+	s.Retain(start + 1000)
+	resp, err = s.Query(dataobj.TsdbQueryParam{
+		Start:    start,
+		End:      start + 1190,
+		Endpoint: "host1",
+		Counter:  "cpu.idle/core=0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 前两个chunk(0~990)已经过期被删除
+	if !math.IsNaN(float64(resp.Values[0].Value)) || resp.Values[100].Value != 100 {
+		t.Fatalf("retained: %v %v", resp.Values[0], resp.Values[100])
+	}
+}
+
+func Test_StorageBackfill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewStorage(Options{Dir: dir, ChunkPoints: 50, Retention: 1, MaxPoints: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := int64(1560000000)
+	newItem := func(i int) *dataobj.TsdbItem {
+		return &dataobj.TsdbItem{
+			Endpoint:  "host1",
+			Metric:    "cpu.idle",
+			Value:     float64(i),
+			Timestamp: start + int64(i*10),
+			DsType:    dataobj.GAUGE,
+			Step:      10,
+			Min:       "U",
+			Max:       "U",
+		}
+	}
+
+	// 中间缺了10~19的点, 补写之后查询结果是完整的
+	items := []*dataobj.TsdbItem{}
+	for i := 0; i < 30; i++ {
+		if i < 10 || i >= 20 {
+			items = append(items, newItem(i))
+		}
+	}
+	s.Push(items)
+
+	backfill := []*dataobj.TsdbItem{}
+	for i := 10; i < 20; i++ {
+		backfill = append(backfill, newItem(i))
+	}
+	if dropped := s.Backfill(backfill); dropped != 0 {
+		t.Fatalf("backfill dropped %d", dropped)
+	}
+
+	resp, err := s.Query(dataobj.TsdbQueryParam{
+		Start:    start,
+		End:      start + 290,
+		Endpoint: "host1",
+		Counter:  "cpu.idle",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, v := range resp.Values {
+		if float64(v.Value) != float64(i) {
+			t.Fatalf("value %d: got %v", i, v.Value)
+		}
+	}
+}
+
+func Test_StorageRetainRemoved(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tsdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewStorage(Options{Dir: dir, ChunkPoints: 50, Retention: 1, MaxPoints: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := int64(1560000000)
+	item := &dataobj.TsdbItem{
+		Endpoint:  "host1",
+		Metric:    "cpu.idle",
+		Value:     1,
+		Timestamp: start,
+		DsType:    dataobj.GAUGE,
+		Step:      10,
+		Min:       "U",
+		Max:       "U",
+	}
+
+	// 模拟Push已经拿到series, 还没有写入时被Retain移除
+	series := s.getOrCreate(item)
+	s.Retain(start)
+
+	if _, err := series.push(item, 50); err != errSeriesRemoved {
+		t.Fatalf("push to removed series: %v", err)
+	}
+
+	if dropped := s.Push([]*dataobj.TsdbItem{item}); dropped != 0 {
+		t.Fatalf("push dropped %d", dropped)
+	}
+
+	resp, err := s.Query(dataobj.TsdbQueryParam{
+		Start:    start,
+		End:      start + 10,
+		Endpoint: "host1",
+		Counter:  "cpu.idle",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Values) == 0 || resp.Values[0].Value != 1 {
+		t.Fatalf("point lost after retain: %v", resp.Values)
+	}
+}
@@ -4,8 +4,16 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/open-falcon/falcon-ng/src/modules/tsdb/config"
+	"github.com/open-falcon/falcon-ng/src/modules/tsdb/http"
+	"github.com/open-falcon/falcon-ng/src/modules/tsdb/rpc"
+	"github.com/open-falcon/falcon-ng/src/modules/tsdb/storage"
 
 	"github.com/toolkits/pkg/file"
+	"github.com/toolkits/pkg/logger"
 	"github.com/toolkits/pkg/runner"
 )
 
@@ -34,6 +42,20 @@ func init() {
 	}
 }
 
+func main() {
+	aconf()
+	pconf()
+	start()
+
+	config.InitLogger()
+
+	storage.Init()
+
+	go rpc.Start()
+	http.Start()
+	ending()
+}
+
 // auto detect configuration file
 func aconf() {
 	if *conf != "" && file.IsExist(*conf) {
@@ -54,9 +76,26 @@ func aconf() {
 	os.Exit(1)
 }
 
-func main() {
-	aconf()
-	start()
+// parse configuration file
+func pconf() {
+	if err := config.Parse(*conf); err != nil {
+		fmt.Println("cannot parse configuration file:", err)
+		os.Exit(1)
+	}
+}
+
+func ending() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	select {
+	case <-c:
+		fmt.Printf("stop signal caught, stopping... pid=%d\n", os.Getpid())
+	}
+
+	http.Shutdown()
+	storage.Close()
+	logger.Close()
+	fmt.Println("tsdb stopped successfully")
 }
 
 func start() {